@@ -0,0 +1,132 @@
+// Command hello is a sample EasyGo plugin that speaks JSON over stdio. It
+// adds a greet action, an "easygo hello [name]" command, a Hello page in
+// the panel and a GET /panel/api/plugins/hello/greeting/{name} route.
+//
+// Install it with:
+//
+//	go build -o /opt/easygo/plugins/hello ./examples/plugins/hello
+//
+// EasyGo runs the plugin once per request, writing the request to its
+// stdin and reading the response from its stdout.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+)
+
+// request is what EasyGo sends
+type request struct {
+	Method string            `json:"method"`
+	Action string            `json:"action"`
+	Params map[string]string `json:"params"`
+	DryRun bool              `json:"dry_run"`
+	User   string            `json:"user"`
+}
+
+// response answers an invoke request
+type response struct {
+	Success bool        `json:"success"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+	HTML    string      `json:"html,omitempty"`
+	Error   *failure    `json:"error,omitempty"`
+}
+
+// failure describes why an action failed. Code is one of EasyGo's error
+// codes, e.g. validation_failed, so the CLI exit code and HTTP status match.
+type failure struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// descriptor lists what the plugin provides
+var descriptor = map[string]interface{}{
+	"name":        "hello",
+	"version":     "1.0.0",
+	"description": "Sample plugin that greets people",
+	"actions": []map[string]interface{}{
+		{"name": "greet", "description": "Greet someone", "params": []string{"name", "greeting"}},
+		{"name": "page", "description": "Render the Hello page"},
+	},
+	"commands": []map[string]interface{}{
+		{"name": "hello", "short": "Greet someone (sample plugin)", "action": "greet", "args": []string{"name"}},
+	},
+	"pages": []map[string]interface{}{
+		{"path": "/", "title": "Hello", "action": "page"},
+	},
+	"routes": []map[string]interface{}{
+		{"method": "GET", "path": "/greeting/{name}", "action": "greet"},
+	},
+}
+
+func main() {
+	var req request
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid request: %v\n", err)
+		os.Exit(1)
+	}
+
+	var out interface{}
+	switch req.Method {
+	case "describe":
+		out = descriptor
+	case "invoke":
+		out = invoke(&req)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown method %q\n", req.Method)
+		os.Exit(1)
+	}
+	json.NewEncoder(os.Stdout).Encode(out)
+}
+
+// invoke runs an action
+func invoke(req *request) *response {
+	switch req.Action {
+	case "greet":
+		return greet(req.Params["name"], req.Params["greeting"])
+	case "page":
+		return page(req)
+	}
+	return &response{
+		Success: false,
+		Message: "unknown action " + req.Action,
+		Error:   &failure{Code: "not_found", Message: "unknown action " + req.Action},
+	}
+}
+
+// greet greets name
+func greet(name, greeting string) *response {
+	if name == "" {
+		return &response{
+			Success: false,
+			Message: "Nobody to greet",
+			Error:   &failure{Code: "validation_failed", Message: "name is required"},
+		}
+	}
+	if greeting == "" {
+		greeting = "Hello"
+	}
+
+	message := fmt.Sprintf("%s, %s!", greeting, name)
+	return &response{
+		Success: true,
+		Message: message,
+		Data:    map[string]string{"greeting": message},
+	}
+}
+
+// page renders the Hello page, greeting the panel user or ?name=
+func page(req *request) *response {
+	name := req.Params["name"]
+	if name == "" {
+		name = req.User
+	}
+	return &response{
+		Success: true,
+		HTML: fmt.Sprintf(`<div class="card"><div class="card-body"><p class="mb-0">Hello, %s! This page is served by the sample plugin.</p></div></div>`,
+			html.EscapeString(name)),
+	}
+}
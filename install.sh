@@ -55,6 +55,18 @@ else
     exit 1
 fi
 
+# Create default configuration
+if [ ! -f /etc/easygo/config.yaml ]; then
+    echo "Creating configuration..."
+    mkdir -p /etc/easygo
+    cat > /etc/easygo/config.yaml << EOF
+web:
+  listen: "0.0.0.0:8083"
+  session_secret: "$(head -c 32 /dev/urandom | base64 | tr -d '\n')"
+EOF
+    chmod 600 /etc/easygo/config.yaml
+fi
+
 # Create systemd service file
 echo "Creating systemd service..."
 cat > /etc/systemd/system/$SERVICE_NAME.service << EOF
@@ -68,7 +80,7 @@ Type=simple
 User=$USER
 Group=$USER
 WorkingDirectory=$INSTALL_DIR
-ExecStart=$INSTALL_DIR/easygo web --port 8083 --host 0.0.0.0
+ExecStart=$INSTALL_DIR/easygo web
 ExecReload=/bin/kill -HUP \$MAINPID
 Restart=always
 RestartSec=5
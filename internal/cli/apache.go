@@ -22,6 +22,8 @@ var apacheInstallCmd = &cobra.Command{
 		}
 		
 		webAction := actions.NewWebServerAction()
+		prepareAction(cmd, &webAction.BaseAction)
+		streamOutput(&webAction.BaseAction)
 		result := webAction.InstallApache()
 		handleResult(result)
 		return nil
@@ -33,7 +35,8 @@ var apacheStatusCmd = &cobra.Command{
 	Short: "Check Apache status",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		webAction := actions.NewWebServerAction()
-		result := webAction.ServiceStatus("apache2")
+		prepareAction(cmd, &webAction.BaseAction)
+		result := webAction.ServiceStatus(webAction.Platform().ApacheService)
 		handleResult(result)
 		return nil
 	},
@@ -41,7 +44,20 @@ var apacheStatusCmd = &cobra.Command{
 
 var apacheVhostCmd = &cobra.Command{
 	Use:   "vhost [domain] [document-root]",
-	Short: "Create Apache virtual host",
+	Short: "Create and manage Apache virtual hosts",
+	Long: `Create an Apache virtual host serving a document root, or re-render an existing
+one, from the template given with --template and its --var values (see
+"vhost templates"). Without --template an existing vhost keeps its template
+and variables, and a new one gets the php template. Existing vhosts are
+managed with the list, show, enable, disable and delete subcommands.
+
+--https serves the vhost on port 443 with the domain's certificate, issued
+with "ssl issue" or uploaded with "ssl upload", which do so themselves. Plain
+HTTP is redirected, ACME challenges aside, unless --no-redirect is given; the
+other HTTPS flags tune it and together replace the recorded settings, which
+re-rendering keeps. --no-https goes back to plain HTTP.
+
+  easygo apache vhost example.com /var/www/example --https --hsts`,
 	Args:  cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if err := requireRoot(); err != nil {
@@ -51,8 +67,14 @@ var apacheVhostCmd = &cobra.Command{
 		domain := args[0]
 		docroot := args[1]
 		
+		options, err := vhostOptions(cmd)
+		if err != nil {
+			return err
+		}
+		
 		webAction := actions.NewWebServerAction()
-		result := webAction.ConfigureApacheVhost(domain, docroot)
+		prepareAction(cmd, &webAction.BaseAction)
+		result := webAction.ConfigureVhost(actions.WebServerApache, domain, docroot, options)
 		handleResult(result)
 		return nil
 	},
@@ -67,7 +89,8 @@ var apacheStartCmd = &cobra.Command{
 		}
 		
 		webAction := actions.NewWebServerAction()
-		result := webAction.StartService("apache2")
+		prepareAction(cmd, &webAction.BaseAction)
+		result := webAction.StartService(webAction.Platform().ApacheService)
 		handleResult(result)
 		return nil
 	},
@@ -82,7 +105,8 @@ var apacheStopCmd = &cobra.Command{
 		}
 		
 		webAction := actions.NewWebServerAction()
-		result := webAction.StopService("apache2")
+		prepareAction(cmd, &webAction.BaseAction)
+		result := webAction.StopService(webAction.Platform().ApacheService)
 		handleResult(result)
 		return nil
 	},
@@ -97,7 +121,8 @@ var apacheRestartCmd = &cobra.Command{
 		}
 		
 		webAction := actions.NewWebServerAction()
-		result := webAction.RestartService("apache2")
+		prepareAction(cmd, &webAction.BaseAction)
+		result := webAction.RestartService(webAction.Platform().ApacheService)
 		handleResult(result)
 		return nil
 	},
@@ -112,18 +137,22 @@ var apacheUninstallCmd = &cobra.Command{
 			return err
 		}
 		
-		// Confirmation prompt
-		fmt.Print("WARNING: This will completely remove Apache, all configurations, and data.\nAre you sure you want to continue? (yes/no): ")
-		var confirmation string
-		fmt.Scanln(&confirmation)
-		
-		if confirmation != "yes" {
-			fmt.Println("Apache uninstall cancelled.")
-			return nil
+		// Confirmation prompt (nothing is removed in a dry run)
+		if !isDryRun(cmd) {
+			fmt.Print("WARNING: This will completely remove Apache, all configurations, and data.\nAre you sure you want to continue? (yes/no): ")
+			var confirmation string
+			fmt.Scanln(&confirmation)
+			
+			if confirmation != "yes" {
+				fmt.Println("Apache uninstall cancelled.")
+				return nil
+			}
+			
+			fmt.Println("Uninstalling Apache web server...")
 		}
-		
-		fmt.Println("Uninstalling Apache web server...")
 		webAction := actions.NewWebServerAction()
+		prepareAction(cmd, &webAction.BaseAction)
+		streamOutput(&webAction.BaseAction)
 		result := webAction.UninstallApache()
 		handleResult(result)
 		return nil
@@ -135,6 +164,8 @@ func init() {
 	apacheCmd.AddCommand(apacheUninstallCmd)
 	apacheCmd.AddCommand(apacheStatusCmd)
 	apacheCmd.AddCommand(apacheVhostCmd)
+	apacheVhostCmd.AddCommand(vhostCommands(actions.WebServerApache, "Apache")...)
+	addVhostTemplateFlags(apacheVhostCmd, false)
 	apacheCmd.AddCommand(apacheStartCmd)
 	apacheCmd.AddCommand(apacheStopCmd)
 	apacheCmd.AddCommand(apacheRestartCmd)
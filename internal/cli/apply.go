@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"easygo/pkg/actions"
+	"easygo/pkg/manifest"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Converge the server on a manifest",
+	Long: `Read a manifest of domains, PHP versions and pools, databases, certificates,
+cron jobs and firewall rules, compare it with the server and make only the
+changes needed to match it. Resources that are not in the manifest are left
+alone.
+
+Example manifest:
+
+  php:
+    - version: "8.2"
+      pools: [shop]
+  domains:
+    - name: shop.example.com
+      web_server: nginx
+      document_root: /var/www/shop
+      template: wordpress          # see "easygo nginx vhost templates"
+      vars:
+        upload_size: 128m
+      tls:                         # HTTPS once the certificate is issued
+        hsts: true
+  certificates:
+    - domain: shop.example.com
+      email: admin@example.com
+  databases:
+    - name: shop
+      type: mysql
+      user: shop
+      password_env: SHOP_DB_PASSWORD
+  cron:
+    - schedule: "0 3 * * *"
+      command: /usr/local/bin/shop-cleanup
+  firewall:
+    - protocol: tcp
+      port: "443"
+      action: allow`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireRoot(); err != nil {
+			return err
+		}
+
+		plan, err := planManifest(cmd)
+		if err != nil {
+			return err
+		}
+		if plan.Empty() {
+			fmt.Print(plan.Text())
+			return nil
+		}
+
+		result := plan.Apply(func(change *manifest.Change, result *actions.Result) {
+			if result.Success {
+				fmt.Printf("✓ %s\n", change)
+			} else {
+				fmt.Printf("✗ %s\n", change)
+			}
+		})
+		handleResult(result)
+		return nil
+	},
+}
+
+var applyPlanCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show the changes apply would make",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		plan, err := planManifest(cmd)
+		if err != nil {
+			return err
+		}
+
+		if format, _ := cmd.Flags().GetString("plan-format"); format == "json" {
+			data, _ := json.MarshalIndent(plan, "", "  ")
+			fmt.Println(string(data))
+		} else {
+			fmt.Print(plan.Text())
+		}
+
+		// Let scripts tell whether the server has drifted from the manifest
+		if detailed, _ := cmd.Flags().GetBool("detailed-exitcode"); detailed && !plan.Empty() {
+			os.Exit(2)
+		}
+		return nil
+	},
+}
+
+// planManifest loads the manifest named by --file and diffs it against
+// the server
+func planManifest(cmd *cobra.Command) (*manifest.Plan, error) {
+	path, _ := cmd.Flags().GetString("file")
+	m, err := manifest.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	planner := manifest.NewPlanner(func(ba *actions.BaseAction) {
+		prepareAction(cmd, ba)
+	})
+	return planner.Plan(m)
+}
+
+func init() {
+	applyCmd.PersistentFlags().StringP("file", "f", "", "manifest file (YAML)")
+	applyCmd.MarkPersistentFlagRequired("file")
+	applyPlanCmd.Flags().Bool("detailed-exitcode", false, "exit with status 2 when there are changes")
+
+	applyCmd.AddCommand(applyPlanCmd)
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"easygo/pkg/actions"
+	"easygo/pkg/audit"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the audit log of administrative actions",
+	Long: `Every action run from the CLI or the web panel, and every panel login, is
+recorded with the user, client address, interface, parameters (secrets
+redacted), result and duration. Entries are hash-chained: each holds the
+hash of the one before, so changing or removing one is detected.
+
+Entries are shown newest first. --since and --until take a date
+(2024-05-01), an RFC 3339 time or a duration such as 24h.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter, err := auditFilter(cmd)
+		if err != nil {
+			return err
+		}
+		result, err := audit.Query(filter)
+		if err != nil {
+			return err
+		}
+		
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(result)
+		}
+		
+		for _, entry := range result.Entries {
+			status := "ok"
+			if !entry.Success {
+				status = "FAILED"
+			}
+			fmt.Printf("  %-6d %s  %-12s %-4s %-15s %-26s %-6s %6dms\n", entry.Seq, entry.Time.Local().Format("2006-01-02 15:04:05"),
+				entry.User, entry.Interface, entry.Source, entry.Action, status, entry.DurationMS)
+			if len(entry.Params) > 0 {
+				var params []string
+				for name, value := range entry.Params {
+					params = append(params, name+"="+value)
+				}
+				sort.Strings(params)
+				fmt.Printf("         %s\n", strings.Join(params, " "))
+			}
+			if entry.Error != "" {
+				fmt.Printf("         error: %s\n", entry.Error)
+			}
+		}
+		fmt.Printf("%d of %d entries\n", len(result.Entries), result.Total)
+		if result.Broken != "" {
+			fmt.Printf("✗ The audit log was tampered with: %s\n", result.Broken)
+		}
+		return nil
+	},
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that no audit entry was changed or removed",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		result, err := audit.Query(&audit.Filter{Limit: 1})
+		if err != nil {
+			return err
+		}
+		if result.Broken != "" {
+			return &actions.Error{Kind: actions.ErrConflict, Msg: "the audit log was tampered with: " + result.Broken}
+		}
+		
+		fmt.Printf("✓ The audit log is intact (%d entries)\n", result.Total)
+		return nil
+	},
+}
+
+// auditFilter builds the audit filter from the command's flags
+func auditFilter(cmd *cobra.Command) (*audit.Filter, error) {
+	filter := &audit.Filter{}
+	filter.User, _ = cmd.Flags().GetString("user")
+	filter.Action, _ = cmd.Flags().GetString("action")
+	filter.Interface, _ = cmd.Flags().GetString("interface")
+	filter.Source, _ = cmd.Flags().GetString("source")
+	filter.Failed, _ = cmd.Flags().GetBool("failed")
+	filter.Limit, _ = cmd.Flags().GetInt("limit")
+	
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value, _ := cmd.Flags().GetString(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := audit.ParseTime(value)
+		if err != nil {
+			return nil, &actions.Error{Kind: actions.ErrValidationFailed, Msg: "--" + name, Err: err}
+		}
+		*t = parsed
+	}
+	return filter, nil
+}
+
+func init() {
+	auditCmd.Flags().String("user", "", "only actions by this user")
+	auditCmd.Flags().String("action", "", "only actions whose name contains this, e.g. Database")
+	auditCmd.Flags().String("interface", "", "only actions run from this interface (cli, web)")
+	auditCmd.Flags().String("source", "", "only actions from this client address")
+	auditCmd.Flags().String("since", "", "only actions at or after this time")
+	auditCmd.Flags().String("until", "", "only actions before this time")
+	auditCmd.Flags().Bool("failed", false, "only failed actions")
+	auditCmd.Flags().Int("limit", 50, "number of entries to show, 0 for all")
+	auditCmd.Flags().Bool("json", false, "print the entries as JSON")
+	
+	auditCmd.AddCommand(auditVerifyCmd)
+}
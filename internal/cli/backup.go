@@ -26,6 +26,8 @@ var backupFilesCmd = &cobra.Command{
 		name := args[2]
 		
 		backupAction := actions.NewBackupAction()
+		prepareAction(cmd, &backupAction.BaseAction)
+		streamOutput(&backupAction.BaseAction)
 		result := backupAction.CreateFileBackup(source, destination, name)
 		handleResult(result)
 		return nil
@@ -35,7 +37,7 @@ var backupFilesCmd = &cobra.Command{
 var backupDatabaseCmd = &cobra.Command{
 	Use:   "database [db-name] [db-type] [destination]",
 	Short: "Create database backup",
-	Args:  cobra.ExactArgs(3),
+	Args:  cobra.RangeArgs(2, 3),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if err := requireRoot(); err != nil {
 			return err
@@ -43,9 +45,11 @@ var backupDatabaseCmd = &cobra.Command{
 		
 		dbName := args[0]
 		dbType := args[1]
-		destination := args[2]
+		destination := optionalArg(args, 2)
 		
 		backupAction := actions.NewBackupAction()
+		prepareAction(cmd, &backupAction.BaseAction)
+		streamOutput(&backupAction.BaseAction)
 		result := backupAction.CreateDatabaseBackup(dbName, dbType, destination)
 		handleResult(result)
 		return nil
@@ -55,15 +59,17 @@ var backupDatabaseCmd = &cobra.Command{
 var backupFullCmd = &cobra.Command{
 	Use:   "full [destination]",
 	Short: "Create full system backup",
-	Args:  cobra.ExactArgs(1),
+	Args:  cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if err := requireRoot(); err != nil {
 			return err
 		}
 		
-		destination := args[0]
+		destination := optionalArg(args, 0)
 		
 		backupAction := actions.NewBackupAction()
+		prepareAction(cmd, &backupAction.BaseAction)
+		streamOutput(&backupAction.BaseAction)
 		result := backupAction.CreateFullSystemBackup(destination)
 		handleResult(result)
 		return nil
@@ -83,6 +89,8 @@ var backupRestoreCmd = &cobra.Command{
 		destination := args[1]
 		
 		backupAction := actions.NewBackupAction()
+		prepareAction(cmd, &backupAction.BaseAction)
+		streamOutput(&backupAction.BaseAction)
 		result := backupAction.RestoreFileBackup(backupFile, destination)
 		handleResult(result)
 		return nil
@@ -92,11 +100,12 @@ var backupRestoreCmd = &cobra.Command{
 var backupListCmd = &cobra.Command{
 	Use:   "list [backup-dir]",
 	Short: "List available backups",
-	Args:  cobra.ExactArgs(1),
+	Args:  cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		backupDir := args[0]
+		backupDir := optionalArg(args, 0)
 		
 		backupAction := actions.NewBackupAction()
+		prepareAction(cmd, &backupAction.BaseAction)
 		result := backupAction.ListBackups(backupDir)
 		handleResult(result)
 		return nil
@@ -117,6 +126,7 @@ var backupCleanCmd = &cobra.Command{
 		daysToKeep := 30 // default
 		
 		backupAction := actions.NewBackupAction()
+		prepareAction(cmd, &backupAction.BaseAction)
 		result := backupAction.CleanOldBackups(backupDir, daysToKeep)
 		handleResult(result)
 		return nil
@@ -130,4 +140,13 @@ func init() {
 	backupCmd.AddCommand(backupRestoreCmd)
 	backupCmd.AddCommand(backupListCmd)
 	backupCmd.AddCommand(backupCleanCmd)
+}
+
+// optionalArg returns args[i], or an empty string so the action falls back
+// to its configured default
+func optionalArg(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
 }
\ No newline at end of file
@@ -27,7 +27,7 @@ var dbCmd = &cobra.Command{
 var sslCmd = &cobra.Command{
 	Use:   "ssl",
 	Short: "SSL certificate management",
-	Long:  `Manage Let's Encrypt SSL certificates with auto-renewal.`,
+	Long:  `Issue Let's Encrypt certificates or upload others, and serve domains over HTTPS with them.`,
 }
 
 var firewallCmd = &cobra.Command{
@@ -17,6 +17,7 @@ var cronListCmd = &cobra.Command{
 	Short: "List cron jobs",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cronAction := actions.NewCronAction()
+		prepareAction(cmd, &cronAction.BaseAction)
 		result := cronAction.ListCronJobs()
 		handleResult(result)
 		return nil
@@ -28,6 +29,7 @@ var cronSystemCmd = &cobra.Command{
 	Short: "List system cron jobs",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cronAction := actions.NewCronAction()
+		prepareAction(cmd, &cronAction.BaseAction)
 		result := cronAction.ListSystemCronJobs()
 		handleResult(result)
 		return nil
@@ -48,6 +50,7 @@ var cronAddCmd = &cobra.Command{
 		description, _ := cmd.Flags().GetString("description")
 		
 		cronAction := actions.NewCronAction()
+		prepareAction(cmd, &cronAction.BaseAction)
 		result := cronAction.AddCronJob(schedule, command, description)
 		handleResult(result)
 		return nil
@@ -66,6 +69,7 @@ var cronRemoveCmd = &cobra.Command{
 		command := args[0]
 		
 		cronAction := actions.NewCronAction()
+		prepareAction(cmd, &cronAction.BaseAction)
 		result := cronAction.RemoveCronJob(command)
 		handleResult(result)
 		return nil
@@ -77,6 +81,7 @@ var cronStatusCmd = &cobra.Command{
 	Short: "Check cron service status",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cronAction := actions.NewCronAction()
+		prepareAction(cmd, &cronAction.BaseAction)
 		result := cronAction.GetCronStatus()
 		handleResult(result)
 		return nil
@@ -92,6 +97,7 @@ var cronMaintenanceCmd = &cobra.Command{
 		}
 		
 		cronAction := actions.NewCronAction()
+		prepareAction(cmd, &cronAction.BaseAction)
 		result := cronAction.SetupSystemMaintenance()
 		handleResult(result)
 		return nil
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"easygo/pkg/actions"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var discoverCmd = &cobra.Command{
+	Use:   "discover",
+	Short: "Find existing sites, pools, certificates, cron jobs and databases",
+	Long: `Scan the enabled Nginx and Apache sites, PHP-FPM pools, certbot certificates,
+crontabs and MySQL/PostgreSQL databases and compare them with the state store.
+Resources are reported as managed, unmanaged (not yet known to EasyGo), drifted
+(recorded with different settings) or missing (recorded but gone).`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireRoot(); err != nil {
+			return err
+		}
+		
+		discoveryAction := actions.NewDiscoveryAction()
+		prepareAction(cmd, &discoveryAction.BaseAction)
+		result := discoveryAction.Scan()
+		if !result.Success {
+			handleResult(result)
+			return nil
+		}
+		
+		all, _ := cmd.Flags().GetBool("all")
+		for _, resource := range result.Data.([]*actions.DiscoveredResource) {
+			if resource.Status == actions.DiscoveredManaged && !all {
+				continue
+			}
+			fmt.Printf("  %-10s %-50s %s\n", resource.Status, resource.ID, resource.Detail)
+		}
+		fmt.Println(result.Message)
+		return nil
+	},
+}
+
+var discoverImportCmd = &cobra.Command{
+	Use:   "import [id...]",
+	Short: "Register discovered resources as managed",
+	Long: `Register unmanaged resources in the state store and update the records of
+drifted ones to match the server. Without IDs (as shown by "easygo discover"),
+every unmanaged and drifted resource is imported.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireRoot(); err != nil {
+			return err
+		}
+		
+		discoveryAction := actions.NewDiscoveryAction()
+		prepareAction(cmd, &discoveryAction.BaseAction)
+		result := discoveryAction.Import(args...)
+		if imported, ok := result.Data.([]*actions.DiscoveredResource); ok && plan == nil {
+			for _, resource := range imported {
+				fmt.Printf("  + %s\n", resource.ID)
+			}
+			result.Data = nil
+		}
+		handleResult(result)
+		return nil
+	},
+}
+
+func init() {
+	discoverCmd.Flags().Bool("all", false, "also list managed resources")
+	
+	discoverCmd.AddCommand(discoverImportCmd)
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"easygo/pkg/actions"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var driftCmd = &cobra.Command{
+	Use:   "drift",
+	Short: "Detect changes to files EasyGo manages",
+	Long: `Compare every file EasyGo has written with the content it wrote and list the
+files that were modified or deleted since, with a unified diff, as well as
+files in the site and pool directories that EasyGo did not write.
+
+Use "easygo drift adopt" to accept a change or "easygo drift rerender" to
+discard it.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		baseAction := &actions.BaseAction{}
+		prepareAction(cmd, baseAction)
+		result := baseAction.DetectDrift()
+		if !result.Success {
+			handleResult(result)
+			return nil
+		}
+		
+		showDiff, _ := cmd.Flags().GetBool("diff")
+		for _, drift := range result.Data.([]*actions.FileDrift) {
+			fmt.Printf("  %-9s %s\n", drift.Status, drift.Path)
+			if showDiff && drift.Diff != "" {
+				fmt.Println()
+				fmt.Print(drift.Diff)
+				fmt.Println()
+			}
+		}
+		fmt.Println(result.Message)
+		return nil
+	},
+}
+
+var driftAdoptCmd = &cobra.Command{
+	Use:   "adopt [path]",
+	Short: "Accept the current content of a drifted file",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireRoot(); err != nil {
+			return err
+		}
+		
+		baseAction := &actions.BaseAction{}
+		prepareAction(cmd, baseAction)
+		result := baseAction.AdoptFile(args[0])
+		handleResult(result)
+		return nil
+	},
+}
+
+var driftRerenderCmd = &cobra.Command{
+	Use:   "rerender [path]",
+	Short: "Write back the content EasyGo generated for a drifted file",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireRoot(); err != nil {
+			return err
+		}
+		
+		baseAction := &actions.BaseAction{}
+		prepareAction(cmd, baseAction)
+		result := baseAction.RerenderFile(args[0])
+		handleResult(result)
+		return nil
+	},
+}
+
+func init() {
+	driftCmd.Flags().Bool("diff", true, "show a unified diff of each change")
+	
+	driftCmd.AddCommand(driftAdoptCmd)
+	driftCmd.AddCommand(driftRerenderCmd)
+}
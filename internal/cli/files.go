@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"easygo/pkg/actions"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var filesCmd = &cobra.Command{
+	Use:   "files",
+	Short: "Managed configuration files",
+	Long:  `List configuration files written by EasyGo and restore their previous versions.`,
+}
+
+var filesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List files managed by EasyGo",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		baseAction := &actions.BaseAction{}
+		prepareAction(cmd, baseAction)
+		result := baseAction.ListManagedFiles()
+		
+		if result.Success {
+			if files, ok := result.Data.([]string); ok {
+				fmt.Println("Managed files:")
+				for _, file := range files {
+					fmt.Printf("  %s\n", file)
+				}
+			}
+		} else {
+			handleResult(result)
+		}
+		return nil
+	},
+}
+
+var filesHistoryCmd = &cobra.Command{
+	Use:   "history [path]",
+	Short: "List previous versions of a managed file",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := args[0]
+		
+		baseAction := &actions.BaseAction{}
+		prepareAction(cmd, baseAction)
+		result := baseAction.ListFileVersions(path)
+		
+		if result.Success {
+			if versions, ok := result.Data.([]*actions.FileVersion); ok {
+				fmt.Printf("Previous versions of %s:\n", path)
+				for _, version := range versions {
+					fmt.Printf("  %s  %s  %d bytes\n", version.Version, version.Created.Format("2006-01-02 15:04:05"), version.Size)
+				}
+			}
+		} else {
+			handleResult(result)
+		}
+		return nil
+	},
+}
+
+var filesRestoreCmd = &cobra.Command{
+	Use:   "restore [path] [version]",
+	Short: "Restore a managed file to a previous version",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireRoot(); err != nil {
+			return err
+		}
+		
+		path := args[0]
+		version := args[1]
+		
+		baseAction := &actions.BaseAction{}
+		prepareAction(cmd, baseAction)
+		result := baseAction.RestoreFileVersion(path, version)
+		handleResult(result)
+		return nil
+	},
+}
+
+func init() {
+	filesCmd.AddCommand(filesListCmd)
+	filesCmd.AddCommand(filesHistoryCmd)
+	filesCmd.AddCommand(filesRestoreCmd)
+}
@@ -22,6 +22,8 @@ var nginxInstallCmd = &cobra.Command{
 		}
 		
 		webAction := actions.NewWebServerAction()
+		prepareAction(cmd, &webAction.BaseAction)
+		streamOutput(&webAction.BaseAction)
 		result := webAction.InstallNginx()
 		handleResult(result)
 		return nil
@@ -33,6 +35,7 @@ var nginxStatusCmd = &cobra.Command{
 	Short: "Check Nginx status",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		webAction := actions.NewWebServerAction()
+		prepareAction(cmd, &webAction.BaseAction)
 		result := webAction.ServiceStatus("nginx")
 		handleResult(result)
 		return nil
@@ -41,7 +44,36 @@ var nginxStatusCmd = &cobra.Command{
 
 var nginxVhostCmd = &cobra.Command{
 	Use:   "vhost [domain] [document-root]",
-	Short: "Create Nginx virtual host",
+	Short: "Create and manage Nginx virtual hosts",
+	Long: `Create an Nginx virtual host serving a document root, or re-render an existing
+one, from the template given with --template and its --var values (see
+"vhost templates"). Without --template an existing vhost keeps its template
+and variables, and a new one gets the php template. Existing vhosts are
+managed with the list, show, enable, disable and delete subcommands.
+
+--backend makes a reverse proxy: requests are balanced over the backends by
+an upstream block, with the proxy template unless another is given. The
+other proxy flags tune it; together they replace the recorded settings.
+
+  easygo nginx vhost app.example.com /var/www/app \
+    --backend 127.0.0.1:3000 --backend 127.0.0.1:3001 \
+    --lb-method least_conn --max-fails 3 --fail-timeout 30 --websocket
+
+--https serves the vhost on port 443 with the domain's certificate, issued
+with "ssl issue" or uploaded with "ssl upload", which do so themselves. Plain
+HTTP is redirected, ACME challenges aside, unless --no-redirect is given; the
+other HTTPS flags tune it and together replace the recorded settings, which
+re-rendering keeps. --no-https goes back to plain HTTP.
+
+  easygo nginx vhost example.com /var/www/example --https --ciphers modern --hsts
+
+--hybrid puts Nginx in front of Apache for sites relying on .htaccess files:
+Apache renders the vhost from --template (an Apache template) and listens on
+vhosts.hybrid_backend only, its ports.conf rewired, while Nginx takes port 80,
+serves static files itself and passes the rest on with the client's address,
+which mod_remoteip restores.
+
+  easygo nginx vhost legacy.example.com /var/www/legacy --hybrid --template wordpress`,
 	Args:  cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if err := requireRoot(); err != nil {
@@ -51,8 +83,14 @@ var nginxVhostCmd = &cobra.Command{
 		domain := args[0]
 		docroot := args[1]
 		
+		options, err := vhostOptions(cmd)
+		if err != nil {
+			return err
+		}
+		
 		webAction := actions.NewWebServerAction()
-		result := webAction.ConfigureNginxVhost(domain, docroot)
+		prepareAction(cmd, &webAction.BaseAction)
+		result := webAction.ConfigureVhost(actions.WebServerNginx, domain, docroot, options)
 		handleResult(result)
 		return nil
 	},
@@ -67,6 +105,7 @@ var nginxStartCmd = &cobra.Command{
 		}
 		
 		webAction := actions.NewWebServerAction()
+		prepareAction(cmd, &webAction.BaseAction)
 		result := webAction.StartService("nginx")
 		handleResult(result)
 		return nil
@@ -82,6 +121,7 @@ var nginxStopCmd = &cobra.Command{
 		}
 		
 		webAction := actions.NewWebServerAction()
+		prepareAction(cmd, &webAction.BaseAction)
 		result := webAction.StopService("nginx")
 		handleResult(result)
 		return nil
@@ -97,6 +137,7 @@ var nginxRestartCmd = &cobra.Command{
 		}
 		
 		webAction := actions.NewWebServerAction()
+		prepareAction(cmd, &webAction.BaseAction)
 		result := webAction.RestartService("nginx")
 		handleResult(result)
 		return nil
@@ -112,18 +153,22 @@ var nginxUninstallCmd = &cobra.Command{
 			return err
 		}
 		
-		// Confirmation prompt
-		fmt.Print("WARNING: This will completely remove Nginx, all configurations, and data.\nAre you sure you want to continue? (yes/no): ")
-		var confirmation string
-		fmt.Scanln(&confirmation)
-		
-		if confirmation != "yes" {
-			fmt.Println("Nginx uninstall cancelled.")
-			return nil
+		// Confirmation prompt (nothing is removed in a dry run)
+		if !isDryRun(cmd) {
+			fmt.Print("WARNING: This will completely remove Nginx, all configurations, and data.\nAre you sure you want to continue? (yes/no): ")
+			var confirmation string
+			fmt.Scanln(&confirmation)
+			
+			if confirmation != "yes" {
+				fmt.Println("Nginx uninstall cancelled.")
+				return nil
+			}
+			
+			fmt.Println("Uninstalling Nginx web server...")
 		}
-		
-		fmt.Println("Uninstalling Nginx web server...")
 		webAction := actions.NewWebServerAction()
+		prepareAction(cmd, &webAction.BaseAction)
+		streamOutput(&webAction.BaseAction)
 		result := webAction.UninstallNginx()
 		handleResult(result)
 		return nil
@@ -135,6 +180,8 @@ func init() {
 	nginxCmd.AddCommand(nginxUninstallCmd)
 	nginxCmd.AddCommand(nginxStatusCmd)
 	nginxCmd.AddCommand(nginxVhostCmd)
+	nginxVhostCmd.AddCommand(vhostCommands(actions.WebServerNginx, "Nginx")...)
+	addVhostTemplateFlags(nginxVhostCmd, true)
 	nginxCmd.AddCommand(nginxStartCmd)
 	nginxCmd.AddCommand(nginxStopCmd)
 	nginxCmd.AddCommand(nginxRestartCmd)
@@ -25,7 +25,15 @@ var phpInstallCmd = &cobra.Command{
 		version := args[0]
 		
 		phpAction := actions.NewPHPAction()
-		result := phpAction.InstallPHP(version)
+		prepareAction(cmd, &phpAction.BaseAction)
+		streamOutput(&phpAction.BaseAction)
+		
+		var result *actions.Result
+		if poolName, _ := cmd.Flags().GetString("pool"); poolName != "" {
+			result = phpAction.InstallPHPWithPool(version, poolName)
+		} else {
+			result = phpAction.InstallPHP(version)
+		}
 		handleResult(result)
 		return nil
 	},
@@ -36,6 +44,7 @@ var phpListCmd = &cobra.Command{
 	Short: "List installed PHP versions",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		phpAction := actions.NewPHPAction()
+		prepareAction(cmd, &phpAction.BaseAction)
 		result := phpAction.GetInstalledVersions()
 		
 		if result.Success {
@@ -68,6 +77,7 @@ var phpDefaultCmd = &cobra.Command{
 		version := args[0]
 		
 		phpAction := actions.NewPHPAction()
+		prepareAction(cmd, &phpAction.BaseAction)
 		result := phpAction.SetDefaultPHP(version)
 		handleResult(result)
 		return nil
@@ -87,6 +97,7 @@ var phpPoolCmd = &cobra.Command{
 		poolName := args[1]
 		
 		phpAction := actions.NewPHPAction()
+		prepareAction(cmd, &phpAction.BaseAction)
 		result := phpAction.ConfigurePHPFPM(version, poolName)
 		handleResult(result)
 		return nil
@@ -98,6 +109,7 @@ var phpAvailableCmd = &cobra.Command{
 	Short: "List available PHP versions",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		phpAction := actions.NewPHPAction()
+		prepareAction(cmd, &phpAction.BaseAction)
 		versions := phpAction.GetAvailableVersions()
 		
 		fmt.Println("Available PHP versions:")
@@ -114,4 +126,6 @@ func init() {
 	phpCmd.AddCommand(phpDefaultCmd)
 	phpCmd.AddCommand(phpPoolCmd)
 	phpCmd.AddCommand(phpAvailableCmd)
+	
+	phpInstallCmd.Flags().String("pool", "", "also configure a PHP-FPM pool, rolling back the install if it fails")
 }
\ No newline at end of file
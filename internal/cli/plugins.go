@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"easygo/pkg/actions"
+	"easygo/pkg/config"
+	"easygo/pkg/plugins"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var pluginsCmd = &cobra.Command{
+	Use:   "plugins",
+	Short: "List and run plugins",
+	Long: `Plugins extend EasyGo with new actions, commands, panel pages and API routes.
+They are loaded from paths.plugins (/opt/easygo/plugins by default): .so files
+as Go plugins and other executables as plugins speaking JSON over stdio.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		list := plugins.Default.Plugins()
+		if len(list) == 0 {
+			fmt.Printf("No plugins loaded from %s\n", plugins.Dir())
+			return
+		}
+		
+		for _, plugin := range list {
+			fmt.Printf("%s %s (%s) %s\n", plugin.Name, plugin.Version, plugin.Kind, plugin.Path)
+			if plugin.Description != "" {
+				fmt.Printf("  %s\n", plugin.Description)
+			}
+			for _, action := range plugins.Default.Actions() {
+				if action.Plugin != plugin.Name {
+					continue
+				}
+				fmt.Printf("  action %-20s %s\n", action.Name, action.Description)
+			}
+		}
+	},
+}
+
+var pluginsRunCmd = &cobra.Command{
+	Use:   "run [plugin.action] [key=value...]",
+	Short: "Run a plugin action",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		action, ok := plugins.Default.Action(args[0])
+		if !ok {
+			return &actions.Error{Kind: actions.ErrNotFound, Msg: fmt.Sprintf("no plugin action %s", args[0])}
+		}
+		
+		params := make(map[string]string)
+		for _, arg := range args[1:] {
+			key, value, ok := strings.Cut(arg, "=")
+			if !ok {
+				return &actions.Error{Kind: actions.ErrValidationFailed, Msg: fmt.Sprintf("%q is not a key=value parameter", arg)}
+			}
+			params[key] = value
+		}
+		
+		runPluginAction(cmd, action, params)
+		return nil
+	},
+}
+
+// runPluginAction runs a plugin action with the global flags applied
+func runPluginAction(cmd *cobra.Command, action *plugins.Action, params map[string]string) {
+	baseAction := &actions.BaseAction{}
+	prepareAction(cmd, baseAction)
+	result := action.Run(&plugins.Request{Base: baseAction, Params: params})
+	handleResult(result)
+}
+
+// usesPlugins reports whether the command line runs a command that can use
+// plugins: the plugins and web commands, and commands EasyGo does not have
+// itself, which may be plugin commands, along with help for them
+func usesPlugins(args []string) bool {
+	cmd, _, err := rootCmd.Find(args)
+	if err != nil || cmd == rootCmd || cmd == webCmd {
+		return true
+	}
+	for ; cmd != nil; cmd = cmd.Parent() {
+		if cmd == pluginsCmd {
+			return true
+		}
+	}
+	return false
+}
+
+// loadPlugins loads the installed plugins and adds their commands to the
+// root command. Plugins that fail to load are reported and skipped. This
+// runs before the command line is parsed, so the plugin directory is taken
+// from the configuration --config names in args.
+func loadPlugins(args []string) {
+	flags := pflag.NewFlagSet("easygo", pflag.ContinueOnError)
+	flags.ParseErrorsWhitelist.UnknownFlags = true
+	flags.SetOutput(io.Discard)
+	path := flags.String("config", config.DefaultPath, "")
+	flags.Parse(args)
+	
+	// A configuration that does not load is reported when the command runs
+	dir := config.Default().Paths.Plugins
+	if cfg, err := config.Load(*path); err == nil {
+		dir = cfg.Paths.Plugins
+	}
+	
+	for _, err := range plugins.Default.LoadDir(dir) {
+		fmt.Fprintf(os.Stderr, "Warning: plugin not loaded: %v\n", err)
+	}
+	
+	for _, command := range plugins.Default.Commands() {
+		addPluginCommand(pluginCommand(command))
+	}
+	for _, command := range plugins.Default.CobraCommands() {
+		addPluginCommand(command)
+	}
+}
+
+// addPluginCommand adds a plugin command unless it would replace a
+// built-in one
+func addPluginCommand(command *cobra.Command) {
+	name := command.Name()
+	for _, existing := range rootCmd.Commands() {
+		if existing.Name() == name {
+			fmt.Fprintf(os.Stderr, "Warning: plugin command %s conflicts with an existing command, skipped\n", name)
+			return
+		}
+	}
+	rootCmd.AddCommand(command)
+}
+
+// pluginCommand builds the CLI command for a process plugin command.
+// Positional arguments fill the command's args and the action's other
+// params become flags.
+func pluginCommand(command *plugins.Command) *cobra.Command {
+	action, _ := plugins.Default.Action(command.Plugin + "." + command.Action)
+	
+	use := command.Name
+	for _, arg := range command.Args {
+		use += " [" + arg + "]"
+	}
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: command.Short,
+		Args:  cobra.ExactArgs(len(command.Args)),
+	}
+	
+	positional := make(map[string]bool)
+	for _, arg := range command.Args {
+		positional[arg] = true
+	}
+	for _, param := range action.Params {
+		if !positional[param] {
+			cmd.Flags().String(param, "", param)
+		}
+	}
+	
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		params := make(map[string]string)
+		for i, arg := range command.Args {
+			params[arg] = args[i]
+		}
+		for _, param := range action.Params {
+			if !positional[param] && cmd.Flags().Changed(param) {
+				params[param], _ = cmd.Flags().GetString(param)
+			}
+		}
+		
+		runPluginAction(cmd, action, params)
+		return nil
+	}
+	return cmd
+}
+
+func init() {
+	pluginsCmd.AddCommand(pluginsRunCmd)
+}
@@ -1,10 +1,23 @@
 package cli
 
 import (
+	"context"
 	"easygo/pkg/actions"
+	"easygo/pkg/audit"
 	"easygo/pkg/auth"
+	"easygo/pkg/config"
+	"easygo/pkg/events"
+	"easygo/pkg/logging"
+	"easygo/pkg/state"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"syscall"
 
 	"github.com/spf13/cobra"
 )
@@ -14,19 +27,102 @@ var rootCmd = &cobra.Command{
 	Short: "EasyGo Panel - Web Server Management Tool",
 	Long: `EasyGo Panel is a comprehensive web server management tool for Linux systems.
 It provides both CLI and web interfaces for managing web servers, databases, 
-mail services, DNS, SSL certificates, and more.`,
+mail services, DNS, SSL certificates, and more.
+
+Exit codes:
+  0  success
+  1  other failure
+  3  a required component is not installed
+  4  the platform is not supported
+  5  invalid input or a configuration test failed
+  6  a system command failed
+  7  permission denied
+  8  conflict with existing state
+  9  not found`,
+	PersistentPreRunE: loadConfig,
+	// Execute reports errors itself, with an exit code per error kind
+	SilenceErrors: true,
+	SilenceUsage:  true,
 }
 
+// plan collects planned operations when running with --dry-run
+var (
+	plan       *actions.Plan
+	planFormat string
+)
+
+// Log records at consoleLevel and above are shown on stderr, all of them
+// with --verbose. Commands report failed actions themselves, so they only
+// show errors; the web panel shows what it logs.
+var (
+	consoleLevel = slog.LevelError
+	verbose      bool
+)
+
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	// Cancel running commands on Ctrl+C or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	
+	// Actions are audited as run from the CLI by the invoking user
+	ctx = events.WithOrigin(ctx, events.Origin{
+		Interface: events.InterfaceCLI,
+		User:      invokingUser(),
+		Source:    sshClient(),
+	})
+	
+	// Process plugins are started to describe themselves, so only commands
+	// that can use plugins pay for loading them
+	if usesPlugins(os.Args[1:]) {
+		loadPlugins(os.Args[1:])
+	}
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
 
+// Exit codes, one per error kind so scripts can branch on the failure
+const (
+	exitFailure             = 1
+	exitNotInstalled        = 3
+	exitUnsupportedPlatform = 4
+	exitValidationFailed    = 5
+	exitCommandFailed       = 6
+	exitPermissionDenied    = 7
+	exitConflict            = 8
+	exitNotFound            = 9
+)
+
+// exitCode returns the exit code for an error
+func exitCode(err error) int {
+	switch actions.ErrorKind(err) {
+	case actions.ErrNotInstalled:
+		return exitNotInstalled
+	case actions.ErrUnsupportedPlatform:
+		return exitUnsupportedPlatform
+	case actions.ErrValidationFailed:
+		return exitValidationFailed
+	case actions.ErrCommandFailed:
+		return exitCommandFailed
+	case actions.ErrPermissionDenied:
+		return exitPermissionDenied
+	case actions.ErrConflict:
+		return exitConflict
+	case actions.ErrNotFound:
+		return exitNotFound
+	}
+	return exitFailure
+}
+
 func init() {
 	// Add global flags
+	rootCmd.PersistentFlags().String("config", config.DefaultPath, "configuration file")
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().Duration("timeout", 0, "maximum time each system command may run (e.g. 10m, 0 for no limit)")
+	rootCmd.PersistentFlags().Bool("dry-run", false, "show the commands and file changes that would be made without applying them")
+	rootCmd.PersistentFlags().String("plan-format", "text", "output format for --dry-run plans (text, json)")
+	rootCmd.PersistentFlags().String("root", "", "read and write the managed system's files under this directory (overrides paths.root)")
 	
 	// Add subcommands
 	rootCmd.AddCommand(webCmd)
@@ -40,7 +136,19 @@ func init() {
 	rootCmd.AddCommand(firewallCmd)
 	rootCmd.AddCommand(backupCmd)
 	rootCmd.AddCommand(cronCmd)
+	rootCmd.AddCommand(filesCmd)
+	rootCmd.AddCommand(stateCmd)
+	rootCmd.AddCommand(applyCmd)
+	rootCmd.AddCommand(discoverCmd)
+	rootCmd.AddCommand(driftCmd)
+	rootCmd.AddCommand(pluginsCmd)
+	rootCmd.AddCommand(webhooksCmd)
+	rootCmd.AddCommand(auditCmd)
 	rootCmd.AddCommand(statusCmd)
+	
+	// Record events in the audit log and send them to the configured webhooks
+	events.Default.Subscribe(audit.Record)
+	events.Default.Subscribe(events.Webhooks.Handle)
 }
 
 // requireRoot is a helper function to check root privileges
@@ -48,18 +156,160 @@ func requireRoot() error {
 	return auth.RequireRoot()
 }
 
+// loadConfig reads the configuration file named by --config and applies it
+func loadConfig(cmd *cobra.Command, args []string) error {
+	verbose, _ = cmd.Flags().GetBool("verbose")
+	path, _ := cmd.Flags().GetString("config")
+	cfg, err := config.Load(path)
+	if err != nil {
+		return &actions.Error{Kind: actions.ErrValidationFailed, Msg: "cannot load configuration", Err: err}
+	}
+	if cmd.Flags().Changed("root") {
+		root, _ := cmd.Flags().GetString("root")
+		if cfg.Paths.Root, err = filepath.Abs(root); err != nil {
+			return &actions.Error{Kind: actions.ErrValidationFailed, Msg: "invalid --root", Err: err}
+		}
+	}
+	applyConfig(cfg)
+	return nil
+}
+
+// applyConfig makes cfg the configuration in effect, sets up logging and
+// opens the state store it names. Without a store (e.g. when not running
+// as root) actions simply record nothing.
+func applyConfig(cfg *config.Config) {
+	config.Set(cfg)
+	setupLogging(cfg)
+	
+	actions.DefaultStore = nil
+	if store, err := state.Open(cfg.Paths.State); err == nil {
+		actions.DefaultStore = store
+	}
+}
+
+// setupLogging (re)opens the log file. Commands run by users who cannot
+// write it only log to stderr.
+func setupLogging(cfg *config.Config) error {
+	err := logging.Setup(cfg.Log, consoleLevel, verbose)
+	if err != nil {
+		slog.Debug("Cannot open log file", "file", cfg.Log.File, "error", err)
+	}
+	return err
+}
+
+// invokingUser returns the user who ran the command, looking through sudo
+func invokingUser() string {
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
+		return sudoUser
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+// sshClient returns the address the user logged in from over SSH, if any
+func sshClient() string {
+	if client := strings.Fields(os.Getenv("SSH_CLIENT")); len(client) > 0 {
+		return client[0]
+	}
+	return ""
+}
+
+// prepareAction applies global flags and the command's context to an action
+func prepareAction(cmd *cobra.Command, ba *actions.BaseAction) {
+	ba.SetOwner(invokingUser())
+	ba.SetContext(cmd.Context())
+	if timeout, _ := cmd.Flags().GetDuration("timeout"); timeout > 0 {
+		ba.SetTimeout(timeout)
+	}
+	if isDryRun(cmd) {
+		if plan == nil {
+			plan = actions.NewPlan()
+			planFormat, _ = cmd.Flags().GetString("plan-format")
+		}
+		ba.SetPlan(plan)
+	}
+}
+
+// isDryRun reports whether the command was invoked with --dry-run
+func isDryRun(cmd *cobra.Command) bool {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	return dryRun
+}
+
+// streamOutput shows command output live for long-running actions
+func streamOutput(ba *actions.BaseAction) {
+	ba.SetOutput(func(line string) {
+		fmt.Printf("  │ %s\n", line)
+	})
+}
+
 // handleResult processes action results and displays appropriate output
 func handleResult(result *actions.Result) {
+	if plan != nil {
+		printPlan(result)
+		return
+	}
+	
 	if result.Success {
 		fmt.Printf("✓ %s\n", result.Message)
 		if result.Data != nil {
 			fmt.Printf("Data: %+v\n", result.Data)
 		}
+		printHooks(result.Hooks)
 	} else {
 		fmt.Printf("✗ %s\n", result.Message)
 		if result.Error != nil {
 			fmt.Printf("Error: %v\n", result.Error)
 		}
-		os.Exit(1)
+		printHooks(result.Hooks)
+		os.Exit(exitCode(result.Error))
+	}
+}
+
+// printHooks shows the hook scripts that ran around an action and their output
+func printHooks(hooks []actions.HookRun) {
+	for _, hook := range hooks {
+		mark := "✓"
+		if !hook.Success {
+			mark = "✗"
+		}
+		fmt.Printf("%s %s hook %s\n", mark, hook.Phase, hook.Script)
+		if hook.Output != "" {
+			for _, line := range strings.Split(hook.Output, "\n") {
+				fmt.Printf("  │ %s\n", line)
+			}
+		}
+	}
+}
+
+// printPlan displays the operations recorded during a dry run
+func printPlan(result *actions.Result) {
+	if planFormat == "json" {
+		output := map[string]interface{}{
+			"success": result.Success,
+			"message": result.Message,
+			"plan":    plan,
+		}
+		if result.Error != nil {
+			output["error"] = result.Error.Error()
+			output["error_code"] = actions.ErrorCode(result.Error)
+		}
+		data, _ := json.MarshalIndent(output, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		fmt.Println("Dry run - planned operations:")
+		fmt.Print(plan.Text())
+		if !result.Success {
+			fmt.Printf("✗ %s\n", result.Message)
+			if result.Error != nil {
+				fmt.Printf("Error: %v\n", result.Error)
+			}
+		}
+	}
+	
+	if !result.Success {
+		os.Exit(exitCode(result.Error))
 	}
 }
\ No newline at end of file
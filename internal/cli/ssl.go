@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"easygo/pkg/actions"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var sslIssueCmd = &cobra.Command{
+	Use:   "issue [domain]",
+	Short: "Issue a Let's Encrypt certificate and serve the domain over HTTPS",
+	Long: `Issue a Let's Encrypt certificate for a domain, answering the HTTP challenge
+from --webroot, by default the document root of the domain's vhost. A
+managed vhost is then re-rendered to serve HTTPS with it, with its recorded
+HTTPS settings or the defaults (see "nginx vhost --help").`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireRoot(); err != nil {
+			return err
+		}
+		
+		email, _ := cmd.Flags().GetString("email")
+		webroot, _ := cmd.Flags().GetString("webroot")
+		sslAction := actions.NewSSLAction()
+		prepareAction(cmd, &sslAction.BaseAction)
+		streamOutput(&sslAction.BaseAction)
+		handleResult(sslAction.IssueCertificate(args[0], email, webroot))
+		return nil
+	},
+}
+
+var sslUploadCmd = &cobra.Command{
+	Use:   "upload [domain]",
+	Short: "Install a certificate and serve the domain over HTTPS",
+	Long: `Install a certificate from another authority: the PEM files given with --cert,
+the certificate followed by its intermediates, and --key are checked to
+form a pair valid for the domain, then kept in /etc/ssl/easygo/<domain>.
+A managed vhost is re-rendered to serve HTTPS with them.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireRoot(); err != nil {
+			return err
+		}
+		
+		certPath, _ := cmd.Flags().GetString("cert")
+		keyPath, _ := cmd.Flags().GetString("key")
+		chain, err := os.ReadFile(certPath)
+		if err != nil {
+			return fmt.Errorf("--cert: %w", err)
+		}
+		key, err := os.ReadFile(keyPath)
+		if err != nil {
+			return fmt.Errorf("--key: %w", err)
+		}
+		
+		sslAction := actions.NewSSLAction()
+		prepareAction(cmd, &sslAction.BaseAction)
+		handleResult(sslAction.UploadCertificate(args[0], chain, key))
+		return nil
+	},
+}
+
+var sslRenewCmd = &cobra.Command{
+	Use:   "renew",
+	Short: "Renew certificates and reload the HTTPS vhosts",
+	Long: `Renew the Let's Encrypt certificates that are due and reload the web servers
+whose HTTPS vhosts serve the renewed ones. Vhost files are not rewritten.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireRoot(); err != nil {
+			return err
+		}
+		
+		sslAction := actions.NewSSLAction()
+		prepareAction(cmd, &sslAction.BaseAction)
+		handleResult(sslAction.RenewCertificates())
+		return nil
+	},
+}
+
+var sslAutoRenewCmd = &cobra.Command{
+	Use:   "auto-renew",
+	Short: "Run ssl renew daily from root's crontab",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireRoot(); err != nil {
+			return err
+		}
+		
+		sslAction := actions.NewSSLAction()
+		prepareAction(cmd, &sslAction.BaseAction)
+		handleResult(sslAction.SetupAutoRenewal())
+		return nil
+	},
+}
+
+func init() {
+	sslIssueCmd.Flags().String("email", "", "address Let's Encrypt sends expiry notices to")
+	sslIssueCmd.Flags().String("webroot", "", "directory the challenge is answered from, the vhost's document root by default")
+	sslIssueCmd.MarkFlagRequired("email")
+	sslUploadCmd.Flags().String("cert", "", "PEM file with the certificate and its intermediates")
+	sslUploadCmd.Flags().String("key", "", "PEM file with the private key")
+	sslUploadCmd.MarkFlagRequired("cert")
+	sslUploadCmd.MarkFlagRequired("key")
+	
+	sslCmd.AddCommand(sslIssueCmd)
+	sslCmd.AddCommand(sslUploadCmd)
+	sslCmd.AddCommand(sslRenewCmd)
+	sslCmd.AddCommand(sslAutoRenewCmd)
+}
@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"easygo/pkg/actions"
+	"easygo/pkg/config"
+	"easygo/pkg/state"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Resources recorded by EasyGo",
+	Long:  `List the domains, databases, backups, cron jobs, PHP-FPM pools and certificates EasyGo manages, as recorded in its state store.`,
+}
+
+// openStateStore returns the state store, or an error when it is unavailable
+func openStateStore() (*state.Store, error) {
+	if actions.DefaultStore == nil {
+		return state.Open(config.Current().Paths.State)
+	}
+	return actions.DefaultStore, nil
+}
+
+var stateDomainsCmd = &cobra.Command{
+	Use:   "domains",
+	Short: "List recorded domains",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStateStore()
+		if err != nil {
+			return err
+		}
+		domains, err := store.Domains().List()
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Domains:")
+		for _, domain := range domains {
+			status := "enabled"
+			if !domain.Enabled {
+				status = "disabled"
+			}
+			fmt.Printf("  %-30s %-7s %-9s %-30s %s\n", domain.Name, domain.WebServer, status, domain.DocumentRoot, domain.Owner)
+		}
+		return nil
+	},
+}
+
+var stateDatabasesCmd = &cobra.Command{
+	Use:   "databases",
+	Short: "List recorded databases",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStateStore()
+		if err != nil {
+			return err
+		}
+		databases, err := store.Databases().List()
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Databases:")
+		for _, database := range databases {
+			fmt.Printf("  %-30s %-10s %-20s %s\n", database.Name, database.Type, database.User, database.CreatedAt.Format("2006-01-02 15:04"))
+		}
+		return nil
+	},
+}
+
+var stateBackupsCmd = &cobra.Command{
+	Use:   "backups",
+	Short: "List recorded backups and backup jobs",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStateStore()
+		if err != nil {
+			return err
+		}
+		jobs, err := store.BackupJobs().List()
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Backups:")
+		for _, job := range jobs {
+			when := job.LastRun.Format("2006-01-02 15:04")
+			if job.Schedule != "" {
+				when = "scheduled " + job.Schedule
+			}
+			fmt.Printf("  %-4s %-9s %-20s %-10s %-25s %s\n", job.ID, job.Type, job.Name, job.Status, when, job.Destination)
+		}
+		return nil
+	},
+}
+
+var stateCronCmd = &cobra.Command{
+	Use:   "cron",
+	Short: "List recorded cron jobs",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStateStore()
+		if err != nil {
+			return err
+		}
+		jobs, err := store.CronJobs().List()
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Cron jobs:")
+		for _, job := range jobs {
+			fmt.Printf("  %-4s %-10s %-15s %s\n", job.ID, job.User, job.Schedule, job.Command)
+		}
+		return nil
+	},
+}
+
+var statePoolsCmd = &cobra.Command{
+	Use:   "pools",
+	Short: "List recorded PHP-FPM pools",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStateStore()
+		if err != nil {
+			return err
+		}
+		pools, err := store.FPMPools().List()
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("PHP-FPM pools:")
+		for _, pool := range pools {
+			fmt.Printf("  PHP %-5s %-20s %s\n", pool.PHPVersion, pool.Name, pool.Socket)
+		}
+		return nil
+	},
+}
+
+var stateCertificatesCmd = &cobra.Command{
+	Use:   "certificates",
+	Short: "List recorded certificates",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStateStore()
+		if err != nil {
+			return err
+		}
+		certificates, err := store.Certificates().List()
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Certificates:")
+		for _, cert := range certificates {
+			fmt.Printf("  %-30s expires %-12s %s\n", cert.Domain, cert.NotAfter.Format("2006-01-02"), cert.Path)
+		}
+		return nil
+	},
+}
+
+func init() {
+	stateCmd.AddCommand(stateDomainsCmd)
+	stateCmd.AddCommand(stateDatabasesCmd)
+	stateCmd.AddCommand(stateBackupsCmd)
+	stateCmd.AddCommand(stateCronCmd)
+	stateCmd.AddCommand(statePoolsCmd)
+	stateCmd.AddCommand(stateCertificatesCmd)
+}
\ No newline at end of file
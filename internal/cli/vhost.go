@@ -0,0 +1,293 @@
+package cli
+
+import (
+	"easygo/pkg/actions"
+	"easygo/pkg/state"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// vhostCommands returns the list, show, enable, disable and delete
+// subcommands of a web server's vhost command
+func vhostCommands(webServer, title string) []*cobra.Command {
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: fmt.Sprintf("List %s virtual hosts", title),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			webAction := actions.NewWebServerAction()
+			prepareAction(cmd, &webAction.BaseAction)
+			result := webAction.ListVhosts(webServer)
+			if !result.Success {
+				handleResult(result)
+				return nil
+			}
+			
+			vhosts := result.Data.([]*actions.Vhost)
+			for _, vhost := range vhosts {
+				status := "enabled"
+				if !vhost.Enabled {
+					status = "disabled"
+				}
+				managed := ""
+				if !vhost.Managed {
+					managed = " (not managed)"
+				} else if vhost.Hybrid {
+					managed = " (hybrid)"
+				}
+				if vhost.TLS != nil {
+					managed += " (https)"
+				}
+				fmt.Printf("  %-30s %-8s %s%s\n", vhost.Domain, status, vhost.DocumentRoot, managed)
+			}
+			fmt.Printf("%d virtual hosts\n", len(vhosts))
+			return nil
+		},
+	}
+	
+	showCmd := &cobra.Command{
+		Use:   "show [domain]",
+		Short: "Show a virtual host and its configuration",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			webAction := actions.NewWebServerAction()
+			prepareAction(cmd, &webAction.BaseAction)
+			result := webAction.ShowVhost(webServer, args[0])
+			if !result.Success {
+				handleResult(result)
+				return nil
+			}
+			
+			vhost := result.Data.(*actions.Vhost)
+			fmt.Printf("Domain:        %s\n", vhost.Domain)
+			fmt.Printf("Server name:   %s\n", vhost.ServerName)
+			fmt.Printf("Document root: %s\n", vhost.DocumentRoot)
+			fmt.Printf("Configuration: %s\n", vhost.ConfigPath)
+			fmt.Printf("Enabled:       %t\n", vhost.Enabled)
+			fmt.Printf("Managed:       %t\n", vhost.Managed)
+			if vhost.Hybrid {
+				fmt.Println("Hybrid:        Nginx in front of Apache")
+			}
+			if vhost.Managed {
+				fmt.Printf("Template:      %s\n", vhost.Template)
+				for name, value := range vhost.Vars {
+					fmt.Printf("  %s=%s\n", name, value)
+				}
+			}
+			if settings := vhost.TLS; settings != nil {
+				ciphers := settings.Ciphers
+				if ciphers == "" {
+					ciphers = actions.CiphersIntermediate
+				}
+				fmt.Printf("HTTPS:         %s ciphers, redirect %t, HTTP/2 %t, HSTS %t, OCSP stapling %t\n",
+					ciphers, !settings.NoRedirect, !settings.NoHTTP2, settings.HSTS, settings.OCSPStapling)
+			}
+			if proxy := vhost.Proxy; proxy != nil {
+				fmt.Printf("Backends:      %s\n", strings.Join(proxy.Backends, ", "))
+				if proxy.Method != "" {
+					fmt.Printf("Balancing:     %s\n", proxy.Method)
+				}
+				fmt.Printf("WebSocket:     %t\n", proxy.Websocket)
+				if proxy.Cache != "" {
+					fmt.Printf("Cache:         %s\n", proxy.Cache)
+				}
+			}
+			fmt.Println()
+			fmt.Println(strings.TrimRight(vhost.Config, "\n"))
+			return nil
+		},
+	}
+	
+	enableCmd := &cobra.Command{
+		Use:   "enable [domain]",
+		Short: "Enable a virtual host",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := requireRoot(); err != nil {
+				return err
+			}
+			
+			webAction := actions.NewWebServerAction()
+			prepareAction(cmd, &webAction.BaseAction)
+			handleResult(webAction.EnableVhost(webServer, args[0]))
+			return nil
+		},
+	}
+	
+	disableCmd := &cobra.Command{
+		Use:   "disable [domain]",
+		Short: "Disable a virtual host, keeping its configuration",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := requireRoot(); err != nil {
+				return err
+			}
+			
+			webAction := actions.NewWebServerAction()
+			prepareAction(cmd, &webAction.BaseAction)
+			handleResult(webAction.DisableVhost(webServer, args[0]))
+			return nil
+		},
+	}
+	
+	deleteCmd := &cobra.Command{
+		Use:   "delete [domain]",
+		Short: "Delete a virtual host",
+		Long: fmt.Sprintf(`Delete a virtual host's configuration and reload %s.
+The document root and logs are left alone unless --archive is given: then
+they are packed into <backup.dir>/vhosts/<domain>-<time>.tar.gz first and
+removed once the virtual host is gone. That is refused when the document
+root is outside vhosts.web_root or overlaps another domain's, in any Apache
+or Nginx vhost file.`, title),
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := requireRoot(); err != nil {
+				return err
+			}
+			
+			archive, _ := cmd.Flags().GetBool("archive")
+			webAction := actions.NewWebServerAction()
+			prepareAction(cmd, &webAction.BaseAction)
+			handleResult(webAction.DeleteVhost(webServer, args[0], archive))
+			return nil
+		},
+	}
+	deleteCmd.Flags().Bool("archive", false, "archive and remove the document root and logs")
+	
+	templatesCmd := &cobra.Command{
+		Use:   "templates",
+		Short: fmt.Sprintf("List %s vhost templates and their variables", title),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			webAction := actions.NewWebServerAction()
+			prepareAction(cmd, &webAction.BaseAction)
+			result := webAction.ListVhostTemplates(webServer)
+			if !result.Success {
+				handleResult(result)
+				return nil
+			}
+			
+			for _, t := range result.Data.([]*actions.VhostTemplate) {
+				fmt.Printf("%s (%s)\n  %s\n", t.Name, t.Source, t.Description)
+				if t.Proxy {
+					fmt.Println("    --backend and the proxy flags")
+				}
+				if t.Hybrid {
+					fmt.Println("    used by --hybrid")
+				}
+				for _, variable := range t.Variables {
+					detail := ""
+					if variable.Required {
+						detail = ", required"
+					} else if variable.Default != "" {
+						detail = ", default " + variable.Default
+					}
+					fmt.Printf("    --var %s=...  %s%s\n", variable.Name, variable.Description, detail)
+				}
+			}
+			return nil
+		},
+	}
+	
+	return []*cobra.Command{listCmd, showCmd, enableCmd, disableCmd, deleteCmd, templatesCmd}
+}
+
+// proxyFlags are the flags of proxy settings, besides --backend
+var proxyFlags = []string{"lb-method", "max-fails", "fail-timeout", "websocket", "connect-timeout", "read-timeout", "send-timeout", "unbuffered", "cache"}
+
+// tlsFlags are the flags of HTTPS settings, besides --https
+var tlsFlags = []string{"ciphers", "no-redirect", "no-http2", "hsts", "ocsp-stapling"}
+
+// addVhostTemplateFlags adds the template and HTTPS flags of a vhost create
+// command, and for Nginx the hybrid and proxy flags
+func addVhostTemplateFlags(cmd *cobra.Command, nginx bool) {
+	cmd.Flags().String("template", "", "template to render the vhost from")
+	cmd.Flags().StringArray("var", nil, "template variable as name=value, repeatable")
+	cmd.Flags().Bool("https", false, "serve HTTPS with the domain's issued or uploaded certificate")
+	cmd.Flags().Bool("no-https", false, "serve plain HTTP only, dropping the HTTPS settings")
+	cmd.Flags().String("ciphers", "", "cipher preset: modern (TLS 1.3 only) or intermediate (TLS 1.2 and 1.3, the default)")
+	cmd.Flags().Bool("no-redirect", false, "serve plain HTTP too instead of redirecting it to HTTPS")
+	cmd.Flags().Bool("no-http2", false, "serve HTTPS over HTTP/1.1 only")
+	cmd.Flags().Bool("hsts", false, "send Strict-Transport-Security, so browsers only use HTTPS")
+	cmd.Flags().Bool("ocsp-stapling", false, "staple the certificate authority's OCSP responses")
+	if !nginx {
+		return
+	}
+	
+	cmd.Flags().Bool("hybrid", false, "serve static files with Nginx and pass the rest on to Apache, rendered from the Apache --template")
+	cmd.Flags().StringArray("backend", nil, "proxy backend as host:port or unix:/path, repeatable; uses the proxy template")
+	cmd.Flags().String("lb-method", "", "how requests are balanced: round_robin, least_conn, ip_hash or random")
+	cmd.Flags().Int("max-fails", 0, "failed attempts before a backend is skipped")
+	cmd.Flags().Int("fail-timeout", 0, "seconds a failed backend is skipped")
+	cmd.Flags().Bool("websocket", false, "pass WebSocket upgrades on")
+	cmd.Flags().Int("connect-timeout", 0, "seconds to wait for a backend connection")
+	cmd.Flags().Int("read-timeout", 0, "seconds to wait for a backend response")
+	cmd.Flags().Int("send-timeout", 0, "seconds to wait while sending a request to a backend")
+	cmd.Flags().Bool("unbuffered", false, "stream responses and requests instead of buffering them")
+	cmd.Flags().String("cache", "", "cache responses for this long, e.g. 10m")
+}
+
+// vhostOptions reads the template, HTTPS and proxy flags. HTTPS settings
+// are only set with --https and proxy settings with --backend; both
+// replace the recorded ones.
+func vhostOptions(cmd *cobra.Command) (*actions.VhostOptions, error) {
+	template, _ := cmd.Flags().GetString("template")
+	values, _ := cmd.Flags().GetStringArray("var")
+	
+	options := &actions.VhostOptions{Template: template, Vars: make(map[string]string)}
+	for _, pair := range values {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("--var %q: expected name=value", pair)
+		}
+		options.Vars[name] = value
+	}
+	
+	https, _ := cmd.Flags().GetBool("https")
+	options.NoTLS, _ = cmd.Flags().GetBool("no-https")
+	switch {
+	case https && options.NoTLS:
+		return nil, fmt.Errorf("--https and --no-https exclude each other")
+	case https:
+		settings := &state.TLS{}
+		settings.Ciphers, _ = cmd.Flags().GetString("ciphers")
+		settings.NoRedirect, _ = cmd.Flags().GetBool("no-redirect")
+		settings.NoHTTP2, _ = cmd.Flags().GetBool("no-http2")
+		settings.HSTS, _ = cmd.Flags().GetBool("hsts")
+		settings.OCSPStapling, _ = cmd.Flags().GetBool("ocsp-stapling")
+		options.TLS = settings
+	default:
+		for _, name := range tlsFlags {
+			if cmd.Flags().Changed(name) {
+				return nil, fmt.Errorf("--%s needs --https", name)
+			}
+		}
+	}
+	
+	if cmd.Flags().Lookup("backend") == nil {
+		return options, nil
+	}
+	options.Hybrid, _ = cmd.Flags().GetBool("hybrid")
+	backends, _ := cmd.Flags().GetStringArray("backend")
+	if len(backends) == 0 {
+		for _, name := range proxyFlags {
+			if cmd.Flags().Changed(name) {
+				return nil, fmt.Errorf("--%s needs the proxy's --backend flags", name)
+			}
+		}
+		return options, nil
+	}
+	
+	proxy := &state.Proxy{Backends: backends}
+	proxy.Method, _ = cmd.Flags().GetString("lb-method")
+	proxy.MaxFails, _ = cmd.Flags().GetInt("max-fails")
+	proxy.FailTimeout, _ = cmd.Flags().GetInt("fail-timeout")
+	proxy.Websocket, _ = cmd.Flags().GetBool("websocket")
+	proxy.ConnectTimeout, _ = cmd.Flags().GetInt("connect-timeout")
+	proxy.ReadTimeout, _ = cmd.Flags().GetInt("read-timeout")
+	proxy.SendTimeout, _ = cmd.Flags().GetInt("send-timeout")
+	proxy.Unbuffered, _ = cmd.Flags().GetBool("unbuffered")
+	proxy.Cache, _ = cmd.Flags().GetString("cache")
+	options.Proxy = proxy
+	return options, nil
+}
@@ -2,7 +2,15 @@ package cli
 
 import (
 	"easygo/internal/web"
+	"easygo/pkg/config"
+	"easygo/pkg/events"
+	"easygo/pkg/logging"
 	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 )
@@ -10,19 +18,62 @@ import (
 var webCmd = &cobra.Command{
 	Use:   "web",
 	Short: "Start the web panel",
-	Long:  `Start the EasyGo web panel interface on the specified port.`,
+	Long: `Start the EasyGo web panel interface on the configured address (web.listen).
+Sending SIGHUP reloads the configuration file.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		port, _ := cmd.Flags().GetString("port")
-		host, _ := cmd.Flags().GetString("host")
+		// Flags override the configured listen address
+		host, port, _ := net.SplitHostPort(config.Current().Web.Listen)
+		if cmd.Flags().Changed("port") {
+			port, _ = cmd.Flags().GetString("port")
+		}
+		if cmd.Flags().Changed("host") {
+			host, _ = cmd.Flags().GetString("host")
+		}
+		addr := net.JoinHostPort(host, port)
 		
-		fmt.Printf("Starting EasyGo Web Panel on %s:%s\n", host, port)
+		// The panel shows what it logs at the configured level
+		consoleLevel, _ = logging.ParseLevel(config.Current().Log.Level)
+		if err := setupLogging(config.Current()); err != nil {
+			slog.Warn("Logging to stderr only", "file", config.Current().Log.File, "error", err)
+		}
+		
+		configPath, _ := cmd.Flags().GetString("config")
+		go reloadOnSIGHUP(configPath)
+		
+		// The panel sends webhook deliveries, including those the CLI queued
+		events.Webhooks.Start(cmd.Context())
+		
+		fmt.Printf("Starting EasyGo Web Panel on %s\n", addr)
 		
 		server := web.NewServer()
-		return server.Start(fmt.Sprintf("%s:%s", host, port))
+		return server.Start(addr)
 	},
 }
 
+// reloadOnSIGHUP reloads the configuration whenever the process receives
+// SIGHUP. An invalid file is reported and the previous settings are kept.
+func reloadOnSIGHUP(path string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	
+	for range hup {
+		previous := config.Current()
+		cfg, err := config.Load(path)
+		if err != nil {
+			slog.Error("Configuration reload failed, keeping previous settings", "file", path, "error", err)
+			continue
+		}
+		
+		// This also reopens the log file, e.g. after logrotate moved it
+		applyConfig(cfg)
+		slog.Info("Configuration reloaded", "file", path)
+		if cfg.Web.Listen != previous.Web.Listen || cfg.Web.SessionSecret != previous.Web.SessionSecret {
+			slog.Warn("Changes to web.listen and web.session_secret take effect after a restart")
+		}
+	}
+}
+
 func init() {
-	webCmd.Flags().StringP("port", "p", "8080", "Port to listen on")
-	webCmd.Flags().StringP("host", "H", "0.0.0.0", "Host to bind to")
+	webCmd.Flags().StringP("port", "p", "8080", "Port to listen on (overrides web.listen)")
+	webCmd.Flags().StringP("host", "H", "0.0.0.0", "Host to bind to (overrides web.listen)")
 }
\ No newline at end of file
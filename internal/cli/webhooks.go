@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"easygo/pkg/actions"
+	"easygo/pkg/events"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var webhooksCmd = &cobra.Command{
+	Use:   "webhooks",
+	Short: "Show webhook deliveries",
+	Long: `Events such as ConfigureNginxVhost, IssueCertificate, StartService and Login
+are POSTed to the endpoints in the webhooks section of the configuration,
+signed with HMAC-SHA256 in the X-EasyGo-Signature header. This lists the
+delivery log, newest last. The web panel sends the deliveries and retries
+failed ones.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStateStore()
+		if err != nil {
+			return err
+		}
+		deliveries, err := store.WebhookDeliveries().List()
+		if err != nil {
+			return err
+		}
+		
+		for _, delivery := range deliveries {
+			fmt.Printf("  %-5s %-16s %-9s %-22s %d attempt(s) %s\n", delivery.ID, delivery.CreatedAt.Format("2006-01-02 15:04:05"), delivery.Status, delivery.EventType, delivery.Attempts, delivery.URL)
+			if delivery.LastError != "" {
+				fmt.Printf("        last error: %s\n", delivery.LastError)
+			}
+		}
+		fmt.Printf("%d deliveries\n", len(deliveries))
+		return nil
+	},
+}
+
+var webhooksTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Send a Ping event to every webhook endpoint",
+	Run: func(cmd *cobra.Command, args []string) {
+		event := &events.Event{
+			Type:    events.TypePing,
+			User:    invokingUser(),
+			Success: true,
+			Message: "Test event from easygo webhooks test",
+		}
+		events.Default.Publish(event)
+		fmt.Printf("Queued %s event %s for the web panel to deliver; see \"easygo webhooks\" for the deliveries\n", event.Type, event.ID)
+	},
+}
+
+var webhooksRedeliverCmd = &cobra.Command{
+	Use:   "redeliver [id]",
+	Short: "Send a delivery again",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireRoot(); err != nil {
+			return err
+		}
+		
+		delivery, err := events.Webhooks.Redeliver(args[0])
+		if errors.Is(err, events.ErrDelivering) {
+			return &actions.Error{Kind: actions.ErrConflict, Msg: "cannot redeliver", Err: err}
+		}
+		if err != nil {
+			return err
+		}
+		if delivery.Status != events.DeliveryDelivered {
+			fmt.Printf("✗ Delivery %s to %s: %s\n", delivery.ID, delivery.URL, delivery.LastError)
+			return nil
+		}
+		fmt.Printf("✓ Delivered %s to %s\n", delivery.ID, delivery.URL)
+		return nil
+	},
+}
+
+func init() {
+	webhooksCmd.AddCommand(webhooksTestCmd)
+	webhooksCmd.AddCommand(webhooksRedeliverCmd)
+}
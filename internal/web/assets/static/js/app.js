@@ -176,29 +176,366 @@ function uninstallService(serviceName) {
         return;
     }
     
-    // Show loading state
-    showAlert('warning', `Uninstalling ${serviceName}... This may take a few minutes.`);
+    // Uninstalling takes a while, so it runs as a job whose page shows the progress
+    enqueueJob('uninstall', {service: serviceName});
+}
+
+// Import discovered resources; without IDs, every unmanaged and drifted one
+function importResources(ids) {
+    const body = new URLSearchParams();
+    (ids || []).forEach(id => body.append('id', id));
     
-    fetch(`/api/services/${serviceName}/uninstall`, {
+    fetch('/panel/api/discovery/import', {
         method: 'POST',
-        headers: {
-            'Content-Type': 'application/json',
+        body: body
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.success) {
+            showAlert('success', data.message);
+            setTimeout(() => location.reload(), 1000);
+        } else {
+            showAlert('danger', `Failed to import: ${data.message}`);
+        }
+    })
+    .catch(error => {
+        showAlert('danger', `Error importing resources: ${error.message}`);
+    });
+}
+
+// Resolve a drifted file: 'adopt' keeps the change, 'rerender' discards it
+function resolveDrift(path, resolution) {
+    const body = new URLSearchParams();
+    body.append('path', path);
+    
+    fetch(`/panel/api/drift/${resolution}`, {
+        method: 'POST',
+        body: body
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.success) {
+            showAlert('success', data.message);
+            setTimeout(() => location.reload(), 1000);
+        } else {
+            showAlert('danger', `Failed to ${resolution} ${path}: ${data.message}`);
+        }
+    })
+    .catch(error => {
+        showAlert('danger', `Error resolving drift of ${path}: ${error.message}`);
+    });
+}
+
+// Function to send a webhook delivery again
+function redeliverWebhook(id) {
+    fetch(`/panel/api/webhooks/deliveries/${id}/redeliver`, {
+        method: 'POST'
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.success && data.data.status === 'delivered') {
+            showAlert('success', data.message);
+        } else {
+            showAlert('danger', data.message);
+        }
+        setTimeout(() => location.reload(), 1000);
+    })
+    .catch(error => {
+        showAlert('danger', `Error redelivering ${id}: ${error.message}`);
+    });
+}
+
+// Templates of the web server chosen in the domain form
+let vhostTemplates = [];
+
+// Open the domain form, filled in to edit an existing virtual host
+function editVhost(server, domain, docroot, template, vars, proxy, tls) {
+    const form = document.getElementById('vhostForm');
+    form.reset();
+    form.elements.server.value = server || '';
+    form.elements.domain.value = domain || '';
+    form.elements.document_root.value = docroot || '';
+    form.elements.server.disabled = !!domain;
+    form.elements.domain.readOnly = !!domain;
+    form.dataset.template = template || '';
+    form.dataset.vars = JSON.stringify(vars || {});
+    form.dataset.proxy = JSON.stringify(proxy || {});
+    form.elements.https.checked = !!tls;
+    form.elements.redirect.checked = !(tls && tls.no_redirect);
+    form.elements.http2.checked = !(tls && tls.no_http2);
+    form.elements.hsts.checked = !!(tls && tls.hsts);
+    form.elements.ocsp_stapling.checked = !!(tls && tls.ocsp_stapling);
+    form.elements.ciphers.value = (tls && tls.ciphers) || 'intermediate';
+    document.querySelector('#vhostModal .modal-title').textContent = domain ? `Edit ${domain}` : 'Add New Domain';
+    loadVhostTemplates();
+    bootstrap.Modal.getOrCreateInstance(document.getElementById('vhostModal')).show();
+}
+
+// Fill the template list of the domain form for the chosen web server.
+// Hybrid vhosts are rendered from Apache templates.
+function loadVhostTemplates() {
+    const form = document.getElementById('vhostForm');
+    const select = form.elements.template;
+    select.innerHTML = '';
+    vhostTemplates = [];
+    renderVhostVars();
+    if (!form.elements.server.value) {
+        return;
+    }
+    const hybrid = form.elements.server.value === 'hybrid';
+    const server = hybrid ? 'apache' : form.elements.server.value;
+    
+    fetch(`/panel/api/vhosts/templates?server=${server}`)
+    .then(response => response.json())
+    .then(data => {
+        if (!data.success) {
+            showAlert('danger', `Failed to load templates: ${data.message}`);
+            return;
+        }
+        vhostTemplates = data.data.filter(t => !t.hybrid && !(hybrid && t.proxy));
+        vhostTemplates.forEach(t => select.add(new Option(t.name, t.name)));
+        select.value = form.dataset.template || 'php';
+        renderVhostVars();
+    })
+    .catch(error => {
+        showAlert('danger', `Error loading templates: ${error.message}`);
+    });
+}
+
+// Show an input for each variable of the chosen template
+function renderVhostVars() {
+    const form = document.getElementById('vhostForm');
+    const container = document.getElementById('vhostVars');
+    const template = vhostTemplates.find(t => t.name === form.elements.template.value);
+    const values = JSON.parse(form.dataset.vars || '{}');
+    container.innerHTML = '';
+    document.getElementById('vhostTemplateDescription').textContent = template ? template.description : '';
+    if (!template) {
+        return;
+    }
+    
+    (template.variables || []).forEach(variable => {
+        addVhostField(container, `var_${variable.name}`, variable.name + (variable.required ? ' *' : ''),
+            variable.description, values[variable.name] || '', variable.default || '');
+    });
+    if (template.proxy) {
+        const proxy = JSON.parse(form.dataset.proxy || '{}');
+        addVhostField(container, 'backend', 'Backends *', 'host:port or unix:/path, separated by spaces', (proxy.backends || []).join(' '), '127.0.0.1:3000');
+        addVhostField(container, 'method', 'Load balancing', 'round_robin, least_conn, ip_hash or random', proxy.method || '', 'round_robin');
+        addVhostField(container, 'max_fails', 'Max fails', 'Failed attempts before a backend is skipped', proxy.max_fails || '', '1');
+        addVhostField(container, 'fail_timeout', 'Fail timeout', 'Seconds a failed backend is skipped', proxy.fail_timeout || '', '10');
+        addVhostField(container, 'connect_timeout', 'Connect timeout', 'Seconds to wait for a backend connection', proxy.connect_timeout || '', '60');
+        addVhostField(container, 'read_timeout', 'Read timeout', 'Seconds to wait for a backend response', proxy.read_timeout || '', '60');
+        addVhostField(container, 'send_timeout', 'Send timeout', 'Seconds to wait while sending a request', proxy.send_timeout || '', '60');
+        addVhostField(container, 'cache', 'Cache', 'How long to cache responses, e.g. 10m; empty for none', proxy.cache || '', '');
+        addVhostField(container, 'websocket', 'WebSocket', 'Pass WebSocket upgrades on', !!proxy.websocket, null);
+        addVhostField(container, 'unbuffered', 'Unbuffered', 'Stream responses instead of buffering them', !!proxy.unbuffered, null);
+    }
+}
+
+// Add an input, or a checkbox when value is a boolean, to the domain form
+function addVhostField(container, name, label, description, value, placeholder) {
+    const column = document.createElement('div');
+    column.className = 'col-md-6 mb-3';
+    const input = document.createElement('input');
+    input.name = name;
+    const caption = document.createElement('label');
+    caption.textContent = label;
+    if (typeof value === 'boolean') {
+        column.classList.add('form-check', 'ps-5');
+        input.type = 'checkbox';
+        input.className = 'form-check-input';
+        input.checked = value;
+        caption.className = 'form-check-label';
+        column.append(input, caption);
+    } else {
+        input.className = 'form-control';
+        input.value = value;
+        input.placeholder = placeholder;
+        caption.className = 'form-label';
+        column.append(caption, input);
+    }
+    const help = document.createElement('div');
+    help.className = 'form-text';
+    help.textContent = description;
+    column.append(help);
+    container.append(column);
+}
+
+// Create or re-render the virtual host in the domain form
+function saveVhost() {
+    const form = document.getElementById('vhostForm');
+    const body = new URLSearchParams();
+    ['server', 'domain', 'document_root', 'template'].forEach(name => body.append(name, form.elements[name].value));
+    if (body.get('server') === 'hybrid') {
+        body.set('server', 'nginx');
+        body.append('hybrid', 'true');
+    }
+    form.querySelectorAll('#vhostVars input').forEach(input => {
+        if (input.type === 'checkbox') {
+            body.append(input.name, input.checked);
+        } else if (input.name === 'backend') {
+            input.value.split(/[\s,]+/).filter(Boolean).forEach(backend => body.append('backend', backend));
+        } else {
+            body.append(input.name, input.value);
+        }
+    });
+    ['https', 'redirect', 'http2', 'hsts', 'ocsp_stapling'].forEach(name => body.append(name, form.elements[name].checked));
+    body.append('ciphers', form.elements.ciphers.value);
+    
+    fetch('/panel/api/vhosts', {
+        method: 'POST',
+        body: body
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.success) {
+            showAlert('success', data.message);
+            setTimeout(() => location.reload(), 1000);
+        } else {
+            showAlert('danger', `Failed to save ${body.get('domain')}: ${data.message}`);
         }
     })
+    .catch(error => {
+        showAlert('danger', `Error saving ${body.get('domain')}: ${error.message}`);
+    });
+}
+
+// Enable, disable or delete a virtual host
+function vhostAction(server, domain, action, params) {
+    fetch(`/panel/api/vhosts/${server}/${encodeURIComponent(domain)}/${action}`, {
+        method: 'POST',
+        body: new URLSearchParams(params || {})
+    })
     .then(response => response.json())
     .then(data => {
         if (data.success) {
-            showAlert('success', `${serviceName} uninstalled successfully. The page will reload in 3 seconds.`);
-            // Reload page after 3 seconds to reflect changes
-            setTimeout(() => {
-                window.location.reload();
-            }, 3000);
+            showAlert('success', data.message);
+            setTimeout(() => location.reload(), 1000);
         } else {
-            showAlert('danger', `Failed to uninstall ${serviceName}: ${data.message}`);
+            showAlert('danger', `Failed to ${action} ${domain}: ${data.message}`);
         }
     })
     .catch(error => {
-        showAlert('danger', `Error uninstalling ${serviceName}: ${error.message}`);
+        showAlert('danger', `Error trying to ${action} ${domain}: ${error.message}`);
+    });
+}
+
+// Ask whether to archive a virtual host's files, then delete it
+function deleteVhost(server, domain) {
+    document.getElementById('deleteVhostDomain').textContent = domain;
+    document.getElementById('archiveVhost').checked = false;
+    const modal = bootstrap.Modal.getOrCreateInstance(document.getElementById('deleteVhostModal'));
+    document.getElementById('deleteVhostButton').onclick = () => {
+        modal.hide();
+        vhostAction(server, domain, 'delete', {archive: document.getElementById('archiveVhost').checked});
+    };
+    modal.show();
+}
+
+// Issue a Let's Encrypt certificate in the background
+function issueCertificate() {
+    const form = document.getElementById('issueCertificateForm');
+    enqueueJob('ssl-issue', new FormData(form));
+}
+
+// Install an uploaded certificate and serve its domain over HTTPS
+function uploadCertificate() {
+    const form = document.getElementById('uploadCertificateForm');
+    const domain = form.elements.domain.value;
+    
+    fetch('/panel/api/certificates', {
+        method: 'POST',
+        body: new URLSearchParams(new FormData(form))
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.success) {
+            showAlert('success', data.message);
+            setTimeout(() => location.reload(), 1000);
+        } else {
+            showAlert('danger', `Failed to upload the certificate for ${domain}: ${data.message}`);
+        }
+    })
+    .catch(error => {
+        showAlert('danger', `Error uploading the certificate for ${domain}: ${error.message}`);
+    });
+}
+
+// Queue a job and open its page
+function enqueueJob(kind, params) {
+    const body = new URLSearchParams(params);
+    body.append('kind', kind);
+    
+    fetch('/panel/api/jobs', {
+        method: 'POST',
+        body: body
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.success) {
+            window.location.href = `/panel/jobs/${data.data.id}`;
+        } else {
+            showAlert('danger', `Failed to queue ${kind}: ${data.message}`);
+        }
+    })
+    .catch(error => {
+        showAlert('danger', `Error queueing ${kind}: ${error.message}`);
+    });
+}
+
+// Cancel a queued or running job
+function cancelJob(id) {
+    fetch(`/panel/api/jobs/${id}/cancel`, {
+        method: 'POST'
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.success) {
+            showAlert('info', data.message);
+        } else {
+            showAlert('danger', `Failed to cancel job ${id}: ${data.message}`);
+        }
+    })
+    .catch(error => {
+        showAlert('danger', `Error cancelling job ${id}: ${error.message}`);
+    });
+}
+
+// Follow a job's output and progress on its page
+function streamJob(id) {
+    const log = document.getElementById('job-log');
+    const badges = {
+        queued: 'bg-warning',
+        running: 'bg-primary',
+        succeeded: 'bg-success',
+        failed: 'bg-danger',
+        cancelled: 'bg-secondary',
+    };
+    const showStatus = (job) => {
+        const bar = document.getElementById('job-progress');
+        bar.style.width = `${job.progress}%`;
+        bar.textContent = `${job.progress}%`;
+        document.getElementById('job-step').textContent = job.step || '';
+        const status = job.status.charAt(0).toUpperCase() + job.status.slice(1);
+        document.getElementById('job-status').innerHTML = `<span class="badge ${badges[job.status]}">${status}</span>`;
+    };
+    
+    const source = new EventSource(`/panel/api/jobs/${id}/stream`);
+    source.addEventListener('log', event => {
+        log.textContent += event.data + '\n';
+        log.scrollTop = log.scrollHeight;
+    });
+    source.addEventListener('progress', event => showStatus(JSON.parse(event.data)));
+    source.addEventListener('done', event => {
+        const job = JSON.parse(event.data);
+        showStatus(job);
+        document.getElementById('job-message').textContent = job.message + (job.error ? ` (${job.error})` : '');
+        const cancel = document.getElementById('job-cancel');
+        if (cancel) {
+            cancel.remove();
+        }
+        source.close();
     });
 }
 
@@ -0,0 +1,93 @@
+package web
+
+import (
+	"easygo/pkg/actions"
+	"easygo/pkg/audit"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// auditFilter builds the audit filter from query parameters: user,
+// action, interface, source, since, until, failed and limit
+func auditFilter(query url.Values) (*audit.Filter, error) {
+	filter := &audit.Filter{
+		User:      query.Get("user"),
+		Action:    query.Get("action"),
+		Interface: query.Get("interface"),
+		Source:    query.Get("source"),
+		Failed:    query.Get("failed") == "true" || query.Get("failed") == "1",
+		Limit:     100,
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return nil, &actions.Error{Kind: actions.ErrValidationFailed, Msg: fmt.Sprintf("limit: %q is not a number", limit)}
+		}
+		filter.Limit = n
+	}
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := audit.ParseTime(value)
+		if err != nil {
+			return nil, &actions.Error{Kind: actions.ErrValidationFailed, Msg: name, Err: err}
+		}
+		*t = parsed
+	}
+	return filter, nil
+}
+
+// handleAudit shows the audit log with filters
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	session, _ := s.store.Get(r, "session")
+	username, _ := session.Values["username"].(string)
+
+	data := PageData{
+		Title:       "Audit Log - EasyGo Panel",
+		User:        username,
+		CurrentPage: "audit",
+	}
+
+	query := r.URL.Query()
+	filter, err := auditFilter(query)
+	var result *audit.Result
+	if err == nil {
+		result, err = audit.Query(filter)
+	}
+	if err != nil {
+		data.Flash = "Failed to read the audit log: " + err.Error()
+	}
+	data.Data = map[string]interface{}{
+		"Query":  query,
+		"Result": result,
+	}
+
+	s.renderTemplate(w, "audit.html", data)
+}
+
+// handleAPIAudit returns audit entries, newest first, filtered like the
+// audit page
+func (s *Server) handleAPIAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	filter, err := auditFilter(r.URL.Query())
+	var result *audit.Result
+	if err == nil {
+		result, err = audit.Query(filter)
+	}
+	if err != nil {
+		writeActionResponse(w, r, &actions.Result{Success: false, Message: "Failed to read the audit log", Error: err}, nil)
+		return
+	}
+
+	message := fmt.Sprintf("%d of %d entries", len(result.Entries), result.Total)
+	if result.Broken != "" {
+		message += "; the audit log was tampered with: " + result.Broken
+	}
+	writeActionResponse(w, r, &actions.Result{Success: true, Message: message, Data: result}, nil)
+}
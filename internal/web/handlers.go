@@ -3,7 +3,12 @@ package web
 import (
 	"easygo/pkg/actions"
 	"easygo/pkg/auth"
+	"easygo/pkg/config"
+	"easygo/pkg/events"
+	"easygo/pkg/state"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	
 	"github.com/gorilla/mux"
@@ -57,6 +62,14 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	
 	// Authenticate using PAM
 	if err := auth.AuthenticateUser(username, password); err != nil {
+		events.Default.Publish(&events.Event{
+			Type:      events.TypeLogin,
+			User:      username,
+			Interface: events.InterfaceWeb,
+			Source:    clientAddress(r),
+			Success:   false,
+			Message:   "Login failed",
+		})
 		data := PageData{
 			Title:       "Login - EasyGo Panel",
 			CurrentPage: "login",
@@ -72,6 +85,15 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	session.Values["username"] = username
 	session.Save(r, w)
 	
+	events.Default.Publish(&events.Event{
+		Type:      events.TypeLogin,
+		User:      username,
+		Interface: events.InterfaceWeb,
+		Source:    clientAddress(r),
+		Success:   true,
+		Message:   "Logged in",
+	})
+	
 	http.Redirect(w, r, "/panel/", http.StatusFound)
 }
 
@@ -165,21 +187,7 @@ func (s *Server) handlePHP(w http.ResponseWriter, r *http.Request) {
 	s.renderTemplate(w, "php.html", data)
 }
 
-// handleDomains handles domain management
-func (s *Server) handleDomains(w http.ResponseWriter, r *http.Request) {
-	session, _ := s.store.Get(r, "session")
-	username, _ := session.Values["username"].(string)
-	
-	data := PageData{
-		Title:       "Domains - EasyGo Panel",
-		User:        username,
-		CurrentPage: "domains",
-	}
-	
-	s.renderTemplate(w, "domains.html", data)
-}
-
-// handleSSL handles SSL certificate management
+// handleSSL lists the certificates recorded in the state store
 func (s *Server) handleSSL(w http.ResponseWriter, r *http.Request) {
 	session, _ := s.store.Get(r, "session")
 	username, _ := session.Values["username"].(string)
@@ -190,6 +198,16 @@ func (s *Server) handleSSL(w http.ResponseWriter, r *http.Request) {
 		CurrentPage: "ssl",
 	}
 	
+	certificates := []*state.Certificate{}
+	if store := actions.DefaultStore; store != nil {
+		recorded, err := store.Certificates().List()
+		if err != nil {
+			data.Flash = "Failed to read the state store: " + err.Error()
+		}
+		certificates = append(certificates, recorded...)
+	}
+	data.Data = certificates
+	
 	s.renderTemplate(w, "ssl.html", data)
 }
 
@@ -221,12 +239,146 @@ func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
 	s.renderTemplate(w, "settings.html", data)
 }
 
+// handleDiscovery shows resources found on the server that EasyGo does not
+// manage, or whose records no longer match
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	session, _ := s.store.Get(r, "session")
+	username, _ := session.Values["username"].(string)
+	
+	discoveryAction := actions.NewDiscoveryAction()
+	discoveryAction.SetContext(r.Context())
+	result := discoveryAction.Scan()
+	
+	data := PageData{
+		Title:       "Discovery - EasyGo Panel",
+		User:        username,
+		CurrentPage: "discovery",
+		Data:        result,
+	}
+	if !result.Success {
+		data.Flash = result.Message
+	}
+	
+	s.renderTemplate(w, "discovery.html", data)
+}
+
+// handleDrift shows managed files that were changed outside EasyGo
+func (s *Server) handleDrift(w http.ResponseWriter, r *http.Request) {
+	session, _ := s.store.Get(r, "session")
+	username, _ := session.Values["username"].(string)
+	
+	baseAction := &actions.BaseAction{}
+	baseAction.SetContext(r.Context())
+	result := baseAction.DetectDrift()
+	
+	data := PageData{
+		Title:       "Drift - EasyGo Panel",
+		User:        username,
+		CurrentPage: "drift",
+		Data:        result,
+	}
+	if !result.Success {
+		data.Flash = result.Message
+	}
+	
+	s.renderTemplate(w, "drift.html", data)
+}
+
 // API Handlers
 
 type APIResponse struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
+	Success bool              `json:"success"`
+	Message string            `json:"message"`
+	Data    interface{}       `json:"data,omitempty"`
+	Error   *APIError         `json:"error,omitempty"`
+	Hooks   []actions.HookRun `json:"hooks,omitempty"`
+}
+
+// APIError describes why an action failed
+type APIError struct {
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Stderr   string `json:"stderr,omitempty"`
+}
+
+// newAPIError describes an action error for API clients
+func newAPIError(err error) *APIError {
+	if err == nil {
+		return nil
+	}
+	
+	apiErr := &APIError{
+		Code:    actions.ErrorCode(err),
+		Message: err.Error(),
+	}
+	var cmdErr *actions.CommandError
+	if errors.As(err, &cmdErr) {
+		if cmdErr.ExitCode >= 0 {
+			exitCode := cmdErr.ExitCode
+			apiErr.ExitCode = &exitCode
+		}
+		apiErr.Stderr = cmdErr.Stderr
+	}
+	return apiErr
+}
+
+// statusCode returns the HTTP status for a failed action
+func statusCode(err error) int {
+	switch actions.ErrorKind(err) {
+	case actions.ErrNotInstalled, actions.ErrNotFound:
+		return http.StatusNotFound
+	case actions.ErrUnsupportedPlatform:
+		return http.StatusNotImplemented
+	case actions.ErrValidationFailed:
+		return http.StatusUnprocessableEntity
+	case actions.ErrPermissionDenied:
+		return http.StatusForbidden
+	case actions.ErrConflict:
+		return http.StatusConflict
+	case actions.ErrCommandFailed:
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// applyDryRun switches the action to dry-run mode when the request has
+// the dry_run query parameter set, returning the plan that records it
+func applyDryRun(r *http.Request, ba *actions.BaseAction) *actions.Plan {
+	switch r.URL.Query().Get("dry_run") {
+	case "", "0", "false":
+		return nil
+	}
+	
+	plan := actions.NewPlan()
+	ba.SetPlan(plan)
+	return plan
+}
+
+// writeActionResponse writes an action result, including the plan for dry
+// runs. Plans are rendered as plain text when format=text is requested.
+func writeActionResponse(w http.ResponseWriter, r *http.Request, result *actions.Result, plan *actions.Plan) {
+	if plan != nil && r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, plan.Text())
+		return
+	}
+	
+	response := APIResponse{
+		Success: result.Success,
+		Message: result.Message,
+		Data:    result.Data,
+		Hooks:   result.Hooks,
+	}
+	if plan != nil {
+		response.Data = plan
+	}
+	if !result.Success {
+		response.Error = newAPIError(result.Error)
+		w.WriteHeader(statusCode(result.Error))
+	}
+	
+	json.NewEncoder(w).Encode(response)
 }
 
 // handleAPIServiceStatus returns status of all services
@@ -234,10 +386,19 @@ func (s *Server) handleAPIServiceStatus(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Content-Type", "application/json")
 	
 	baseAction := &actions.BaseAction{}
-	services := []string{"apache2", "nginx", "php8.2-fpm", "mysql", "postgresql"}
+	baseAction.SetContext(r.Context())
+	platform := baseAction.Platform()
 	var serviceData []map[string]interface{}
 	
-	for _, service := range services {
+	for _, service := range config.Current().Services {
+		// Map generic names to the platform's service names
+		switch service {
+		case "apache":
+			service = platform.ApacheService
+		case "php-fpm":
+			service = platform.PHPFPMService(config.Current().PHP.DefaultVersion)
+		}
+		
 		result := baseAction.ServiceStatus(service)
 		status := "stopped"
 		if result.Success {
@@ -270,14 +431,11 @@ func (s *Server) handleAPIServiceStart(w http.ResponseWriter, r *http.Request) {
 	serviceName := vars["service"]
 	
 	baseAction := &actions.BaseAction{}
+	baseAction.SetContext(r.Context())
+	plan := applyDryRun(r, baseAction)
 	result := baseAction.StartService(serviceName)
 	
-	response := APIResponse{
-		Success: result.Success,
-		Message: result.Message,
-	}
-	
-	json.NewEncoder(w).Encode(response)
+	writeActionResponse(w, r, result, plan)
 }
 
 // handleAPIServiceStop stops a service
@@ -288,14 +446,11 @@ func (s *Server) handleAPIServiceStop(w http.ResponseWriter, r *http.Request) {
 	serviceName := vars["service"]
 	
 	baseAction := &actions.BaseAction{}
+	baseAction.SetContext(r.Context())
+	plan := applyDryRun(r, baseAction)
 	result := baseAction.StopService(serviceName)
 	
-	response := APIResponse{
-		Success: result.Success,
-		Message: result.Message,
-	}
-	
-	json.NewEncoder(w).Encode(response)
+	writeActionResponse(w, r, result, plan)
 }
 
 // handleAPIServiceRestart restarts a service
@@ -306,17 +461,16 @@ func (s *Server) handleAPIServiceRestart(w http.ResponseWriter, r *http.Request)
 	serviceName := vars["service"]
 	
 	baseAction := &actions.BaseAction{}
+	baseAction.SetContext(r.Context())
+	plan := applyDryRun(r, baseAction)
 	result := baseAction.RestartService(serviceName)
 	
-	response := APIResponse{
-		Success: result.Success,
-		Message: result.Message,
-	}
-	
-	json.NewEncoder(w).Encode(response)
+	writeActionResponse(w, r, result, plan)
 }
 
-// handleAPIServiceUninstall uninstalls a web server service
+// handleAPIServiceUninstall uninstalls a web server service. Uninstalling
+// takes a while, so it is queued as a job, which can be followed and
+// cancelled on its page; dry runs are planned right away.
 func (s *Server) handleAPIServiceUninstall(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	
@@ -324,14 +478,21 @@ func (s *Server) handleAPIServiceUninstall(w http.ResponseWriter, r *http.Reques
 	serviceName := vars["service"]
 	
 	webAction := actions.NewWebServerAction()
+	webAction.SetContext(r.Context())
+	plan := applyDryRun(r, &webAction.BaseAction)
+	if plan == nil {
+		s.queueJob(w, r, "uninstall", map[string]string{"service": serviceName})
+		return
+	}
 	var result *actions.Result
 	
 	switch serviceName {
-	case "apache", "apache2":
+	case "apache", "apache2", "httpd":
 		result = webAction.UninstallApache()
 	case "nginx":
 		result = webAction.UninstallNginx()
 	default:
+		w.WriteHeader(http.StatusBadRequest)
 		response := APIResponse{
 			Success: false,
 			Message: "Unsupported service for uninstall: " + serviceName,
@@ -340,12 +501,7 @@ func (s *Server) handleAPIServiceUninstall(w http.ResponseWriter, r *http.Reques
 		return
 	}
 	
-	response := APIResponse{
-		Success: result.Success,
-		Message: result.Message,
-	}
-	
-	json.NewEncoder(w).Encode(response)
+	writeActionResponse(w, r, result, plan)
 }
 
 // handleAPISystemStats returns system statistics
@@ -361,4 +517,165 @@ func (s *Server) handleAPISystemStats(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	json.NewEncoder(w).Encode(stats)
+}
+
+// handleAPIFiles lists files managed by EasyGo
+func (s *Server) handleAPIFiles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	
+	baseAction := &actions.BaseAction{}
+	result := baseAction.ListManagedFiles()
+	
+	writeActionResponse(w, r, result, nil)
+}
+
+// handleAPIFileVersions lists previous versions of a managed file
+func (s *Server) handleAPIFileVersions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	
+	baseAction := &actions.BaseAction{}
+	result := baseAction.ListFileVersions(r.URL.Query().Get("path"))
+	
+	writeActionResponse(w, r, result, nil)
+}
+
+// handleAPIFileRestore restores a managed file to a previous version
+func (s *Server) handleAPIFileRestore(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	
+	path := r.FormValue("path")
+	version := r.FormValue("version")
+	
+	baseAction := &actions.BaseAction{}
+	baseAction.SetContext(r.Context())
+	plan := applyDryRun(r, baseAction)
+	result := baseAction.RestoreFileVersion(path, version)
+	
+	writeActionResponse(w, r, result, plan)
+}
+
+// handleAPIState lists the resources of one kind recorded in the state store
+func (s *Server) handleAPIState(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	
+	store := actions.DefaultStore
+	if store == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: false,
+			Message: "State store is not available",
+		})
+		return
+	}
+	
+	var records interface{}
+	var err error
+	switch kind := mux.Vars(r)["kind"]; kind {
+	case "domains":
+		records, err = store.Domains().List()
+	case "databases":
+		records, err = store.Databases().List()
+	case "backups":
+		records, err = store.BackupJobs().List()
+	case "cron":
+		records, err = store.CronJobs().List()
+	case "pools":
+		records, err = store.FPMPools().List()
+	case "certificates":
+		records, err = store.Certificates().List()
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: false,
+			Message: "Unknown resource kind: " + kind,
+		})
+		return
+	}
+	
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: false,
+			Message: "Failed to read state store",
+			Error:   newAPIError(err),
+		})
+		return
+	}
+	
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Data:    records,
+	})
+}
+
+// handleAPIDiscovery compares the server with the state store
+func (s *Server) handleAPIDiscovery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	
+	discoveryAction := actions.NewDiscoveryAction()
+	discoveryAction.SetContext(r.Context())
+	result := discoveryAction.Scan()
+	
+	writeActionResponse(w, r, result, nil)
+}
+
+// handleAPIDiscoveryImport registers discovered resources, those named by
+// the id form values or all unmanaged and drifted ones
+func (s *Server) handleAPIDiscoveryImport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	
+	session, _ := s.store.Get(r, "session")
+	username, _ := session.Values["username"].(string)
+	r.ParseForm()
+	
+	discoveryAction := actions.NewDiscoveryAction()
+	discoveryAction.SetContext(r.Context())
+	discoveryAction.SetOwner(username)
+	plan := applyDryRun(r, &discoveryAction.BaseAction)
+	result := discoveryAction.Import(r.Form["id"]...)
+	
+	writeActionResponse(w, r, result, plan)
+}
+
+// handleAPIDrift lists managed files that were changed outside EasyGo
+func (s *Server) handleAPIDrift(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	
+	baseAction := &actions.BaseAction{}
+	baseAction.SetContext(r.Context())
+	result := baseAction.DetectDrift()
+	
+	writeActionResponse(w, r, result, nil)
+}
+
+// handleAPIDriftAdopt accepts the current content of a drifted file
+func (s *Server) handleAPIDriftAdopt(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	
+	session, _ := s.store.Get(r, "session")
+	username, _ := session.Values["username"].(string)
+	
+	baseAction := &actions.BaseAction{}
+	baseAction.SetContext(r.Context())
+	baseAction.SetOwner(username)
+	plan := applyDryRun(r, baseAction)
+	result := baseAction.AdoptFile(r.FormValue("path"))
+	
+	writeActionResponse(w, r, result, plan)
+}
+
+// handleAPIDriftRerender writes back the generated content of a drifted file
+func (s *Server) handleAPIDriftRerender(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	
+	session, _ := s.store.Get(r, "session")
+	username, _ := session.Values["username"].(string)
+	
+	baseAction := &actions.BaseAction{}
+	baseAction.SetContext(r.Context())
+	baseAction.SetOwner(username)
+	plan := applyDryRun(r, baseAction)
+	result := baseAction.RerenderFile(r.FormValue("path"))
+	
+	writeActionResponse(w, r, result, plan)
 }
\ No newline at end of file
@@ -0,0 +1,663 @@
+package web
+
+import (
+	"context"
+	"easygo/pkg/actions"
+	"easygo/pkg/config"
+	"easygo/pkg/events"
+	"easygo/pkg/state"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Job states
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+const (
+	jobWorkers       = 2
+	jobQueueSize     = 100
+	jobFlushInterval = time.Second
+
+	// maxJobLogLines is how much output a job keeps, dropping the oldest
+	maxJobLogLines = 5000
+
+	// maxJobs is how many finished jobs are kept
+	maxJobs = 200
+)
+
+// jobKind is an operation that can be queued. check validates the
+// parameters when the job is queued; run performs it, calling prepare on
+// its action so the queue can capture output and progress and cancel it.
+type jobKind struct {
+	title func(params map[string]string) string
+	check func(params map[string]string) error
+	run   func(prepare func(ba *actions.BaseAction), params map[string]string) *actions.Result
+}
+
+// jobKinds are the operations the panel runs in the background
+var jobKinds = map[string]jobKind{
+	"install": {
+		title: func(params map[string]string) string { return "Install " + params["service"] },
+		check: checkWebServer,
+		run: func(prepare func(ba *actions.BaseAction), params map[string]string) *actions.Result {
+			webAction := actions.NewWebServerAction()
+			prepare(&webAction.BaseAction)
+			if params["service"] == "nginx" {
+				return webAction.InstallNginx()
+			}
+			return webAction.InstallApache()
+		},
+	},
+	"uninstall": {
+		title: func(params map[string]string) string { return "Uninstall " + params["service"] },
+		check: checkWebServer,
+		run: func(prepare func(ba *actions.BaseAction), params map[string]string) *actions.Result {
+			webAction := actions.NewWebServerAction()
+			prepare(&webAction.BaseAction)
+			if params["service"] == "nginx" {
+				return webAction.UninstallNginx()
+			}
+			return webAction.UninstallApache()
+		},
+	},
+	"ssl-issue": {
+		title: func(params map[string]string) string { return "Issue a certificate for " + params["domain"] },
+		check: func(params map[string]string) error { return requireParams(params, "domain", "email") },
+		run: func(prepare func(ba *actions.BaseAction), params map[string]string) *actions.Result {
+			sslAction := actions.NewSSLAction()
+			prepare(&sslAction.BaseAction)
+			return sslAction.IssueCertificate(params["domain"], params["email"], params["webroot"])
+		},
+	},
+	"ssl-renew": {
+		title: func(params map[string]string) string { return "Renew certificates" },
+		check: func(params map[string]string) error { return nil },
+		run: func(prepare func(ba *actions.BaseAction), params map[string]string) *actions.Result {
+			sslAction := actions.NewSSLAction()
+			prepare(&sslAction.BaseAction)
+			return sslAction.RenewCertificates()
+		},
+	},
+	"backup-full": {
+		title: func(params map[string]string) string { return "Full system backup" },
+		check: func(params map[string]string) error { return nil },
+		run: func(prepare func(ba *actions.BaseAction), params map[string]string) *actions.Result {
+			backupAction := actions.NewBackupAction()
+			prepare(&backupAction.BaseAction)
+			return backupAction.CreateFullSystemBackup(params["destination"])
+		},
+	},
+	"backup-files": {
+		title: func(params map[string]string) string { return "Back up " + params["source"] },
+		check: func(params map[string]string) error { return requireParams(params, "source", "name") },
+		run: func(prepare func(ba *actions.BaseAction), params map[string]string) *actions.Result {
+			backupAction := actions.NewBackupAction()
+			prepare(&backupAction.BaseAction)
+			return backupAction.CreateFileBackup(params["source"], params["destination"], params["name"])
+		},
+	},
+	"backup-database": {
+		title: func(params map[string]string) string { return "Back up database " + params["database"] },
+		check: func(params map[string]string) error { return requireParams(params, "database", "type") },
+		run: func(prepare func(ba *actions.BaseAction), params map[string]string) *actions.Result {
+			backupAction := actions.NewBackupAction()
+			prepare(&backupAction.BaseAction)
+			return backupAction.CreateDatabaseBackup(params["database"], params["type"], params["destination"])
+		},
+	},
+}
+
+// checkWebServer accepts the web servers that can be installed and
+// uninstalled
+func checkWebServer(params map[string]string) error {
+	switch params["service"] {
+	case "apache", "apache2", "httpd", "nginx":
+		return nil
+	}
+	return &actions.Error{Kind: actions.ErrValidationFailed, Msg: fmt.Sprintf("unsupported service %q", params["service"])}
+}
+
+// requireParams checks that parameters are set
+func requireParams(params map[string]string, names ...string) error {
+	for _, name := range names {
+		if params[name] == "" {
+			return &actions.Error{Kind: actions.ErrValidationFailed, Msg: name + " is required"}
+		}
+	}
+	return nil
+}
+
+// jobQueue runs queued jobs a few at a time. Jobs are kept in the state
+// store, so their status, progress and output survive a restart of the
+// panel; the queue holds the running ones in memory.
+type jobQueue struct {
+	mu      sync.Mutex
+	running map[string]*runningJob
+	pending chan string
+}
+
+// runningJob is a job being run by a worker
+type runningJob struct {
+	job    *state.Job
+	cancel context.CancelFunc
+	dirty  bool // changed since it was last saved
+}
+
+func newJobQueue() *jobQueue {
+	return &jobQueue{
+		running: make(map[string]*runningJob),
+		pending: make(chan string, jobQueueSize),
+	}
+}
+
+// jobStore opens the state store that holds the jobs
+func jobStore() (*state.Store, error) {
+	return state.Open(config.Current().Paths.State)
+}
+
+// start starts the workers. Jobs that were queued when the panel stopped
+// are queued again; those that were running are marked failed.
+func (q *jobQueue) start() {
+	if store, err := jobStore(); err == nil {
+		jobs, _ := store.Jobs().List()
+		for _, job := range jobs {
+			switch job.Status {
+			case jobQueued:
+				select {
+				case q.pending <- job.ID:
+				default:
+				}
+			case jobRunning:
+				job.Status = jobFailed
+				job.Message = "Interrupted because the panel stopped"
+				job.FinishedAt = time.Now()
+				store.Jobs().Put(job)
+			}
+		}
+	} else {
+		slog.Error("Job queue unavailable", "error", err)
+	}
+
+	for i := 0; i < jobWorkers; i++ {
+		go func() {
+			for id := range q.pending {
+				q.run(id)
+			}
+		}()
+	}
+}
+
+// enqueue records a job and queues it
+func (q *jobQueue) enqueue(kind string, params map[string]string, origin events.Origin) (*state.Job, error) {
+	spec, ok := jobKinds[kind]
+	if !ok {
+		return nil, &actions.Error{Kind: actions.ErrNotFound, Msg: "unknown job kind " + kind}
+	}
+	if err := spec.check(params); err != nil {
+		return nil, err
+	}
+	store, err := jobStore()
+	if err != nil {
+		return nil, err
+	}
+
+	job := &state.Job{
+		Kind:   kind,
+		Title:  spec.title(params),
+		Status: jobQueued,
+		Source: origin.Source,
+		Meta:   state.Meta{Owner: origin.User, Params: params},
+	}
+	if err := store.Jobs().Put(job); err != nil {
+		return nil, err
+	}
+	select {
+	case q.pending <- job.ID:
+	default:
+		store.Jobs().Delete(job.ID)
+		return nil, &actions.Error{Kind: actions.ErrConflict, Msg: fmt.Sprintf("%d jobs are already queued", jobQueueSize)}
+	}
+
+	pruneJobs(store)
+	return job, nil
+}
+
+// run runs a queued job, unless it was cancelled while it waited
+func (q *jobQueue) run(id string) {
+	store, err := jobStore()
+	if err != nil {
+		slog.Error("Job not run", "job", id, "error", err)
+		return
+	}
+
+	q.mu.Lock()
+	job, err := store.Jobs().Get(id)
+	if err != nil || job.Status != jobQueued {
+		q.mu.Unlock()
+		return
+	}
+
+	// The job's actions are audited as run by whoever queued it
+	ctx, cancel := context.WithCancel(events.WithOrigin(context.Background(), events.Origin{
+		Interface: events.InterfaceWeb,
+		User:      job.Owner,
+		Source:    job.Source,
+	}))
+	defer cancel()
+	spec, ok := jobKinds[job.Kind]
+	if !ok {
+		q.mu.Unlock()
+		return
+	}
+	job.Status = jobRunning
+	job.StartedAt = time.Now()
+	rj := &runningJob{job: job, cancel: cancel, dirty: true}
+	q.running[id] = rj
+	q.mu.Unlock()
+	q.save(store, rj)
+	slog.Info("Job started", "job", id, "kind", job.Kind, "user", job.Owner)
+
+	// Save output and progress now and then rather than on every line
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(jobFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				q.save(store, rj)
+			}
+		}
+	}()
+
+	result := spec.run(func(ba *actions.BaseAction) {
+		ba.SetContext(ctx)
+		ba.SetOwner(job.Owner)
+		ba.SetOutput(func(line string) {
+			q.update(rj, func(job *state.Job) {
+				appendJobLog(job, line)
+			})
+		})
+		ba.SetProgress(func(percent int, step string) {
+			q.update(rj, func(job *state.Job) {
+				job.Progress = percent
+				job.Step = step
+				appendJobLog(job, "==> "+step)
+			})
+		})
+	}, job.Params)
+	close(stop)
+	<-stopped
+
+	q.update(rj, func(job *state.Job) {
+		for _, run := range result.Hooks {
+			appendJobLog(job, fmt.Sprintf("==> %s hook %s exited with status %d", run.Phase, run.Script, run.ExitCode))
+			for _, line := range strings.Split(run.Output, "\n") {
+				if line != "" {
+					appendJobLog(job, line)
+				}
+			}
+		}
+
+		job.Message = strings.TrimSpace(result.Message)
+		job.FinishedAt = time.Now()
+		switch {
+		case ctx.Err() != nil:
+			job.Status = jobCancelled
+		case result.Success:
+			job.Status = jobSucceeded
+			job.Progress = 100
+		default:
+			job.Status = jobFailed
+		}
+		if result.Error != nil {
+			job.Error = result.Error.Error()
+			job.ErrorCode = actions.ErrorCode(result.Error)
+		}
+	})
+	q.save(store, rj)
+	slog.Info("Job finished", "job", id, "kind", job.Kind, "status", rj.job.Status)
+
+	q.mu.Lock()
+	delete(q.running, id)
+	q.mu.Unlock()
+}
+
+// appendJobLog adds a line of output to a job
+func appendJobLog(job *state.Job, line string) {
+	job.Log = append(job.Log, line)
+	if excess := len(job.Log) - maxJobLogLines; excess > 0 {
+		job.Log = append([]string(nil), job.Log[excess:]...)
+		job.LogDropped += excess
+	}
+}
+
+// update changes a running job
+func (q *jobQueue) update(rj *runningJob, change func(job *state.Job)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	change(rj.job)
+	rj.dirty = true
+}
+
+// snapshot copies a running job, so it can be read without the lock
+func snapshot(job *state.Job) *state.Job {
+	copied := *job
+	copied.Log = append([]string(nil), job.Log...)
+	return &copied
+}
+
+// save records a running job if it changed
+func (q *jobQueue) save(store *state.Store, rj *runningJob) {
+	q.mu.Lock()
+	if !rj.dirty {
+		q.mu.Unlock()
+		return
+	}
+	job := snapshot(rj.job)
+	rj.dirty = false
+	q.mu.Unlock()
+
+	if err := store.Jobs().Put(job); err != nil {
+		slog.Warn("Failed to save job", "job", job.ID, "error", err)
+	}
+}
+
+// get returns a job, with the latest output if it is running
+func (q *jobQueue) get(id string) (*state.Job, error) {
+	q.mu.Lock()
+	if rj, ok := q.running[id]; ok {
+		defer q.mu.Unlock()
+		return snapshot(rj.job), nil
+	}
+	q.mu.Unlock()
+
+	store, err := jobStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.Jobs().Get(id)
+}
+
+// list returns the jobs, newest first
+func (q *jobQueue) list() ([]*state.Job, error) {
+	store, err := jobStore()
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := store.Jobs().List()
+	if err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	newest := make([]*state.Job, 0, len(jobs))
+	for i := len(jobs) - 1; i >= 0; i-- {
+		job := jobs[i]
+		if rj, ok := q.running[job.ID]; ok {
+			job = snapshot(rj.job)
+		}
+		newest = append(newest, job)
+	}
+	return newest, nil
+}
+
+// cancel stops a running job or drops a queued one
+func (q *jobQueue) cancel(id string) (*state.Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if rj, ok := q.running[id]; ok {
+		rj.cancel()
+		return snapshot(rj.job), nil
+	}
+
+	store, err := jobStore()
+	if err != nil {
+		return nil, err
+	}
+	job, err := store.Jobs().Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != jobQueued {
+		return nil, &actions.Error{Kind: actions.ErrConflict, Msg: fmt.Sprintf("job %s already %s", id, job.Status)}
+	}
+	job.Status = jobCancelled
+	job.FinishedAt = time.Now()
+	return job, store.Jobs().Put(job)
+}
+
+// finished reports whether a job has stopped for good
+func finished(job *state.Job) bool {
+	return job.Status != jobQueued && job.Status != jobRunning
+}
+
+// pruneJobs drops the oldest finished jobs beyond maxJobs
+func pruneJobs(store *state.Store) {
+	jobs, err := store.Jobs().List()
+	if err != nil {
+		return
+	}
+	excess := len(jobs) - maxJobs
+	for _, job := range jobs {
+		if excess <= 0 {
+			break
+		}
+		if !finished(job) {
+			continue
+		}
+		store.Jobs().Delete(job.ID)
+		excess--
+	}
+}
+
+// handleJobs lists recent jobs
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	session, _ := s.store.Get(r, "session")
+	username, _ := session.Values["username"].(string)
+
+	jobs, err := s.jobs.list()
+
+	data := PageData{
+		Title:       "Jobs - EasyGo Panel",
+		User:        username,
+		CurrentPage: "jobs",
+		Data:        jobs,
+	}
+	if err != nil {
+		data.Flash = "Failed to read jobs: " + err.Error()
+	}
+
+	s.renderTemplate(w, "jobs.html", data)
+}
+
+// handleJob shows a job and follows its output
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	session, _ := s.store.Get(r, "session")
+	username, _ := session.Values["username"].(string)
+
+	job, err := s.jobs.get(mux.Vars(r)["id"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := PageData{
+		Title:       job.Title + " - EasyGo Panel",
+		User:        username,
+		CurrentPage: "jobs",
+		Data:        job,
+	}
+
+	s.renderTemplate(w, "job.html", data)
+}
+
+// handleAPIJobs lists recent jobs, newest first, without their output
+func (s *Server) handleAPIJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	jobs, err := s.jobs.list()
+	if err != nil {
+		writeActionResponse(w, r, &actions.Result{Success: false, Message: "Failed to read jobs", Error: err}, nil)
+		return
+	}
+	for _, job := range jobs {
+		job.Log = nil
+	}
+
+	writeActionResponse(w, r, &actions.Result{
+		Success: true,
+		Message: fmt.Sprintf("%d jobs", len(jobs)),
+		Data:    jobs,
+	}, nil)
+}
+
+// handleAPIJobEnqueue queues a job. The form has the job's kind and its
+// parameters, e.g. kind=uninstall&service=nginx.
+func (s *Server) handleAPIJobEnqueue(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	r.ParseForm()
+	params := make(map[string]string)
+	for name := range r.Form {
+		if name != "kind" {
+			params[name] = r.Form.Get(name)
+		}
+	}
+
+	s.queueJob(w, r, r.FormValue("kind"), params)
+}
+
+// queueJob queues a job for a request and answers with it
+func (s *Server) queueJob(w http.ResponseWriter, r *http.Request, kind string, params map[string]string) {
+	job, err := s.jobs.enqueue(kind, params, events.OriginFrom(r.Context()))
+	if err != nil {
+		writeActionResponse(w, r, &actions.Result{Success: false, Message: "Failed to queue job", Error: err}, nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Queued job %s: %s", job.ID, job.Title),
+		Data:    job,
+	})
+}
+
+// handleAPIJob returns a job with its output
+func (s *Server) handleAPIJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	job, err := s.jobs.get(id)
+	if err != nil {
+		writeActionResponse(w, r, &actions.Result{Success: false, Message: "No job " + id, Error: err}, nil)
+		return
+	}
+
+	writeActionResponse(w, r, &actions.Result{Success: true, Message: job.Status, Data: job}, nil)
+}
+
+// handleAPIJobCancel cancels a job
+func (s *Server) handleAPIJobCancel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	job, err := s.jobs.cancel(id)
+	if err != nil {
+		writeActionResponse(w, r, &actions.Result{Success: false, Message: "Failed to cancel job " + id, Error: err}, nil)
+		return
+	}
+
+	writeActionResponse(w, r, &actions.Result{Success: true, Message: "Job " + id + " cancelled", Data: job}, nil)
+}
+
+// handleAPIJobStream streams a job as server-sent events: "log" events
+// carry output lines, "progress" events the status, progress and step,
+// and a final "done" event the finished job without its output
+func (s *Server) handleAPIJobStream(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, err := s.jobs.get(id); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		writeActionResponse(w, r, &actions.Result{Success: false, Message: "No job " + id, Error: err}, nil)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	sent := 0 // lines sent, counting those dropped from the log
+	lastProgress := ""
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		job, err := s.jobs.get(id)
+		if err != nil {
+			return
+		}
+
+		if sent < job.LogDropped {
+			sent = job.LogDropped
+		}
+		for _, line := range job.Log[sent-job.LogDropped:] {
+			writeEvent(w, "log", line)
+		}
+		sent = job.LogDropped + len(job.Log)
+
+		progress, _ := json.Marshal(map[string]interface{}{"status": job.Status, "progress": job.Progress, "step": job.Step})
+		if string(progress) != lastProgress {
+			writeEvent(w, "progress", string(progress))
+			lastProgress = string(progress)
+		}
+
+		if finished(job) {
+			job.Log = nil
+			done, _ := json.Marshal(job)
+			writeEvent(w, "done", string(done))
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeEvent writes a server-sent event
+func writeEvent(w http.ResponseWriter, event, data string) {
+	fmt.Fprintf(w, "event: %s\n", event)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
@@ -0,0 +1,72 @@
+package web
+
+import (
+	"easygo/pkg/logging"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// requestIDHeader carries the request ID. One sent by a proxy in front of
+// the panel is kept, so both logs can be matched.
+const requestIDHeader = "X-Request-ID"
+
+// logRequests gives every request an ID, returned in the X-Request-ID
+// header and added to every record logged while handling it, and logs the
+// request when it is done. Static files are only logged at debug level.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		ctx := logging.WithRequestID(r.Context(), id)
+
+		started := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		if strings.HasPrefix(r.URL.Path, "/static/") {
+			level = slog.LevelDebug
+		}
+		slog.Log(ctx, level, "Request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"bytes", recorder.bytes,
+			"duration_ms", time.Since(started).Milliseconds(),
+			"remote", clientAddress(r),
+			"user", recorder.user,
+		)
+	})
+}
+
+// responseRecorder notes what was sent in response to a request, and who
+// sent it once authMiddleware knows
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+	user   string
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	rr.status = status
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(data []byte) (int, error) {
+	n, err := rr.ResponseWriter.Write(data)
+	rr.bytes += n
+	return n, err
+}
+
+// Flush lets job streams reach the browser as they are written
+func (rr *responseRecorder) Flush() {
+	if flusher, ok := rr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
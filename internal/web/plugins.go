@@ -0,0 +1,143 @@
+package web
+
+import (
+	"easygo/pkg/actions"
+	"easygo/pkg/plugins"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// setupPluginRoutes mounts the pages and API routes registered by plugins
+func (s *Server) setupPluginRoutes(protected, api *mux.Router) {
+	api.HandleFunc("/plugins", s.handleAPIPlugins).Methods("GET")
+	api.HandleFunc("/plugins/{plugin}/actions/{action}", s.handleAPIPluginAction).Methods("POST")
+
+	for _, page := range plugins.Default.Pages() {
+		protected.HandleFunc(strings.TrimPrefix(page.URL(), "/panel"), s.handlePluginPage(page)).Methods("GET")
+	}
+
+	routers := make(map[string]*mux.Router)
+	router := func(plugin string) *mux.Router {
+		if routers[plugin] == nil {
+			routers[plugin] = api.PathPrefix("/plugins/" + plugin).Subrouter()
+		}
+		return routers[plugin]
+	}
+	for _, route := range plugins.Default.Routes() {
+		action, _ := plugins.Default.Action(route.Plugin + "." + route.Action)
+		router(route.Plugin).HandleFunc(route.Path, s.handlePluginRoute(action)).Methods(route.Method)
+	}
+	for plugin, setups := range plugins.Default.Routers() {
+		for _, setup := range setups {
+			setup(router(plugin))
+		}
+	}
+}
+
+// pluginRequest builds a plugin request from an HTTP request: form values
+// and path variables become params, and the session user the owner
+func (s *Server) pluginRequest(r *http.Request) (*plugins.Request, *actions.Plan) {
+	session, _ := s.store.Get(r, "session")
+	username, _ := session.Values["username"].(string)
+	r.ParseForm()
+
+	params := make(map[string]string)
+	for key, values := range r.Form {
+		params[key] = values[0]
+	}
+	for key, value := range mux.Vars(r) {
+		params[key] = value
+	}
+	delete(params, "dry_run")
+	delete(params, "format")
+
+	baseAction := &actions.BaseAction{}
+	baseAction.SetContext(r.Context())
+	baseAction.SetOwner(username)
+	plan := applyDryRun(r, baseAction)
+	return &plugins.Request{Base: baseAction, Params: params}, plan
+}
+
+// handleAPIPlugins lists the loaded plugins, their actions and pages
+func (s *Server) handleAPIPlugins(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	loaded := plugins.Default.Plugins()
+	writeActionResponse(w, r, &actions.Result{
+		Success: true,
+		Message: fmt.Sprintf("%d plugins loaded", len(loaded)),
+		Data: map[string]interface{}{
+			"plugins": loaded,
+			"actions": plugins.Default.Actions(),
+			"pages":   plugins.Default.Pages(),
+			"routes":  plugins.Default.Routes(),
+		},
+	}, nil)
+}
+
+// handleAPIPluginAction runs a plugin action with the form values as params
+func (s *Server) handleAPIPluginAction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	name := vars["plugin"] + "." + vars["action"]
+	action, ok := plugins.Default.Action(name)
+	if !ok {
+		writeActionResponse(w, r, &actions.Result{
+			Success: false,
+			Message: fmt.Sprintf("No plugin action %s", name),
+			Error:   &actions.Error{Kind: actions.ErrNotFound, Msg: "no plugin action " + name},
+		}, nil)
+		return
+	}
+
+	req, plan := s.pluginRequest(r)
+	delete(req.Params, "plugin")
+	delete(req.Params, "action")
+	result := action.Run(req)
+
+	writeActionResponse(w, r, result, plan)
+}
+
+// handlePluginRoute serves an API route that runs a plugin action
+func (s *Server) handlePluginRoute(action *plugins.Action) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		req, plan := s.pluginRequest(r)
+		result := action.Run(req)
+
+		writeActionResponse(w, r, result, plan)
+	}
+}
+
+// PluginPageData is the content of a plugin page
+type PluginPageData struct {
+	Page    *plugins.Page
+	Content template.HTML
+}
+
+// handlePluginPage serves a panel page rendered by a plugin, with the
+// query parameters as params
+func (s *Server) handlePluginPage(page *plugins.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, _ := s.pluginRequest(r)
+		content, err := page.Render(req)
+
+		data := PageData{
+			Title:       page.Title + " - EasyGo Panel",
+			User:        req.Base.Owner(),
+			CurrentPage: page.URL(),
+			Data:        PluginPageData{Page: page, Content: content},
+		}
+		if err != nil {
+			data.Flash = fmt.Sprintf("%s failed: %v", page.Title, err)
+		}
+
+		s.renderTemplate(w, "plugin.html", data)
+	}
+}
@@ -1,11 +1,18 @@
 package web
 
 import (
+	"crypto/rand"
+	"easygo/pkg/actions"
+	"easygo/pkg/config"
+	"easygo/pkg/events"
+	"easygo/pkg/plugins"
 	"embed"
 	"html/template"
 	"io/fs"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
@@ -19,30 +26,57 @@ type Server struct {
 	router   *mux.Router
 	store    *sessions.CookieStore
 	template *template.Template
+	jobs     *jobQueue
 }
 
 // NewServer creates a new web server instance
 func NewServer() *Server {
 	server := &Server{
-		router: mux.NewRouter(),
-		store:  sessions.NewCookieStore([]byte("easygo-secret-key-change-this")),
+		router:   mux.NewRouter(),
+		store:    sessions.NewCookieStore(sessionSecret()),
+		jobs:     newJobQueue(),
 	}
 	
 	// Parse templates
 	var err error
-	server.template, err = template.ParseFS(embedFS, "assets/templates/*.html")
+	server.template, err = template.New("").Funcs(template.FuncMap{
+		"pluginPages": plugins.Default.Pages,
+	}).ParseFS(embedFS, "assets/templates/*.html")
 	if err != nil {
-		log.Fatal("Failed to parse templates:", err)
+		slog.Error("Failed to parse templates", "error", err)
+		os.Exit(1)
+	}
+	
+	if actions.DefaultStore == nil {
+		slog.Warn("State store unavailable, created resources will not be recorded")
 	}
 	
 	server.setupRoutes()
 	return server
 }
 
+// sessionSecret returns the configured session secret. Without one a
+// random secret is generated, so sessions do not survive a restart.
+func sessionSecret() []byte {
+	if secret := config.Current().Web.SessionSecret; secret != "" {
+		return []byte(secret)
+	}
+	
+	slog.Warn("web.session_secret is not set, using a random secret")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		slog.Error("Failed to generate session secret", "error", err)
+		os.Exit(1)
+	}
+	return secret
+}
+
 // Start starts the web server
 func (s *Server) Start(addr string) error {
-	log.Printf("Starting EasyGo Web Panel on %s", addr)
-	return http.ListenAndServe(addr, s.router)
+	s.jobs.start()
+	
+	slog.Info("Starting EasyGo Web Panel", "addr", addr)
+	return http.ListenAndServe(addr, logRequests(s.router))
 }
 
 // setupRoutes configures all the routes
@@ -50,7 +84,8 @@ func (s *Server) setupRoutes() {
 	// Static files
 	staticFS, err := fs.Sub(embedFS, "assets/static")
 	if err != nil {
-		log.Fatal("Failed to create static filesystem:", err)
+		slog.Error("Failed to create static filesystem", "error", err)
+		os.Exit(1)
 	}
 	s.router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.FS(staticFS))))
 	
@@ -81,6 +116,22 @@ func (s *Server) setupRoutes() {
 	// Databases
 	protected.HandleFunc("/databases", s.handleDatabases).Methods("GET", "POST")
 	
+	// Discovery
+	protected.HandleFunc("/discovery", s.handleDiscovery).Methods("GET")
+	
+	// Drift
+	protected.HandleFunc("/drift", s.handleDrift).Methods("GET")
+	
+	// Webhooks
+	protected.HandleFunc("/webhooks", s.handleWebhooks).Methods("GET")
+	
+	// Audit log
+	protected.HandleFunc("/audit", s.handleAudit).Methods("GET")
+	
+	// Jobs
+	protected.HandleFunc("/jobs", s.handleJobs).Methods("GET")
+	protected.HandleFunc("/jobs/{id}", s.handleJob).Methods("GET")
+	
 	// Settings
 	protected.HandleFunc("/settings", s.handleSettings).Methods("GET", "POST")
 	
@@ -92,6 +143,32 @@ func (s *Server) setupRoutes() {
 	api.HandleFunc("/services/{service}/restart", s.handleAPIServiceRestart).Methods("POST")
 	api.HandleFunc("/services/{service}/uninstall", s.handleAPIServiceUninstall).Methods("POST")
 	api.HandleFunc("/system/stats", s.handleAPISystemStats).Methods("GET")
+	api.HandleFunc("/files", s.handleAPIFiles).Methods("GET")
+	api.HandleFunc("/files/versions", s.handleAPIFileVersions).Methods("GET")
+	api.HandleFunc("/files/restore", s.handleAPIFileRestore).Methods("POST")
+	api.HandleFunc("/state/{kind}", s.handleAPIState).Methods("GET")
+	api.HandleFunc("/discovery", s.handleAPIDiscovery).Methods("GET")
+	api.HandleFunc("/discovery/import", s.handleAPIDiscoveryImport).Methods("POST")
+	api.HandleFunc("/vhosts", s.handleAPIVhosts).Methods("GET")
+	api.HandleFunc("/vhosts", s.handleAPIVhostConfigure).Methods("POST")
+	api.HandleFunc("/vhosts/templates", s.handleAPIVhostTemplates).Methods("GET")
+	api.HandleFunc("/vhosts/{server}/{domain}", s.handleAPIVhost).Methods("GET")
+	api.HandleFunc("/vhosts/{server}/{domain}/{action:enable|disable|delete}", s.handleAPIVhostAction).Methods("POST")
+	api.HandleFunc("/certificates", s.handleAPICertificateUpload).Methods("POST")
+	api.HandleFunc("/drift", s.handleAPIDrift).Methods("GET")
+	api.HandleFunc("/drift/adopt", s.handleAPIDriftAdopt).Methods("POST")
+	api.HandleFunc("/drift/rerender", s.handleAPIDriftRerender).Methods("POST")
+	api.HandleFunc("/audit", s.handleAPIAudit).Methods("GET")
+	api.HandleFunc("/jobs", s.handleAPIJobs).Methods("GET")
+	api.HandleFunc("/jobs", s.handleAPIJobEnqueue).Methods("POST")
+	api.HandleFunc("/jobs/{id}", s.handleAPIJob).Methods("GET")
+	api.HandleFunc("/jobs/{id}/stream", s.handleAPIJobStream).Methods("GET")
+	api.HandleFunc("/jobs/{id}/cancel", s.handleAPIJobCancel).Methods("POST")
+	api.HandleFunc("/webhooks/deliveries", s.handleAPIWebhookDeliveries).Methods("GET")
+	api.HandleFunc("/webhooks/deliveries/{id}/redeliver", s.handleAPIWebhookRedeliver).Methods("POST")
+	
+	// Plugins
+	s.setupPluginRoutes(protected, api)
 }
 
 // authMiddleware checks if user is authenticated
@@ -104,14 +181,34 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 		
-		next.ServeHTTP(w, r)
+		// Actions are audited as run from the panel by the session's user
+		username, _ := session.Values["username"].(string)
+		if recorder, ok := w.(*responseRecorder); ok {
+			recorder.user = username
+		}
+		ctx := events.WithOrigin(r.Context(), events.Origin{
+			Interface: events.InterfaceWeb,
+			User:      username,
+			Source:    clientAddress(r),
+		})
+		
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// clientAddress returns the IP address of the client
+func clientAddress(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
 // renderTemplate renders a template with data
 func (s *Server) renderTemplate(w http.ResponseWriter, name string, data interface{}) {
 	err := s.template.ExecuteTemplate(w, name, data)
 	if err != nil {
+		slog.Error("Failed to render template", "template", name, "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,24 @@
+package web
+
+import (
+	"easygo/pkg/actions"
+	"net/http"
+)
+
+// handleAPICertificateUpload installs the PEM certificate chain and key of
+// the certificate and key form values for the domain, and serves its vhost
+// over HTTPS with them
+func (s *Server) handleAPICertificateUpload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	session, _ := s.store.Get(r, "session")
+	username, _ := session.Values["username"].(string)
+
+	sslAction := actions.NewSSLAction()
+	sslAction.SetContext(r.Context())
+	sslAction.SetOwner(username)
+	plan := applyDryRun(r, &sslAction.BaseAction)
+	result := sslAction.UploadCertificate(r.FormValue("domain"), []byte(r.FormValue("certificate")), []byte(r.FormValue("key")))
+
+	writeActionResponse(w, r, result, plan)
+}
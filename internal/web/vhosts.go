@@ -0,0 +1,216 @@
+package web
+
+import (
+	"easygo/pkg/actions"
+	"easygo/pkg/state"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// vhostServers are the web servers listed on the domains page
+var vhostServers = []string{actions.WebServerApache, actions.WebServerNginx}
+
+// handleDomains lists the virtual hosts of both web servers
+func (s *Server) handleDomains(w http.ResponseWriter, r *http.Request) {
+	session, _ := s.store.Get(r, "session")
+	username, _ := session.Values["username"].(string)
+
+	data := PageData{
+		Title:       "Domains - EasyGo Panel",
+		User:        username,
+		CurrentPage: "domains",
+	}
+
+	webAction := actions.NewWebServerAction()
+	webAction.SetContext(r.Context())
+	vhosts := []*actions.Vhost{}
+	var failures []string
+	for _, webServer := range vhostServers {
+		result := webAction.ListVhosts(webServer)
+		if !result.Success {
+			failures = append(failures, result.Message)
+			continue
+		}
+		vhosts = append(vhosts, result.Data.([]*actions.Vhost)...)
+	}
+	data.Data = vhosts
+	data.Flash = strings.Join(failures, "; ")
+
+	s.renderTemplate(w, "domains.html", data)
+}
+
+// handleAPIVhosts lists the virtual hosts of the web server named by the
+// server query parameter, or of both
+func (s *Server) handleAPIVhosts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	webAction := actions.NewWebServerAction()
+	webAction.SetContext(r.Context())
+	if webServer := r.URL.Query().Get("server"); webServer != "" {
+		writeActionResponse(w, r, webAction.ListVhosts(webServer), nil)
+		return
+	}
+
+	vhosts := []*actions.Vhost{}
+	for _, webServer := range vhostServers {
+		result := webAction.ListVhosts(webServer)
+		if !result.Success {
+			writeActionResponse(w, r, result, nil)
+			return
+		}
+		vhosts = append(vhosts, result.Data.([]*actions.Vhost)...)
+	}
+	writeActionResponse(w, r, &actions.Result{
+		Success: true,
+		Message: "Virtual hosts listed",
+		Data:    vhosts,
+	}, nil)
+}
+
+// handleAPIVhost shows a virtual host and its configuration
+func (s *Server) handleAPIVhost(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+
+	webAction := actions.NewWebServerAction()
+	webAction.SetContext(r.Context())
+	result := webAction.ShowVhost(vars["server"], vars["domain"])
+
+	writeActionResponse(w, r, result, nil)
+}
+
+// handleAPIVhostTemplates lists the vhost templates of the web server
+// named by the server query parameter
+func (s *Server) handleAPIVhostTemplates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	webAction := actions.NewWebServerAction()
+	webAction.SetContext(r.Context())
+	result := webAction.ListVhostTemplates(r.URL.Query().Get("server"))
+
+	writeActionResponse(w, r, result, nil)
+}
+
+// handleAPIVhostConfigure creates a virtual host from the server, domain,
+// document_root and template form values, with template variables in
+// var_<name> values, or re-renders an existing one. backend values make a
+// reverse proxy, tuned by the method, max_fails, fail_timeout, websocket,
+// connect_timeout, read_timeout, send_timeout, unbuffered and cache values;
+// hybrid=true puts Nginx in front of Apache rendering the template.
+// https=true serves HTTPS as set by the ciphers, redirect, http2, hsts and
+// ocsp_stapling values, https=false plain HTTP only; without https the
+// recorded settings are kept.
+func (s *Server) handleAPIVhostConfigure(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	session, _ := s.store.Get(r, "session")
+	username, _ := session.Values["username"].(string)
+	r.ParseForm()
+
+	options := &actions.VhostOptions{
+		Template: r.FormValue("template"),
+		Vars:     make(map[string]string),
+		Hybrid:   r.FormValue("hybrid") == "true",
+	}
+	for key := range r.Form {
+		if name := strings.TrimPrefix(key, "var_"); name != key {
+			options.Vars[name] = r.Form.Get(key)
+		}
+	}
+	if backends := r.Form["backend"]; len(backends) > 0 {
+		proxy, err := proxyForm(r, backends)
+		if err != nil {
+			writeActionResponse(w, r, &actions.Result{
+				Success: false,
+				Message: err.Error(),
+				Error:   &actions.Error{Kind: actions.ErrValidationFailed, Msg: "invalid proxy settings", Err: err},
+			}, nil)
+			return
+		}
+		options.Proxy = proxy
+	}
+	switch r.FormValue("https") {
+	case "true":
+		options.TLS = tlsForm(r)
+	case "false":
+		options.NoTLS = true
+	}
+
+	webAction := actions.NewWebServerAction()
+	webAction.SetContext(r.Context())
+	webAction.SetOwner(username)
+	plan := applyDryRun(r, &webAction.BaseAction)
+	result := webAction.ConfigureVhost(r.FormValue("server"), r.FormValue("domain"), r.FormValue("document_root"), options)
+
+	writeActionResponse(w, r, result, plan)
+}
+
+// proxyForm reads the proxy settings of a vhost form
+func proxyForm(r *http.Request, backends []string) (*state.Proxy, error) {
+	proxy := &state.Proxy{
+		Backends:   backends,
+		Method:     r.FormValue("method"),
+		Websocket:  r.FormValue("websocket") == "true",
+		Unbuffered: r.FormValue("unbuffered") == "true",
+		Cache:      r.FormValue("cache"),
+	}
+	for name, value := range map[string]*int{
+		"max_fails":       &proxy.MaxFails,
+		"fail_timeout":    &proxy.FailTimeout,
+		"connect_timeout": &proxy.ConnectTimeout,
+		"read_timeout":    &proxy.ReadTimeout,
+		"send_timeout":    &proxy.SendTimeout,
+	} {
+		if field := r.FormValue(name); field != "" {
+			n, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %q is not a number", name, field)
+			}
+			*value = n
+		}
+	}
+	return proxy, nil
+}
+
+// tlsForm reads the HTTPS settings of a vhost form, where redirect and
+// http2 are on unless set to false
+func tlsForm(r *http.Request) *state.TLS {
+	return &state.TLS{
+		Ciphers:      r.FormValue("ciphers"),
+		NoRedirect:   r.FormValue("redirect") == "false",
+		NoHTTP2:      r.FormValue("http2") == "false",
+		HSTS:         r.FormValue("hsts") == "true",
+		OCSPStapling: r.FormValue("ocsp_stapling") == "true",
+	}
+}
+
+// handleAPIVhostAction enables, disables or deletes a virtual host. Deleting
+// with archive=true archives and removes its document root and logs too.
+func (s *Server) handleAPIVhostAction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+
+	session, _ := s.store.Get(r, "session")
+	username, _ := session.Values["username"].(string)
+
+	webAction := actions.NewWebServerAction()
+	webAction.SetContext(r.Context())
+	webAction.SetOwner(username)
+	plan := applyDryRun(r, &webAction.BaseAction)
+
+	var result *actions.Result
+	switch vars["action"] {
+	case "enable":
+		result = webAction.EnableVhost(vars["server"], vars["domain"])
+	case "disable":
+		result = webAction.DisableVhost(vars["server"], vars["domain"])
+	case "delete":
+		result = webAction.DeleteVhost(vars["server"], vars["domain"], r.FormValue("archive") == "true")
+	}
+
+	writeActionResponse(w, r, result, plan)
+}
@@ -0,0 +1,100 @@
+package web
+
+import (
+	"easygo/pkg/actions"
+	"easygo/pkg/config"
+	"easygo/pkg/events"
+	"easygo/pkg/state"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// webhookDeliveries lists the delivery log, newest first
+func webhookDeliveries() ([]*state.WebhookDelivery, error) {
+	store, err := state.Open(config.Current().Paths.State)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := store.WebhookDeliveries().List()
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(deliveries)-1; i < j; i, j = i+1, j-1 {
+		deliveries[i], deliveries[j] = deliveries[j], deliveries[i]
+	}
+	return deliveries, nil
+}
+
+// handleWebhooks shows the webhook endpoints and the delivery log
+func (s *Server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	session, _ := s.store.Get(r, "session")
+	username, _ := session.Values["username"].(string)
+
+	deliveries, err := webhookDeliveries()
+
+	data := PageData{
+		Title:       "Webhooks - EasyGo Panel",
+		User:        username,
+		CurrentPage: "webhooks",
+		Data: map[string]interface{}{
+			"Endpoints":  config.Current().Webhooks.Endpoints,
+			"Deliveries": deliveries,
+		},
+	}
+	if err != nil {
+		data.Flash = "Failed to read webhook deliveries: " + err.Error()
+	}
+
+	s.renderTemplate(w, "webhooks.html", data)
+}
+
+// handleAPIWebhookDeliveries returns the delivery log, newest first
+func (s *Server) handleAPIWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	deliveries, err := webhookDeliveries()
+	if err != nil {
+		writeActionResponse(w, r, &actions.Result{
+			Success: false,
+			Message: "Failed to read webhook deliveries",
+			Error:   err,
+		}, nil)
+		return
+	}
+
+	writeActionResponse(w, r, &actions.Result{
+		Success: true,
+		Message: fmt.Sprintf("%d deliveries", len(deliveries)),
+		Data:    deliveries,
+	}, nil)
+}
+
+// handleAPIWebhookRedeliver sends a delivery again
+func (s *Server) handleAPIWebhookRedeliver(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	delivery, err := events.Webhooks.Redeliver(id)
+	if err != nil {
+		writeActionResponse(w, r, &actions.Result{
+			Success: false,
+			Message: "Failed to redeliver " + id,
+			Error:   err,
+		}, nil)
+		return
+	}
+
+	// A failed attempt is still a successful request; the delivery says how
+	// it went and the dispatcher retries it
+	message := fmt.Sprintf("Delivered %s to %s", delivery.ID, delivery.URL)
+	if delivery.Status != events.DeliveryDelivered {
+		message = fmt.Sprintf("Delivery %s to %s failed: %s", delivery.ID, delivery.URL, delivery.LastError)
+	}
+	writeActionResponse(w, r, &actions.Result{
+		Success: true,
+		Message: message,
+		Data:    delivery,
+	}, nil)
+}
@@ -1,7 +1,11 @@
 package actions
 
 import (
+	"easygo/pkg/config"
+	"easygo/pkg/state"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,24 +16,26 @@ type BackupAction struct {
 
 // NewBackupAction creates a new backup action instance
 func NewBackupAction() *BackupAction {
-	return &BackupAction{}
+	b := &BackupAction{}
+	// Backups are made by local commands into EasyGo's backup directory,
+	// so they use the local file system even under paths.root
+	b.SetFileSystem(OSFileSystem{})
+	return b
 }
 
-// BackupJob represents a backup job
-type BackupJob struct {
-	ID          string
-	Name        string
-	Type        string // files, database, full
-	Source      string
-	Destination string
-	Schedule    string
-	Enabled     bool
-	LastRun     time.Time
-	Status      string
-}
+// BackupJob represents a backup job as recorded in the state store
+type BackupJob = state.BackupJob
 
 // CreateFileBackup creates a backup of files/directories
-func (b *BackupAction) CreateFileBackup(source, destination, name string) *Result {
+func (b *BackupAction) CreateFileBackup(source, destination, name string) (res *Result) {
+	hook := b.Hook("CreateFileBackup", map[string]string{"source": source, "destination": destination, "name": name})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
+	destination = backupDestination(destination)
+	
 	// Create backup directory if it doesn't exist
 	if !b.DirectoryExists(destination) {
 		createResult := b.CreateDirectory(destination)
@@ -43,11 +49,21 @@ func (b *BackupAction) CreateFileBackup(source, destination, name string) *Resul
 	backupFile := fmt.Sprintf("%s/%s_%s.tar.gz", destination, name, timestamp)
 	
 	// Create tar.gz backup
-	return b.RunCommand("tar", "-czf", backupFile, "-C", source, ".")
+	result := b.RunCommand("tar", "-czf", backupFile, "-C", source, ".")
+	b.recordBackup(result, &BackupJob{Name: name, Type: "files", Source: source, Destination: destination}, backupFile)
+	return result
 }
 
 // CreateDatabaseBackup creates a database backup
-func (b *BackupAction) CreateDatabaseBackup(dbName, dbType, destination string) *Result {
+func (b *BackupAction) CreateDatabaseBackup(dbName, dbType, destination string) (res *Result) {
+	hook := b.Hook("CreateDatabaseBackup", map[string]string{"db_name": dbName, "db_type": dbType, "destination": destination})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
+	destination = backupDestination(destination)
+	
 	// Create backup directory if it doesn't exist
 	if !b.DirectoryExists(destination) {
 		createResult := b.CreateDirectory(destination)
@@ -57,25 +73,36 @@ func (b *BackupAction) CreateDatabaseBackup(dbName, dbType, destination string)
 	}
 	
 	timestamp := time.Now().Format("20060102_150405")
+	backupFile := fmt.Sprintf("%s/%s_%s.sql", destination, dbName, timestamp)
 	
+	var result *Result
 	switch dbType {
 	case "mysql", "mariadb":
-		backupFile := fmt.Sprintf("%s/%s_%s.sql", destination, dbName, timestamp)
-		return b.RunCommand("mysqldump", dbName, ">", backupFile)
+		result = b.RunCommand("mysqldump", dbName, ">", backupFile)
 	case "postgresql":
-		backupFile := fmt.Sprintf("%s/%s_%s.sql", destination, dbName, timestamp)
-		return b.RunCommand("sudo", "-u", "postgres", "pg_dump", dbName, ">", backupFile)
+		result = b.RunCommand("sudo", "-u", "postgres", "pg_dump", dbName, ">", backupFile)
 	default:
 		return &Result{
 			Success: false,
 			Message: fmt.Sprintf("Unsupported database type: %s", dbType),
-			Error:   fmt.Errorf("unsupported database type"),
+			Error:   newError(ErrValidationFailed, "unsupported database type %q", dbType),
 		}
 	}
+	
+	b.recordBackup(result, &BackupJob{Name: dbName, Type: "database", Source: dbType + "/" + dbName, Destination: destination}, backupFile)
+	return result
 }
 
 // CreateFullSystemBackup creates a full system backup
-func (b *BackupAction) CreateFullSystemBackup(destination string) *Result {
+func (b *BackupAction) CreateFullSystemBackup(destination string) (res *Result) {
+	hook := b.Hook("CreateFullSystemBackup", map[string]string{"destination": destination})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
+	destination = backupDestination(destination)
+	
 	// Create backup directory if it doesn't exist
 	if !b.DirectoryExists(destination) {
 		createResult := b.CreateDirectory(destination)
@@ -102,16 +129,25 @@ func (b *BackupAction) CreateFullSystemBackup(destination string) *Result {
 	args := append([]string{"-czf", backupFile}, excludeArgs...)
 	args = append(args, "/")
 	
-	return b.RunCommand("tar", args...)
+	b.reportProgress(5, "Archiving / to "+backupFile)
+	result := b.RunCommand("tar", args...)
+	b.recordBackup(result, &BackupJob{Name: "system_backup", Type: "full", Source: "/", Destination: destination}, backupFile)
+	return result
 }
 
 // RestoreFileBackup restores files from backup
-func (b *BackupAction) RestoreFileBackup(backupFile, destination string) *Result {
+func (b *BackupAction) RestoreFileBackup(backupFile, destination string) (res *Result) {
+	hook := b.Hook("RestoreFileBackup", map[string]string{"backup_file": backupFile, "destination": destination})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	if !b.FileExists(backupFile) {
 		return &Result{
 			Success: false,
 			Message: "Backup file not found",
-			Error:   fmt.Errorf("backup file does not exist"),
+			Error:   newError(ErrNotFound, "backup file %s does not exist", backupFile),
 		}
 	}
 	
@@ -128,24 +164,59 @@ func (b *BackupAction) RestoreFileBackup(backupFile, destination string) *Result
 
 // ListBackups lists available backups
 func (b *BackupAction) ListBackups(backupDir string) *Result {
+	backupDir = backupDestination(backupDir)
+	
 	if !b.DirectoryExists(backupDir) {
 		return &Result{
 			Success: false,
 			Message: "Backup directory not found",
-			Error:   fmt.Errorf("backup directory does not exist"),
+			Error:   newError(ErrNotFound, "backup directory %s does not exist", backupDir),
 		}
 	}
 	
-	return b.RunCommand("ls", "-la", backupDir)
+	// Backups taken by EasyGo are recorded in the state store
+	if store := b.Store(); store != nil {
+		jobs, err := store.BackupJobs().Find(func(job *BackupJob) bool {
+			return job.Schedule == "" && job.Destination == backupDir
+		})
+		if err != nil {
+			return &Result{
+				Success: false,
+				Message: "Failed to read backup records",
+				Error:   err,
+			}
+		}
+		
+		var lines []string
+		for _, job := range jobs {
+			lines = append(lines, fmt.Sprintf("%-4s %-9s %-20s %-10s %s  %s",
+				job.ID, job.Type, job.Name, job.Status, job.LastRun.Format("2006-01-02 15:04:05"), job.Params["file"]))
+		}
+		return &Result{
+			Success: true,
+			Message: fmt.Sprintf("Found %d backups in %s\n%s", len(jobs), backupDir, strings.Join(lines, "\n")),
+			Data:    jobs,
+		}
+	}
+	
+	return b.query("ls", "-la", backupDir)
 }
 
 // CleanOldBackups removes old backup files
-func (b *BackupAction) CleanOldBackups(backupDir string, daysToKeep int) *Result {
+func (b *BackupAction) CleanOldBackups(backupDir string, daysToKeep int) (res *Result) {
+	hook := b.Hook("CleanOldBackups", map[string]string{"backup_dir": backupDir, "days_to_keep": strconv.Itoa(daysToKeep)})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
+	backupDir = backupDestination(backupDir)
+	
 	if !b.DirectoryExists(backupDir) {
 		return &Result{
 			Success: false,
 			Message: "Backup directory not found",
-			Error:   fmt.Errorf("backup directory does not exist"),
+			Error:   newError(ErrNotFound, "backup directory %s does not exist", backupDir),
 		}
 	}
 	
@@ -162,7 +233,13 @@ func (b *BackupAction) CleanOldBackups(backupDir string, daysToKeep int) *Result
 }
 
 // SetupAutomaticBackup sets up automatic backup via cron
-func (b *BackupAction) SetupAutomaticBackup(jobName, schedule, backupType, source, destination string) *Result {
+func (b *BackupAction) SetupAutomaticBackup(jobName, schedule, backupType, source, destination string) (res *Result) {
+	hook := b.Hook("SetupAutomaticBackup", map[string]string{"job_name": jobName, "schedule": schedule, "backup_type": backupType, "source": source, "destination": destination})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	// Create backup script
 	scriptPath := fmt.Sprintf("/opt/easygo/scripts/backup_%s.sh", jobName)
 	
@@ -215,5 +292,41 @@ echo "$(date): Full system backup completed" >> $LOG_FILE
 	cronEntry := fmt.Sprintf("%s %s", schedule, scriptPath)
 	cmd := fmt.Sprintf("(crontab -l 2>/dev/null; echo '%s') | crontab -", cronEntry)
 	
-	return b.RunCommand("bash", "-c", cmd)
+	result := b.RunCommand("bash", "-c", cmd)
+	if result.Success {
+		job := &BackupJob{
+			Name:        jobName,
+			Type:        backupType,
+			Source:      source,
+			Destination: destination,
+			Schedule:    schedule,
+			Enabled:     true,
+			Meta:        b.meta(map[string]string{"script": scriptPath}),
+		}
+		b.record(func(store *state.Store) error {
+			return store.BackupJobs().Put(job)
+		})
+	}
+	return result
+}
+
+// backupDestination returns dir, or the configured backup.dir when empty
+func backupDestination(dir string) string {
+	if dir == "" {
+		return config.Current().Backup.Dir
+	}
+	return dir
+}
+
+// recordBackup records a backup run and its outcome
+func (b *BackupAction) recordBackup(result *Result, job *BackupJob, backupFile string) {
+	job.Meta = b.meta(map[string]string{"file": backupFile})
+	job.LastRun = time.Now()
+	job.Status = "completed"
+	if !result.Success {
+		job.Status = "failed"
+	}
+	b.record(func(store *state.Store) error {
+		return store.BackupJobs().Put(job)
+	})
 }
\ No newline at end of file
@@ -1,9 +1,14 @@
 package actions
 
 import (
+	"context"
+	"easygo/pkg/config"
+	"easygo/pkg/state"
+	"errors"
 	"fmt"
-	"os/exec"
+	"log/slog"
 	"strings"
+	"time"
 )
 
 // Result represents the result of an action
@@ -12,6 +17,7 @@ type Result struct {
 	Message string
 	Error   error
 	Data    interface{}
+	Hooks   []HookRun // hook scripts run around the action
 }
 
 // Service represents a system service
@@ -22,12 +28,157 @@ type Service struct {
 }
 
 // BaseAction provides common functionality for all actions
-type BaseAction struct{}
+type BaseAction struct {
+	runner   CommandRunner
+	ctx      context.Context
+	timeout  time.Duration
+	output   func(line string)
+	progress func(percent int, step string)
+	plan     *Plan
+
+	platform *Platform
+	fsys     FileSystem
+	store    *state.Store
+	owner    string
+}
+
+// SetRunner sets the command runner used by the action
+func (ba *BaseAction) SetRunner(runner CommandRunner) {
+	ba.runner = runner
+}
+
+// Runner returns the command runner used by the action
+func (ba *BaseAction) Runner() CommandRunner {
+	if ba.runner != nil {
+		return ba.runner
+	}
+	return DefaultRunner
+}
+
+// SetContext sets the context that cancels the action's commands
+func (ba *BaseAction) SetContext(ctx context.Context) {
+	ba.ctx = ctx
+}
+
+// Context returns the context the action's commands run under
+func (ba *BaseAction) Context() context.Context {
+	if ba.ctx != nil {
+		return ba.ctx
+	}
+	return context.Background()
+}
+
+// SetTimeout limits how long each command may run. Zero uses the
+// configured commands.timeout.
+func (ba *BaseAction) SetTimeout(timeout time.Duration) {
+	ba.timeout = timeout
+}
+
+// SetOutput sets a callback that receives command output line by line
+func (ba *BaseAction) SetOutput(output func(line string)) {
+	ba.output = output
+}
+
+// SetProgress sets a callback that receives the progress of long-running
+// actions, in percent, with a description of the current step
+func (ba *BaseAction) SetProgress(progress func(percent int, step string)) {
+	ba.progress = progress
+}
+
+// reportProgress passes the progress of the action to its callback, if any
+func (ba *BaseAction) reportProgress(percent int, step string) {
+	if ba.progress != nil {
+		ba.progress(percent, step)
+	}
+}
+
+// SetPlan switches the action to dry-run mode. Commands, file writes and
+// directory creation are recorded in the plan instead of being executed.
+// Passing nil turns dry-run mode off.
+func (ba *BaseAction) SetPlan(plan *Plan) {
+	ba.plan = plan
+}
+
+// DryRun reports whether the action only records planned operations
+func (ba *BaseAction) DryRun() bool {
+	return ba.plan != nil
+}
 
 // RunCommand executes a system command
 func (ba *BaseAction) RunCommand(command string, args ...string) *Result {
-	cmd := exec.Command(command, args...)
-	output, err := cmd.CombinedOutput()
+	cmd := Command{Name: command, Args: args, Output: ba.output}
+	if ba.plan != nil {
+		ba.plan.add(PlannedOperation{Kind: PlanCommand, Command: cmd.String()})
+		return &Result{
+			Success: true,
+			Message: "[dry-run] " + cmd.String(),
+		}
+	}
+	return ba.run(cmd)
+}
+
+// RunCommandInput executes a system command with input on stdin. Use it
+// for secrets such as passwords in SQL: unlike arguments, the input shows
+// up neither in the process list nor in plans and logs.
+func (ba *BaseAction) RunCommandInput(input, command string, args ...string) *Result {
+	cmd := Command{Name: command, Args: args, Stdin: input, Output: ba.output}
+	if ba.plan != nil {
+		ba.plan.add(PlannedOperation{Kind: PlanCommand, Command: cmd.String() + " < [input withheld]"})
+		return &Result{
+			Success: true,
+			Message: "[dry-run] " + cmd.String(),
+		}
+	}
+	return ba.run(cmd)
+}
+
+// query runs a read-only command. Queries run even in dry-run mode so
+// that the plan follows the same branches a real run would.
+func (ba *BaseAction) query(command string, args ...string) *Result {
+	return ba.run(Command{Name: command, Args: args})
+}
+
+// exec runs a command through the action's runner, applying the
+// action's context and timeout
+func (ba *BaseAction) exec(cmd Command) ([]byte, error) {
+	ctx := ba.Context()
+	timeout := ba.timeout
+	if timeout == 0 {
+		timeout = config.Current().Commands.Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Arguments may hold secrets, such as SQL setting a password, so only
+	// the command's name is logged
+	slog.DebugContext(ctx, "Running command", "command", cmd.Name)
+	started := time.Now()
+	output, err := ba.Runner().Run(ctx, cmd)
+	if err != nil {
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			err = fmt.Errorf("timed out after %s: %w", timeout, context.DeadlineExceeded)
+		case errors.Is(ctx.Err(), context.Canceled):
+			err = fmt.Errorf("cancelled: %w", context.Canceled)
+		}
+		// A command error names the whole command line, so only its cause
+		// is logged
+		cause := err
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) {
+			cause = cmdErr.Err
+		}
+		slog.DebugContext(ctx, "Command failed", "command", cmd.Name, "duration_ms", time.Since(started).Milliseconds(), "error", cause)
+	}
+	return output, commandError(cmd, "", err)
+}
+
+// run executes a command and wraps its outcome in a Result
+func (ba *BaseAction) run(cmd Command) *Result {
+	output, err := ba.exec(cmd)
 	
 	if err != nil {
 		return &Result{
@@ -46,17 +197,40 @@ func (ba *BaseAction) RunCommand(command string, args ...string) *Result {
 
 // ServiceStatus checks the status of a service
 func (ba *BaseAction) ServiceStatus(serviceName string) *Result {
-	result := ba.RunCommand("systemctl", "is-active", serviceName)
-	if result.Error != nil {
-		return result
-	}
+	var status string
+	var enabled bool
 	
-	enabledResult := ba.RunCommand("systemctl", "is-enabled", serviceName)
-	enabled := enabledResult.Success && strings.TrimSpace(enabledResult.Message) == "enabled"
+	switch ba.Platform().InitSystem {
+	case InitSystemd:
+		result := ba.query("systemctl", "is-active", serviceName)
+		if result.Error != nil {
+			return result
+		}
+		status = strings.TrimSpace(result.Message)
+		
+		enabledResult := ba.query("systemctl", "is-enabled", serviceName)
+		enabled = enabledResult.Success && strings.TrimSpace(enabledResult.Message) == "enabled"
+	case InitOpenRC:
+		result := ba.query("rc-service", serviceName, "status")
+		if result.Error != nil {
+			return result
+		}
+		status = "active"
+		
+		enabledResult := ba.query("rc-update", "show", "default")
+		enabled = enabledResult.Success && strings.Contains(enabledResult.Message, serviceName+" ")
+	default:
+		result := ba.query("service", serviceName, "status")
+		if result.Error != nil {
+			return result
+		}
+		status = "active"
+		enabled = ba.sysvEnabled(serviceName)
+	}
 	
 	service := &Service{
 		Name:    serviceName,
-		Status:  strings.TrimSpace(result.Message),
+		Status:  status,
 		Enabled: enabled,
 	}
 	
@@ -67,66 +241,168 @@ func (ba *BaseAction) ServiceStatus(serviceName string) *Result {
 	}
 }
 
+// sysvEnabled reports whether a SysV init service is started in runlevel
+// 2, by an S<nn><service> link in /etc/rc2.d
+func (ba *BaseAction) sysvEnabled(serviceName string) bool {
+	entries, err := ba.FileSystem().ReadDir("/etc/rc2.d")
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if len(name) == len(serviceName)+3 && name[0] == 'S' && name[3:] == serviceName {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceCommand runs a service control operation (start, stop, restart,
+// reload, enable or disable) using the platform's init system. Its hooks
+// are those of the public method, e.g. StartService.
+func (ba *BaseAction) serviceCommand(operation, serviceName string) (res *Result) {
+	hook := ba.Hook(strings.ToUpper(operation[:1])+operation[1:]+"Service", map[string]string{"service": serviceName})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
+	switch ba.Platform().InitSystem {
+	case InitOpenRC:
+		switch operation {
+		case "enable":
+			return ba.RunCommand("rc-update", "add", serviceName, "default")
+		case "disable":
+			return ba.RunCommand("rc-update", "del", serviceName, "default")
+		}
+		return ba.RunCommand("rc-service", serviceName, operation)
+	case InitSysVinit:
+		switch operation {
+		case "enable":
+			return ba.RunCommand("update-rc.d", serviceName, "defaults")
+		case "disable":
+			return ba.RunCommand("update-rc.d", serviceName, "remove")
+		}
+		return ba.RunCommand("service", serviceName, operation)
+	}
+	return ba.RunCommand("systemctl", operation, serviceName)
+}
+
 // StartService starts a system service
 func (ba *BaseAction) StartService(serviceName string) *Result {
-	return ba.RunCommand("systemctl", "start", serviceName)
+	return ba.serviceCommand("start", serviceName)
 }
 
 // StopService stops a system service
 func (ba *BaseAction) StopService(serviceName string) *Result {
-	return ba.RunCommand("systemctl", "stop", serviceName)
+	return ba.serviceCommand("stop", serviceName)
 }
 
 // EnableService enables a system service
 func (ba *BaseAction) EnableService(serviceName string) *Result {
-	return ba.RunCommand("systemctl", "enable", serviceName)
+	return ba.serviceCommand("enable", serviceName)
 }
 
 // DisableService disables a system service
 func (ba *BaseAction) DisableService(serviceName string) *Result {
-	return ba.RunCommand("systemctl", "disable", serviceName)
+	return ba.serviceCommand("disable", serviceName)
 }
 
 // RestartService restarts a system service
 func (ba *BaseAction) RestartService(serviceName string) *Result {
-	return ba.RunCommand("systemctl", "restart", serviceName)
+	return ba.serviceCommand("restart", serviceName)
 }
 
 // ReloadService reloads a system service
 func (ba *BaseAction) ReloadService(serviceName string) *Result {
-	return ba.RunCommand("systemctl", "reload", serviceName)
+	return ba.serviceCommand("reload", serviceName)
 }
 
 // FileExists checks if a file exists
 func (ba *BaseAction) FileExists(path string) bool {
-	result := ba.RunCommand("test", "-f", path)
-	return result.Success
+	info, err := ba.FileSystem().Stat(path)
+	return err == nil && info.Mode().IsRegular()
 }
 
 // DirectoryExists checks if a directory exists
 func (ba *BaseAction) DirectoryExists(path string) bool {
-	result := ba.RunCommand("test", "-d", path)
+	info, err := ba.FileSystem().Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// LocalFileExists checks if a file exists where commands run, even under
+// paths.root: programs and package sources, which local commands use
+func (ba *BaseAction) LocalFileExists(path string) bool {
+	result := ba.query("test", "-f", path)
 	return result.Success
 }
 
 // CreateDirectory creates a directory
 func (ba *BaseAction) CreateDirectory(path string) *Result {
-	return ba.RunCommand("mkdir", "-p", path)
+	if ba.plan != nil {
+		ba.plan.add(PlannedOperation{Kind: PlanMkdir, Path: path})
+		return &Result{
+			Success: true,
+			Message: "[dry-run] mkdir " + path,
+		}
+	}
+	if err := ba.FileSystem().MkdirAll(path); err != nil {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("Failed to create %s", path),
+			Error:   err,
+		}
+	}
+	return &Result{
+		Success: true,
+		Message: "Directory created successfully",
+	}
+}
+
+// Symlink creates or replaces a symbolic link
+func (ba *BaseAction) Symlink(target, link string) *Result {
+	if ba.plan != nil {
+		cmd := Command{Name: "ln", Args: []string{"-sfn", target, link}}
+		ba.plan.add(PlannedOperation{Kind: PlanCommand, Command: cmd.String()})
+		return &Result{
+			Success: true,
+			Message: "[dry-run] " + cmd.String(),
+		}
+	}
+	if err := ba.FileSystem().Symlink(target, link); err != nil {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("Failed to link %s to %s", link, target),
+			Error:   err,
+		}
+	}
+	return &Result{
+		Success: true,
+		Message: "Link created successfully",
+	}
 }
 
-// WriteFile writes content to a file
+// WriteFile atomically writes content to a file, keeping the previous
+// version in the backup directory and recording the new content's hash
+// for drift detection
 func (ba *BaseAction) WriteFile(path, content string) *Result {
-	cmd := exec.Command("tee", path)
-	cmd.Stdin = strings.NewReader(content)
-	output, err := cmd.CombinedOutput()
+	if ba.plan != nil {
+		ba.plan.add(PlannedOperation{Kind: PlanWriteFile, Path: path, Content: content})
+		return &Result{
+			Success: true,
+			Message: "[dry-run] write " + path,
+		}
+	}
 	
-	if err != nil {
+	path = ba.resolvePath(path)
+	if err := ba.writeFileVersioned(path, []byte(content)); err != nil {
 		return &Result{
 			Success: false,
-			Message: string(output),
+			Message: fmt.Sprintf("Failed to write %s", path),
 			Error:   err,
 		}
 	}
+	ba.recordManagedFile(path, content)
 	
 	return &Result{
 		Success: true,
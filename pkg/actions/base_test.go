@@ -0,0 +1,40 @@
+package actions
+
+import (
+	"testing"
+)
+
+func TestServiceStatusSysVinit(t *testing.T) {
+	action := &BaseAction{}
+	runner := fakeSystem(t, action)
+	platform := ParseOSRelease("ID=debian\nVERSION_ID=12\n")
+	platform.InitSystem = InitSysVinit
+	action.SetPlatform(platform)
+	if err := action.FileSystem().Symlink("../init.d/nginx", "/etc/rc2.d/S01nginx"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		service string
+		enabled bool
+	}{
+		{service: "nginx", enabled: true},
+		{service: "apache2", enabled: false},
+		{service: "nginx; touch /tmp/owned", enabled: false},
+	}
+	for _, tt := range tests {
+		runner.Expect("service", tt.service, "status")
+		result := action.ServiceStatus(tt.service)
+		if !result.Success {
+			t.Fatalf("%s: error = %v", tt.service, result.Error)
+		}
+		if enabled := result.Data.(*Service).Enabled; enabled != tt.enabled {
+			t.Errorf("%s: enabled = %v, want %v", tt.service, enabled, tt.enabled)
+		}
+	}
+	checkCalls(t, runner, []string{
+		"service nginx status",
+		"service apache2 status",
+		"service nginx; touch /tmp/owned status",
+	})
+}
@@ -1,9 +1,10 @@
 package actions
 
 import (
+	"easygo/pkg/state"
 	"fmt"
+	"os/user"
 	"strings"
-	"time"
 )
 
 // CronAction handles cron job management
@@ -16,32 +17,23 @@ func NewCronAction() *CronAction {
 	return &CronAction{}
 }
 
-// CronJob represents a cron job
-type CronJob struct {
-	ID          string
-	Schedule    string
-	Command     string
-	User        string
-	Description string
-	Enabled     bool
-	LastRun     time.Time
-	NextRun     time.Time
-}
+// CronJob represents a cron job as recorded in the state store
+type CronJob = state.CronJob
 
 // ListCronJobs lists all cron jobs for the current user
 func (c *CronAction) ListCronJobs() *Result {
-	return c.RunCommand("crontab", "-l")
+	return c.query("crontab", "-l")
 }
 
 // ListSystemCronJobs lists system-wide cron jobs
 func (c *CronAction) ListSystemCronJobs() *Result {
-	result := c.RunCommand("cat", "/etc/crontab")
+	result := c.query("cat", "/etc/crontab")
 	if !result.Success {
 		return result
 	}
 	
 	// Also check /etc/cron.d/ directory
-	cronDResult := c.RunCommand("ls", "-la", "/etc/cron.d/")
+	cronDResult := c.query("ls", "-la", "/etc/cron.d/")
 	if cronDResult.Success {
 		result.Message += "\n\n--- /etc/cron.d/ ---\n" + cronDResult.Message
 	}
@@ -50,13 +42,32 @@ func (c *CronAction) ListSystemCronJobs() *Result {
 }
 
 // AddCronJob adds a new cron job
-func (c *CronAction) AddCronJob(schedule, command, description string) *Result {
+func (c *CronAction) AddCronJob(schedule, command, description string) (res *Result) {
+	hook := c.Hook("AddCronJob", map[string]string{"schedule": schedule, "command": command, "description": description})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	// Validate cron schedule format (basic validation)
 	if !c.isValidCronSchedule(schedule) {
 		return &Result{
 			Success: false,
 			Message: "Invalid cron schedule format",
-			Error:   fmt.Errorf("invalid schedule format"),
+			Error:   newError(ErrValidationFailed, "invalid schedule format %q", schedule),
+		}
+	}
+	
+	// Refuse to add the same job twice
+	if current := c.query("crontab", "-l"); current.Success {
+		for _, line := range strings.Split(current.Message, "\n") {
+			if strings.TrimSpace(line) == schedule+" "+command {
+				return &Result{
+					Success: false,
+					Message: "Cron job already exists",
+					Error:   newError(ErrConflict, "cron job %q already exists", schedule+" "+command),
+				}
+			}
 		}
 	}
 	
@@ -70,18 +81,38 @@ func (c *CronAction) AddCronJob(schedule, command, description string) *Result {
 	
 	// Add to crontab
 	cmd := fmt.Sprintf("(crontab -l 2>/dev/null; echo '%s') | crontab -", cronEntry)
-	return c.RunCommand("bash", "-c", cmd)
+	result := c.RunCommand("bash", "-c", cmd)
+	if result.Success {
+		job := &CronJob{
+			Schedule:    schedule,
+			Command:     command,
+			User:        crontabUser(),
+			Description: description,
+			Enabled:     true,
+			Meta:        c.meta(nil),
+		}
+		c.record(func(store *state.Store) error {
+			return store.CronJobs().Put(job)
+		})
+	}
+	return result
 }
 
 // RemoveCronJob removes a cron job by matching the command
-func (c *CronAction) RemoveCronJob(command string) *Result {
+func (c *CronAction) RemoveCronJob(command string) (res *Result) {
+	hook := c.Hook("RemoveCronJob", map[string]string{"command": command})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	// Get current crontab
-	currentResult := c.RunCommand("crontab", "-l")
+	currentResult := c.query("crontab", "-l")
 	if !currentResult.Success {
 		return &Result{
 			Success: false,
 			Message: "No crontab found",
-			Error:   fmt.Errorf("no crontab exists"),
+			Error:   newError(ErrNotFound, "no crontab exists"),
 		}
 	}
 	
@@ -99,45 +130,58 @@ func (c *CronAction) RemoveCronJob(command string) *Result {
 	newCrontab := strings.Join(filteredLines, "\n")
 	cmd := fmt.Sprintf("echo '%s' | crontab -", newCrontab)
 	
-	return c.RunCommand("bash", "-c", cmd)
+	result := c.RunCommand("bash", "-c", cmd)
+	if result.Success {
+		c.record(func(store *state.Store) error {
+			jobs, err := store.CronJobs().Find(func(job *CronJob) bool {
+				return job.User == crontabUser() && strings.Contains(job.Command, command)
+			})
+			if err != nil {
+				return err
+			}
+			for _, job := range jobs {
+				if err := store.CronJobs().Delete(job.ID); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return result
+}
+
+// crontabUser returns the user whose crontab the cron commands edit
+func crontabUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
 }
 
 // EnableCronService enables the cron service
 func (c *CronAction) EnableCronService() *Result {
-	// Enable cron service (varies by system)
-	enableResult := c.EnableService("cron")
-	if !enableResult.Success {
-		// Try alternative service names
-		enableResult = c.EnableService("crond")
-	}
-	
-	return enableResult
+	// Service name varies by system (cron, crond)
+	return c.EnableService(c.Platform().CronService)
 }
 
 // StartCronService starts the cron service
 func (c *CronAction) StartCronService() *Result {
-	startResult := c.StartService("cron")
-	if !startResult.Success {
-		// Try alternative service names
-		startResult = c.StartService("crond")
-	}
-	
-	return startResult
+	return c.StartService(c.Platform().CronService)
 }
 
 // GetCronStatus gets the status of the cron service
 func (c *CronAction) GetCronStatus() *Result {
-	statusResult := c.ServiceStatus("cron")
-	if !statusResult.Success {
-		// Try alternative service names
-		statusResult = c.ServiceStatus("crond")
-	}
-	
-	return statusResult
+	return c.ServiceStatus(c.Platform().CronService)
 }
 
 // AddSystemCronJob adds a system-wide cron job
-func (c *CronAction) AddSystemCronJob(name, schedule, user, command, description string) *Result {
+func (c *CronAction) AddSystemCronJob(name, schedule, user, command, description string) (res *Result) {
+	hook := c.Hook("AddSystemCronJob", map[string]string{"name": name, "schedule": schedule, "user": user, "command": command, "description": description})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	cronFile := fmt.Sprintf("/etc/cron.d/%s", name)
 	
 	cronContent := fmt.Sprintf(`# %s
@@ -148,9 +192,15 @@ func (c *CronAction) AddSystemCronJob(name, schedule, user, command, description
 }
 
 // RemoveSystemCronJob removes a system-wide cron job
-func (c *CronAction) RemoveSystemCronJob(name string) *Result {
+func (c *CronAction) RemoveSystemCronJob(name string) (res *Result) {
+	hook := c.Hook("RemoveSystemCronJob", map[string]string{"name": name})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	cronFile := fmt.Sprintf("/etc/cron.d/%s", name)
-	return c.RunCommand("rm", "-f", cronFile)
+	return c.RemoveFile(cronFile)
 }
 
 // AddDailyCronJob adds a job to run daily
@@ -172,7 +222,13 @@ func (c *CronAction) AddMonthlyCronJob(day, hour, minute int, command, descripti
 }
 
 // SetupLogRotation sets up log rotation for EasyGo Panel
-func (c *CronAction) SetupLogRotation() *Result {
+func (c *CronAction) SetupLogRotation() (res *Result) {
+	hook := c.Hook("SetupLogRotation", nil)
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	logRotateConfig := `/var/log/easygo/*.log {
     daily
     rotate 30
@@ -190,7 +246,13 @@ func (c *CronAction) SetupLogRotation() *Result {
 }
 
 // SetupSystemMaintenance sets up basic system maintenance cron jobs
-func (c *CronAction) SetupSystemMaintenance() *Result {
+func (c *CronAction) SetupSystemMaintenance() (res *Result) {
+	hook := c.Hook("SetupSystemMaintenance", nil)
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	// Add system update check (weekly)
 	updateCheckResult := c.AddWeeklyCronJob(0, 2, 0, "/usr/bin/apt update && /usr/bin/apt list --upgradable", "Weekly system update check")
 	if !updateCheckResult.Success {
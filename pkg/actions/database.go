@@ -1,8 +1,9 @@
 package actions
 
 import (
+	"easygo/pkg/state"
 	"fmt"
-	"time"
+	"strings"
 )
 
 // DatabaseAction handles database management
@@ -15,80 +16,166 @@ func NewDatabaseAction() *DatabaseAction {
 	return &DatabaseAction{}
 }
 
-// Database represents a database
-type Database struct {
-	Name     string
-	Type     string // mysql, mariadb, postgresql
-	Size     string
-	User     string
-	Created  time.Time
-	Status   string
-}
+// Database represents a database as recorded in the state store
+type Database = state.Database
 
 // InstallMariaDB installs MariaDB server
-func (d *DatabaseAction) InstallMariaDB() *Result {
-	if d.FileExists("/usr/bin/apt") {
-		return d.installMariaDBDebian()
-	} else if d.FileExists("/usr/bin/yum") || d.FileExists("/usr/bin/dnf") {
-		return d.installMariaDBRHEL()
+func (d *DatabaseAction) InstallMariaDB() (res *Result) {
+	hook := d.Hook("InstallMariaDB", nil)
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
+	pm := d.PackageManager()
+	if pm == nil {
+		return unsupportedPlatform()
+	}
+	
+	updateResult := pm.Update()
+	if !updateResult.Success {
+		return updateResult
+	}
+	
+	installResult := pm.Install(ResolvePackages(pm, "", "mariadb")...)
+	if !installResult.Success {
+		return installResult
 	}
 	
-	return &Result{
-		Success: false,
-		Message: "Unsupported Linux distribution",
-		Error:   fmt.Errorf("unsupported package manager"),
+	// Start and enable MariaDB
+	d.EnableService("mariadb")
+	startResult := d.StartService("mariadb")
+	if !startResult.Success {
+		return startResult
 	}
+	
+	// Secure installation
+	return d.secureMariaDBInstallation()
 }
 
 // InstallPostgreSQL installs PostgreSQL server
-func (d *DatabaseAction) InstallPostgreSQL() *Result {
-	if d.FileExists("/usr/bin/apt") {
-		return d.installPostgreSQLDebian()
-	} else if d.FileExists("/usr/bin/yum") || d.FileExists("/usr/bin/dnf") {
-		return d.installPostgreSQLRHEL()
+func (d *DatabaseAction) InstallPostgreSQL() (res *Result) {
+	hook := d.Hook("InstallPostgreSQL", nil)
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
+	pm := d.PackageManager()
+	if pm == nil {
+		return unsupportedPlatform()
+	}
+	
+	updateResult := pm.Update()
+	if !updateResult.Success {
+		return updateResult
+	}
+	
+	installResult := pm.Install(ResolvePackages(pm, "", "postgresql")...)
+	if !installResult.Success {
+		return installResult
 	}
 	
-	return &Result{
-		Success: false,
-		Message: "Unsupported Linux distribution",
-		Error:   fmt.Errorf("unsupported package manager"),
+	// RHEL packages do not initialize the database cluster
+	if pm.Name() == "dnf" || pm.Name() == "yum" {
+		initResult := d.RunCommand("postgresql-setup", "initdb")
+		if !initResult.Success {
+			return initResult
+		}
 	}
+	
+	// Start and enable PostgreSQL
+	d.EnableService("postgresql")
+	return d.StartService("postgresql")
 }
 
 // CreateDatabase creates a new database
-func (d *DatabaseAction) CreateDatabase(name, dbType, username, password string) *Result {
+func (d *DatabaseAction) CreateDatabase(name, dbType, username, password string) (res *Result) {
+	hook := d.Hook("CreateDatabase", map[string]string{"name": name, "db_type": dbType, "username": username})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
+	var result *Result
 	switch dbType {
 	case "mysql", "mariadb":
-		return d.createMySQLDatabase(name, username, password)
+		result = d.createMySQLDatabase(name, username, password)
 	case "postgresql":
-		return d.createPostgreSQLDatabase(name, username, password)
+		result = d.createPostgreSQLDatabase(name, username, password)
 	default:
 		return &Result{
 			Success: false,
 			Message: fmt.Sprintf("Unsupported database type: %s", dbType),
-			Error:   fmt.Errorf("unsupported database type"),
+			Error:   newError(ErrValidationFailed, "unsupported database type %q", dbType),
 		}
 	}
+	
+	if result.Success {
+		database := &Database{Name: name, Type: dbType, User: username, Meta: d.meta(nil)}
+		d.record(func(store *state.Store) error {
+			return store.Databases().Put(database)
+		})
+	}
+	return result
 }
 
 // DropDatabase drops a database
-func (d *DatabaseAction) DropDatabase(name, dbType string) *Result {
+func (d *DatabaseAction) DropDatabase(name, dbType string) (res *Result) {
+	hook := d.Hook("DropDatabase", map[string]string{"name": name, "db_type": dbType})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
+	var result *Result
 	switch dbType {
 	case "mysql", "mariadb":
-		return d.dropMySQLDatabase(name)
+		result = d.dropMySQLDatabase(name)
 	case "postgresql":
-		return d.dropPostgreSQLDatabase(name)
+		result = d.dropPostgreSQLDatabase(name)
 	default:
 		return &Result{
 			Success: false,
 			Message: fmt.Sprintf("Unsupported database type: %s", dbType),
-			Error:   fmt.Errorf("unsupported database type"),
+			Error:   newError(ErrValidationFailed, "unsupported database type %q", dbType),
 		}
 	}
+	
+	if result.Success {
+		d.record(func(store *state.Store) error {
+			return store.Databases().Delete((&Database{Name: name, Type: dbType}).Key())
+		})
+	}
+	return result
 }
 
-// ListDatabases lists all databases
+// ListDatabases lists the databases EasyGo created, or all databases on
+// the server when there is no state store
 func (d *DatabaseAction) ListDatabases(dbType string) *Result {
+	if store := d.Store(); store != nil {
+		databases, err := store.Databases().Find(func(database *Database) bool {
+			return database.Type == dbType
+		})
+		if err != nil {
+			return &Result{
+				Success: false,
+				Message: "Failed to read database records",
+				Error:   err,
+			}
+		}
+		
+		var lines []string
+		for _, database := range databases {
+			lines = append(lines, fmt.Sprintf("%-30s %-20s %s", database.Name, database.User, database.CreatedAt.Format("2006-01-02 15:04")))
+		}
+		return &Result{
+			Success: true,
+			Message: fmt.Sprintf("Found %d %s databases\n%s", len(databases), dbType, strings.Join(lines, "\n")),
+			Data:    databases,
+		}
+	}
+	
 	switch dbType {
 	case "mysql", "mariadb":
 		return d.listMySQLDatabases()
@@ -98,13 +185,19 @@ func (d *DatabaseAction) ListDatabases(dbType string) *Result {
 		return &Result{
 			Success: false,
 			Message: fmt.Sprintf("Unsupported database type: %s", dbType),
-			Error:   fmt.Errorf("unsupported database type"),
+			Error:   newError(ErrValidationFailed, "unsupported database type %q", dbType),
 		}
 	}
 }
 
 // BackupDatabase creates a backup of a database
-func (d *DatabaseAction) BackupDatabase(name, dbType, backupPath string) *Result {
+func (d *DatabaseAction) BackupDatabase(name, dbType, backupPath string) (res *Result) {
+	hook := d.Hook("BackupDatabase", map[string]string{"name": name, "db_type": dbType, "backup_path": backupPath})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	switch dbType {
 	case "mysql", "mariadb":
 		return d.backupMySQLDatabase(name, backupPath)
@@ -114,13 +207,19 @@ func (d *DatabaseAction) BackupDatabase(name, dbType, backupPath string) *Result
 		return &Result{
 			Success: false,
 			Message: fmt.Sprintf("Unsupported database type: %s", dbType),
-			Error:   fmt.Errorf("unsupported database type"),
+			Error:   newError(ErrValidationFailed, "unsupported database type %q", dbType),
 		}
 	}
 }
 
 // RestoreDatabase restores a database from backup
-func (d *DatabaseAction) RestoreDatabase(name, dbType, backupPath string) *Result {
+func (d *DatabaseAction) RestoreDatabase(name, dbType, backupPath string) (res *Result) {
+	hook := d.Hook("RestoreDatabase", map[string]string{"name": name, "db_type": dbType, "backup_path": backupPath})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	switch dbType {
 	case "mysql", "mariadb":
 		return d.restoreMySQLDatabase(name, backupPath)
@@ -130,92 +229,75 @@ func (d *DatabaseAction) RestoreDatabase(name, dbType, backupPath string) *Resul
 		return &Result{
 			Success: false,
 			Message: fmt.Sprintf("Unsupported database type: %s", dbType),
-			Error:   fmt.Errorf("unsupported database type"),
+			Error:   newError(ErrValidationFailed, "unsupported database type %q", dbType),
 		}
 	}
 }
 
 // InstallPHPMyAdmin installs phpMyAdmin
-func (d *DatabaseAction) InstallPHPMyAdmin() *Result {
-	if d.FileExists("/usr/bin/apt") {
-		// Pre-configure phpMyAdmin for automatic installation
-		d.RunCommand("echo", "phpmyadmin", "phpmyadmin/dbconfig-install", "boolean", "true", "|", "debconf-set-selections")
-		d.RunCommand("echo", "phpmyadmin", "phpmyadmin/app-password-confirm", "password", "admin", "|", "debconf-set-selections")
-		d.RunCommand("echo", "phpmyadmin", "phpmyadmin/mysql/admin-pass", "password", "", "|", "debconf-set-selections")
-		d.RunCommand("echo", "phpmyadmin", "phpmyadmin/reconfigure-webserver", "multiselect", "apache2", "|", "debconf-set-selections")
-		
-		return d.RunCommand("apt", "install", "-y", "phpmyadmin", "php-mbstring", "php-zip", "php-gd", "php-json", "php-curl")
-	}
-	
-	return &Result{
-		Success: false,
-		Message: "Manual phpMyAdmin installation required for this distribution",
-		Error:   fmt.Errorf("automatic installation not supported"),
-	}
-}
-
-// Private helper methods for MariaDB/MySQL
-
-func (d *DatabaseAction) installMariaDBDebian() *Result {
-	updateResult := d.RunCommand("apt", "update")
-	if !updateResult.Success {
-		return updateResult
+func (d *DatabaseAction) InstallPHPMyAdmin() (res *Result) {
+	hook := d.Hook("InstallPHPMyAdmin", nil)
+	if failed := hook.Pre(); failed != nil {
+		return failed
 	}
+	defer hook.Post(&res)
 	
-	installResult := d.RunCommand("apt", "install", "-y", "mariadb-server", "mariadb-client")
-	if !installResult.Success {
-		return installResult
+	pm := d.PackageManager()
+	if pm == nil || pm.Name() != "apt" {
+		return &Result{
+			Success: false,
+			Message: "Manual phpMyAdmin installation required for this distribution",
+			Error:   newError(ErrUnsupportedPlatform, "automatic installation not supported"),
+		}
 	}
 	
-	// Start and enable MariaDB
-	d.EnableService("mariadb")
-	startResult := d.StartService("mariadb")
-	if !startResult.Success {
-		return startResult
-	}
+	// Pre-configure phpMyAdmin for automatic installation
+	d.RunCommand("echo", "phpmyadmin", "phpmyadmin/dbconfig-install", "boolean", "true", "|", "debconf-set-selections")
+	d.RunCommand("echo", "phpmyadmin", "phpmyadmin/app-password-confirm", "password", "admin", "|", "debconf-set-selections")
+	d.RunCommand("echo", "phpmyadmin", "phpmyadmin/mysql/admin-pass", "password", "", "|", "debconf-set-selections")
+	d.RunCommand("echo", "phpmyadmin", "phpmyadmin/reconfigure-webserver", "multiselect", "apache2", "|", "debconf-set-selections")
 	
-	// Secure installation
-	return d.secureMariaDBInstallation()
+	return pm.Install(ResolvePackages(pm, "", "phpmyadmin")...)
 }
 
-func (d *DatabaseAction) installMariaDBRHEL() *Result {
-	var installCmd string
-	if d.FileExists("/usr/bin/dnf") {
-		installCmd = "dnf"
-	} else {
-		installCmd = "yum"
-	}
-	
-	installResult := d.RunCommand(installCmd, "install", "-y", "mariadb-server", "mariadb")
-	if !installResult.Success {
-		return installResult
-	}
-	
-	// Start and enable MariaDB
-	d.EnableService("mariadb")
-	startResult := d.StartService("mariadb")
-	if !startResult.Success {
-		return startResult
-	}
-	
-	return d.secureMariaDBInstallation()
-}
+// Private helper methods for MariaDB/MySQL
 
 func (d *DatabaseAction) secureMariaDBInstallation() *Result {
 	// This is a simplified version - in production, you'd want proper security setup
-	return d.RunCommand("mysql", "-e", "UPDATE mysql.user SET Password=PASSWORD('rootpassword') WHERE User='root'; FLUSH PRIVILEGES;")
+	return d.RunCommandInput("UPDATE mysql.user SET Password=PASSWORD('rootpassword') WHERE User='root'; FLUSH PRIVILEGES;", "mysql")
 }
 
 func (d *DatabaseAction) createMySQLDatabase(name, username, password string) *Result {
-	// Create database
-	createDBResult := d.RunCommand("mysql", "-e", fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s;", name))
+	tx := d.Begin(fmt.Sprintf("database %s with user %s", name, username))
+	
+	// Create database, dropping it again on failure unless it already existed
+	var undoDB []string
+	if !d.mysqlExists(fmt.Sprintf("SHOW DATABASES LIKE '%s';", name)) {
+		undoDB = []string{"mysql", "-e", fmt.Sprintf("DROP DATABASE IF EXISTS %s;", name)}
+	}
+	createDBResult := tx.Run(undoDB, "mysql", "-e", fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s;", name))
 	if !createDBResult.Success {
 		return createDBResult
 	}
 	
-	// Create user and grant privileges
+	// Create user and grant privileges, passing the SQL on stdin so the
+	// password stays out of the journal, plans and process list
+	var undoUser func() *Result
+	if !d.mysqlExists(fmt.Sprintf("SELECT User FROM mysql.user WHERE User='%s' AND Host='localhost';", username)) {
+		undoUser = func() *Result {
+			return d.RunCommand("mysql", "-e", fmt.Sprintf("DROP USER IF EXISTS '%s'@'localhost';", username))
+		}
+	}
 	createUserSQL := fmt.Sprintf("CREATE USER IF NOT EXISTS '%s'@'localhost' IDENTIFIED BY '%s'; GRANT ALL PRIVILEGES ON %s.* TO '%s'@'localhost'; FLUSH PRIVILEGES;", username, password, name, username)
-	return d.RunCommand("mysql", "-e", createUserSQL)
+	return tx.Commit(tx.Do("create user "+username, func() *Result {
+		return d.RunCommandInput(createUserSQL, "mysql")
+	}, undoUser))
+}
+
+// mysqlExists reports whether a query returns any rows
+func (d *DatabaseAction) mysqlExists(sql string) bool {
+	result := d.query("mysql", "-N", "-e", sql)
+	return result.Success && strings.TrimSpace(result.Message) != ""
 }
 
 func (d *DatabaseAction) dropMySQLDatabase(name string) *Result {
@@ -223,7 +305,7 @@ func (d *DatabaseAction) dropMySQLDatabase(name string) *Result {
 }
 
 func (d *DatabaseAction) listMySQLDatabases() *Result {
-	return d.RunCommand("mysql", "-e", "SHOW DATABASES;")
+	return d.query("mysql", "-e", "SHOW DATABASES;")
 }
 
 func (d *DatabaseAction) backupMySQLDatabase(name, backupPath string) *Result {
@@ -236,62 +318,26 @@ func (d *DatabaseAction) restoreMySQLDatabase(name, backupPath string) *Result {
 
 // Private helper methods for PostgreSQL
 
-func (d *DatabaseAction) installPostgreSQLDebian() *Result {
-	updateResult := d.RunCommand("apt", "update")
-	if !updateResult.Success {
-		return updateResult
-	}
-	
-	installResult := d.RunCommand("apt", "install", "-y", "postgresql", "postgresql-contrib")
-	if !installResult.Success {
-		return installResult
-	}
-	
-	// Start and enable PostgreSQL
-	d.EnableService("postgresql")
-	return d.StartService("postgresql")
-}
-
-func (d *DatabaseAction) installPostgreSQLRHEL() *Result {
-	var installCmd string
-	if d.FileExists("/usr/bin/dnf") {
-		installCmd = "dnf"
-	} else {
-		installCmd = "yum"
-	}
-	
-	installResult := d.RunCommand(installCmd, "install", "-y", "postgresql-server", "postgresql-contrib")
-	if !installResult.Success {
-		return installResult
-	}
-	
-	// Initialize database
-	initResult := d.RunCommand("postgresql-setup", "initdb")
-	if !initResult.Success {
-		return initResult
-	}
-	
-	// Start and enable PostgreSQL
-	d.EnableService("postgresql")
-	return d.StartService("postgresql")
-}
-
 func (d *DatabaseAction) createPostgreSQLDatabase(name, username, password string) *Result {
+	tx := d.Begin(fmt.Sprintf("database %s with user %s", name, username))
+	
 	// Create user
-	createUserResult := d.RunCommand("sudo", "-u", "postgres", "createuser", username)
+	createUserResult := tx.Run([]string{"sudo", "-u", "postgres", "dropuser", username}, "sudo", "-u", "postgres", "createuser", username)
 	if !createUserResult.Success {
 		return createUserResult
 	}
 	
 	// Create database
-	createDBResult := d.RunCommand("sudo", "-u", "postgres", "createdb", "-O", username, name)
+	createDBResult := tx.Run([]string{"sudo", "-u", "postgres", "dropdb", name}, "sudo", "-u", "postgres", "createdb", "-O", username, name)
 	if !createDBResult.Success {
 		return createDBResult
 	}
 	
-	// Set password
+	// Set password, on stdin like MySQL's
 	setPasswordSQL := fmt.Sprintf("ALTER USER %s PASSWORD '%s';", username, password)
-	return d.RunCommand("sudo", "-u", "postgres", "psql", "-c", setPasswordSQL)
+	return tx.Commit(tx.Do("set password of "+username, func() *Result {
+		return d.RunCommandInput(setPasswordSQL, "sudo", "-u", "postgres", "psql", "-v", "ON_ERROR_STOP=1")
+	}, nil))
 }
 
 func (d *DatabaseAction) dropPostgreSQLDatabase(name string) *Result {
@@ -299,7 +345,7 @@ func (d *DatabaseAction) dropPostgreSQLDatabase(name string) *Result {
 }
 
 func (d *DatabaseAction) listPostgreSQLDatabases() *Result {
-	return d.RunCommand("sudo", "-u", "postgres", "psql", "-l")
+	return d.query("sudo", "-u", "postgres", "psql", "-l")
 }
 
 func (d *DatabaseAction) backupPostgreSQLDatabase(name, backupPath string) *Result {
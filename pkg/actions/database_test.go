@@ -0,0 +1,178 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateDatabase(t *testing.T) {
+	const createUser = "CREATE USER IF NOT EXISTS 'shop'@'localhost' IDENTIFIED BY 's3cret'; GRANT ALL PRIVILEGES ON shop.* TO 'shop'@'localhost'; FLUSH PRIVILEGES;"
+
+	tests := []struct {
+		name    string
+		dbType  string
+		script  func(runner *FakeRunner)
+		success bool
+		want    []Command
+	}{
+		{
+			name:   "mysql",
+			dbType: "mysql",
+			script: func(runner *FakeRunner) {
+				runner.Expect("mysql", "-e", "CREATE DATABASE IF NOT EXISTS shop;")
+				runner.Expect("mysql")
+			},
+			success: true,
+			want: []Command{
+				{Name: "mysql", Args: []string{"-N", "-e", "SHOW DATABASES LIKE 'shop';"}},
+				{Name: "mysql", Args: []string{"-e", "CREATE DATABASE IF NOT EXISTS shop;"}},
+				{Name: "mysql", Args: []string{"-N", "-e", "SELECT User FROM mysql.user WHERE User='shop' AND Host='localhost';"}},
+				{Name: "mysql", Stdin: createUser},
+			},
+		},
+		{
+			name:   "mysql user fails",
+			dbType: "mariadb",
+			script: func(runner *FakeRunner) {
+				runner.Expect("mysql", "-e", "CREATE DATABASE IF NOT EXISTS shop;")
+				runner.Expect("mysql").Fails("ERROR 1396")
+				runner.Expect("mysql", "-e", "DROP DATABASE IF EXISTS shop;")
+			},
+			success: false,
+			want: []Command{
+				{Name: "mysql", Args: []string{"-N", "-e", "SHOW DATABASES LIKE 'shop';"}},
+				{Name: "mysql", Args: []string{"-e", "CREATE DATABASE IF NOT EXISTS shop;"}},
+				{Name: "mysql", Args: []string{"-N", "-e", "SELECT User FROM mysql.user WHERE User='shop' AND Host='localhost';"}},
+				{Name: "mysql", Stdin: createUser},
+				{Name: "mysql", Args: []string{"-e", "DROP DATABASE IF EXISTS shop;"}},
+			},
+		},
+		{
+			name:   "mysql existing database is kept",
+			dbType: "mysql",
+			script: func(runner *FakeRunner) {
+				runner.Expect("mysql", "-N", "-e", "SHOW DATABASES LIKE 'shop';").Returns("shop\n", nil)
+				runner.Expect("mysql", "-e", "CREATE DATABASE IF NOT EXISTS shop;")
+				runner.Expect("mysql").Fails("ERROR 1396")
+			},
+			success: false,
+			want: []Command{
+				{Name: "mysql", Args: []string{"-N", "-e", "SHOW DATABASES LIKE 'shop';"}},
+				{Name: "mysql", Args: []string{"-e", "CREATE DATABASE IF NOT EXISTS shop;"}},
+				{Name: "mysql", Args: []string{"-N", "-e", "SELECT User FROM mysql.user WHERE User='shop' AND Host='localhost';"}},
+				{Name: "mysql", Stdin: createUser},
+			},
+		},
+		{
+			name:   "postgresql",
+			dbType: "postgresql",
+			script: func(runner *FakeRunner) {
+				runner.Expect("sudo", "-u", "postgres", "createuser", "shop")
+				runner.Expect("sudo", "-u", "postgres", "createdb", "-O", "shop", "shop")
+				runner.Expect("sudo", "-u", "postgres", "psql", "-v", "ON_ERROR_STOP=1")
+			},
+			success: true,
+			want: []Command{
+				{Name: "sudo", Args: []string{"-u", "postgres", "createuser", "shop"}},
+				{Name: "sudo", Args: []string{"-u", "postgres", "createdb", "-O", "shop", "shop"}},
+				{Name: "sudo", Args: []string{"-u", "postgres", "psql", "-v", "ON_ERROR_STOP=1"}, Stdin: "ALTER USER shop PASSWORD 's3cret';"},
+			},
+		},
+		{
+			name:   "postgresql database fails",
+			dbType: "postgresql",
+			script: func(runner *FakeRunner) {
+				runner.Expect("sudo", "-u", "postgres", "createuser", "shop")
+				runner.Expect("sudo", "-u", "postgres", "createdb", "-O", "shop", "shop").Fails("createdb: error")
+				runner.Expect("sudo", "-u", "postgres", "dropuser", "shop")
+			},
+			success: false,
+			want: []Command{
+				{Name: "sudo", Args: []string{"-u", "postgres", "createuser", "shop"}},
+				{Name: "sudo", Args: []string{"-u", "postgres", "createdb", "-O", "shop", "shop"}},
+				{Name: "sudo", Args: []string{"-u", "postgres", "dropuser", "shop"}},
+			},
+		},
+		{
+			name:    "unsupported type",
+			dbType:  "oracle",
+			script:  func(*FakeRunner) {},
+			success: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDatabaseAction()
+			runner := fakeSystem(t, &d.BaseAction)
+			tt.script(runner)
+
+			result := d.CreateDatabase("shop", tt.dbType, "shop", "s3cret")
+			if result.Success != tt.success {
+				t.Errorf("success = %t, error = %v", result.Success, result.Error)
+			}
+			checkCommands(t, runner, tt.want)
+		})
+	}
+}
+
+func TestDropDatabase(t *testing.T) {
+	tests := []struct {
+		dbType string
+		want   Command
+	}{
+		{"mysql", Command{Name: "mysql", Args: []string{"-e", "DROP DATABASE IF EXISTS shop;"}}},
+		{"postgresql", Command{Name: "sudo", Args: []string{"-u", "postgres", "dropdb", "shop"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dbType, func(t *testing.T) {
+			d := NewDatabaseAction()
+			runner := fakeSystem(t, &d.BaseAction)
+			runner.Expect(tt.want.Name, tt.want.Args...)
+
+			if result := d.DropDatabase("shop", tt.dbType); !result.Success {
+				t.Errorf("error = %v", result.Error)
+			}
+			checkCommands(t, runner, []Command{tt.want})
+		})
+	}
+}
+
+func TestCreateDatabaseTimeout(t *testing.T) {
+	d := NewDatabaseAction()
+	runner := fakeSystem(t, &d.BaseAction)
+	runner.Expect("sudo", "-u", "postgres", "createuser", "shop").Blocks()
+	d.SetTimeout(10 * time.Millisecond)
+
+	result := d.CreateDatabase("shop", "postgresql", "shop", "s3cret")
+	if result.Success || !errors.Is(result.Error, context.DeadlineExceeded) {
+		t.Errorf("success = %t, error = %v, want a timeout", result.Success, result.Error)
+	}
+	checkCommands(t, runner, []Command{
+		{Name: "sudo", Args: []string{"-u", "postgres", "createuser", "shop"}},
+	})
+}
+
+func TestCreateDatabasePlanHidesPassword(t *testing.T) {
+	for _, dbType := range []string{"mysql", "postgresql"} {
+		t.Run(dbType, func(t *testing.T) {
+			d := NewDatabaseAction()
+			fakeSystem(t, &d.BaseAction)
+			plan := NewPlan()
+			d.SetPlan(plan)
+
+			if result := d.CreateDatabase("shop", dbType, "shop", "s3cret"); !result.Success {
+				t.Fatalf("error = %v", result.Error)
+			}
+			text := plan.Text()
+			data, _ := plan.MarshalJSON()
+			if strings.Contains(text, "s3cret") || strings.Contains(string(data), "s3cret") {
+				t.Errorf("plan shows the password:\n%s", text)
+			}
+		})
+	}
+}
@@ -0,0 +1,627 @@
+package actions
+
+import (
+	"crypto/x509"
+	"easygo/pkg/config"
+	"easygo/pkg/state"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Discovery states
+const (
+	DiscoveredManaged   = "managed"   // recorded and matching the server
+	DiscoveredUnmanaged = "unmanaged" // on the server but not recorded
+	DiscoveredDrifted   = "drifted"   // recorded with different settings
+	DiscoveredMissing   = "missing"   // recorded but gone from the server
+)
+
+// DiscoveredResource is a resource found on the server or in the state
+// store, and how the two compare
+type DiscoveredResource struct {
+	ID     string `json:"id"` // kind:name
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Path   string `json:"path,omitempty"`
+	Detail string `json:"detail,omitempty"`
+
+	found state.Record // the resource as found on the server
+}
+
+// DiscoveryAction finds existing sites, pools, certificates, cron jobs and
+// databases and registers them in the state store
+type DiscoveryAction struct {
+	BaseAction
+}
+
+// NewDiscoveryAction creates a new discovery action instance
+func NewDiscoveryAction() *DiscoveryAction {
+	return &DiscoveryAction{}
+}
+
+// letsencryptLiveDir is where certbot keeps the current certificates
+const letsencryptLiveDir = "/etc/letsencrypt/live"
+
+// cronSpoolDirs hold the per-user crontabs (Debian, then RHEL layout)
+var cronSpoolDirs = []string{"/var/spool/cron/crontabs", "/var/spool/cron"}
+
+// Scan compares the server with the state store
+func (d *DiscoveryAction) Scan() *Result {
+	store := d.Store()
+	if store == nil {
+		return &Result{
+			Success: false,
+			Message: "State store is not available",
+			Error:   newError(ErrNotFound, "state store is not available"),
+		}
+	}
+
+	var resources []*DiscoveredResource
+	for _, scan := range []func(*state.Store) ([]*DiscoveredResource, error){
+		d.scanDomains, d.scanPools, d.scanCertificates, d.scanCronJobs, d.scanDatabases,
+	} {
+		found, err := scan(store)
+		if err != nil {
+			return &Result{
+				Success: false,
+				Message: "Discovery failed",
+				Error:   err,
+			}
+		}
+		resources = append(resources, found...)
+	}
+
+	counts := make(map[string]int)
+	for _, resource := range resources {
+		counts[resource.Status]++
+	}
+	return &Result{
+		Success: true,
+		Message: fmt.Sprintf("Found %d resources: %d managed, %d unmanaged, %d drifted, %d missing", len(resources),
+			counts[DiscoveredManaged], counts[DiscoveredUnmanaged], counts[DiscoveredDrifted], counts[DiscoveredMissing]),
+		Data: resources,
+	}
+}
+
+// Import registers unmanaged resources in the state store and updates the
+// records of drifted ones to match the server. ids selects resources by
+// ID; with none, every unmanaged and drifted resource is imported.
+func (d *DiscoveryAction) Import(ids ...string) (res *Result) {
+	hook := d.Hook("Import", map[string]string{"ids": strings.Join(ids, ",")})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+
+	scan := d.Scan()
+	if !scan.Success {
+		return scan
+	}
+
+	resources := scan.Data.([]*DiscoveredResource)
+	known := make(map[string]bool)
+	for _, resource := range resources {
+		known[resource.ID] = true
+	}
+	selected := make(map[string]bool)
+	for _, id := range ids {
+		if !known[id] {
+			return &Result{
+				Success: false,
+				Message: fmt.Sprintf("No resource %s was found", id),
+				Error:   newError(ErrNotFound, "no resource %s", id),
+			}
+		}
+		selected[id] = true
+	}
+
+	var imported []*DiscoveredResource
+	for _, resource := range resources {
+		if len(ids) > 0 && !selected[resource.ID] {
+			continue
+		}
+		if resource.found == nil || (resource.Status != DiscoveredUnmanaged && resource.Status != DiscoveredDrifted) {
+			continue
+		}
+
+		*resource.found.Metadata() = d.meta(map[string]string{"source": "import"})
+		if err := d.put(d.Store(), resource.found); err != nil {
+			return &Result{
+				Success: false,
+				Message: fmt.Sprintf("Failed to import %s", resource.ID),
+				Error:   err,
+				Data:    imported,
+			}
+		}
+		resource.Status = DiscoveredManaged
+		imported = append(imported, resource)
+	}
+
+	return &Result{
+		Success: true,
+		Message: fmt.Sprintf("Imported %d resources", len(imported)),
+		Data:    imported,
+	}
+}
+
+// put saves a discovered record in its repository. Dry runs save nothing.
+func (d *DiscoveryAction) put(store *state.Store, record state.Record) error {
+	if d.DryRun() {
+		return nil
+	}
+
+	switch r := record.(type) {
+	case *state.Domain:
+		return store.Domains().Put(r)
+	case *state.FPMPool:
+		return store.FPMPools().Put(r)
+	case *state.Certificate:
+		return store.Certificates().Put(r)
+	case *state.CronJob:
+		return store.CronJobs().Put(r)
+	case *state.Database:
+		return store.Databases().Put(r)
+	}
+	return fmt.Errorf("cannot store %T", record)
+}
+
+var (
+	nginxServerNamePattern    = regexp.MustCompile(`(?m)^\s*server_name\s+([^;]+);`)
+	nginxRootPattern          = regexp.MustCompile(`(?m)^\s*root\s+([^;]+);`)
+	apacheServerNamePattern   = regexp.MustCompile(`(?mi)^\s*ServerName\s+(\S+)`)
+	apacheDocumentRootPattern = regexp.MustCompile(`(?mi)^\s*DocumentRoot\s+"?([^"\s]+)"?`)
+)
+
+// scanDomains reads the enabled Nginx and Apache virtual hosts
+func (d *DiscoveryAction) scanDomains(store *state.Store) ([]*DiscoveredResource, error) {
+	platform := d.Platform()
+	found := make(map[string]*state.Domain)
+
+	scan := func(dir, webServer string, namePattern, rootPattern *regexp.Regexp) {
+		for _, path := range configFiles(d.FileSystem(), dir) {
+			if strings.HasSuffix(path, disabledSuffix) {
+				continue
+			}
+			content, err := d.FileSystem().ReadFile(path)
+			if err != nil {
+				continue
+			}
+			name := firstMatch(namePattern, string(content))
+			key := (&state.Domain{Name: name, WebServer: webServer}).Key()
+			if name == "" || name == "_" || found[key] != nil {
+				continue
+			}
+			// Record the file itself, not the sites-enabled link
+			if target, err := d.FileSystem().EvalSymlinks(path); err == nil {
+				path = target
+			}
+			found[key] = &state.Domain{
+				Name:         name,
+				DocumentRoot: firstMatch(rootPattern, string(content)),
+				WebServer:    webServer,
+				ConfigPath:   path,
+				Enabled:      true,
+			}
+		}
+	}
+	scan(enabledDir(platform.NginxSitesEnabled, platform.NginxSitesAvailable), "nginx", nginxServerNamePattern, nginxRootPattern)
+	scan(enabledDir(platform.ApacheSitesEnabled, platform.ApacheSitesAvailable), "apache", apacheServerNamePattern, apacheDocumentRootPattern)
+
+	recorded, err := store.Domains().List()
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []*DiscoveredResource
+	for _, domain := range recorded {
+		resource := &DiscoveredResource{ID: "domain:" + domain.Key(), Kind: "domain", Name: domain.Key(), Path: domain.ConfigPath, Status: DiscoveredManaged}
+		current := found[domain.Key()]
+		delete(found, domain.Key())
+		if domain.Hybrid {
+			// The Apache side is recorded with the Nginx vhost
+			delete(found, (&state.Domain{Name: domain.Name, WebServer: WebServerApache}).Key())
+		}
+
+		switch {
+		case current == nil && !d.FileExists(domain.ConfigPath):
+			resource.Status = DiscoveredMissing
+			resource.Detail = "configuration file is gone"
+		case current == nil:
+			if domain.Enabled {
+				resource.Status = DiscoveredDrifted
+				resource.Detail = "not enabled"
+				disabled := *domain
+				disabled.Enabled = false
+				resource.found = &disabled
+			}
+		default:
+			var diffs []string
+			if current.DocumentRoot != domain.DocumentRoot {
+				diffs = append(diffs, fmt.Sprintf("document root %s, recorded %s", current.DocumentRoot, domain.DocumentRoot))
+			}
+			if !domain.Enabled {
+				diffs = append(diffs, "enabled, recorded disabled")
+			}
+			if len(diffs) > 0 {
+				resource.Status = DiscoveredDrifted
+				resource.Detail = strings.Join(diffs, "; ")
+				resource.Path = current.ConfigPath
+				resource.found = current
+			}
+		}
+		resources = append(resources, resource)
+	}
+
+	for key, domain := range found {
+		resources = append(resources, &DiscoveredResource{
+			ID: "domain:" + key, Kind: "domain", Name: key, Status: DiscoveredUnmanaged,
+			Path: domain.ConfigPath, Detail: domain.WebServer + ", " + domain.DocumentRoot, found: domain,
+		})
+	}
+	return sortResources(resources), nil
+}
+
+var (
+	poolNamePattern   = regexp.MustCompile(`(?m)^\s*\[([^\]]+)\]`)
+	poolListenPattern = regexp.MustCompile(`(?m)^\s*listen\s*=\s*(\S+)`)
+)
+
+// scanPools reads the PHP-FPM pool files of each PHP version
+func (d *DiscoveryAction) scanPools(store *state.Store) ([]*DiscoveredResource, error) {
+	platform := d.Platform()
+	php := &PHPAction{BaseAction: d.BaseAction}
+	versions := php.GetAvailableVersions()
+
+	// Some layouts share one pool directory between all versions; its
+	// pools are taken to belong to the default version
+	shared := len(versions) > 1 && platform.PHPFPMPoolDir(versions[0]) == platform.PHPFPMPoolDir(versions[1])
+	if shared {
+		versions = []string{config.Current().PHP.DefaultVersion}
+	}
+
+	found := make(map[string]*state.FPMPool)
+	for _, version := range versions {
+		for _, path := range configFiles(d.FileSystem(), platform.PHPFPMPoolDir(version)) {
+			content, err := d.FileSystem().ReadFile(path)
+			if err != nil {
+				continue
+			}
+			name := firstMatch(poolNamePattern, string(content))
+			if name == "" || name == "global" {
+				continue
+			}
+			pool := &state.FPMPool{
+				Name:       name,
+				PHPVersion: version,
+				Socket:     firstMatch(poolListenPattern, string(content)),
+				ConfigPath: path,
+			}
+			found[pool.Key()] = pool
+		}
+	}
+
+	recorded, err := store.FPMPools().List()
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []*DiscoveredResource
+	for _, pool := range recorded {
+		resource := &DiscoveredResource{ID: "pool:" + pool.Key(), Kind: "pool", Name: pool.Key(), Path: pool.ConfigPath, Status: DiscoveredManaged}
+		current := found[pool.Key()]
+		delete(found, pool.Key())
+
+		switch {
+		case current == nil:
+			resource.Status = DiscoveredMissing
+			resource.Detail = "pool file is gone"
+		case current.Socket != pool.Socket:
+			resource.Status = DiscoveredDrifted
+			resource.Detail = fmt.Sprintf("listens on %s, recorded %s", current.Socket, pool.Socket)
+			resource.found = current
+		}
+		resources = append(resources, resource)
+	}
+
+	for key, pool := range found {
+		resources = append(resources, &DiscoveredResource{
+			ID: "pool:" + key, Kind: "pool", Name: key, Status: DiscoveredUnmanaged,
+			Path: pool.ConfigPath, Detail: pool.Socket, found: pool,
+		})
+	}
+	return sortResources(resources), nil
+}
+
+// scanCertificates reads the certificates in certbot's live directory
+func (d *DiscoveryAction) scanCertificates(store *state.Store) ([]*DiscoveredResource, error) {
+	found := make(map[string]*state.Certificate)
+	entries, _ := d.FileSystem().ReadDir(letsencryptLiveDir)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		path := CertificatePath(entry.Name())
+		cert := &state.Certificate{Domain: entry.Name(), Path: path}
+		if notAfter, err := certificateExpiry(d.FileSystem(), path); err == nil {
+			cert.NotAfter = notAfter
+		} else if !d.FileExists(path) {
+			continue
+		}
+		found[cert.Domain] = cert
+	}
+
+	recorded, err := store.Certificates().List()
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []*DiscoveredResource
+	for _, cert := range recorded {
+		resource := &DiscoveredResource{ID: "certificate:" + cert.Domain, Kind: "certificate", Name: cert.Domain, Path: cert.Path, Status: DiscoveredManaged}
+		current := found[cert.Domain]
+		delete(found, cert.Domain)
+		if cert.Source == CertificateUploaded {
+			// Uploaded certificates are kept outside certbot's live directory
+			current = nil
+			if notAfter, err := certificateExpiry(d.FileSystem(), cert.Path); err == nil {
+				uploaded := *cert
+				uploaded.NotAfter = notAfter
+				current = &uploaded
+			}
+		}
+
+		switch {
+		case current == nil:
+			resource.Status = DiscoveredMissing
+			resource.Detail = "certificate is gone"
+		case !current.NotAfter.Equal(cert.NotAfter):
+			// Renewed outside EasyGo; adopting it just updates the expiry
+			resource.Status = DiscoveredDrifted
+			resource.Detail = "expires " + current.NotAfter.Format("2006-01-02")
+			resource.found = current
+		}
+		resources = append(resources, resource)
+	}
+
+	for domain, cert := range found {
+		resources = append(resources, &DiscoveredResource{
+			ID: "certificate:" + domain, Kind: "certificate", Name: domain, Status: DiscoveredUnmanaged,
+			Path: cert.Path, Detail: "expires " + cert.NotAfter.Format("2006-01-02"), found: cert,
+		})
+	}
+	return sortResources(resources), nil
+}
+
+// certificateExpiry returns when the first certificate in a PEM file expires
+func certificateExpiry(fsys FileSystem, path string) (notAfter time.Time, err error) {
+	data, err := fsys.ReadFile(path)
+	if err != nil {
+		return notAfter, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return notAfter, errors.New("no PEM data")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return notAfter, err
+	}
+	return cert.NotAfter, nil
+}
+
+var cronEnvPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\s*=`)
+
+// scanCronJobs reads the users' crontabs
+func (d *DiscoveryAction) scanCronJobs(store *state.Store) ([]*DiscoveredResource, error) {
+	found := make(map[string]*state.CronJob)
+	for _, dir := range cronSpoolDirs {
+		entries, err := d.FileSystem().ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			content, err := d.FileSystem().ReadFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				continue
+			}
+			for _, job := range parseCrontab(string(content), entry.Name()) {
+				found[cronID(job)] = job
+			}
+		}
+	}
+
+	recorded, err := store.CronJobs().List()
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []*DiscoveredResource
+	for _, job := range recorded {
+		id := cronID(job)
+		resource := &DiscoveredResource{ID: "cron:" + id, Kind: "cron", Name: id, Status: DiscoveredManaged}
+		if found[id] == nil {
+			resource.Status = DiscoveredMissing
+			resource.Detail = "not in the crontab"
+		}
+		delete(found, id)
+		resources = append(resources, resource)
+	}
+
+	for id, job := range found {
+		resources = append(resources, &DiscoveredResource{
+			ID: "cron:" + id, Kind: "cron", Name: id, Status: DiscoveredUnmanaged,
+			Detail: job.Description, found: job,
+		})
+	}
+	return sortResources(resources), nil
+}
+
+// parseCrontab returns the jobs in a user's crontab. A comment directly
+// above a job, as AddCronJob writes, becomes its description.
+func parseCrontab(content, user string) []*state.CronJob {
+	var jobs []*state.CronJob
+	var description string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "#"):
+			description = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+			continue
+		case line == "" || cronEnvPattern.MatchString(line):
+			description = ""
+			continue
+		}
+
+		scheduleFields := 5
+		if strings.HasPrefix(line, "@") {
+			scheduleFields = 1
+		}
+		fields := strings.Fields(line)
+		if len(fields) <= scheduleFields {
+			continue
+		}
+		jobs = append(jobs, &state.CronJob{
+			Schedule:    strings.Join(fields[:scheduleFields], " "),
+			Command:     strings.Join(fields[scheduleFields:], " "),
+			User:        user,
+			Description: description,
+			Enabled:     true,
+		})
+		description = ""
+	}
+	return jobs
+}
+
+// cronID identifies a cron job by its user, schedule and command
+func cronID(job *state.CronJob) string {
+	return fmt.Sprintf("%s %s %s", job.User, job.Schedule, job.Command)
+}
+
+// systemDatabases are created by the database servers themselves
+var systemDatabases = map[string]bool{
+	"information_schema": true, "mysql": true, "performance_schema": true, "sys": true, "postgres": true,
+}
+
+// scanDatabases lists the databases on the MySQL/MariaDB and PostgreSQL
+// servers. A server that cannot be queried is skipped, and its recorded
+// databases are not reported as missing.
+func (d *DiscoveryAction) scanDatabases(store *state.Store) ([]*DiscoveredResource, error) {
+	found := make(map[string]*state.Database)
+	queried := make(map[string]bool)
+
+	if result := d.query("mysql", "-N", "-e", "SELECT s.SCHEMA_NAME, IFNULL(MIN(d.User), '') FROM information_schema.SCHEMATA s LEFT JOIN mysql.db d ON d.Db = s.SCHEMA_NAME GROUP BY s.SCHEMA_NAME;"); result.Success {
+		queried["mysql"], queried["mariadb"] = true, true
+		for _, line := range strings.Split(result.Message, "\n") {
+			fields := strings.Split(strings.TrimSpace(line), "\t")
+			if fields[0] == "" || systemDatabases[fields[0]] {
+				continue
+			}
+			db := &state.Database{Name: fields[0], Type: "mysql"}
+			if len(fields) > 1 {
+				db.User = fields[1]
+			}
+			found[db.Key()] = db
+		}
+	}
+
+	if result := d.query("sudo", "-u", "postgres", "psql", "-At", "-c", "SELECT datname, pg_get_userbyid(datdba) FROM pg_database WHERE NOT datistemplate;"); result.Success {
+		queried["postgresql"] = true
+		for _, line := range strings.Split(result.Message, "\n") {
+			fields := strings.Split(strings.TrimSpace(line), "|")
+			if fields[0] == "" || systemDatabases[fields[0]] {
+				continue
+			}
+			db := &state.Database{Name: fields[0], Type: "postgresql"}
+			if len(fields) > 1 {
+				db.User = fields[1]
+			}
+			found[db.Key()] = db
+		}
+	}
+
+	recorded, err := store.Databases().List()
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []*DiscoveredResource
+	for _, db := range recorded {
+		resource := &DiscoveredResource{ID: "database:" + db.Key(), Kind: "database", Name: db.Key(), Status: DiscoveredManaged}
+		// MariaDB databases are found as mysql ones
+		key := db.Key()
+		if db.Type == "mariadb" {
+			key = (&state.Database{Name: db.Name, Type: "mysql"}).Key()
+		}
+		if found[key] == nil && queried[db.Type] {
+			resource.Status = DiscoveredMissing
+			resource.Detail = "not on the server"
+		}
+		delete(found, key)
+		resources = append(resources, resource)
+	}
+
+	for key, db := range found {
+		resources = append(resources, &DiscoveredResource{
+			ID: "database:" + key, Kind: "database", Name: key, Status: DiscoveredUnmanaged,
+			Detail: "user " + db.User, found: db,
+		})
+	}
+	return sortResources(resources), nil
+}
+
+// configFiles returns the regular files (or links to them) in a directory
+func configFiles(fsys FileSystem, dir string) []string {
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var files []string
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if info, err := fsys.Stat(path); err == nil && info.Mode().IsRegular() && !strings.HasPrefix(entry.Name(), ".") {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// enabledDir returns the sites-enabled directory, or the directory vhosts
+// are included from when the layout has none
+func enabledDir(enabled, available string) string {
+	if enabled != "" {
+		return enabled
+	}
+	return available
+}
+
+// firstMatch returns the first word of a pattern's first capture
+func firstMatch(pattern *regexp.Regexp, content string) string {
+	match := pattern.FindStringSubmatch(content)
+	if match == nil {
+		return ""
+	}
+	fields := strings.Fields(match[1])
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.Trim(fields[0], `"'`)
+}
+
+// sortResources orders resources by ID
+func sortResources(resources []*DiscoveredResource) []*DiscoveredResource {
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].ID < resources[j].ID
+	})
+	return resources
+}
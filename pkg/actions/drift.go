@@ -0,0 +1,310 @@
+package actions
+
+import (
+	"crypto/sha256"
+	"easygo/pkg/state"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Drift states of a managed file
+const (
+	DriftModified = "modified" // edited since EasyGo wrote it
+	DriftMissing  = "missing"  // deleted since EasyGo wrote it
+	DriftExtra    = "extra"    // in a site or pool directory but not written by EasyGo
+)
+
+// FileDrift describes a managed file that no longer matches what EasyGo
+// wrote, or a file EasyGo does not manage where it expects only its own
+type FileDrift struct {
+	Path         string `json:"path"`
+	Status       string `json:"status"`
+	RecordedHash string `json:"recorded_sha256,omitempty"`
+	CurrentHash  string `json:"current_sha256,omitempty"`
+	Diff         string `json:"diff,omitempty"` // unified diff from the generated to the current content
+}
+
+// contentHash returns the hex SHA-256 of content
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// recordManagedFile records the hash of the content EasyGo wrote to a file
+func (ba *BaseAction) recordManagedFile(path, content string) {
+	file := &state.ManagedFile{
+		Path:   path,
+		SHA256: contentHash([]byte(content)),
+		Size:   len(content),
+		Meta:   ba.meta(nil),
+	}
+	ba.record(func(store *state.Store) error {
+		return store.ManagedFiles().Put(file)
+	})
+}
+
+// forgetManagedFile stops tracking a file for drift
+func (ba *BaseAction) forgetManagedFile(path string) {
+	os.Remove(generatedPath(path))
+	ba.record(func(store *state.Store) error {
+		return store.ManagedFiles().Delete(path)
+	})
+}
+
+// driftStore returns the state store, which drift detection requires
+func (ba *BaseAction) driftStore() (*state.Store, *Result) {
+	store := ba.Store()
+	if store == nil {
+		return nil, &Result{
+			Success: false,
+			Message: "State store is not available",
+			Error:   newError(ErrNotFound, "state store is not available"),
+		}
+	}
+	return store, nil
+}
+
+// DetectDrift compares every managed file with the content EasyGo last
+// wrote to it, and lists unmanaged files in the site and pool directories
+// EasyGo writes to
+func (ba *BaseAction) DetectDrift() *Result {
+	store, failure := ba.driftStore()
+	if failure != nil {
+		return failure
+	}
+	files, err := store.ManagedFiles().List()
+	if err != nil {
+		return &Result{
+			Success: false,
+			Message: "Failed to read managed files",
+			Error:   err,
+		}
+	}
+
+	var drifts []*FileDrift
+	managed := make(map[string]bool)
+	dirs := make(map[string]bool)
+	for _, file := range files {
+		managed[file.Path] = true
+		dirs[filepath.Dir(file.Path)] = true
+		if drift := fileDrift(ba.FileSystem(), file); drift != nil {
+			drifts = append(drifts, drift)
+		}
+	}
+
+	for _, dir := range ba.siteDirs() {
+		if !dirs[dir] {
+			continue
+		}
+		for _, path := range configFiles(ba.FileSystem(), dir) {
+			if path = ba.resolvePath(path); managed[path] {
+				continue
+			}
+			current, err := ba.FileSystem().ReadFile(path)
+			if err != nil {
+				continue
+			}
+			managed[path] = true
+			drifts = append(drifts, &FileDrift{
+				Path:        path,
+				Status:      DriftExtra,
+				CurrentHash: contentHash(current),
+			})
+		}
+	}
+
+	sort.Slice(drifts, func(i, j int) bool {
+		return drifts[i].Path < drifts[j].Path
+	})
+	return &Result{
+		Success: true,
+		Message: fmt.Sprintf("Checked %d managed files, %d drifted", len(files), len(drifts)),
+		Data:    drifts,
+	}
+}
+
+// fileDrift compares a managed file with its recorded hash, returning nil
+// when it is unchanged
+func fileDrift(fsys FileSystem, file *state.ManagedFile) *FileDrift {
+	generated, _ := os.ReadFile(generatedPath(file.Path))
+	current, err := fsys.ReadFile(file.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &FileDrift{
+			Path:         file.Path,
+			Status:       DriftMissing,
+			RecordedHash: file.SHA256,
+			Diff:         unifiedDiff(file.Path, string(generated), ""),
+		}
+	}
+
+	hash := contentHash(current)
+	if err != nil || hash == file.SHA256 {
+		return nil
+	}
+	return &FileDrift{
+		Path:         file.Path,
+		Status:       DriftModified,
+		RecordedHash: file.SHA256,
+		CurrentHash:  hash,
+		Diff:         unifiedDiff(file.Path, string(generated), string(current)),
+	}
+}
+
+// unifiedDiff returns the changes from the generated to the current
+// content of a file
+func unifiedDiff(path, generated, current string) string {
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        diffLines(generated),
+		B:        diffLines(current),
+		FromFile: path + " (generated by EasyGo)",
+		ToFile:   path,
+		Context:  3,
+	})
+	return diff
+}
+
+// diffLines splits content into lines, keeping their line endings
+func diffLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	} else {
+		lines[len(lines)-1] += "\n\\ No newline at end of file\n"
+	}
+	return lines
+}
+
+// siteDirs returns the directories that hold one file per site or pool,
+// where a file EasyGo did not write is worth pointing out
+func (ba *BaseAction) siteDirs() []string {
+	platform := ba.Platform()
+	dirs := []string{platform.NginxSitesAvailable, platform.ApacheSitesAvailable}
+	for _, version := range (&PHPAction{}).GetAvailableVersions() {
+		dirs = append(dirs, platform.PHPFPMPoolDir(version))
+	}
+	return dirs
+}
+
+// findDrift returns the drift of one file, or a failed result when the
+// file has not drifted
+func (ba *BaseAction) findDrift(path string) (*FileDrift, *Result) {
+	result := ba.DetectDrift()
+	if !result.Success {
+		return nil, result
+	}
+
+	path = ba.resolvePath(filepath.Clean(path))
+	for _, drift := range result.Data.([]*FileDrift) {
+		if drift.Path == path {
+			return drift, nil
+		}
+	}
+	return nil, &Result{
+		Success: false,
+		Message: fmt.Sprintf("%s has not drifted", path),
+		Error:   newError(ErrNotFound, "no drift for %s", path),
+	}
+}
+
+// AdoptFile accepts the current state of a drifted file: an edited or
+// unmanaged file's content becomes the content EasyGo expects, and a
+// deleted file is no longer tracked
+func (ba *BaseAction) AdoptFile(path string) (res *Result) {
+	hook := ba.Hook("AdoptFile", map[string]string{"path": path})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+
+	drift, failure := ba.findDrift(path)
+	if failure != nil {
+		return failure
+	}
+	if ba.DryRun() {
+		return &Result{
+			Success: true,
+			Message: fmt.Sprintf("[dry-run] adopt %s %s", drift.Status, drift.Path),
+		}
+	}
+
+	if drift.Status == DriftMissing {
+		ba.forgetManagedFile(drift.Path)
+		return &Result{
+			Success: true,
+			Message: fmt.Sprintf("%s is no longer managed", drift.Path),
+		}
+	}
+
+	current, err := ba.FileSystem().ReadFile(drift.Path)
+	if err == nil {
+		err = os.MkdirAll(versionDir(drift.Path), 0700)
+	}
+	if err == nil {
+		err = os.WriteFile(generatedPath(drift.Path), current, 0600)
+	}
+	if err != nil {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("Failed to adopt %s", drift.Path),
+			Error:   err,
+		}
+	}
+	ba.recordManagedFile(drift.Path, string(current))
+
+	return &Result{
+		Success: true,
+		Message: fmt.Sprintf("Adopted the current content of %s", drift.Path),
+	}
+}
+
+// RerenderFile discards changes to a drifted file by writing back the
+// content EasyGo last generated. The edited content is kept as a previous
+// version. The service using the file must be reloaded to apply it.
+func (ba *BaseAction) RerenderFile(path string) (res *Result) {
+	hook := ba.Hook("RerenderFile", map[string]string{"path": path})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+
+	drift, failure := ba.findDrift(path)
+	if failure != nil {
+		return failure
+	}
+	if drift.Status == DriftExtra {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("%s was not written by EasyGo", drift.Path),
+			Error:   newError(ErrValidationFailed, "%s has no generated content to restore", drift.Path),
+		}
+	}
+
+	generated, err := os.ReadFile(generatedPath(drift.Path))
+	if err != nil {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("The generated content of %s was not kept", drift.Path),
+			Error:   err,
+		}
+	}
+
+	result := ba.WriteFile(drift.Path, string(generated))
+	if !result.Success {
+		return result
+	}
+	return &Result{
+		Success: true,
+		Message: fmt.Sprintf("Re-rendered %s; reload the service that uses it to apply", drift.Path),
+	}
+}
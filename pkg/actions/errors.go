@@ -0,0 +1,161 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+)
+
+// Error kinds. Errors returned in Result.Error match one of these with
+// errors.Is, so callers can branch on what went wrong.
+var (
+	ErrNotInstalled        = errors.New("not installed")
+	ErrUnsupportedPlatform = errors.New("unsupported platform")
+	ErrValidationFailed    = errors.New("validation failed")
+	ErrCommandFailed       = errors.New("command failed")
+	ErrConflict            = errors.New("conflict")
+
+	// These are the io/fs errors, so failing file operations match too
+	ErrPermissionDenied = fs.ErrPermission
+	ErrNotFound         = fs.ErrNotExist
+)
+
+// Error is an error of a known kind
+type Error struct {
+	Kind error  // one of the Err* kinds
+	Msg  string // what failed
+	Err  error  // underlying cause, if any
+}
+
+// newError creates an error of the given kind
+func newError(kind error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, args...)}
+}
+
+// wrapError creates an error of the given kind caused by err
+func wrapError(kind error, err error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, args...), Err: err}
+}
+
+func (e *Error) Error() string {
+	msg := e.Msg
+	if msg == "" {
+		msg = e.Kind.Error()
+	}
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Is reports whether the error is of the target kind
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Unwrap returns the underlying cause
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// CommandError is returned when a system command fails. It matches
+// ErrCommandFailed, ErrNotInstalled when the program does not exist, and
+// ErrPermissionDenied when the command was refused for lack of privileges.
+type CommandError struct {
+	Command  string
+	ExitCode int // -1 when the command did not exit normally
+	Stderr   string
+	Err      error
+}
+
+func (e *CommandError) Error() string {
+	if e.ExitCode >= 0 {
+		return fmt.Sprintf("%s: exit status %d", e.Command, e.ExitCode)
+	}
+	return fmt.Sprintf("%s: %v", e.Command, e.Err)
+}
+
+// Is reports whether the error is of the target kind
+func (e *CommandError) Is(target error) bool {
+	switch target {
+	case ErrCommandFailed:
+		return true
+	case ErrNotInstalled:
+		return e.ExitCode < 0 && (errors.Is(e.Err, exec.ErrNotFound) || errors.Is(e.Err, fs.ErrNotExist))
+	case ErrPermissionDenied:
+		return e.ExitCode == 126 || strings.Contains(strings.ToLower(e.Stderr), "permission denied")
+	}
+	return false
+}
+
+// Unwrap returns the underlying cause
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// validationResult marks a failed configuration test as ErrValidationFailed
+func validationResult(result *Result) *Result {
+	if result.Success || errors.Is(result.Error, ErrValidationFailed) {
+		return result
+	}
+	return &Result{
+		Success: false,
+		Message: result.Message,
+		Error:   wrapError(ErrValidationFailed, result.Error, "configuration test failed"),
+		Data:    result.Data,
+	}
+}
+
+// Kinds lists the error kinds in the order ErrorKind checks them
+var Kinds = []error{
+	ErrPermissionDenied,
+	ErrNotInstalled,
+	ErrUnsupportedPlatform,
+	ErrValidationFailed,
+	ErrConflict,
+	ErrNotFound,
+	ErrCommandFailed,
+}
+
+// errorCodes names the error kinds for scripts and API clients
+var errorCodes = map[error]string{
+	ErrPermissionDenied:    "permission_denied",
+	ErrNotInstalled:        "not_installed",
+	ErrUnsupportedPlatform: "unsupported_platform",
+	ErrValidationFailed:    "validation_failed",
+	ErrConflict:            "conflict",
+	ErrNotFound:            "not_found",
+	ErrCommandFailed:       "command_failed",
+}
+
+// ErrorCode returns the name of err's kind, e.g. "not_installed", or
+// "error" when it has none
+func ErrorCode(err error) string {
+	if code, ok := errorCodes[ErrorKind(err)]; ok {
+		return code
+	}
+	return "error"
+}
+
+// KindForCode returns the error kind named by an ErrorCode, or nil for an
+// unknown code
+func KindForCode(code string) error {
+	for kind, name := range errorCodes {
+		if name == code {
+			return kind
+		}
+	}
+	return nil
+}
+
+// ErrorKind returns the kind of err, or nil when it has none
+func ErrorKind(err error) error {
+	for _, kind := range Kinds {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	return nil
+}
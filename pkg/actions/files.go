@@ -0,0 +1,327 @@
+package actions
+
+import (
+	"bytes"
+	"easygo/pkg/config"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fileVersionsDir is where previous versions of files written by EasyGo
+// are kept (paths.file_versions). Each managed file gets a directory
+// mirroring its absolute path, holding one file per version named after
+// the time it was replaced.
+func fileVersionsDir() string {
+	return config.Current().Paths.FileVersions
+}
+
+// versionFormat names backup versions so they sort chronologically
+const versionFormat = "20060102T150405.000000000"
+
+// FileVersion is a previous version of a managed file
+type FileVersion struct {
+	Path       string
+	Version    string
+	Created    time.Time
+	Size       int64
+	BackupPath string
+}
+
+// versionDir returns the backup directory of a managed file
+func versionDir(path string) string {
+	return filepath.Join(fileVersionsDir(), filepath.Clean("/"+path))
+}
+
+// generatedFile holds, in a managed file's backup directory, the content
+// EasyGo last wrote, so later edits can be shown as a diff
+const generatedFile = ".generated"
+
+// generatedPath returns where the content EasyGo last wrote to a file is kept
+func generatedPath(path string) string {
+	return filepath.Join(versionDir(path), generatedFile)
+}
+
+// resolvePath follows symlinks, since files are written through them
+func (ba *BaseAction) resolvePath(path string) string {
+	if resolved, err := ba.FileSystem().EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+// writeFileVersioned atomically replaces a file. The previous content, if
+// any, is kept as a new version in the backup directory. Mode and
+// ownership of an existing file are preserved.
+func (ba *BaseAction) writeFileVersioned(path string, content []byte) error {
+	fsys := ba.FileSystem()
+	previous, err := fsys.ReadFile(path)
+	existed := err == nil
+	if !existed && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Record the file as managed and keep the version being replaced
+	if err := os.MkdirAll(versionDir(path), 0700); err != nil {
+		return fmt.Errorf("create backup directory: %w", err)
+	}
+	if existed && !bytes.Equal(previous, content) {
+		version := time.Now().Format(versionFormat)
+		if err := os.WriteFile(filepath.Join(versionDir(path), version), previous, 0600); err != nil {
+			return fmt.Errorf("back up %s: %w", path, err)
+		}
+	}
+
+	if err := fsys.WriteFile(path, content); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(generatedPath(path), content, 0600); err != nil {
+		return fmt.Errorf("keep generated content of %s: %w", path, err)
+	}
+	return nil
+}
+
+// writePrivateFile writes a secret, such as a private key, readable by
+// its owner only. It is neither versioned nor tracked for drift, which
+// would keep copies of it, and copies kept while it was are removed.
+// Plans name the file without its content.
+func (ba *BaseAction) writePrivateFile(path, content string) *Result {
+	if ba.plan != nil {
+		ba.plan.add(PlannedOperation{Kind: PlanWriteFile, Path: path})
+		return &Result{
+			Success: true,
+			Message: "[dry-run] write " + path,
+		}
+	}
+
+	path = ba.resolvePath(path)
+	if err := ba.FileSystem().WritePrivateFile(path, []byte(content)); err != nil {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("Failed to write %s", path),
+			Error:   err,
+		}
+	}
+	if err := os.RemoveAll(versionDir(path)); err != nil {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("Wrote %s, but failed to remove its earlier versions", path),
+			Error:   err,
+		}
+	}
+	ba.forgetManagedFile(path)
+	return &Result{
+		Success: true,
+		Message: "File written successfully",
+	}
+}
+
+// ListFileVersions lists the stored previous versions of a managed file,
+// newest first
+func (ba *BaseAction) ListFileVersions(path string) *Result {
+	entries, err := os.ReadDir(versionDir(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Result{
+				Success: false,
+				Message: fmt.Sprintf("%s is not managed by EasyGo", path),
+				Error:   err,
+			}
+		}
+		return &Result{
+			Success: false,
+			Message: "Failed to read backup directory",
+			Error:   err,
+		}
+	}
+
+	var versions []*FileVersion
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		created, err := time.ParseInLocation(versionFormat, entry.Name(), time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		versions = append(versions, &FileVersion{
+			Path:       path,
+			Version:    entry.Name(),
+			Created:    created,
+			Size:       info.Size(),
+			BackupPath: filepath.Join(versionDir(path), entry.Name()),
+		})
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version > versions[j].Version
+	})
+
+	return &Result{
+		Success: true,
+		Message: fmt.Sprintf("Found %d previous versions of %s", len(versions), path),
+		Data:    versions,
+	}
+}
+
+// ListManagedFiles lists every file EasyGo has written and still tracks:
+// those recorded in the state store, or without one those whose generated
+// content is kept
+func (ba *BaseAction) ListManagedFiles() *Result {
+	var files []string
+	if store := ba.Store(); store != nil {
+		records, err := store.ManagedFiles().List()
+		if err != nil {
+			return &Result{
+				Success: false,
+				Message: "Failed to read managed files",
+				Error:   err,
+			}
+		}
+		for _, record := range records {
+			files = append(files, record.Path)
+		}
+	} else {
+		root := fileVersionsDir()
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && info.Name() == generatedFile {
+				files = append(files, strings.TrimPrefix(filepath.Dir(path), filepath.Clean(root)))
+			}
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return &Result{
+				Success: false,
+				Message: "Failed to read backup directory",
+				Error:   err,
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return &Result{
+		Success: true,
+		Message: fmt.Sprintf("Found %d managed files", len(files)),
+		Data:    files,
+	}
+}
+
+// RestoreFileVersion restores a managed file to a previous version. The
+// content being replaced is itself kept as a new version.
+func (ba *BaseAction) RestoreFileVersion(path, version string) (res *Result) {
+	hook := ba.Hook("RestoreFileVersion", map[string]string{"path": path, "version": version})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+
+	if version != filepath.Base(version) {
+		return &Result{
+			Success: false,
+			Message: "Invalid version",
+			Error:   newError(ErrValidationFailed, "invalid version %q", version),
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(versionDir(path), version))
+	if err != nil {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("Version %s of %s not found", version, path),
+			Error:   err,
+		}
+	}
+
+	result := ba.WriteFile(path, string(content))
+	if !result.Success {
+		return result
+	}
+
+	return &Result{
+		Success: true,
+		Message: fmt.Sprintf("Restored %s to version %s", path, version),
+	}
+}
+
+// WriteConfig writes a configuration file and runs validate afterwards. If
+// validation fails the previous file is restored, or the new file removed
+// when there was none, and the validation result is returned.
+func (ba *BaseAction) WriteConfig(path, content string, validate func() *Result) *Result {
+	tx := ba.Begin("configuration of " + path)
+	result := tx.WriteFile(path, content)
+	if !result.Success {
+		return result
+	}
+
+	validation := tx.Do("validate "+path, func() *Result {
+		return validationResult(validate())
+	}, nil)
+	if !validation.Success {
+		return validation
+	}
+	return tx.Commit(result)
+}
+
+// RemoveAll removes a directory and everything in it
+func (ba *BaseAction) RemoveAll(path string) *Result {
+	if ba.plan != nil {
+		cmd := Command{Name: "rm", Args: []string{"-rf", path}}
+		ba.plan.add(PlannedOperation{Kind: PlanCommand, Command: cmd.String()})
+		return &Result{
+			Success: true,
+			Message: "[dry-run] " + cmd.String(),
+		}
+	}
+	if err := ba.FileSystem().RemoveAll(path); err != nil {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("Failed to remove %s", path),
+			Error:   err,
+		}
+	}
+	return &Result{
+		Success: true,
+		Message: fmt.Sprintf("Removed %s", path),
+	}
+}
+
+// RemoveFile removes a file. A managed file is no longer tracked for drift.
+func (ba *BaseAction) RemoveFile(path string) *Result {
+	if ba.plan != nil {
+		cmd := Command{Name: "rm", Args: []string{"-f", path}}
+		ba.plan.add(PlannedOperation{Kind: PlanCommand, Command: cmd.String()})
+		return &Result{
+			Success: true,
+			Message: "[dry-run] " + cmd.String(),
+		}
+	}
+
+	// Removing a link leaves the file it leads to managed
+	_, linkErr := ba.FileSystem().Readlink(path)
+	resolved := ba.resolvePath(path)
+	if err := ba.FileSystem().Remove(path); err != nil {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("Failed to remove %s", path),
+			Error:   err,
+		}
+	}
+	if linkErr != nil {
+		ba.forgetManagedFile(resolved)
+	}
+	return &Result{
+		Success: true,
+		Message: "File removed successfully",
+	}
+}
@@ -0,0 +1,48 @@
+package actions
+
+import (
+	"easygo/pkg/state"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestListManagedFiles(t *testing.T) {
+	for _, withStore := range []bool{true, false} {
+		name := "versions"
+		if withStore {
+			name = "store"
+		}
+		t.Run(name, func(t *testing.T) {
+			ba := &BaseAction{}
+			fakeSystem(t, ba)
+			if withStore {
+				store, err := state.Open(filepath.Join(t.TempDir(), "state.db"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				ba.SetStore(store)
+			}
+
+			for _, path := range []string{"/etc/nginx/sites-available/a.example.com", "/etc/nginx/sites-available/b.example.com"} {
+				if result := ba.WriteFile(path, "server {}\n"); !result.Success {
+					t.Fatalf("write %s: %v", path, result.Error)
+				}
+			}
+			// Rewriting keeps a version, deleting forgets the file
+			ba.WriteFile("/etc/nginx/sites-available/a.example.com", "server { listen 80; }\n")
+			if result := ba.RemoveFile("/etc/nginx/sites-available/b.example.com"); !result.Success {
+				t.Fatalf("remove: %v", result.Error)
+			}
+
+			result := ba.ListManagedFiles()
+			if !result.Success {
+				t.Fatalf("error = %v", result.Error)
+			}
+			want := []string{"/etc/nginx/sites-available/a.example.com"}
+			if files := result.Data.([]string); !slices.Equal(files, want) {
+				t.Errorf("files = %v, want %v", files, want)
+			}
+		})
+	}
+}
@@ -25,10 +25,16 @@ type FirewallRule struct {
 }
 
 // InstallFirewall installs and configures basic firewall
-func (f *FirewallAction) InstallFirewall() *Result {
-	// Install iptables-persistent for Debian/Ubuntu
-	if f.FileExists("/usr/bin/apt") {
-		installResult := f.RunCommand("apt", "install", "-y", "iptables-persistent")
+func (f *FirewallAction) InstallFirewall() (res *Result) {
+	hook := f.Hook("InstallFirewall", nil)
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
+	// Install persistent rule support (iptables-persistent on Debian/Ubuntu)
+	if pm := f.PackageManager(); pm != nil {
+		installResult := pm.Install(ResolvePackages(pm, "", "firewall")...)
 		if !installResult.Success {
 			return installResult
 		}
@@ -39,7 +45,13 @@ func (f *FirewallAction) InstallFirewall() *Result {
 }
 
 // SetupBasicRules configures basic firewall rules
-func (f *FirewallAction) SetupBasicRules() *Result {
+func (f *FirewallAction) SetupBasicRules() (res *Result) {
+	hook := f.Hook("SetupBasicRules", nil)
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	rules := [][]string{
 		// Allow loopback
 		{"iptables", "-A", "INPUT", "-i", "lo", "-j", "ACCEPT"},
@@ -73,30 +85,14 @@ func (f *FirewallAction) SetupBasicRules() *Result {
 }
 
 // AddRule adds a new firewall rule
-func (f *FirewallAction) AddRule(protocol, port, source, action string) *Result {
-	var args []string
-	
-	if action == "allow" {
-		args = []string{"-A", "INPUT", "-p", protocol}
-		if port != "" {
-			args = append(args, "--dport", port)
-		}
-		if source != "" {
-			args = append(args, "-s", source)
-		}
-		args = append(args, "-j", "ACCEPT")
-	} else if action == "deny" {
-		args = []string{"-A", "INPUT", "-p", protocol}
-		if port != "" {
-			args = append(args, "--dport", port)
-		}
-		if source != "" {
-			args = append(args, "-s", source)
-		}
-		args = append(args, "-j", "DROP")
+func (f *FirewallAction) AddRule(protocol, port, source, action string) (res *Result) {
+	hook := f.Hook("AddRule", map[string]string{"protocol": protocol, "port": port, "source": source, "action": action})
+	if failed := hook.Pre(); failed != nil {
+		return failed
 	}
+	defer hook.Post(&res)
 	
-	result := f.RunCommand("iptables", args...)
+	result := f.RunCommand("iptables", ruleArgs("-A", protocol, port, source, action)...)
 	if !result.Success {
 		return result
 	}
@@ -104,8 +100,39 @@ func (f *FirewallAction) AddRule(protocol, port, source, action string) *Result
 	return f.SaveRules()
 }
 
+// HasRule reports whether an INPUT rule like the one AddRule would add
+// is already in place
+func (f *FirewallAction) HasRule(protocol, port, source, action string) bool {
+	return f.query("iptables", ruleArgs("-C", protocol, port, source, action)...).Success
+}
+
+// ruleArgs builds the iptables arguments for an INPUT rule, where
+// operation is -A to append it or -C to check for it
+func ruleArgs(operation, protocol, port, source, action string) []string {
+	args := []string{operation, "INPUT", "-p", protocol}
+	if port != "" {
+		args = append(args, "--dport", port)
+	}
+	if source != "" {
+		args = append(args, "-s", source)
+	}
+	
+	if action == "allow" {
+		args = append(args, "-j", "ACCEPT")
+	} else if action == "deny" {
+		args = append(args, "-j", "DROP")
+	}
+	return args
+}
+
 // RemoveRule removes a firewall rule
-func (f *FirewallAction) RemoveRule(ruleSpec string) *Result {
+func (f *FirewallAction) RemoveRule(ruleSpec string) (res *Result) {
+	hook := f.Hook("RemoveRule", map[string]string{"rule_spec": ruleSpec})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	// Parse rule specification and remove it
 	// This is a simplified implementation
 	result := f.RunCommand("iptables", "-D", "INPUT", ruleSpec)
@@ -118,31 +145,21 @@ func (f *FirewallAction) RemoveRule(ruleSpec string) *Result {
 
 // ListRules lists current firewall rules
 func (f *FirewallAction) ListRules() *Result {
-	return f.RunCommand("iptables", "-L", "-n", "--line-numbers")
+	return f.query("iptables", "-L", "-n", "--line-numbers")
 }
 
 // InstallFail2Ban installs and configures Fail2ban
 func (f *FirewallAction) InstallFail2Ban() *Result {
-	var installResult *Result
-	
-	if f.FileExists("/usr/bin/apt") {
-		installResult = f.RunCommand("apt", "install", "-y", "fail2ban")
-	} else if f.FileExists("/usr/bin/yum") || f.FileExists("/usr/bin/dnf") {
-		var installCmd string
-		if f.FileExists("/usr/bin/dnf") {
-			installCmd = "dnf"
-		} else {
-			installCmd = "yum"
-		}
-		installResult = f.RunCommand(installCmd, "install", "-y", "fail2ban")
-	} else {
+	pm := f.PackageManager()
+	if pm == nil {
 		return &Result{
 			Success: false,
 			Message: "Unsupported package manager",
-			Error:   fmt.Errorf("unsupported package manager"),
+			Error:   newError(ErrUnsupportedPlatform, "unsupported package manager"),
 		}
 	}
 	
+	installResult := pm.Install(ResolvePackages(pm, "", "fail2ban")...)
 	if !installResult.Success {
 		return installResult
 	}
@@ -153,7 +170,8 @@ func (f *FirewallAction) InstallFail2Ban() *Result {
 
 // ConfigureFail2Ban configures Fail2ban with basic jails
 func (f *FirewallAction) ConfigureFail2Ban() *Result {
-	config := `[DEFAULT]
+	platform := f.Platform()
+	config := fmt.Sprintf(`[DEFAULT]
 bantime = 3600
 findtime = 600
 maxretry = 5
@@ -163,38 +181,40 @@ backend = auto
 enabled = true
 port = ssh
 filter = sshd
-logpath = /var/log/auth.log
+logpath = %s
 maxretry = 3
 
 [apache-auth]
 enabled = true
 port = http,https
 filter = apache-auth
-logpath = /var/log/apache2/*error.log
+logpath = %s/*error.log
 maxretry = 6
 
 [apache-badbots]
 enabled = true
 port = http,https
 filter = apache-badbots
-logpath = /var/log/apache2/*access.log
+logpath = %s/*access.log
 maxretry = 2
 
 [nginx-http-auth]
 enabled = true
 port = http,https
 filter = nginx-http-auth
-logpath = /var/log/nginx/error.log
+logpath = %s/error.log
 maxretry = 6
 
 [nginx-badbots]
 enabled = true
 port = http,https
 filter = nginx-badbots
-logpath = /var/log/nginx/*access.log
-maxretry = 2`
+logpath = %s/*access.log
+maxretry = 2`, platform.AuthLog, platform.ApacheLogDir, platform.ApacheLogDir, platform.NginxLogDir, platform.NginxLogDir)
 
-	result := f.WriteFile("/etc/fail2ban/jail.local", config)
+	result := f.WriteConfig("/etc/fail2ban/jail.local", config, func() *Result {
+		return f.RunCommand("fail2ban-client", "-t")
+	})
 	if !result.Success {
 		return result
 	}
@@ -206,64 +226,99 @@ maxretry = 2`
 
 // GetFail2BanStatus gets Fail2ban status
 func (f *FirewallAction) GetFail2BanStatus() *Result {
-	return f.RunCommand("fail2ban-client", "status")
+	return f.query("fail2ban-client", "status")
 }
 
 // UnbanIP unbans an IP address from Fail2ban
-func (f *FirewallAction) UnbanIP(ip, jail string) *Result {
+func (f *FirewallAction) UnbanIP(ip, jail string) (res *Result) {
+	hook := f.Hook("UnbanIP", map[string]string{"ip": ip, "jail": jail})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	return f.RunCommand("fail2ban-client", "set", jail, "unbanip", ip)
 }
 
 // BanIP bans an IP address
-func (f *FirewallAction) BanIP(ip, jail string) *Result {
+func (f *FirewallAction) BanIP(ip, jail string) (res *Result) {
+	hook := f.Hook("BanIP", map[string]string{"ip": ip, "jail": jail})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	return f.RunCommand("fail2ban-client", "set", jail, "banip", ip)
 }
 
 // InstallIPSet installs and configures IPSet for IP lists
-func (f *FirewallAction) InstallIPSet() *Result {
-	if f.FileExists("/usr/bin/apt") {
-		return f.RunCommand("apt", "install", "-y", "ipset")
-	} else if f.FileExists("/usr/bin/yum") || f.FileExists("/usr/bin/dnf") {
-		var installCmd string
-		if f.FileExists("/usr/bin/dnf") {
-			installCmd = "dnf"
-		} else {
-			installCmd = "yum"
-		}
-		return f.RunCommand(installCmd, "install", "-y", "ipset")
+func (f *FirewallAction) InstallIPSet() (res *Result) {
+	hook := f.Hook("InstallIPSet", nil)
+	if failed := hook.Pre(); failed != nil {
+		return failed
 	}
+	defer hook.Post(&res)
 	
-	return &Result{
-		Success: false,
-		Message: "Unsupported package manager",
-		Error:   fmt.Errorf("unsupported package manager"),
+	pm := f.PackageManager()
+	if pm == nil {
+		return &Result{
+			Success: false,
+			Message: "Unsupported package manager",
+			Error:   newError(ErrUnsupportedPlatform, "unsupported package manager"),
+		}
 	}
+	
+	return pm.Install(ResolvePackages(pm, "", "ipset")...)
 }
 
 // CreateIPSet creates a new IP set
-func (f *FirewallAction) CreateIPSet(name, setType string) *Result {
+func (f *FirewallAction) CreateIPSet(name, setType string) (res *Result) {
+	hook := f.Hook("CreateIPSet", map[string]string{"name": name, "set_type": setType})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	return f.RunCommand("ipset", "create", name, setType)
 }
 
 // AddToIPSet adds an IP to an IP set
-func (f *FirewallAction) AddToIPSet(setName, ip string) *Result {
+func (f *FirewallAction) AddToIPSet(setName, ip string) (res *Result) {
+	hook := f.Hook("AddToIPSet", map[string]string{"set_name": setName, "ip": ip})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	return f.RunCommand("ipset", "add", setName, ip)
 }
 
 // RemoveFromIPSet removes an IP from an IP set
-func (f *FirewallAction) RemoveFromIPSet(setName, ip string) *Result {
+func (f *FirewallAction) RemoveFromIPSet(setName, ip string) (res *Result) {
+	hook := f.Hook("RemoveFromIPSet", map[string]string{"set_name": setName, "ip": ip})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	return f.RunCommand("ipset", "del", setName, ip)
 }
 
 // ListIPSets lists all IP sets
 func (f *FirewallAction) ListIPSets() *Result {
-	return f.RunCommand("ipset", "list")
+	return f.query("ipset", "list")
 }
 
 // SaveRules saves current iptables rules
-func (f *FirewallAction) SaveRules() *Result {
-	if f.FileExists("/usr/sbin/iptables-save") {
-		return f.RunCommand("sh", "-c", "iptables-save > /etc/iptables/rules.v4")
+func (f *FirewallAction) SaveRules() (res *Result) {
+	hook := f.Hook("SaveRules", nil)
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
+	if f.LocalFileExists("/usr/sbin/iptables-save") {
+		return f.RunCommand("sh", "-c", "iptables-save > "+f.Platform().IptablesRules)
 	}
 	return &Result{
 		Success: true,
@@ -272,19 +327,32 @@ func (f *FirewallAction) SaveRules() *Result {
 }
 
 // RestoreRules restores iptables rules from file
-func (f *FirewallAction) RestoreRules() *Result {
-	if f.FileExists("/etc/iptables/rules.v4") {
-		return f.RunCommand("iptables-restore", "/etc/iptables/rules.v4")
+func (f *FirewallAction) RestoreRules() (res *Result) {
+	hook := f.Hook("RestoreRules", nil)
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
+	rulesFile := f.Platform().IptablesRules
+	if f.FileExists(rulesFile) {
+		return f.RunCommand("iptables-restore", rulesFile)
 	}
 	return &Result{
 		Success: false,
 		Message: "No saved rules found",
-		Error:   fmt.Errorf("rules file not found"),
+		Error:   newError(ErrNotFound, "rules file not found"),
 	}
 }
 
 // FlushRules flushes all iptables rules
-func (f *FirewallAction) FlushRules() *Result {
+func (f *FirewallAction) FlushRules() (res *Result) {
+	hook := f.Hook("FlushRules", nil)
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	// Set default policies to ACCEPT before flushing
 	f.RunCommand("iptables", "-P", "INPUT", "ACCEPT")
 	f.RunCommand("iptables", "-P", "OUTPUT", "ACCEPT")
@@ -0,0 +1,138 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddRule(t *testing.T) {
+	tests := []struct {
+		name                           string
+		protocol, port, source, action string
+		saved                          bool // iptables-save is installed
+		fail                           string
+		want                           []string
+	}{
+		{
+			name: "allow port", protocol: "tcp", port: "443", action: "allow", saved: true,
+			want: []string{
+				"iptables -A INPUT -p tcp --dport 443 -j ACCEPT",
+				"test -f /usr/sbin/iptables-save",
+				"sh -c iptables-save > /etc/iptables/rules.v4",
+			},
+		},
+		{
+			name: "deny source", protocol: "tcp", source: "203.0.113.7", action: "deny",
+			want: []string{
+				"iptables -A INPUT -p tcp -s 203.0.113.7 -j DROP",
+				"test -f /usr/sbin/iptables-save",
+			},
+		},
+		{
+			name: "rejected rule", protocol: "tcp", port: "80", action: "allow",
+			fail: "iptables -A INPUT -p tcp --dport 80 -j ACCEPT",
+			want: []string{"iptables -A INPUT -p tcp --dport 80 -j ACCEPT"},
+		},
+		{
+			name: "failed save", protocol: "udp", port: "53", action: "allow", saved: true,
+			fail: "sh -c iptables-save > /etc/iptables/rules.v4",
+			want: []string{
+				"iptables -A INPUT -p udp --dport 53 -j ACCEPT",
+				"test -f /usr/sbin/iptables-save",
+				"sh -c iptables-save > /etc/iptables/rules.v4",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFirewallAction()
+			runner := fakeSystem(t, &f.BaseAction)
+			runner.Expect("iptables", ruleArgs("-A", tt.protocol, tt.port, tt.source, tt.action)...)
+			if tt.saved {
+				runner.Expect("test", "-f", "/usr/sbin/iptables-save")
+			}
+			runner.Expect("sh", "-c", "iptables-save > /etc/iptables/rules.v4")
+			if tt.fail != "" {
+				for _, expected := range runner.Unmet() {
+					if (Command{Name: expected.Name, Args: expected.Args}).String() == tt.fail {
+						expected.Fails("failed")
+					}
+				}
+			}
+
+			result := f.AddRule(tt.protocol, tt.port, tt.source, tt.action)
+			if result.Success != (tt.fail == "") {
+				t.Errorf("success = %t, error = %v", result.Success, result.Error)
+			}
+			checkCalls(t, runner, tt.want)
+		})
+	}
+}
+
+func TestSetupBasicRules(t *testing.T) {
+	rules := []string{
+		"iptables -A INPUT -i lo -j ACCEPT",
+		"iptables -A INPUT -m state --state ESTABLISHED,RELATED -j ACCEPT",
+		"iptables -A INPUT -p tcp --dport 22 -j ACCEPT",
+		"iptables -A INPUT -p tcp --dport 80 -j ACCEPT",
+		"iptables -A INPUT -p tcp --dport 443 -j ACCEPT",
+		"iptables -A INPUT -p tcp --dport 8083 -j ACCEPT",
+		"iptables -P INPUT DROP",
+		"iptables -P OUTPUT ACCEPT",
+		"iptables -P FORWARD ACCEPT",
+	}
+
+	tests := []struct {
+		name string
+		fail string
+		want []string
+	}{
+		{
+			name: "all rules",
+			want: append(append([]string{}, rules...), "test -f /usr/sbin/iptables-save"),
+		},
+		{
+			// The default policy must not drop SSH when its rule failed
+			name: "stops at failed rule",
+			fail: rules[2],
+			want: rules[:3],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFirewallAction()
+			runner := fakeSystem(t, &f.BaseAction)
+			for _, rule := range rules {
+				fields := strings.Fields(rule)
+				expected := runner.Expect(fields[0], fields[1:]...)
+				if rule == tt.fail {
+					expected.Fails("iptables: No chain/target/match by that name.")
+				}
+			}
+
+			result := f.SetupBasicRules()
+			if result.Success != (tt.fail == "") {
+				t.Errorf("success = %t, error = %v", result.Success, result.Error)
+			}
+			checkCalls(t, runner, tt.want)
+		})
+	}
+}
+
+func TestBanIPTimeout(t *testing.T) {
+	f := NewFirewallAction()
+	runner := fakeSystem(t, &f.BaseAction)
+	runner.Expect("fail2ban-client", "set", "sshd", "banip", "203.0.113.7").Blocks()
+	f.SetTimeout(10 * time.Millisecond)
+
+	result := f.BanIP("203.0.113.7", "sshd")
+	if result.Success || !errors.Is(result.Error, context.DeadlineExceeded) {
+		t.Errorf("success = %t, error = %v, want a timeout", result.Success, result.Error)
+	}
+	checkCalls(t, runner, []string{"fail2ban-client set sshd banip 203.0.113.7"})
+}
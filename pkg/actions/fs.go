@@ -0,0 +1,264 @@
+package actions
+
+import (
+	"easygo/pkg/config"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// FileSystem holds the files of the managed system: web server, PHP and
+// cron configuration, document roots and certificates. Paths are absolute
+// paths on the managed system. EasyGo's own files (state, file versions,
+// hooks) are not accessed through it.
+type FileSystem interface {
+	Stat(path string) (fs.FileInfo, error)
+	ReadFile(path string) ([]byte, error)
+	ReadDir(path string) ([]fs.DirEntry, error)
+	// WriteFile atomically replaces a file's content, keeping the mode and
+	// ownership of an existing file
+	WriteFile(path string, content []byte) error
+	// WritePrivateFile writes a file as WriteFile does, leaving it
+	// readable by its owner only
+	WritePrivateFile(path string, content []byte) error
+	MkdirAll(path string) error
+	// Remove removes a file; a missing file is not an error
+	Remove(path string) error
+	// RemoveAll removes a directory and everything in it
+	RemoveAll(path string) error
+	Readlink(path string) (string, error)
+	// Symlink creates or replaces a symbolic link
+	Symlink(target, link string) error
+	// EvalSymlinks follows symbolic links to the path they lead to
+	EvalSymlinks(path string) (string, error)
+}
+
+// OSFileSystem is the local file system. With a Root, every path is taken
+// relative to it, as if the process were chrooted there: /etc/nginx is
+// Root/etc/nginx, and absolute symbolic links stay under Root too. Missing
+// parent directories are created when writing files and links under a
+// Root, so a complete server configuration can be rendered into an empty
+// staging directory.
+type OSFileSystem struct {
+	Root string // empty or / for the real root
+}
+
+// DefaultFileSystem is used by actions that have no file system of their
+// own. When nil, the local file system under paths.root is used.
+var DefaultFileSystem FileSystem
+
+// SetFileSystem sets the file system the action reads and writes
+func (ba *BaseAction) SetFileSystem(fsys FileSystem) {
+	ba.fsys = fsys
+}
+
+// FileSystem returns the file system the action reads and writes
+func (ba *BaseAction) FileSystem() FileSystem {
+	if ba.fsys != nil {
+		return ba.fsys
+	}
+	if DefaultFileSystem != nil {
+		return DefaultFileSystem
+	}
+	return OSFileSystem{Root: config.Current().Paths.Root}
+}
+
+// localPath returns where local commands find a path of the managed system
+func (ba *BaseAction) localPath(path string) string {
+	if fsys, ok := ba.FileSystem().(OSFileSystem); ok {
+		return fsys.Path(path)
+	}
+	return path
+}
+
+// Path returns where a path of the managed system is on the local one
+func (f OSFileSystem) Path(path string) string {
+	if f.chrooted() {
+		return filepath.Join(f.Root, filepath.Clean("/"+path))
+	}
+	return path
+}
+
+// chrooted reports whether paths are taken relative to a root
+func (f OSFileSystem) chrooted() bool {
+	return f.Root != "" && f.Root != "/"
+}
+
+// target returns the local path of the file a path leads to. Under a
+// root, symbolic links are followed here, since the kernel would resolve
+// absolute ones against the real root.
+func (f OSFileSystem) target(path string) string {
+	if f.chrooted() {
+		if resolved, err := f.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+	}
+	return f.Path(path)
+}
+
+func (f OSFileSystem) Stat(path string) (fs.FileInfo, error) {
+	return os.Stat(f.target(path))
+}
+
+func (f OSFileSystem) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(f.target(path))
+}
+
+func (f OSFileSystem) ReadDir(path string) ([]fs.DirEntry, error) {
+	return os.ReadDir(f.target(path))
+}
+
+func (f OSFileSystem) MkdirAll(path string) error {
+	return os.MkdirAll(f.Path(path), 0755)
+}
+
+func (f OSFileSystem) Remove(path string) error {
+	if err := os.Remove(f.Path(path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (f OSFileSystem) RemoveAll(path string) error {
+	return os.RemoveAll(f.Path(path))
+}
+
+func (f OSFileSystem) Readlink(path string) (string, error) {
+	return os.Readlink(f.Path(path))
+}
+
+func (f OSFileSystem) Symlink(target, link string) error {
+	if err := f.Remove(link); err != nil {
+		return err
+	}
+	if f.chrooted() {
+		if err := os.MkdirAll(filepath.Dir(f.Path(link)), 0755); err != nil {
+			return err
+		}
+	}
+	return os.Symlink(target, f.Path(link))
+}
+
+func (f OSFileSystem) WriteFile(path string, content []byte) error {
+	return f.writeFile(path, content, 0)
+}
+
+func (f OSFileSystem) WritePrivateFile(path string, content []byte) error {
+	return f.writeFile(path, content, 0600)
+}
+
+// writeFile writes a synced temporary file next to the file and renames it
+// into place. Without a mode, an existing file's is kept and a new file
+// gets 0644.
+func (f OSFileSystem) writeFile(path string, content []byte, mode os.FileMode) error {
+	path = f.target(path)
+	if f.chrooted() {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+	}
+
+	uid, gid := -1, -1
+	info, err := os.Stat(path)
+	if err == nil {
+		if mode == 0 {
+			mode = info.Mode().Perm()
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			uid, gid = int(stat.Uid), int(stat.Gid)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if mode == 0 {
+		mode = 0644
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".easygo-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if uid >= 0 {
+		tmp.Chown(uid, gid)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+
+	// Make the rename durable
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// maxLinks is how many symbolic links EvalSymlinks follows before giving up
+const maxLinks = 255
+
+// EvalSymlinks follows symbolic links under the root, resolving absolute
+// link targets against the root rather than the real /
+func (f OSFileSystem) EvalSymlinks(path string) (string, error) {
+	if !f.chrooted() {
+		return filepath.EvalSymlinks(path)
+	}
+
+	resolved := "/"
+	rest := strings.Split(filepath.Clean("/"+path), "/")
+	for links := 0; len(rest) > 0; {
+		name := rest[0]
+		rest = rest[1:]
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, name)
+		info, err := os.Lstat(f.Path(next))
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		if links++; links > maxLinks {
+			return "", &fs.PathError{Op: "evalsymlinks", Path: path, Err: errors.New("too many links")}
+		}
+		target, err := os.Readlink(f.Path(next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			resolved = "/"
+		}
+		rest = append(strings.Split(target, "/"), rest...)
+	}
+	return resolved, nil
+}
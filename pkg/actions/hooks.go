@@ -0,0 +1,215 @@
+package actions
+
+import (
+	"easygo/pkg/config"
+	"easygo/pkg/events"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Hook phases
+const (
+	HookPre  = "pre"
+	HookPost = "post"
+)
+
+// HookRun is the outcome of one hook script
+type HookRun struct {
+	Action   string `json:"action"`
+	Phase    string `json:"phase"`
+	Script   string `json:"script"`
+	Success  bool   `json:"success"`
+	ExitCode int    `json:"exit_code"` // -1 when the script did not exit normally
+	Output   string `json:"output,omitempty"`
+}
+
+// HookPayload is the JSON a hook script receives on stdin
+type HookPayload struct {
+	Action string            `json:"action"`
+	Phase  string            `json:"phase"`
+	Params map[string]string `json:"params,omitempty"`
+	User   string            `json:"user,omitempty"`
+	Time   time.Time         `json:"time"`
+	Result *HookResult       `json:"result,omitempty"` // post hooks only
+}
+
+// HookResult is the outcome of the action, as passed to post hooks
+type HookResult struct {
+	Success   bool   `json:"success"`
+	Message   string `json:"message"`
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// Hook runs the scripts in <hooks dir>/<action>/pre.d before an action
+// and those in post.d after it. Actions use it as:
+//
+//	hook := ba.Hook("ConfigureNginxVhost", params)
+//	if failed := hook.Pre(); failed != nil {
+//		return failed
+//	}
+//	defer hook.Post(&res)
+type Hook struct {
+	ba      *BaseAction
+	action  string
+	params  map[string]string
+	runs    []HookRun
+	started time.Time
+}
+
+// Hook prepares the hooks of an action. params describe the operation to
+// the scripts and must not hold secrets.
+func (ba *BaseAction) Hook(action string, params map[string]string) *Hook {
+	return &Hook{ba: ba, action: action, params: params, started: time.Now()}
+}
+
+// Pre runs the pre hooks. When one exits non-zero the remaining hooks are
+// skipped and the returned result aborts the action, which is published
+// like a failed action; otherwise Pre returns nil.
+func (h *Hook) Pre() *Result {
+	for _, script := range hookScripts(h.action, HookPre) {
+		run := h.run(script, HookPre, nil)
+		if run.Success {
+			continue
+		}
+		message := fmt.Sprintf("Pre hook %s aborted %s", filepath.Base(script), h.action)
+		if run.Output != "" {
+			message += ": " + run.Output
+		}
+		result := &Result{
+			Success: false,
+			Message: message,
+			Error:   &Error{Kind: ErrCommandFailed, Msg: fmt.Sprintf("pre hook %s exited with status %d", script, run.ExitCode)},
+			Hooks:   h.runs,
+		}
+		h.publish(result)
+		return result
+	}
+	return nil
+}
+
+// Post runs the post hooks with the action's result and attaches the
+// output of every hook to it. A failing post hook is reported in the
+// result but does not fail the action, which has already been done.
+// Unless this is a dry run, the action's event is then published.
+func (h *Hook) Post(res **Result) {
+	result := *res
+	if result == nil {
+		return
+	}
+
+	outcome := &HookResult{Success: result.Success, Message: strings.TrimSpace(result.Message)}
+	if result.Error != nil {
+		outcome.Error = result.Error.Error()
+		outcome.ErrorCode = ErrorCode(result.Error)
+	}
+	for _, script := range hookScripts(h.action, HookPost) {
+		h.run(script, HookPost, outcome)
+	}
+	result.Hooks = append(result.Hooks, h.runs...)
+
+	h.publish(result)
+}
+
+// publish logs the action's result and publishes its event, unless this
+// is a dry run
+func (h *Hook) publish(result *Result) {
+	if h.ba.DryRun() {
+		return
+	}
+
+	origin := events.OriginFrom(h.ba.Context())
+	user := h.ba.owner
+	if user == "" {
+		user = origin.User
+	}
+	event := &events.Event{
+		Type:       h.action,
+		User:       user,
+		Interface:  origin.Interface,
+		Source:     origin.Source,
+		Success:    result.Success,
+		Message:    strings.TrimSpace(result.Message),
+		Params:     h.params,
+		DurationMS: time.Since(h.started).Milliseconds(),
+	}
+	if result.Error != nil {
+		event.Error = result.Error.Error()
+		event.ErrorCode = ErrorCode(result.Error)
+	}
+
+	if event.Success {
+		slog.InfoContext(h.ba.Context(), "Action succeeded", "action", h.action, "user", user, "duration_ms", event.DurationMS)
+	} else {
+		slog.WarnContext(h.ba.Context(), "Action failed", "action", h.action, "user", user, "duration_ms", event.DurationMS, "error", event.Error)
+	}
+	events.Default.Publish(event)
+}
+
+// run runs one hook script with the payload on stdin. In dry-run mode the
+// script is only recorded in the plan.
+func (h *Hook) run(script, phase string, outcome *HookResult) HookRun {
+	cmd := Command{Name: script}
+	if h.ba.DryRun() {
+		h.ba.plan.add(PlannedOperation{Kind: PlanCommand, Command: cmd.String()})
+		run := HookRun{Action: h.action, Phase: phase, Script: script, Success: true}
+		h.runs = append(h.runs, run)
+		return run
+	}
+
+	payload, _ := json.Marshal(&HookPayload{
+		Action: h.action,
+		Phase:  phase,
+		Params: h.params,
+		User:   h.ba.owner,
+		Time:   time.Now(),
+		Result: outcome,
+	})
+	cmd.Stdin = string(payload)
+	slog.DebugContext(h.ba.Context(), "Running hook", "action", h.action, "phase", phase, "script", script)
+	output, err := h.ba.exec(cmd)
+
+	run := HookRun{
+		Action:  h.action,
+		Phase:   phase,
+		Script:  script,
+		Success: err == nil,
+		Output:  strings.TrimSpace(string(output)),
+	}
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		run.ExitCode = cmdErr.ExitCode
+	}
+	h.runs = append(h.runs, run)
+	return run
+}
+
+// hookScripts lists the executable scripts of an action's phase in the
+// order they run, sorted by file name. Hidden files are skipped.
+func hookScripts(action, phase string) []string {
+	dir := filepath.Join(config.Current().Paths.Hooks, action, phase+".d")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var scripts []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		scripts = append(scripts, path)
+	}
+	return scripts
+}
@@ -0,0 +1,49 @@
+package actions
+
+import (
+	"easygo/pkg/config"
+	"easygo/pkg/events"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestHookPreAbortPublishesEvent(t *testing.T) {
+	var mu sync.Mutex
+	var published []*events.Event
+	events.Default.Subscribe(func(event *events.Event) {
+		if event.Type != "UninstallApache" {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		published = append(published, event)
+	})
+
+	w := NewWebServerAction()
+	runner := fakeSystem(t, &w.BaseAction)
+	script := filepath.Join(config.Current().Paths.Hooks, "UninstallApache", "pre.d", "10-deny")
+	if err := os.MkdirAll(filepath.Dir(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(script, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	runner.Expect(script).Fails("apache still serves sites")
+
+	result := w.UninstallApache()
+	if result.Success {
+		t.Fatal("aborted action succeeded")
+	}
+	checkCalls(t, runner, []string{script})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(published) != 1 {
+		t.Fatalf("published %d events, want 1", len(published))
+	}
+	if event := published[0]; event.Success || event.ErrorCode != "command_failed" || event.Message != result.Message {
+		t.Errorf("event = %+v, want the aborted result", event)
+	}
+}
@@ -0,0 +1,302 @@
+package actions
+
+import (
+	"easygo/pkg/config"
+	"easygo/pkg/state"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+)
+
+// HybridVhostTemplate renders the Nginx side of hybrid vhosts
+const HybridVhostTemplate = "hybrid"
+
+// remoteIPSnippet is the Apache configuration snippet taking the client
+// address of hybrid vhosts' requests from Nginx's X-Forwarded-For header
+const remoteIPSnippet = "easygo-remoteip"
+
+// ConfigureHybridVhost puts Nginx in front of Apache for a domain. Apache
+// renders the vhost from the template, .htaccess files and all, listening
+// on vhosts.hybrid_backend only; Nginx takes ports 80 and 443, serves
+// static files and passes everything else on to Apache, which logs the
+// real client address through mod_remoteip.
+func (w *WebServerAction) ConfigureHybridVhost(domain, docroot string, options *VhostOptions) *Result {
+	hybrid := VhostOptions{}
+	if options != nil {
+		hybrid = *options
+	}
+	hybrid.Hybrid = true
+	return w.ConfigureVhost(WebServerNginx, domain, docroot, &hybrid)
+}
+
+// configureHybridVhost renders both sides of a hybrid vhost, moves Apache
+// to the backend address and restarts both web servers
+func (w *WebServerAction) configureHybridVhost(domain, docroot string, options *VhostOptions) (res *Result) {
+	hook := w.Hook("ConfigureHybridVhost", map[string]string{"domain": domain, "docroot": docroot, "template": options.Template})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+
+	if failure := validateVhostPaths(domain, docroot); failure != nil {
+		return failure
+	}
+	if options.Proxy != nil {
+		return &Result{
+			Success: false,
+			Message: "Hybrid vhosts pass requests on to Apache and take no proxy settings",
+			Error:   newError(ErrValidationFailed, "hybrid vhosts take no proxy settings"),
+		}
+	}
+	apache, _ := w.vhostLayout(WebServerApache)
+	nginx, _ := w.vhostLayout(WebServerNginx)
+
+	backendTemplate, failure := w.vhostTemplate(WebServerApache, options.Template)
+	if failure != nil {
+		return failure
+	}
+	if backendTemplate.Proxy {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("Template %s cannot render the Apache side of hybrid vhosts", backendTemplate.Name),
+			Error:   newError(ErrValidationFailed, "template %s is a proxy template", backendTemplate.Name),
+		}
+	}
+	frontTemplate, failure := w.vhostTemplate(WebServerNginx, HybridVhostTemplate)
+	if failure != nil {
+		return failure
+	}
+	backendConfig, failure := w.renderVhost(apache, backendTemplate, domain, docroot, options)
+	if failure != nil {
+		return failure
+	}
+	frontConfig, failure := w.renderVhost(nginx, frontTemplate, domain, docroot, &VhostOptions{Hybrid: true, TLS: options.TLS})
+	if failure != nil {
+		return failure
+	}
+
+	if failure := w.rejectPlainApacheVhosts(apache, domain); failure != nil {
+		return failure
+	}
+
+	// Bring Apache back up on its previous ports if a restart fails
+	tx := w.Begin(fmt.Sprintf("hybrid vhost %s", domain))
+	tx.OnRollback("restart "+apache.service, func() *Result {
+		return w.RestartService(apache.service)
+	})
+	if result := w.hybridBackendSteps(tx); !result.Success {
+		return result
+	}
+	if result := w.writeVhostSteps(tx, apache, domain, backendConfig); !result.Success {
+		return result
+	}
+	if result := w.writeVhostSteps(tx, nginx, domain, frontConfig); !result.Success {
+		return result
+	}
+	if result := tx.Validate(apache.test[0], apache.test[1:]...); !result.Success {
+		return result
+	}
+	if result := tx.Validate(nginx.test[0], nginx.test[1:]...); !result.Success {
+		return result
+	}
+
+	// Apache restarts first to free the ports Nginx takes over. Nginx is
+	// restarted rather than reloaded, as it may not have been running.
+	if result := tx.Do("restart "+apache.service, func() *Result {
+		return w.RestartService(apache.service)
+	}, nil); !result.Success {
+		return result
+	}
+	result := tx.Commit(tx.Do("restart "+nginx.service, func() *Result {
+		return w.RestartService(nginx.service)
+	}, nil))
+	if result.Success {
+		w.recordDomain(domain, docroot, WebServerNginx, nginx.configPath(domain), options)
+	}
+	return result
+}
+
+// rejectPlainApacheVhosts refuses to move Apache behind Nginx while it
+// serves enabled vhosts other than the domain's that are not hybrid: they
+// would be taken offline along with ports 80 and 443
+func (w *WebServerAction) rejectPlainApacheVhosts(apache *vhostLayout, domain string) *Result {
+	vhosts, err := w.vhosts(apache)
+	if err != nil {
+		return &Result{
+			Success: false,
+			Message: "Failed to read the state store",
+			Error:   err,
+		}
+	}
+
+	var plain []string
+	for _, vhost := range vhosts {
+		if vhost.Enabled && !vhost.Hybrid && vhost.Domain != domain {
+			plain = append(plain, vhost.Domain)
+		}
+	}
+	if len(plain) == 0 {
+		return nil
+	}
+	return &Result{
+		Success: false,
+		Message: fmt.Sprintf("Apache serves %s on ports 80 and 443, which Nginx would take over for hybrid vhost %s; disable them first and make each a hybrid vhost, or delete them", strings.Join(plain, ", "), domain),
+		Error:   newError(ErrConflict, "apache vhosts %s are not hybrid", strings.Join(plain, ", ")),
+	}
+}
+
+// hybridBackendSteps moves Apache to vhosts.hybrid_backend and has it take
+// client addresses from Nginx. Both are no-ops once done.
+func (w *WebServerAction) hybridBackendSteps(tx *Transaction) *Result {
+	platform := w.Platform()
+	backend := config.Current().Vhosts.HybridBackend
+	fsys := w.FileSystem()
+
+	content, err := fsys.ReadFile(platform.ApachePortsConf)
+	if err != nil {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("Failed to read %s, is Apache installed?", platform.ApachePortsConf),
+			Error:   err,
+		}
+	}
+	if ports := listenOn(string(content), backend); ports != string(content) {
+		if result := tx.WriteFile(platform.ApachePortsConf, ports); !result.Success {
+			return result
+		}
+	}
+
+	// Other files Apache includes may listen on the ports too, such as
+	// conf.d/ssl.conf with "Listen 443 https" on RHEL
+	for _, path := range apacheConfFiles(fsys, platform.ApacheConfDir) {
+		if path == platform.ApachePortsConf {
+			continue
+		}
+		content, err := fsys.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		lines := strings.Split(string(content), "\n")
+		if commentListen(lines) < 0 {
+			continue
+		}
+		if result := tx.WriteFile(path, strings.Join(lines, "\n")); !result.Success {
+			return result
+		}
+	}
+
+	snippet := filepath.Join(platform.ApacheConfSnippets, remoteIPSnippet+".conf")
+	if result := tx.WriteFile(snippet, remoteIPConfig(platform, backend)); !result.Success {
+		return result
+	}
+
+	if result := w.apacheModuleStep(tx, "remoteip"); !result.Success {
+		return result
+	}
+	return w.apacheConfStep(tx, remoteIPSnippet)
+}
+
+// listenOn rewrites Apache's Listen directives so that it listens on the
+// backend address only: those for ports 80 and 443, which Nginx takes
+// over, are commented out and the backend's is added after the first
+func listenOn(content, backend string) string {
+	lines := strings.Split(content, "\n")
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) >= 2 && strings.EqualFold(fields[0], "Listen") && fields[1] == backend {
+			return content
+		}
+	}
+	at := commentListen(lines)
+
+	listen := []string{"# Nginx serves ports 80 and 443 in front of Apache (EasyGo hybrid vhosts)", "Listen " + backend}
+	if at < 0 {
+		return strings.TrimRight(content, "\n") + "\n\n" + strings.Join(listen, "\n") + "\n"
+	}
+	return strings.Join(append(lines[:at+1], append(listen, lines[at+1:]...)...), "\n")
+}
+
+// commentListen comments out the Listen directives for ports 80 and 443
+// and returns the index of the first, or -1 when there was none
+func commentListen(lines []string) int {
+	first := -1
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "Listen") {
+			continue
+		}
+		port := fields[1][strings.LastIndex(fields[1], ":")+1:]
+		if port != "80" && port != "443" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		lines[i] = indent + "#" + strings.TrimLeft(line, " \t")
+		if first < 0 {
+			first = i
+		}
+	}
+	return first
+}
+
+// apacheConfFiles lists the .conf files under Apache's configuration
+// directory. Symbolic links, such as those in mods-enabled, are skipped:
+// the files they point to are listed where they are.
+func apacheConfFiles(fsys FileSystem, dir string) []string {
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var files []string
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		switch {
+		case strings.HasPrefix(entry.Name(), "."):
+		case entry.IsDir():
+			files = append(files, apacheConfFiles(fsys, path)...)
+		case entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), ".conf"):
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// remoteIPConfig returns the mod_remoteip snippet: Apache logs and sees the
+// client address Nginx passes on, and HTTPS when Nginx terminated TLS
+func remoteIPConfig(platform *Platform, backend string) string {
+	host, _, _ := net.SplitHostPort(backend)
+	var snippet strings.Builder
+	snippet.WriteString("# Managed by EasyGo: requests of hybrid vhosts come from Nginx\n")
+	if platform.Family == FamilyRHEL || platform.Family == FamilyAlpine {
+		snippet.WriteString("<IfModule !remoteip_module>\n    LoadModule remoteip_module modules/mod_remoteip.so\n</IfModule>\n")
+	}
+	fmt.Fprintf(&snippet, `RemoteIPHeader X-Forwarded-For
+RemoteIPInternalProxy %s
+SetEnvIf X-Forwarded-Proto "^https$" HTTPS=on
+LogFormat "%%a %%l %%u %%t \"%%r\" %%>s %%b \"%%{Referer}i\" \"%%{User-Agent}i\"" combined
+`, host)
+	return snippet.String()
+}
+
+// hybridDomain reports whether a domain is recorded as a hybrid vhost
+func (w *WebServerAction) hybridDomain(domain string) bool {
+	store := w.Store()
+	if store == nil {
+		return false
+	}
+	record, err := store.Domains().Get((&state.Domain{Name: domain, WebServer: WebServerNginx}).Key())
+	return err == nil && record.Hybrid
+}
+
+// rejectHybridBackend rejects changes to the Apache side of a hybrid vhost,
+// which follows its Nginx vhost
+func rejectHybridBackend(layout *vhostLayout, vhost *Vhost) *Result {
+	if vhost.Hybrid && layout.webServer == WebServerApache {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("The Apache side of hybrid vhost %s follows its Nginx vhost", vhost.Domain),
+			Error:   newError(ErrValidationFailed, "%s is the backend of a hybrid vhost", vhost.Domain),
+		}
+	}
+	return nil
+}
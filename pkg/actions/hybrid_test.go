@@ -0,0 +1,82 @@
+package actions
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigureHybridVhostListen(t *testing.T) {
+	w := NewWebServerAction()
+	runner := fakeSystem(t, &w.BaseAction)
+	w.SetPlatform(ParseOSRelease("ID=rocky\nVERSION_ID=9\n"))
+	platform := w.Platform()
+	sslConf := filepath.Join(platform.ApacheConfDir, "conf.d", "ssl.conf")
+	for path, content := range map[string]string{
+		platform.ApachePortsConf: "ServerRoot \"/etc/httpd\"\nListen 80\nInclude conf.modules.d/*.conf\n",
+		sslConf:                  "Listen 443 https\nSSLPassPhraseDialog exec:/usr/libexec/httpd-ssl-pass-dialog\n",
+	} {
+		if result := w.WriteFile(path, content); !result.Success {
+			t.Fatalf("write %s: %v", path, result.Error)
+		}
+	}
+	for _, line := range []string{"apachectl configtest", "nginx -t", "systemctl restart httpd", "systemctl restart nginx"} {
+		fields := strings.Fields(line)
+		runner.Expect(fields[0], fields[1:]...)
+	}
+
+	if result := w.ConfigureHybridVhost("example.com", "/var/www/example.com", nil); !result.Success {
+		t.Fatalf("error = %v (%s)", result.Error, result.Message)
+	}
+
+	want := map[string]string{
+		platform.ApachePortsConf: "#Listen 80\n# Nginx serves ports 80 and 443 in front of Apache (EasyGo hybrid vhosts)\nListen 127.0.0.1:8081\n",
+		sslConf:                  "#Listen 443 https\n",
+	}
+	for path, lines := range want {
+		content, err := w.FileSystem().ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(content), lines) {
+			t.Errorf("%s:\n%s\nwant it to hold:\n%s", path, content, lines)
+		}
+	}
+}
+
+func TestConfigureHybridVhostPlainApacheVhosts(t *testing.T) {
+	w := NewWebServerAction()
+	runner := fakeSystem(t, &w.BaseAction)
+	runner.Expect("a2ensite", "blog.example.com")
+	runner.Expect("apachectl", "configtest")
+	runner.Expect("systemctl", "reload", "apache2")
+	if result := w.ConfigureVhost(WebServerApache, "blog.example.com", "/var/www/blog", &VhostOptions{Template: "static"}); !result.Success {
+		t.Fatalf("configure blog.example.com: %v (%s)", result.Error, result.Message)
+	}
+	// a2ensite is faked, so the vhost is enabled by hand
+	apache, _ := w.vhostLayout(WebServerApache)
+	enabled := apache.enabledPath("blog.example.com")
+	if err := w.FileSystem().Symlink(apache.configPath("blog.example.com"), enabled); err != nil {
+		t.Fatal(err)
+	}
+	configured := len(runner.Calls())
+
+	result := w.ConfigureHybridVhost("example.com", "/var/www/example.com", nil)
+	if code := ErrorCode(result.Error); result.Success || code != "conflict" {
+		t.Fatalf("code = %q, want conflict (%s)", code, result.Message)
+	}
+	if !strings.Contains(result.Message, "blog.example.com") {
+		t.Errorf("message = %q, want it to name blog.example.com", result.Message)
+	}
+	if calls := runner.Calls()[configured:]; len(calls) != 0 {
+		t.Errorf("commands = %v, want none", calls)
+	}
+
+	// A disabled vhost is not taken offline, and can be made hybrid next
+	if err := w.FileSystem().Remove(enabled); err != nil {
+		t.Fatal(err)
+	}
+	if failure := w.rejectPlainApacheVhosts(apache, "example.com"); failure != nil {
+		t.Errorf("refused with blog.example.com disabled: %s", failure.Message)
+	}
+}
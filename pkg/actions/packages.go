@@ -0,0 +1,453 @@
+package actions
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PackageManager abstracts the system package manager
+type PackageManager interface {
+	// Name returns the package manager command, e.g. "apt" or "dnf"
+	Name() string
+	Install(packages ...string) *Result
+	Remove(packages ...string) *Result
+	// Purge removes packages together with their configuration files
+	Purge(packages ...string) *Result
+	// Update refreshes the package index
+	Update() *Result
+	// Autoremove removes packages that are no longer needed
+	Autoremove() *Result
+	IsInstalled(pkg string) bool
+	// Version returns the installed version of a package
+	Version(pkg string) (string, error)
+	// AddRepository adds a package repository (PPA, release package or URL)
+	AddRepository(repo string) *Result
+	// EnableRepository enables an already configured repository
+	EnableRepository(name string) *Result
+}
+
+// packageManagerBinaries lists supported package managers in detection order
+var packageManagerBinaries = []struct {
+	name string
+	path string
+}{
+	{"apt", "/usr/bin/apt"},
+	{"dnf", "/usr/bin/dnf"},
+	{"yum", "/usr/bin/yum"},
+	{"zypper", "/usr/bin/zypper"},
+	{"apk", "/sbin/apk"},
+}
+
+// packageNames maps logical package names to the names used by each
+// package manager. "{version}" is replaced with the requested version
+// (e.g. 8.2) and "{v}" with the version without dots (e.g. 82). Logical
+// names that are missing from the table are used unchanged; a package
+// manager missing from an entry needs no package for that name.
+var packageNames = map[string]map[string][]string{
+	"apache": {
+		"apt":    {"apache2"},
+		"dnf":    {"httpd"},
+		"yum":    {"httpd"},
+		"zypper": {"apache2"},
+		"apk":    {"apache2"},
+	},
+	"apache-purge": {
+		"apt":    {"apache2", "apache2-utils", "apache2-data", "apache2-bin"},
+		"dnf":    {"httpd", "httpd-tools"},
+		"yum":    {"httpd", "httpd-tools"},
+		"zypper": {"apache2", "apache2-utils"},
+		"apk":    {"apache2", "apache2-utils"},
+	},
+	"nginx": {
+		"apt":    {"nginx"},
+		"dnf":    {"nginx"},
+		"yum":    {"nginx"},
+		"zypper": {"nginx"},
+		"apk":    {"nginx"},
+	},
+	"nginx-purge": {
+		"apt":    {"nginx", "nginx-common", "nginx-core"},
+		"dnf":    {"nginx"},
+		"yum":    {"nginx"},
+		"zypper": {"nginx"},
+		"apk":    {"nginx"},
+	},
+	"mariadb": {
+		"apt":    {"mariadb-server", "mariadb-client"},
+		"dnf":    {"mariadb-server", "mariadb"},
+		"yum":    {"mariadb-server", "mariadb"},
+		"zypper": {"mariadb", "mariadb-client"},
+		"apk":    {"mariadb", "mariadb-client"},
+	},
+	"postgresql": {
+		"apt":    {"postgresql", "postgresql-contrib"},
+		"dnf":    {"postgresql-server", "postgresql-contrib"},
+		"yum":    {"postgresql-server", "postgresql-contrib"},
+		"zypper": {"postgresql-server", "postgresql-contrib"},
+		"apk":    {"postgresql", "postgresql-contrib"},
+	},
+	"phpmyadmin": {
+		"apt": {"phpmyadmin", "php-mbstring", "php-zip", "php-gd", "php-json", "php-curl"},
+	},
+	"certbot": {
+		"apt":    {"certbot"},
+		"dnf":    {"certbot"},
+		"yum":    {"certbot"},
+		"zypper": {"python3-certbot"},
+		"apk":    {"certbot"},
+	},
+	"certbot-dns-cloudflare": {
+		"apt": {"python3-certbot-dns-cloudflare"},
+		"dnf": {"python3-certbot-dns-cloudflare"},
+		"yum": {"python3-certbot-dns-cloudflare"},
+		"apk": {"certbot-dns-cloudflare"},
+	},
+	"certbot-dns-route53": {
+		"apt": {"python3-certbot-dns-route53"},
+		"dnf": {"python3-certbot-dns-route53"},
+		"yum": {"python3-certbot-dns-route53"},
+		"apk": {"certbot-dns-route53"},
+	},
+	"certbot-dns-digitalocean": {
+		"apt": {"python3-certbot-dns-digitalocean"},
+		"dnf": {"python3-certbot-dns-digitalocean"},
+		"yum": {"python3-certbot-dns-digitalocean"},
+		"apk": {"certbot-dns-digitalocean"},
+	},
+	"firewall": {
+		"apt":    {"iptables-persistent"},
+		"dnf":    {"iptables-services"},
+		"yum":    {"iptables-services"},
+		"zypper": {"iptables"},
+		"apk":    {"iptables"},
+	},
+	"fail2ban": {
+		"apt":    {"fail2ban"},
+		"dnf":    {"fail2ban"},
+		"yum":    {"fail2ban"},
+		"zypper": {"fail2ban"},
+		"apk":    {"fail2ban"},
+	},
+	"ipset": {
+		"apt":    {"ipset"},
+		"dnf":    {"ipset"},
+		"yum":    {"ipset"},
+		"zypper": {"ipset"},
+		"apk":    {"ipset"},
+	},
+	"php": {
+		"apt": {
+			"php{version}", "php{version}-fpm", "php{version}-cli", "php{version}-common",
+			"php{version}-mysql", "php{version}-pgsql", "php{version}-sqlite3", "php{version}-curl",
+			"php{version}-gd", "php{version}-mbstring", "php{version}-xml", "php{version}-zip",
+			"php{version}-bcmath", "php{version}-intl", "php{version}-opcache", "php{version}-readline",
+		},
+		"dnf": {
+			"php", "php-fpm", "php-cli", "php-common", "php-mysqlnd", "php-pgsql", "php-sqlite3",
+			"php-curl", "php-gd", "php-mbstring", "php-xml", "php-zip", "php-bcmath", "php-intl",
+			"php-json", "php-opcache",
+		},
+		"yum": {
+			"php", "php-fpm", "php-cli", "php-common", "php-mysqlnd", "php-pgsql", "php-sqlite3",
+			"php-curl", "php-gd", "php-mbstring", "php-xml", "php-zip", "php-bcmath", "php-intl",
+			"php-json", "php-opcache",
+		},
+		"zypper": {
+			"php8", "php8-fpm", "php8-cli", "php8-mysql", "php8-pgsql", "php8-sqlite", "php8-curl",
+			"php8-gd", "php8-mbstring", "php8-xmlreader", "php8-zip", "php8-bcmath", "php8-intl",
+			"php8-opcache",
+		},
+		"apk": {
+			"php{v}", "php{v}-fpm", "php{v}-mysqli", "php{v}-pdo_mysql", "php{v}-pgsql",
+			"php{v}-sqlite3", "php{v}-curl", "php{v}-gd", "php{v}-mbstring", "php{v}-xml",
+			"php{v}-zip", "php{v}-bcmath", "php{v}-intl", "php{v}-opcache",
+		},
+	},
+	// The json extension is built into PHP 8.0 and later
+	"php-json": {
+		"apt": {"php{version}-json"},
+	},
+}
+
+// ResolvePackages maps logical package names to the package names used by
+// the given package manager, substituting version placeholders
+func ResolvePackages(pm PackageManager, version string, names ...string) []string {
+	versionNoDot := strings.Replace(version, ".", "", -1)
+
+	var packages []string
+	for _, name := range names {
+		resolved := []string{name}
+		if mapping, ok := packageNames[name]; ok {
+			resolved = mapping[pm.Name()]
+		}
+		for _, pkg := range resolved {
+			pkg = strings.Replace(pkg, "{version}", version, -1)
+			pkg = strings.Replace(pkg, "{v}", versionNoDot, -1)
+			packages = append(packages, pkg)
+		}
+	}
+	return packages
+}
+
+// PackageManager detects the system package manager. It returns nil when
+// none of the supported package managers is available.
+func (ba *BaseAction) PackageManager() PackageManager {
+	for _, candidate := range packageManagerBinaries {
+		if ba.FileExists(candidate.path) {
+			return newPackageManager(ba, candidate.name)
+		}
+	}
+	return nil
+}
+
+// newPackageManager returns the backend for the named package manager
+func newPackageManager(ba *BaseAction, name string) PackageManager {
+	switch name {
+	case "apt":
+		return &aptManager{ba}
+	case "dnf", "yum":
+		return &rpmManager{ba, name}
+	case "zypper":
+		return &zypperManager{ba}
+	case "apk":
+		return &apkManager{ba}
+	}
+	return nil
+}
+
+// unsupportedPlatform is returned when no package manager could be detected
+func unsupportedPlatform() *Result {
+	return &Result{
+		Success: false,
+		Message: "Unsupported Linux distribution",
+		Error:   newError(ErrUnsupportedPlatform, "unsupported package manager"),
+	}
+}
+
+// noPackages is returned when there is nothing to install
+func noPackages(pm PackageManager) *Result {
+	return &Result{
+		Success: false,
+		Message: fmt.Sprintf("No packages available for %s", pm.Name()),
+		Error:   newError(ErrUnsupportedPlatform, "no packages mapped for %s", pm.Name()),
+	}
+}
+
+// aptManager manages packages on Debian and Ubuntu
+type aptManager struct {
+	ba *BaseAction
+}
+
+func (m *aptManager) Name() string { return "apt" }
+
+func (m *aptManager) Install(packages ...string) *Result {
+	if len(packages) == 0 {
+		return noPackages(m)
+	}
+	return m.ba.RunCommand("apt", append([]string{"install", "-y"}, packages...)...)
+}
+
+func (m *aptManager) Remove(packages ...string) *Result {
+	return m.ba.RunCommand("apt", append([]string{"remove", "-y"}, packages...)...)
+}
+
+func (m *aptManager) Purge(packages ...string) *Result {
+	return m.ba.RunCommand("apt", append([]string{"purge", "-y"}, packages...)...)
+}
+
+func (m *aptManager) Update() *Result {
+	return m.ba.RunCommand("apt", "update")
+}
+
+func (m *aptManager) Autoremove() *Result {
+	result := m.ba.RunCommand("apt", "autoremove", "-y")
+	if !result.Success {
+		return result
+	}
+	return m.ba.RunCommand("apt", "autoclean")
+}
+
+func (m *aptManager) IsInstalled(pkg string) bool {
+	result := m.ba.query("dpkg-query", "-W", "-f=${Status}", pkg)
+	return result.Success && strings.Contains(result.Message, "install ok installed")
+}
+
+func (m *aptManager) Version(pkg string) (string, error) {
+	result := m.ba.query("dpkg-query", "-W", "-f=${Version}", pkg)
+	if !result.Success {
+		return "", newError(ErrNotInstalled, "package %s is not installed", pkg)
+	}
+	return strings.TrimSpace(result.Message), nil
+}
+
+func (m *aptManager) AddRepository(repo string) *Result {
+	return m.ba.RunCommand("add-apt-repository", "-y", repo)
+}
+
+func (m *aptManager) EnableRepository(name string) *Result {
+	return m.AddRepository(name)
+}
+
+// rpmManager manages packages with dnf or yum on RHEL-based systems
+type rpmManager struct {
+	ba   *BaseAction
+	name string
+}
+
+func (m *rpmManager) Name() string { return m.name }
+
+func (m *rpmManager) Install(packages ...string) *Result {
+	if len(packages) == 0 {
+		return noPackages(m)
+	}
+	return m.ba.RunCommand(m.name, append([]string{"install", "-y"}, packages...)...)
+}
+
+func (m *rpmManager) Remove(packages ...string) *Result {
+	return m.ba.RunCommand(m.name, append([]string{"remove", "-y"}, packages...)...)
+}
+
+// Purge removes packages; rpm keeps modified configs as .rpmsave files
+func (m *rpmManager) Purge(packages ...string) *Result {
+	return m.Remove(packages...)
+}
+
+func (m *rpmManager) Update() *Result {
+	return m.ba.RunCommand(m.name, "makecache")
+}
+
+func (m *rpmManager) Autoremove() *Result {
+	return m.ba.RunCommand(m.name, "autoremove", "-y")
+}
+
+func (m *rpmManager) IsInstalled(pkg string) bool {
+	return m.ba.query("rpm", "-q", pkg).Success
+}
+
+func (m *rpmManager) Version(pkg string) (string, error) {
+	result := m.ba.query("rpm", "-q", "--qf", "%{VERSION}-%{RELEASE}", pkg)
+	if !result.Success {
+		return "", newError(ErrNotInstalled, "package %s is not installed", pkg)
+	}
+	return strings.TrimSpace(result.Message), nil
+}
+
+// AddRepository installs a repository release package or .rpm URL
+func (m *rpmManager) AddRepository(repo string) *Result {
+	return m.ba.RunCommand(m.name, "install", "-y", repo)
+}
+
+func (m *rpmManager) EnableRepository(name string) *Result {
+	if m.name == "yum" {
+		return m.ba.RunCommand("yum-config-manager", "--enable", name)
+	}
+	return m.ba.RunCommand("dnf", "config-manager", "--enable", name)
+}
+
+// zypperManager manages packages on openSUSE and SLES
+type zypperManager struct {
+	ba *BaseAction
+}
+
+func (m *zypperManager) Name() string { return "zypper" }
+
+func (m *zypperManager) Install(packages ...string) *Result {
+	if len(packages) == 0 {
+		return noPackages(m)
+	}
+	return m.ba.RunCommand("zypper", append([]string{"--non-interactive", "install"}, packages...)...)
+}
+
+func (m *zypperManager) Remove(packages ...string) *Result {
+	return m.ba.RunCommand("zypper", append([]string{"--non-interactive", "remove"}, packages...)...)
+}
+
+func (m *zypperManager) Purge(packages ...string) *Result {
+	return m.ba.RunCommand("zypper", append([]string{"--non-interactive", "remove", "--clean-deps"}, packages...)...)
+}
+
+func (m *zypperManager) Update() *Result {
+	return m.ba.RunCommand("zypper", "--non-interactive", "refresh")
+}
+
+func (m *zypperManager) Autoremove() *Result {
+	return &Result{
+		Success: true,
+		Message: "zypper removes unneeded dependencies with --clean-deps",
+	}
+}
+
+func (m *zypperManager) IsInstalled(pkg string) bool {
+	return m.ba.query("rpm", "-q", pkg).Success
+}
+
+func (m *zypperManager) Version(pkg string) (string, error) {
+	result := m.ba.query("rpm", "-q", "--qf", "%{VERSION}-%{RELEASE}", pkg)
+	if !result.Success {
+		return "", newError(ErrNotInstalled, "package %s is not installed", pkg)
+	}
+	return strings.TrimSpace(result.Message), nil
+}
+
+func (m *zypperManager) AddRepository(repo string) *Result {
+	return m.ba.RunCommand("zypper", "--non-interactive", "addrepo", "--refresh", repo)
+}
+
+func (m *zypperManager) EnableRepository(name string) *Result {
+	return m.ba.RunCommand("zypper", "--non-interactive", "modifyrepo", "--enable", name)
+}
+
+// apkManager manages packages on Alpine Linux
+type apkManager struct {
+	ba *BaseAction
+}
+
+func (m *apkManager) Name() string { return "apk" }
+
+func (m *apkManager) Install(packages ...string) *Result {
+	if len(packages) == 0 {
+		return noPackages(m)
+	}
+	return m.ba.RunCommand("apk", append([]string{"add"}, packages...)...)
+}
+
+func (m *apkManager) Remove(packages ...string) *Result {
+	return m.ba.RunCommand("apk", append([]string{"del"}, packages...)...)
+}
+
+func (m *apkManager) Purge(packages ...string) *Result {
+	return m.ba.RunCommand("apk", append([]string{"del", "--purge"}, packages...)...)
+}
+
+func (m *apkManager) Update() *Result {
+	return m.ba.RunCommand("apk", "update")
+}
+
+func (m *apkManager) Autoremove() *Result {
+	return &Result{
+		Success: true,
+		Message: "apk removes unneeded dependencies automatically",
+	}
+}
+
+func (m *apkManager) IsInstalled(pkg string) bool {
+	return m.ba.query("apk", "info", "-e", pkg).Success
+}
+
+func (m *apkManager) Version(pkg string) (string, error) {
+	result := m.ba.query("apk", "info", "-v", pkg)
+	if !result.Success || strings.TrimSpace(result.Message) == "" {
+		return "", newError(ErrNotInstalled, "package %s is not installed", pkg)
+	}
+	// apk prints name-version-release
+	line := strings.Fields(result.Message)[0]
+	return strings.TrimPrefix(line, pkg+"-"), nil
+}
+
+func (m *apkManager) AddRepository(repo string) *Result {
+	return m.ba.RunCommand("sh", "-c", fmt.Sprintf("grep -qxF '%s' /etc/apk/repositories || echo '%s' >> /etc/apk/repositories", repo, repo))
+}
+
+func (m *apkManager) EnableRepository(name string) *Result {
+	return m.AddRepository(name)
+}
@@ -1,7 +1,9 @@
 package actions
 
 import (
+	"easygo/pkg/state"
 	"fmt"
+	"path/filepath"
 	"strings"
 )
 
@@ -30,23 +32,46 @@ func (p *PHPAction) GetAvailableVersions() []string {
 }
 
 // InstallPHP installs a specific PHP version with common extensions
-func (p *PHPAction) InstallPHP(version string) *Result {
-	if p.FileExists("/usr/bin/apt") {
-		return p.installPHPDebian(version)
-	} else if p.FileExists("/usr/bin/yum") || p.FileExists("/usr/bin/dnf") {
-		return p.installPHPRHEL(version)
+func (p *PHPAction) InstallPHP(version string) (res *Result) {
+	hook := p.Hook("InstallPHP", map[string]string{"version": version})
+	if failed := hook.Pre(); failed != nil {
+		return failed
 	}
+	defer hook.Post(&res)
 	
-	return &Result{
-		Success: false,
-		Message: "Unsupported Linux distribution",
-		Error:   fmt.Errorf("unsupported package manager"),
+	pm := p.PackageManager()
+	if pm == nil {
+		return unsupportedPlatform()
+	}
+	
+	// Make multiple PHP versions available
+	repoResult := p.addPHPRepositories(pm, version)
+	if !repoResult.Success {
+		return repoResult
+	}
+	
+	// Install PHP and common extensions
+	names := []string{"php"}
+	if version < "8.0" {
+		// json is a separate extension before PHP 8.0
+		names = append(names, "php-json")
+	}
+	
+	installResult := pm.Install(ResolvePackages(pm, version, names...)...)
+	if !installResult.Success {
+		return installResult
 	}
+	
+	// Enable and start PHP-FPM
+	serviceName := p.Platform().PHPFPMService(version)
+	p.EnableService(serviceName)
+	return p.StartService(serviceName)
 }
 
 // GetInstalledVersions returns installed PHP versions
 func (p *PHPAction) GetInstalledVersions() *Result {
 	var versions []*PHPVersion
+	platform := p.Platform()
 	
 	for _, version := range p.GetAvailableVersions() {
 		phpVersion := &PHPVersion{
@@ -54,15 +79,15 @@ func (p *PHPAction) GetInstalledVersions() *Result {
 		}
 		
 		// Check if PHP binary exists
-		phpBinary := fmt.Sprintf("/usr/bin/php%s", version)
+		phpBinary := platform.PHPBinary(version)
 		
-		if p.FileExists(phpBinary) {
+		if p.LocalFileExists(phpBinary) {
 			phpVersion.Installed = true
-			phpVersion.ConfigPath = fmt.Sprintf("/etc/php/%s", version)
-			phpVersion.FPMPath = fmt.Sprintf("/etc/php/%s/fpm", version)
+			phpVersion.ConfigPath = platform.PHPConfDir(version)
+			phpVersion.FPMPath = filepath.Dir(platform.PHPFPMPoolDir(version))
 			
 			// Check if FPM is running
-			serviceName := fmt.Sprintf("php%s-fpm", version)
+			serviceName := platform.PHPFPMService(version)
 			statusResult := p.ServiceStatus(serviceName)
 			if statusResult.Success {
 				if service, ok := statusResult.Data.(*Service); ok {
@@ -84,13 +109,20 @@ func (p *PHPAction) GetInstalledVersions() *Result {
 }
 
 // ConfigurePHPFPM configures PHP-FPM for a specific version
-func (p *PHPAction) ConfigurePHPFPM(version string, poolName string) *Result {
+func (p *PHPAction) ConfigurePHPFPM(version string, poolName string) (res *Result) {
+	hook := p.Hook("ConfigurePHPFPM", map[string]string{"version": version, "pool_name": poolName})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
+	platform := p.Platform()
 	poolConfig := fmt.Sprintf(`[%s]
-user = www-data
-group = www-data
-listen = /var/run/php/php%s-fpm-%s.sock
-listen.owner = www-data
-listen.group = www-data
+user = %s
+group = %s
+listen = %s
+listen.owner = %s
+listen.group = %s
 listen.mode = 0660
 
 pm = dynamic
@@ -104,28 +136,88 @@ php_admin_value[sendmail_path] = /usr/sbin/sendmail -t -i -f www@localhost
 php_flag[display_errors] = off
 php_admin_value[error_log] = /var/log/fpm-php.www.log
 php_admin_flag[log_errors] = on
-`, poolName, version, poolName)
+`, poolName, platform.WebUser, platform.WebGroup, platform.PHPFPMSocket(version, poolName), platform.WebUser, platform.WebGroup)
 
-	poolPath := fmt.Sprintf("/etc/php/%s/fpm/pool.d/%s.conf", version, poolName)
-	result := p.WriteFile(poolPath, poolConfig)
-	if !result.Success {
+	poolPath := filepath.Join(platform.PHPFPMPoolDir(version), poolName+".conf")
+	serviceName := platform.PHPFPMService(version)
+	
+	// Bring PHP-FPM back up with the previous pool if the restart fails
+	tx := p.Begin(fmt.Sprintf("PHP %s pool %s", version, poolName))
+	tx.OnRollback("restart "+serviceName, func() *Result {
+		return p.RestartService(serviceName)
+	})
+	if result := tx.WriteFile(poolPath, poolConfig); !result.Success {
 		return result
 	}
 	
 	// Restart PHP-FPM
-	serviceName := fmt.Sprintf("php%s-fpm", version)
-	return p.RestartService(serviceName)
+	result := tx.Commit(tx.Do("restart "+serviceName, func() *Result {
+		return p.RestartService(serviceName)
+	}, nil))
+	if result.Success {
+		pool := &state.FPMPool{
+			Name:       poolName,
+			PHPVersion: version,
+			Socket:     platform.PHPFPMSocket(version, poolName),
+			ConfigPath: poolPath,
+			Meta:       p.meta(nil),
+		}
+		p.record(func(store *state.Store) error {
+			return store.FPMPools().Put(pool)
+		})
+	}
+	return result
+}
+
+// InstallPHPWithPool installs a PHP version and configures an FPM pool for
+// it. If the pool cannot be set up, a PHP version installed by this call is
+// removed again.
+func (p *PHPAction) InstallPHPWithPool(version, poolName string) (res *Result) {
+	hook := p.Hook("InstallPHPWithPool", map[string]string{"version": version, "pool_name": poolName})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
+	pm := p.PackageManager()
+	if pm == nil {
+		return unsupportedPlatform()
+	}
+	
+	tx := p.Begin(fmt.Sprintf("PHP %s with pool %s", version, poolName))
+	
+	var undo func() *Result
+	if !p.LocalFileExists(p.Platform().PHPBinary(version)) {
+		undo = func() *Result {
+			return pm.Remove(ResolvePackages(pm, version, "php")...)
+		}
+	}
+	if result := tx.Do("install PHP "+version, func() *Result {
+		return p.InstallPHP(version)
+	}, undo); !result.Success {
+		return result
+	}
+	
+	return tx.Commit(tx.Do("configure pool "+poolName, func() *Result {
+		return p.ConfigurePHPFPM(version, poolName)
+	}, nil))
 }
 
 // SetDefaultPHP sets the default PHP version
-func (p *PHPAction) SetDefaultPHP(version string) *Result {
+func (p *PHPAction) SetDefaultPHP(version string) (res *Result) {
+	hook := p.Hook("SetDefaultPHP", map[string]string{"version": version})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	// Update alternatives
-	phpBinary := fmt.Sprintf("/usr/bin/php%s", version)
-	if !p.FileExists(phpBinary) {
+	phpBinary := p.Platform().PHPBinary(version)
+	if !p.LocalFileExists(phpBinary) {
 		return &Result{
 			Success: false,
 			Message: fmt.Sprintf("PHP %s is not installed", version),
-			Error:   fmt.Errorf("PHP version not found"),
+			Error:   newError(ErrNotInstalled, "PHP %s is not installed", version),
 		}
 	}
 	
@@ -141,126 +233,40 @@ func (p *PHPAction) SetDefaultPHP(version string) *Result {
 
 // Private helper methods
 
-func (p *PHPAction) installPHPDebian(version string) *Result {
-	// Add Ondrej's PHP repository for multiple versions
-	if !p.FileExists("/etc/apt/sources.list.d/ondrej-ubuntu-php-*.list") {
-		addRepoResult := p.RunCommand("add-apt-repository", "-y", "ppa:ondrej/php")
-		if !addRepoResult.Success {
-			return addRepoResult
-		}
-		
-		updateResult := p.RunCommand("apt", "update")
-		if !updateResult.Success {
-			return updateResult
+// addPHPRepositories enables the third-party repositories that provide
+// multiple PHP versions
+func (p *PHPAction) addPHPRepositories(pm PackageManager, version string) *Result {
+	switch pm.Name() {
+	case "apt":
+		// Add Ondrej's PHP repository for multiple versions
+		if !p.LocalFileExists("/etc/apt/sources.list.d/ondrej-ubuntu-php-*.list") {
+			addRepoResult := pm.AddRepository("ppa:ondrej/php")
+			if !addRepoResult.Success {
+				return addRepoResult
+			}
+			
+			return pm.Update()
 		}
-	}
-	
-	// Install PHP and common extensions
-	packages := []string{
-		fmt.Sprintf("php%s", version),
-		fmt.Sprintf("php%s-fpm", version),
-		fmt.Sprintf("php%s-cli", version),
-		fmt.Sprintf("php%s-common", version),
-		fmt.Sprintf("php%s-mysql", version),
-		fmt.Sprintf("php%s-pgsql", version),
-		fmt.Sprintf("php%s-sqlite3", version),
-		fmt.Sprintf("php%s-curl", version),
-		fmt.Sprintf("php%s-gd", version),
-		fmt.Sprintf("php%s-mbstring", version),
-		fmt.Sprintf("php%s-xml", version),
-		fmt.Sprintf("php%s-zip", version),
-		fmt.Sprintf("php%s-bcmath", version),
-		fmt.Sprintf("php%s-intl", version),
-		fmt.Sprintf("php%s-json", version),
-		fmt.Sprintf("php%s-opcache", version),
-		fmt.Sprintf("php%s-readline", version),
-	}
-	
-	// Filter packages that don't exist for certain versions
-	if version >= "8.0" {
-		// Remove json package as it's built-in in PHP 8.0+
-		packages = p.filterPackages(packages, "json")
-	}
-	
-	args := append([]string{"install", "-y"}, packages...)
-	installResult := p.RunCommand("apt", args...)
-	if !installResult.Success {
-		return installResult
-	}
-	
-	// Enable and start PHP-FPM
-	serviceName := fmt.Sprintf("php%s-fpm", version)
-	p.EnableService(serviceName)
-	return p.StartService(serviceName)
-}
-
-func (p *PHPAction) installPHPRHEL(version string) *Result {
-	var installCmd string
-	if p.FileExists("/usr/bin/dnf") {
-		installCmd = "dnf"
-	} else {
-		installCmd = "yum"
-	}
-	
-	// Enable EPEL and Remi repositories
-	if !p.FileExists("/etc/yum.repos.d/epel.repo") {
-		epelResult := p.RunCommand(installCmd, "install", "-y", "epel-release")
-		if !epelResult.Success {
-			return epelResult
+	case "dnf", "yum":
+		// Enable EPEL and Remi repositories
+		if !p.LocalFileExists("/etc/yum.repos.d/epel.repo") {
+			epelResult := pm.AddRepository("epel-release")
+			if !epelResult.Success {
+				return epelResult
+			}
 		}
-	}
-	
-	if !p.FileExists("/etc/yum.repos.d/remi.repo") {
-		remiResult := p.RunCommand(installCmd, "install", "-y", "https://rpms.remirepo.net/enterprise/remi-release-8.rpm")
-		if !remiResult.Success {
-			return remiResult
+		
+		if !p.LocalFileExists("/etc/yum.repos.d/remi.repo") {
+			remiResult := pm.AddRepository("https://rpms.remirepo.net/enterprise/remi-release-8.rpm")
+			if !remiResult.Success {
+				return remiResult
+			}
 		}
+		
+		// Enable PHP version repository
+		versionNoDot := strings.Replace(version, ".", "", -1)
+		return pm.EnableRepository(fmt.Sprintf("remi-php%s", versionNoDot))
 	}
 	
-	// Enable PHP version repository
-	versionNoDot := strings.Replace(version, ".", "", -1)
-	enableResult := p.RunCommand(installCmd, "config-manager", "--enable", fmt.Sprintf("remi-php%s", versionNoDot))
-	if !enableResult.Success {
-		return enableResult
-	}
-	
-	// Install PHP packages
-	packages := []string{
-		"php",
-		"php-fpm",
-		"php-cli",
-		"php-common",
-		"php-mysqlnd",
-		"php-pgsql",
-		"php-sqlite3",
-		"php-curl",
-		"php-gd",
-		"php-mbstring",
-		"php-xml",
-		"php-zip",
-		"php-bcmath",
-		"php-intl",
-		"php-json",
-		"php-opcache",
-	}
-	
-	args := append([]string{"install", "-y"}, packages...)
-	installResult := p.RunCommand(installCmd, args...)
-	if !installResult.Success {
-		return installResult
-	}
-	
-	// Enable and start PHP-FPM
-	p.EnableService("php-fpm")
-	return p.StartService("php-fpm")
+	return &Result{Success: true}
 }
-
-func (p *PHPAction) filterPackages(packages []string, exclude string) []string {
-	var filtered []string
-	for _, pkg := range packages {
-		if !strings.Contains(pkg, exclude) {
-			filtered = append(filtered, pkg)
-		}
-	}
-	return filtered
-}
\ No newline at end of file
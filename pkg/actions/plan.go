@@ -0,0 +1,94 @@
+package actions
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Kinds of planned operations
+const (
+	PlanCommand   = "command"
+	PlanWriteFile = "write"
+	PlanMkdir     = "mkdir"
+)
+
+// PlannedOperation is a single change an action would make in dry-run mode
+type PlannedOperation struct {
+	Kind    string `json:"kind"`
+	Command string `json:"command,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// Plan records the operations actions would perform instead of executing them
+type Plan struct {
+	mu         sync.Mutex
+	operations []PlannedOperation
+}
+
+// NewPlan creates an empty plan
+func NewPlan() *Plan {
+	return &Plan{}
+}
+
+// add appends an operation to the plan
+func (p *Plan) add(op PlannedOperation) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.operations = append(p.operations, op)
+}
+
+// AddPlanned records operations planned outside the action, e.g. by a
+// plugin process, in the action's dry-run plan
+func (ba *BaseAction) AddPlanned(ops ...PlannedOperation) {
+	if ba.plan == nil {
+		return
+	}
+	for _, op := range ops {
+		ba.plan.add(op)
+	}
+}
+
+// Operations returns the planned operations in order
+func (p *Plan) Operations() []PlannedOperation {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ops := make([]PlannedOperation, len(p.operations))
+	copy(ops, p.operations)
+	return ops
+}
+
+// Text renders the plan for humans
+func (p *Plan) Text() string {
+	ops := p.Operations()
+	if len(ops) == 0 {
+		return "No changes would be made.\n"
+	}
+
+	var sb strings.Builder
+	for i, op := range ops {
+		switch op.Kind {
+		case PlanCommand:
+			fmt.Fprintf(&sb, "%3d. run    %s\n", i+1, op.Command)
+		case PlanWriteFile:
+			fmt.Fprintf(&sb, "%3d. write  %s (%d bytes)\n", i+1, op.Path, len(op.Content))
+			for _, line := range strings.Split(strings.TrimRight(op.Content, "\n"), "\n") {
+				fmt.Fprintf(&sb, "         | %s\n", line)
+			}
+		case PlanMkdir:
+			fmt.Fprintf(&sb, "%3d. mkdir  %s\n", i+1, op.Path)
+		}
+	}
+	return sb.String()
+}
+
+// MarshalJSON renders the plan as a JSON object
+func (p *Plan) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Operations []PlannedOperation `json:"operations"`
+	}{p.Operations()})
+}
@@ -0,0 +1,287 @@
+package actions
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Distribution families
+const (
+	FamilyDebian  = "debian"
+	FamilyRHEL    = "rhel"
+	FamilySUSE    = "suse"
+	FamilyAlpine  = "alpine"
+	FamilyUnknown = "unknown"
+)
+
+// Init systems
+const (
+	InitSystemd  = "systemd"
+	InitOpenRC   = "openrc"
+	InitSysVinit = "sysvinit"
+)
+
+// Platform describes the running distribution and where it keeps the
+// configuration, sockets, logs and services EasyGo manages
+type Platform struct {
+	ID         string // os-release ID, e.g. ubuntu
+	Name       string // os-release PRETTY_NAME or NAME
+	Version    string // os-release VERSION_ID
+	Family     string
+	InitSystem string
+
+	ApacheService        string
+	ApacheConfDir        string
+	ApacheSitesAvailable string
+	ApacheSitesEnabled   string // empty when vhosts are included directly
+	ApacheLogDir         string
+	ApachePortsConf      string // file with the Listen directives
+	ApacheConfSnippets   string // directory of global configuration snippets
+
+	NginxConfDir        string
+	NginxSitesAvailable string
+	NginxSitesEnabled   string // empty when vhosts are included directly
+	NginxLogDir         string
+	NginxPHPInclude     string // fastcgi directives for PHP locations
+
+	PHPFPMSocketDir string
+	CronService     string
+	WebUser         string
+	WebGroup        string
+	AuthLog         string
+	IptablesRules   string
+}
+
+// ParseOSRelease parses the contents of /etc/os-release into a Platform
+// with the distribution family's default paths. The init system is not
+// part of os-release and defaults to systemd.
+func ParseOSRelease(content string) *Platform {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		fields[key] = strings.Trim(value, `"'`)
+	}
+
+	p := &Platform{
+		ID:         fields["ID"],
+		Name:       fields["PRETTY_NAME"],
+		Version:    fields["VERSION_ID"],
+		Family:     detectFamily(fields["ID"], fields["ID_LIKE"]),
+		InitSystem: InitSystemd,
+	}
+	if p.Name == "" {
+		p.Name = fields["NAME"]
+	}
+	p.applyFamilyDefaults()
+	return p
+}
+
+// detectFamily maps an os-release ID and ID_LIKE to a distribution family
+func detectFamily(id, idLike string) string {
+	for _, candidate := range append([]string{id}, strings.Fields(idLike)...) {
+		switch candidate {
+		case "debian", "ubuntu", "linuxmint", "raspbian", "pop", "elementary":
+			return FamilyDebian
+		case "rhel", "centos", "fedora", "rocky", "almalinux", "ol", "amzn":
+			return FamilyRHEL
+		case "suse", "opensuse", "opensuse-leap", "opensuse-tumbleweed", "sles":
+			return FamilySUSE
+		case "alpine":
+			return FamilyAlpine
+		}
+	}
+	return FamilyUnknown
+}
+
+// applyFamilyDefaults fills in the paths and service names of the family
+func (p *Platform) applyFamilyDefaults() {
+	switch p.Family {
+	case FamilyRHEL:
+		p.ApacheService = "httpd"
+		p.ApacheConfDir = "/etc/httpd"
+		p.ApacheSitesAvailable = "/etc/httpd/conf.d"
+		p.ApacheLogDir = "/var/log/httpd"
+		p.ApachePortsConf = "/etc/httpd/conf/httpd.conf"
+		p.ApacheConfSnippets = "/etc/httpd/conf.d"
+		p.NginxSitesAvailable = "/etc/nginx/conf.d"
+		p.PHPFPMSocketDir = "/run/php-fpm"
+		p.CronService = "crond"
+		p.WebUser = "apache"
+		p.AuthLog = "/var/log/secure"
+		p.IptablesRules = "/etc/sysconfig/iptables"
+	case FamilySUSE:
+		p.ApacheService = "apache2"
+		p.ApacheConfDir = "/etc/apache2"
+		p.ApacheSitesAvailable = "/etc/apache2/vhosts.d"
+		p.ApacheLogDir = "/var/log/apache2"
+		p.ApachePortsConf = "/etc/apache2/listen.conf"
+		p.ApacheConfSnippets = "/etc/apache2/conf.d"
+		p.NginxSitesAvailable = "/etc/nginx/vhosts.d"
+		p.PHPFPMSocketDir = "/run/php-fpm"
+		p.CronService = "cron"
+		p.WebUser = "wwwrun"
+		p.WebGroup = "www"
+		p.AuthLog = "/var/log/messages"
+		p.IptablesRules = "/etc/sysconfig/iptables"
+	case FamilyAlpine:
+		p.InitSystem = InitOpenRC
+		p.ApacheService = "apache2"
+		p.ApacheConfDir = "/etc/apache2"
+		p.ApacheSitesAvailable = "/etc/apache2/conf.d"
+		p.ApacheLogDir = "/var/log/apache2"
+		p.ApachePortsConf = "/etc/apache2/httpd.conf"
+		p.ApacheConfSnippets = "/etc/apache2/conf.d"
+		p.NginxSitesAvailable = "/etc/nginx/http.d"
+		p.PHPFPMSocketDir = "/run/php-fpm"
+		p.CronService = "crond"
+		p.WebUser = "nginx"
+		p.AuthLog = "/var/log/messages"
+		p.IptablesRules = "/etc/iptables/rules-save"
+	default:
+		p.ApacheService = "apache2"
+		p.ApacheConfDir = "/etc/apache2"
+		p.ApacheSitesAvailable = "/etc/apache2/sites-available"
+		p.ApacheSitesEnabled = "/etc/apache2/sites-enabled"
+		p.ApacheLogDir = "/var/log/apache2"
+		p.ApachePortsConf = "/etc/apache2/ports.conf"
+		p.ApacheConfSnippets = "/etc/apache2/conf-available"
+		p.NginxSitesAvailable = "/etc/nginx/sites-available"
+		p.NginxSitesEnabled = "/etc/nginx/sites-enabled"
+		p.NginxPHPInclude = "include snippets/fastcgi-php.conf;"
+		p.PHPFPMSocketDir = "/run/php"
+		p.CronService = "cron"
+		p.WebUser = "www-data"
+		p.AuthLog = "/var/log/auth.log"
+		p.IptablesRules = "/etc/iptables/rules.v4"
+	}
+
+	p.NginxConfDir = "/etc/nginx"
+	p.NginxLogDir = "/var/log/nginx"
+	if p.NginxPHPInclude == "" {
+		p.NginxPHPInclude = "include fastcgi_params;\n        fastcgi_param SCRIPT_FILENAME $document_root$fastcgi_script_name;"
+	}
+	if p.WebGroup == "" {
+		p.WebGroup = p.WebUser
+	}
+}
+
+// ApacheVhostPath returns the configuration file of a domain's Apache vhost
+func (p *Platform) ApacheVhostPath(domain string) string {
+	return filepath.Join(p.ApacheSitesAvailable, domain+".conf")
+}
+
+// NginxVhostPath returns the configuration file of a domain's Nginx vhost
+func (p *Platform) NginxVhostPath(domain string) string {
+	if p.NginxSitesEnabled != "" {
+		return filepath.Join(p.NginxSitesAvailable, domain)
+	}
+	return filepath.Join(p.NginxSitesAvailable, domain+".conf")
+}
+
+// NginxEnabledPath returns the sites-enabled link of a domain's Nginx
+// vhost, or an empty string when the layout has no sites-enabled
+func (p *Platform) NginxEnabledPath(domain string) string {
+	if p.NginxSitesEnabled == "" {
+		return ""
+	}
+	return filepath.Join(p.NginxSitesEnabled, domain)
+}
+
+// PHPBinary returns the path of a PHP version's CLI binary
+func (p *Platform) PHPBinary(version string) string {
+	switch p.Family {
+	case FamilyDebian, FamilyUnknown:
+		return fmt.Sprintf("/usr/bin/php%s", version)
+	case FamilyAlpine:
+		return fmt.Sprintf("/usr/bin/php%s", strings.Replace(version, ".", "", -1))
+	}
+	return "/usr/bin/php"
+}
+
+// PHPConfDir returns the configuration directory of a PHP version
+func (p *Platform) PHPConfDir(version string) string {
+	switch p.Family {
+	case FamilyDebian, FamilyUnknown:
+		return fmt.Sprintf("/etc/php/%s", version)
+	case FamilySUSE:
+		return "/etc/php8"
+	case FamilyAlpine:
+		return fmt.Sprintf("/etc/php%s", strings.Replace(version, ".", "", -1))
+	}
+	return "/etc"
+}
+
+// PHPFPMPoolDir returns the directory holding a PHP version's FPM pools
+func (p *Platform) PHPFPMPoolDir(version string) string {
+	switch p.Family {
+	case FamilyDebian, FamilyUnknown:
+		return fmt.Sprintf("/etc/php/%s/fpm/pool.d", version)
+	case FamilyRHEL:
+		return "/etc/php-fpm.d"
+	case FamilySUSE:
+		return "/etc/php8/fpm/php-fpm.d"
+	}
+	return filepath.Join(p.PHPConfDir(version), "php-fpm.d")
+}
+
+// PHPFPMService returns the FPM service name of a PHP version
+func (p *Platform) PHPFPMService(version string) string {
+	switch p.Family {
+	case FamilyDebian, FamilyUnknown:
+		return fmt.Sprintf("php%s-fpm", version)
+	case FamilyAlpine:
+		return fmt.Sprintf("php-fpm%s", strings.Replace(version, ".", "", -1))
+	}
+	return "php-fpm"
+}
+
+// PHPFPMSocket returns the socket path of a PHP-FPM pool. An empty pool
+// name returns the version's default socket.
+func (p *Platform) PHPFPMSocket(version, pool string) string {
+	if pool == "" {
+		if p.Family == FamilyDebian || p.Family == FamilyUnknown {
+			return filepath.Join(p.PHPFPMSocketDir, fmt.Sprintf("php%s-fpm.sock", version))
+		}
+		return filepath.Join(p.PHPFPMSocketDir, "www.sock")
+	}
+	return filepath.Join(p.PHPFPMSocketDir, fmt.Sprintf("php%s-fpm-%s.sock", version, pool))
+}
+
+// SetPlatform overrides the detected platform
+func (ba *BaseAction) SetPlatform(platform *Platform) {
+	ba.platform = platform
+}
+
+// Platform detects the running platform from /etc/os-release. The result
+// is cached for the lifetime of the action.
+func (ba *BaseAction) Platform() *Platform {
+	if ba.platform != nil {
+		return ba.platform
+	}
+
+	result := ba.query("cat", "/etc/os-release")
+	if !result.Success {
+		result = ba.query("cat", "/usr/lib/os-release")
+	}
+	platform := ParseOSRelease(result.Message)
+
+	switch {
+	case ba.query("test", "-d", "/run/systemd/system").Success:
+		platform.InitSystem = InitSystemd
+	case ba.LocalFileExists("/sbin/openrc-run"):
+		platform.InitSystem = InitOpenRC
+	default:
+		platform.InitSystem = InitSysVinit
+	}
+
+	ba.platform = platform
+	return platform
+}
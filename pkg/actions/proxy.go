@@ -0,0 +1,61 @@
+package actions
+
+import (
+	"easygo/pkg/state"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Load-balancing methods of proxy backends
+var proxyMethods = []string{"round_robin", "least_conn", "ip_hash", "random"}
+
+var (
+	// proxyBackendPattern matches host:port, [ipv6]:port and unix:/path
+	proxyBackendPattern = regexp.MustCompile(`^([A-Za-z0-9.-]+:[0-9]{1,5}|\[[0-9A-Fa-f:.]+\]:[0-9]{1,5}|unix:/[^\s;{}"'#\\]+)$`)
+	// proxyCachePattern matches an Nginx time such as 30s, 10m or 1h
+	proxyCachePattern = regexp.MustCompile(`^[0-9]+[smhd]?$`)
+	// upstreamNamePattern matches what may not be in an upstream name
+	upstreamNamePattern = regexp.MustCompile(`[^A-Za-z0-9]+`)
+)
+
+// validateProxy checks a proxy configuration
+func validateProxy(proxy *state.Proxy) error {
+	if len(proxy.Backends) == 0 {
+		return errors.New("a proxy needs at least one backend")
+	}
+	for _, backend := range proxy.Backends {
+		if !proxyBackendPattern.MatchString(backend) {
+			return fmt.Errorf("backend %q is not host:port or unix:/path", backend)
+		}
+	}
+	if proxy.Method != "" && !slices.Contains(proxyMethods, proxy.Method) {
+		return fmt.Errorf("method %q is not one of %s", proxy.Method, strings.Join(proxyMethods, ", "))
+	}
+	for name, value := range map[string]int{
+		"max_fails":       proxy.MaxFails,
+		"fail_timeout":    proxy.FailTimeout,
+		"connect_timeout": proxy.ConnectTimeout,
+		"read_timeout":    proxy.ReadTimeout,
+		"send_timeout":    proxy.SendTimeout,
+	} {
+		if value < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+	if proxy.Cache != "" && !proxyCachePattern.MatchString(proxy.Cache) {
+		return fmt.Errorf("cache %q is not a time like 10m", proxy.Cache)
+	}
+	if proxy.Cache != "" && proxy.Unbuffered {
+		return errors.New("unbuffered responses cannot be cached")
+	}
+	return nil
+}
+
+// upstreamName returns the name of a domain's upstream block, also used
+// for its cache zone and variables
+func upstreamName(domain string) string {
+	return upstreamNamePattern.ReplaceAllString(domain, "_") + "_backend"
+}
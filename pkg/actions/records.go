@@ -0,0 +1,51 @@
+package actions
+
+import (
+	"easygo/pkg/state"
+	"log/slog"
+)
+
+// DefaultStore records the resources created by actions that have no
+// store of their own. When nil, nothing is recorded.
+var DefaultStore *state.Store
+
+// SetStore sets the state store the action records resources in
+func (ba *BaseAction) SetStore(store *state.Store) {
+	ba.store = store
+}
+
+// Store returns the state store the action records resources in, or nil
+func (ba *BaseAction) Store() *state.Store {
+	if ba.store != nil {
+		return ba.store
+	}
+	return DefaultStore
+}
+
+// SetOwner sets the user recorded as the owner of created resources
+func (ba *BaseAction) SetOwner(owner string) {
+	ba.owner = owner
+}
+
+// Owner returns the user recorded as the owner of created resources
+func (ba *BaseAction) Owner() string {
+	return ba.owner
+}
+
+// meta returns the metadata for a resource created by the action
+func (ba *BaseAction) meta(params map[string]string) state.Meta {
+	return state.Meta{Owner: ba.owner, Params: params}
+}
+
+// record saves a change to the state store. Dry runs record nothing, and
+// since the change itself has been made, failing to record it is logged
+// rather than failing the action.
+func (ba *BaseAction) record(save func(store *state.Store) error) {
+	store := ba.Store()
+	if store == nil || ba.DryRun() {
+		return
+	}
+	if err := save(store); err != nil {
+		slog.WarnContext(ba.Context(), "Failed to update state store", "error", err)
+	}
+}
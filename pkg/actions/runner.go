@@ -0,0 +1,242 @@
+package actions
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Command describes a single system command invocation
+type Command struct {
+	Name  string
+	Args  []string
+	Stdin string
+
+	// Output, when set, receives each line of output as it is produced
+	Output func(line string)
+}
+
+// String returns the command line as it would be typed in a shell
+func (c Command) String() string {
+	if len(c.Args) == 0 {
+		return c.Name
+	}
+	return c.Name + " " + strings.Join(c.Args, " ")
+}
+
+// CommandRunner executes system commands on behalf of actions.
+// Implementations must stop the command when ctx is done.
+type CommandRunner interface {
+	Run(ctx context.Context, cmd Command) ([]byte, error)
+}
+
+// ExecRunner runs commands on the local system using os/exec
+type ExecRunner struct{}
+
+// Run executes the command and returns its combined output
+func (ExecRunner) Run(ctx context.Context, c Command) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	// Give children that inherited the output pipe a moment to exit
+	// after the command is killed, instead of blocking forever
+	cmd.WaitDelay = 5 * time.Second
+	if c.Stdin != "" {
+		cmd.Stdin = strings.NewReader(c.Stdin)
+	}
+	// Keep stderr apart as well for error reports
+	var output, stderr bytes.Buffer
+	if c.Output == nil {
+		combined := &syncWriter{w: &output}
+		cmd.Stdout = combined
+		cmd.Stderr = io.MultiWriter(combined, &stderr)
+		err := cmd.Run()
+		return output.Bytes(), commandError(c, stderr.String(), err)
+	}
+
+	// Stream output line by line while also collecting it
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = io.MultiWriter(pw, &stderr)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(io.TeeReader(pr, &output))
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			c.Output(scanner.Text())
+		}
+		io.Copy(io.Discard, pr)
+	}()
+
+	err := cmd.Run()
+	pw.Close()
+	<-done
+
+	return output.Bytes(), commandError(c, stderr.String(), err)
+}
+
+// syncWriter serializes writes to a writer shared by stdout and stderr,
+// which os/exec copies from separate goroutines
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// commandError wraps the error of a failed command in a CommandError
+func commandError(c Command, stderr string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var ce *CommandError
+	if errors.As(err, &ce) {
+		return err
+	}
+
+	ce = &CommandError{Command: c.String(), ExitCode: -1, Stderr: strings.TrimSpace(stderr), Err: err}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.Exited() {
+		ce.ExitCode = exitErr.ExitCode()
+	}
+	return ce
+}
+
+// DefaultRunner is used by actions that have no runner of their own
+var DefaultRunner CommandRunner = ExecRunner{}
+
+// FakeCommand is a scripted command expectation for FakeRunner
+type FakeCommand struct {
+	Name   string
+	Args   []string
+	Output string
+	Err    error
+	blocks bool
+	used   bool
+}
+
+// Returns sets the canned output and error for the expected command
+func (fc *FakeCommand) Returns(output string, err error) *FakeCommand {
+	fc.Output = output
+	fc.Err = err
+	return fc
+}
+
+// Fails makes the expected command fail with the given output
+func (fc *FakeCommand) Fails(output string) *FakeCommand {
+	return fc.Returns(output, &CommandError{
+		Command:  Command{Name: fc.Name, Args: fc.Args}.String(),
+		ExitCode: 1,
+		Stderr:   output,
+		Err:      errors.New("exit status 1"),
+	})
+}
+
+// Blocks makes the expected command run until its context is done, as a
+// hung command would
+func (fc *FakeCommand) Blocks() *FakeCommand {
+	fc.blocks = true
+	return fc
+}
+
+func (fc *FakeCommand) matches(cmd Command) bool {
+	if fc.used || fc.Name != cmd.Name || len(fc.Args) != len(cmd.Args) {
+		return false
+	}
+	for i, arg := range fc.Args {
+		if arg != cmd.Args[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// FakeRunner records commands instead of executing them and answers
+// with scripted outputs. Commands without a matching expectation fail.
+type FakeRunner struct {
+	mu           sync.Mutex
+	expectations []*FakeCommand
+	calls        []Command
+}
+
+// NewFakeRunner creates a new fake runner with no expectations
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{}
+}
+
+// Expect registers a command that is expected to run. Each expectation
+// is consumed by the first matching call.
+func (f *FakeRunner) Expect(name string, args ...string) *FakeCommand {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fc := &FakeCommand{Name: name, Args: args}
+	f.expectations = append(f.expectations, fc)
+	return fc
+}
+
+// Run records the command and returns the scripted result
+func (f *FakeRunner) Run(ctx context.Context, cmd Command) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.calls = append(f.calls, cmd)
+	for _, fc := range f.expectations {
+		if fc.matches(cmd) {
+			fc.used = true
+			if fc.blocks {
+				f.mu.Unlock()
+				<-ctx.Done()
+				f.mu.Lock()
+				return nil, ctx.Err()
+			}
+			if cmd.Output != nil && fc.Output != "" {
+				for _, line := range strings.Split(strings.TrimRight(fc.Output, "\n"), "\n") {
+					cmd.Output(line)
+				}
+			}
+			return []byte(fc.Output), fc.Err
+		}
+	}
+
+	return nil, fmt.Errorf("unexpected command: %s", cmd)
+}
+
+// Calls returns every command run so far, in order
+func (f *FakeRunner) Calls() []Command {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	calls := make([]Command, len(f.calls))
+	copy(calls, f.calls)
+	return calls
+}
+
+// Unmet returns the expectations that were never run
+func (f *FakeRunner) Unmet() []*FakeCommand {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var unmet []*FakeCommand
+	for _, fc := range f.expectations {
+		if !fc.used {
+			unmet = append(unmet, fc)
+		}
+	}
+	return unmet
+}
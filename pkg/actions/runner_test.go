@@ -0,0 +1,171 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"easygo/pkg/config"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSystem points an action at a fake runner and a Debian system staged
+// in a temporary root with apt installed, keeping EasyGo's own files in
+// the test's directory too
+func fakeSystem(t *testing.T, ba *BaseAction) *FakeRunner {
+	t.Helper()
+
+	dir := t.TempDir()
+	cfg := config.Default()
+	cfg.Paths.Root = filepath.Join(dir, "root")
+	cfg.Paths.FileVersions = filepath.Join(dir, "versions")
+	cfg.Paths.Hooks = filepath.Join(dir, "hooks")
+	cfg.Paths.Templates = filepath.Join(dir, "templates")
+	previous := config.Current()
+	config.Set(cfg)
+	t.Cleanup(func() { config.Set(previous) })
+
+	apt := filepath.Join(cfg.Paths.Root, "usr/bin/apt")
+	if err := os.MkdirAll(filepath.Dir(apt), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(apt, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := NewFakeRunner()
+	ba.SetRunner(runner)
+	ba.SetPlatform(ParseOSRelease("ID=debian\nVERSION_ID=12\n"))
+	ba.SetFileSystem(OSFileSystem{Root: cfg.Paths.Root})
+	return runner
+}
+
+// checkCalls compares the commands an action ran with the expected ones,
+// given as command lines
+func checkCalls(t *testing.T, runner *FakeRunner, want []string) {
+	t.Helper()
+
+	var got []string
+	for _, call := range runner.Calls() {
+		got = append(got, call.String())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands:\n  %s\nwant:\n  %s", strings.Join(got, "\n  "), strings.Join(want, "\n  "))
+	}
+}
+
+// checkCommands compares the commands an action ran with the expected
+// ones argument by argument, for arguments holding spaces, and with their
+// input
+func checkCommands(t *testing.T, runner *FakeRunner, want []Command) {
+	t.Helper()
+
+	calls := runner.Calls()
+	for i := 0; i < len(calls) || i < len(want); i++ {
+		switch {
+		case i >= len(calls):
+			t.Errorf("command %d: missing %s", i, want[i])
+		case i >= len(want):
+			t.Errorf("command %d: unexpected %s", i, calls[i])
+		case calls[i].Name != want[i].Name || strings.Join(calls[i].Args, "\x00") != strings.Join(want[i].Args, "\x00"):
+			t.Errorf("command %d: %s, want %s", i, calls[i], want[i])
+		case calls[i].Stdin != want[i].Stdin:
+			t.Errorf("command %d: %s with input %q, want %q", i, calls[i], calls[i].Stdin, want[i].Stdin)
+		}
+	}
+}
+
+func TestRunCommandTimeout(t *testing.T) {
+	action := &BaseAction{}
+	runner := fakeSystem(t, action)
+	runner.Expect("apt", "update").Blocks()
+	action.SetTimeout(10 * time.Millisecond)
+
+	result := action.RunCommand("apt", "update")
+	if result.Success {
+		t.Fatal("hung command succeeded")
+	}
+	if !errors.Is(result.Error, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want a deadline error", result.Error)
+	}
+	if !strings.Contains(result.Error.Error(), "timed out after 10ms") {
+		t.Errorf("error = %q, want it to name the timeout", result.Error)
+	}
+}
+
+func TestRunCommandCancelled(t *testing.T) {
+	action := &BaseAction{}
+	runner := fakeSystem(t, action)
+	runner.Expect("apt", "update").Blocks()
+	ctx, cancel := context.WithCancel(context.Background())
+	action.SetContext(ctx)
+
+	time.AfterFunc(10*time.Millisecond, cancel)
+	result := action.RunCommand("apt", "update")
+	if !errors.Is(result.Error, context.Canceled) {
+		t.Errorf("error = %v, want a cancellation", result.Error)
+	}
+}
+
+func TestRunCommandFailure(t *testing.T) {
+	action := &BaseAction{}
+	runner := fakeSystem(t, action)
+	runner.Expect("apt", "update").Fails("E: Could not get lock")
+
+	result := action.RunCommand("apt", "update")
+	var cmdErr *CommandError
+	if !errors.As(result.Error, &cmdErr) {
+		t.Fatalf("error = %v, want a CommandError", result.Error)
+	}
+	if cmdErr.Command != "apt update" || cmdErr.ExitCode != 1 || cmdErr.Stderr != "E: Could not get lock" {
+		t.Errorf("error = %+v", cmdErr)
+	}
+	if code := ErrorCode(result.Error); code != "command_failed" {
+		t.Errorf("code = %s, want command_failed", code)
+	}
+}
+
+func TestRunCommandLogsNameOnly(t *testing.T) {
+	var logged bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logged, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	action := &BaseAction{}
+	runner := fakeSystem(t, action)
+	runner.Expect("mysql", "-e", "SET PASSWORD FOR 'shop'@'localhost' = PASSWORD('s3cret');").Fails("ERROR 1045")
+
+	action.RunCommand("mysql", "-e", "SET PASSWORD FOR 'shop'@'localhost' = PASSWORD('s3cret');")
+	if !strings.Contains(logged.String(), "command=mysql") {
+		t.Errorf("log does not name the command:\n%s", logged.String())
+	}
+	if strings.Contains(logged.String(), "s3cret") {
+		t.Errorf("log shows the arguments:\n%s", logged.String())
+	}
+}
+
+func TestExecRunnerOutput(t *testing.T) {
+	script := `for i in $(seq 200); do echo "out $i"; echo "err $i" >&2; done; exit 3`
+	output, err := ExecRunner{}.Run(context.Background(), Command{Name: "sh", Args: []string{"-c", script}})
+
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.ExitCode != 3 {
+		t.Fatalf("error = %v, want exit code 3", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) != 400 {
+		t.Fatalf("got %d lines of output, want 400:\n%s", len(lines), output)
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "out ") && !strings.HasPrefix(line, "err ") {
+			t.Fatalf("garbled line %q", line)
+		}
+	}
+	if stderr := strings.Split(cmdErr.Stderr, "\n"); len(stderr) != 200 || stderr[0] != "err 1" || stderr[199] != "err 200" {
+		t.Errorf("stderr holds %d lines, want err 1 to err 200", len(stderr))
+	}
+}
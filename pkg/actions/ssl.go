@@ -1,10 +1,29 @@
 package actions
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"easygo/pkg/config"
+	"easygo/pkg/state"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 )
 
+// Where certificates come from
+const (
+	CertificateLetsEncrypt = "letsencrypt"
+	CertificateUploaded    = "uploaded"
+)
+
+// uploadedCertificateDir keeps uploaded certificates, in <domain>/
+const uploadedCertificateDir = "/etc/ssl/easygo"
+
 // SSLAction handles SSL certificate management
 type SSLAction struct {
 	BaseAction
@@ -27,24 +46,59 @@ type Certificate struct {
 }
 
 // InstallCertbot installs certbot for Let's Encrypt
-func (s *SSLAction) InstallCertbot() *Result {
-	if s.FileExists("/usr/bin/apt") {
-		return s.installCertbotDebian()
-	} else if s.FileExists("/usr/bin/yum") || s.FileExists("/usr/bin/dnf") {
-		return s.installCertbotRHEL()
+func (s *SSLAction) InstallCertbot() (res *Result) {
+	hook := s.Hook("InstallCertbot", nil)
+	if failed := hook.Pre(); failed != nil {
+		return failed
 	}
+	defer hook.Post(&res)
 	
-	return &Result{
-		Success: false,
-		Message: "Unsupported Linux distribution",
-		Error:   fmt.Errorf("unsupported package manager"),
+	pm := s.PackageManager()
+	if pm == nil {
+		return unsupportedPlatform()
+	}
+	
+	updateResult := pm.Update()
+	if !updateResult.Success {
+		return updateResult
 	}
+	
+	// certbot lives in EPEL on RHEL-based systems
+	if pm.Name() == "dnf" || pm.Name() == "yum" {
+		epelResult := pm.AddRepository("epel-release")
+		if !epelResult.Success {
+			return epelResult
+		}
+	}
+	
+	return pm.Install(ResolvePackages(pm, "", "certbot")...)
 }
 
-// IssueCertificate issues a Let's Encrypt certificate
-func (s *SSLAction) IssueCertificate(domain, email, webroot string) *Result {
+// IssueCertificate issues a Let's Encrypt certificate and serves the
+// domain's vhost over HTTPS with it. An empty webroot is the vhost's
+// document root.
+func (s *SSLAction) IssueCertificate(domain, email, webroot string) (res *Result) {
+	hook := s.Hook("IssueCertificate", map[string]string{"domain": domain, "email": email, "webroot": webroot})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
+	if webroot == "" {
+		if records := s.domainRecords(domain); len(records) > 0 {
+			webroot = records[0].DocumentRoot
+		}
+	}
+	if webroot == "" {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("%s has no managed vhost, give the webroot to answer the challenge from", domain),
+			Error:   newError(ErrValidationFailed, "no webroot for %s", domain),
+		}
+	}
+	
 	// Check if certbot is installed
-	if !s.FileExists("/usr/bin/certbot") {
+	if !s.LocalFileExists("/usr/bin/certbot") {
 		installResult := s.InstallCertbot()
 		if !installResult.Success {
 			return installResult
@@ -62,12 +116,40 @@ func (s *SSLAction) IssueCertificate(domain, email, webroot string) *Result {
 		"--non-interactive",
 	}
 	
-	return s.RunCommand("certbot", args...)
+	result := s.RunCommand("certbot", args...)
+	if !result.Success {
+		return result
+	}
+	s.recordCertificate(domain, CertificatePath(domain), "", CertificateLetsEncrypt)
+	return s.serveHTTPS(domain, result)
+}
+
+// CertificatePath returns where certbot keeps a domain's certificate chain
+func CertificatePath(domain string) string {
+	return filepath.Join("/etc/letsencrypt/live", domain, "fullchain.pem")
+}
+
+// HasCertificate reports whether a certificate has been issued for, or
+// uploaded to, a domain
+func (s *SSLAction) HasCertificate(domain string) bool {
+	path := CertificatePath(domain)
+	if store := s.Store(); store != nil {
+		if record, err := store.Certificates().Get(domain); err == nil && record.Path != "" {
+			path = record.Path
+		}
+	}
+	return s.FileExists(path)
 }
 
 // IssueWildcardCertificate issues a wildcard certificate using DNS challenge
-func (s *SSLAction) IssueWildcardCertificate(domain, email, dnsProvider string) *Result {
-	if !s.FileExists("/usr/bin/certbot") {
+func (s *SSLAction) IssueWildcardCertificate(domain, email, dnsProvider string) (res *Result) {
+	hook := s.Hook("IssueWildcardCertificate", map[string]string{"domain": domain, "email": email, "dns_provider": dnsProvider})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
+	if !s.LocalFileExists("/usr/bin/certbot") {
 		installResult := s.InstallCertbot()
 		if !installResult.Success {
 			return installResult
@@ -80,6 +162,7 @@ func (s *SSLAction) IssueWildcardCertificate(domain, email, dnsProvider string)
 		return pluginResult
 	}
 	
+	// certbot names the certificate after the domain, without the *.
 	args := []string{
 		"certonly",
 		"--dns-" + dnsProvider,
@@ -90,17 +173,275 @@ func (s *SSLAction) IssueWildcardCertificate(domain, email, dnsProvider string)
 		"--non-interactive",
 	}
 	
-	return s.RunCommand("certbot", args...)
+	result := s.RunCommand("certbot", args...)
+	if !result.Success {
+		return result
+	}
+	s.recordCertificate(domain, CertificatePath(domain), "", CertificateLetsEncrypt)
+	return s.serveHTTPS(domain, result)
+}
+
+// UploadCertificate installs a certificate chain and its private key, in
+// PEM form, in /etc/ssl/easygo/<domain> and serves the domain's vhost over
+// HTTPS with them
+func (s *SSLAction) UploadCertificate(domain string, chain, key []byte) (res *Result) {
+	hook := s.Hook("UploadCertificate", map[string]string{"domain": domain})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
+	if failure := validateDomain(domain); failure != nil {
+		return failure
+	}
+	if err := checkCertificate(domain, chain, key); err != nil {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("Certificate not installed: %v", err),
+			Error:   wrapError(ErrValidationFailed, err, "invalid certificate for %s", domain),
+		}
+	}
+	
+	dir := filepath.Join(uploadedCertificateDir, domain)
+	chainPath := filepath.Join(dir, "fullchain.pem")
+	keyPath := filepath.Join(dir, privateKeyName)
+	
+	// Only root may read the private key, which is kept out of file
+	// versions and drift detection
+	tx := s.Begin(fmt.Sprintf("certificate %s", domain))
+	if result := tx.Run(nil, "install", "-d", "-m", "700", s.localPath(dir)); !result.Success {
+		return result
+	}
+	if result := tx.WriteFile(chainPath, string(chain)); !result.Success {
+		return result
+	}
+	if result := tx.WritePrivateFile(keyPath, string(key)); !result.Success {
+		return result
+	}
+	result := tx.Commit(&Result{
+		Success: true,
+		Message: fmt.Sprintf("Installed the certificate for %s in %s", domain, dir),
+	})
+	s.recordCertificate(domain, chainPath, keyPath, CertificateUploaded)
+	return s.serveHTTPS(domain, result)
+}
+
+// checkCertificate checks that a chain and key form a pair whose
+// certificate is valid for the domain now
+func checkCertificate(domain string, chain, key []byte) error {
+	pair, err := tls.X509KeyPair(chain, key)
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return err
+	}
+	if err := leaf.VerifyHostname(domain); err != nil {
+		return err
+	}
+	if now := time.Now(); now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return fmt.Errorf("it is valid from %s to %s", leaf.NotBefore.Format("2006-01-02"), leaf.NotAfter.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// renewedCertificatesList is where certbot's deploy hook lists the live
+// directories of the certificates it renewed, next to the state store
+func renewedCertificatesList() string {
+	return filepath.Join(filepath.Dir(config.Current().Paths.State), "renewed-certificates")
+}
+
+// RenewCertificates renews the Let's Encrypt certificates due for renewal
+// and reloads the web servers whose HTTPS vhosts serve the renewed ones.
+// Vhosts are not re-rendered: they name certbot's live files, which
+// renewal replaces, so their edits are left alone.
+func (s *SSLAction) RenewCertificates() (res *Result) {
+	hook := s.Hook("RenewCertificates", nil)
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
+	list := renewedCertificatesList()
+	deployHook := fmt.Sprintf(`echo "$RENEWED_LINEAGE" >> '%s'`, strings.ReplaceAll(list, "'", `'\''`))
+	result := s.RunCommand("certbot", "renew", "--quiet", "--deploy-hook", deployHook)
+	if s.DryRun() {
+		return result
+	}
+	
+	// Certificates renewed before a failure are served all the same
+	reloaded := s.reloadRenewed(list)
+	if !result.Success {
+		return result
+	}
+	return reloaded
+}
+
+// reloadRenewed records the new expiry of the certificates in the list of
+// renewed ones and reloads the web servers serving them. The list is
+// removed once they are reloaded, so a failed run is taken up by the next.
+func (s *SSLAction) reloadRenewed(list string) *Result {
+	content, err := os.ReadFile(list)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return &Result{
+			Success: false,
+			Message: "Failed to read which certificates were renewed",
+			Error:   err,
+		}
+	}
+	var lineages, renewed []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !slices.Contains(lineages, filepath.Clean(line)) {
+			lineages = append(lineages, filepath.Clean(line))
+			renewed = append(renewed, filepath.Base(line))
+		}
+	}
+	if len(renewed) == 0 {
+		return &Result{
+			Success: true,
+			Message: "No certificates were due for renewal",
+		}
+	}
+	
+	var records []*state.Domain
+	store := s.Store()
+	if store != nil {
+		if records, err = store.Domains().Find(func(domain *state.Domain) bool {
+			return domain.TLS != nil
+		}); err != nil {
+			return &Result{
+				Success: false,
+				Message: fmt.Sprintf("Renewed the certificates of %s, but failed to read the HTTPS vhosts from the state store", strings.Join(renewed, ", ")),
+				Error:   err,
+			}
+		}
+	}
+	
+	// A vhost serves a renewed certificate when the one recorded for its
+	// domain, or certbot's by default, is in a renewed lineage. Lineages
+	// need not be named after the domain, e.g. example.com-0001, and
+	// uploaded certificates are in none.
+	web := &WebServerAction{BaseAction: s.BaseAction}
+	var layouts []*vhostLayout
+	recorded, reloading := map[string]bool{}, map[string]bool{}
+	for _, record := range records {
+		cert, err := store.Certificates().Get(record.Name)
+		if err != nil || cert.Path == "" {
+			cert = &state.Certificate{Domain: record.Name, Path: CertificatePath(record.Name), Source: CertificateLetsEncrypt}
+		}
+		if !slices.Contains(lineages, filepath.Dir(cert.Path)) {
+			continue
+		}
+		if !recorded[record.Name] {
+			recorded[record.Name] = true
+			s.recordCertificate(cert.Domain, cert.Path, cert.KeyPath, cert.Source)
+		}
+		layout, failure := web.vhostLayout(record.WebServer)
+		if failure != nil || reloading[layout.service] {
+			continue
+		}
+		reloading[layout.service] = true
+		layouts = append(layouts, layout)
+	}
+	
+	var reloaded []string
+	for _, layout := range layouts {
+		result := validationResult(s.RunCommand(layout.test[0], layout.test[1:]...))
+		if result.Success {
+			result = s.ReloadService(layout.service)
+		}
+		if !result.Success {
+			return &Result{
+				Success: false,
+				Message: fmt.Sprintf("Renewed the certificates of %s, but failed to reload %s: %s", strings.Join(renewed, ", "), layout.service, result.Message),
+				Error:   result.Error,
+			}
+		}
+		reloaded = append(reloaded, layout.service)
+	}
+	if err := os.Remove(list); err != nil {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("Renewed the certificates of %s, but failed to remove %s", strings.Join(renewed, ", "), list),
+			Error:   err,
+		}
+	}
+	
+	message := fmt.Sprintf("Renewed the certificates of %s", strings.Join(renewed, ", "))
+	if len(reloaded) > 0 {
+		message += " and reloaded " + strings.Join(reloaded, ", ")
+	}
+	return &Result{
+		Success: true,
+		Message: message,
+	}
 }
 
-// RenewCertificates renews all certificates
-func (s *SSLAction) RenewCertificates() *Result {
-	return s.RunCommand("certbot", "renew", "--quiet")
+// recordCertificate records a domain's certificate with its expiry
+func (s *SSLAction) recordCertificate(domain, path, keyPath, source string) {
+	cert := &state.Certificate{
+		Domain:  domain,
+		Path:    path,
+		KeyPath: keyPath,
+		Source:  source,
+		Meta:    s.meta(nil),
+	}
+	if notAfter, err := certificateExpiry(s.FileSystem(), path); err == nil {
+		cert.NotAfter = notAfter
+	}
+	s.record(func(store *state.Store) error {
+		return store.Certificates().Put(cert)
+	})
+}
+
+// domainRecords returns a domain's managed vhosts, one per web server
+func (s *SSLAction) domainRecords(domain string) []*state.Domain {
+	store := s.Store()
+	if store == nil {
+		return nil
+	}
+	records, err := store.Domains().Find(func(record *state.Domain) bool {
+		return record.Name == domain
+	})
+	if err != nil {
+		return nil
+	}
+	return records
+}
+
+// serveHTTPS re-renders the managed vhosts of a domain whose certificate
+// was put in place, with their HTTPS settings or the default ones
+func (s *SSLAction) serveHTTPS(domain string, installed *Result) *Result {
+	records := s.domainRecords(domain)
+	if len(records) == 0 {
+		return installed
+	}
+	
+	web := &WebServerAction{BaseAction: s.BaseAction}
+	for _, record := range records {
+		settings := record.TLS
+		if settings == nil {
+			settings = &state.TLS{}
+		}
+		result := web.ConfigureVhost(record.WebServer, domain, record.DocumentRoot, &VhostOptions{TLS: settings})
+		if !result.Success {
+			return &Result{
+				Success: false,
+				Message: fmt.Sprintf("The certificate for %s is in place, but its %s vhost was not switched to HTTPS: %s", domain, record.WebServer, result.Message),
+				Error:   result.Error,
+			}
+		}
+	}
+	return &Result{
+		Success: true,
+		Message: fmt.Sprintf("The certificate for %s is in place and its vhost serves HTTPS", domain),
+	}
 }
 
 // ListCertificates lists all certificates
 func (s *SSLAction) ListCertificates() *Result {
-	result := s.RunCommand("certbot", "certificates")
+	result := s.query("certbot", "certificates")
 	if !result.Success {
 		return result
 	}
@@ -149,90 +490,67 @@ func (s *SSLAction) ListCertificates() *Result {
 }
 
 // RevokeCertificate revokes a certificate
-func (s *SSLAction) RevokeCertificate(domain string) *Result {
+func (s *SSLAction) RevokeCertificate(domain string) (res *Result) {
+	hook := s.Hook("RevokeCertificate", map[string]string{"domain": domain})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
 	return s.RunCommand("certbot", "revoke", "--cert-name", domain)
 }
 
 // SetupAutoRenewal sets up automatic certificate renewal
-func (s *SSLAction) SetupAutoRenewal() *Result {
-	// Create cron job for automatic renewal
-	cronEntry := "0 12 * * * /usr/bin/certbot renew --quiet"
+func (s *SSLAction) SetupAutoRenewal() (res *Result) {
+	hook := s.Hook("SetupAutoRenewal", nil)
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+	
+	// Renew through EasyGo, which reloads the web servers onto renewed
+	// certificates
+	executable, err := os.Executable()
+	if err != nil {
+		executable = "/usr/local/bin/easygo"
+	}
+	cronEntry := fmt.Sprintf("0 12 * * * %s ssl renew", executable)
 	
 	// Check if cron entry already exists
-	checkResult := s.RunCommand("crontab", "-l")
-	if checkResult.Success && strings.Contains(checkResult.Message, "certbot renew") {
+	checkResult := s.query("crontab", "-l")
+	if checkResult.Success && strings.Contains(checkResult.Message, " ssl renew") {
 		return &Result{
 			Success: true,
 			Message: "Auto-renewal is already configured",
 		}
 	}
 	
-	// Add to crontab
-	cmd := fmt.Sprintf("(crontab -l 2>/dev/null; echo '%s') | crontab -", cronEntry)
+	// Add to crontab, replacing a plain certbot renew entry
+	cmd := fmt.Sprintf("(crontab -l 2>/dev/null | grep -v 'certbot renew'; echo '%s') | crontab -", cronEntry)
 	return s.RunCommand("bash", "-c", cmd)
 }
 
 // Private helper methods
 
-func (s *SSLAction) installCertbotDebian() *Result {
-	updateResult := s.RunCommand("apt", "update")
-	if !updateResult.Success {
-		return updateResult
-	}
-	
-	return s.RunCommand("apt", "install", "-y", "certbot")
-}
-
-func (s *SSLAction) installCertbotRHEL() *Result {
-	var installCmd string
-	if s.FileExists("/usr/bin/dnf") {
-		installCmd = "dnf"
-	} else {
-		installCmd = "yum"
-	}
-	
-	// Install EPEL repository first
-	epelResult := s.RunCommand(installCmd, "install", "-y", "epel-release")
-	if !epelResult.Success {
-		return epelResult
-	}
-	
-	return s.RunCommand(installCmd, "install", "-y", "certbot")
-}
-
 func (s *SSLAction) installDNSPlugin(provider string) *Result {
-	var packageName string
-	
 	switch provider {
-	case "cloudflare":
-		packageName = "python3-certbot-dns-cloudflare"
-	case "route53":
-		packageName = "python3-certbot-dns-route53"
-	case "digitalocean":
-		packageName = "python3-certbot-dns-digitalocean"
+	case "cloudflare", "route53", "digitalocean":
 	default:
 		return &Result{
 			Success: false,
 			Message: fmt.Sprintf("Unsupported DNS provider: %s", provider),
-			Error:   fmt.Errorf("unsupported DNS provider"),
+			Error:   newError(ErrValidationFailed, "unsupported DNS provider %q", provider),
 		}
 	}
 	
-	if s.FileExists("/usr/bin/apt") {
-		return s.RunCommand("apt", "install", "-y", packageName)
-	} else if s.FileExists("/usr/bin/yum") || s.FileExists("/usr/bin/dnf") {
-		var installCmd string
-		if s.FileExists("/usr/bin/dnf") {
-			installCmd = "dnf"
-		} else {
-			installCmd = "yum"
+	pm := s.PackageManager()
+	if pm == nil {
+		return &Result{
+			Success: false,
+			Message: "Unsupported package manager",
+			Error:   newError(ErrUnsupportedPlatform, "unsupported package manager"),
 		}
-		return s.RunCommand(installCmd, "install", "-y", packageName)
 	}
 	
-	return &Result{
-		Success: false,
-		Message: "Unsupported package manager",
-		Error:   fmt.Errorf("unsupported package manager"),
-	}
+	return pm.Install(ResolvePackages(pm, "", "certbot-dns-"+provider)...)
 }
\ No newline at end of file
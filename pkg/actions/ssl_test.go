@@ -0,0 +1,182 @@
+package actions
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"easygo/pkg/config"
+	"easygo/pkg/state"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRenewCertificates(t *testing.T) {
+	tests := []struct {
+		name    string
+		renewed string // lines certbot's deploy hook wrote, if any
+		want    []string
+	}{
+		{
+			name: "nothing due",
+			want: nil,
+		},
+		{
+			name:    "renewed",
+			renewed: "/etc/letsencrypt/live/a.example.com\n",
+			want:    []string{"nginx -t", "systemctl reload nginx"},
+		},
+		{
+			name:    "lineage not named after the domain",
+			renewed: "/etc/letsencrypt/live/b.example.com-0001\n",
+			want:    []string{"apachectl configtest", "systemctl reload apache2"},
+		},
+		{
+			name:    "lineage the vhost does not use",
+			renewed: "/etc/letsencrypt/live/b.example.com\n",
+			want:    nil,
+		},
+		{
+			name:    "uploaded certificate",
+			renewed: "/etc/letsencrypt/live/c.example.com\n",
+			want:    nil,
+		},
+		{
+			name:    "several",
+			renewed: "/etc/letsencrypt/live/a.example.com\n/etc/letsencrypt/live/b.example.com-0001\n/etc/letsencrypt/live/a.example.com\n",
+			want:    []string{"apachectl configtest", "systemctl reload apache2", "nginx -t", "systemctl reload nginx"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSSLAction()
+			runner := fakeSystem(t, &s.BaseAction)
+			config.Current().Paths.State = filepath.Join(t.TempDir(), "state.db")
+			store, err := state.Open(config.Current().Paths.State)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.SetStore(store)
+
+			for name, webServer := range map[string]string{"a.example.com": WebServerNginx, "b.example.com": WebServerApache, "c.example.com": WebServerNginx} {
+				if err := store.Domains().Put(&state.Domain{Name: name, WebServer: webServer, TLS: &state.TLS{}}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, cert := range []*state.Certificate{
+				{Domain: "b.example.com", Path: "/etc/letsencrypt/live/b.example.com-0001/fullchain.pem", Source: CertificateLetsEncrypt},
+				{Domain: "c.example.com", Path: "/etc/ssl/easygo/c.example.com/fullchain.pem", KeyPath: "/etc/ssl/easygo/c.example.com/privkey.pem", Source: CertificateUploaded},
+			} {
+				if err := store.Certificates().Put(cert); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// The fake certbot runs no deploy hook, so its list is written here
+			list := renewedCertificatesList()
+			if tt.renewed != "" {
+				if err := os.WriteFile(list, []byte(tt.renewed), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			deployHook := fmt.Sprintf(`echo "$RENEWED_LINEAGE" >> '%s'`, list)
+			runner.Expect("certbot", "renew", "--quiet", "--deploy-hook", deployHook)
+			runner.Expect("nginx", "-t")
+			runner.Expect("systemctl", "reload", "nginx")
+			runner.Expect("apachectl", "configtest")
+			runner.Expect("systemctl", "reload", "apache2")
+
+			if result := s.RenewCertificates(); !result.Success {
+				t.Fatalf("error = %v (%s)", result.Error, result.Message)
+			}
+			checkCalls(t, runner, append([]string{"certbot renew --quiet --deploy-hook " + deployHook}, tt.want...))
+			if _, err := os.Stat(list); !os.IsNotExist(err) {
+				t.Errorf("%s was kept: %v", list, err)
+			}
+		})
+	}
+}
+
+func TestUploadCertificateKey(t *testing.T) {
+	s := NewSSLAction()
+	runner := fakeSystem(t, &s.BaseAction)
+	store, err := state.Open(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetStore(store)
+
+	domain := "shop.example.com"
+	chain, key := selfSignedCertificate(t, domain)
+	dir := filepath.Join(uploadedCertificateDir, domain)
+	chainPath := filepath.Join(dir, "fullchain.pem")
+	keyPath := filepath.Join(dir, privateKeyName)
+	runner.Expect("install", "-d", "-m", "700", s.localPath(dir))
+
+	// A key written as a managed file before is no longer kept
+	if result := s.WriteFile(keyPath, "previous key\n"); !result.Success {
+		t.Fatal(result.Error)
+	}
+	s.WriteFile(keyPath, "previous key, rewritten\n")
+
+	if result := s.UploadCertificate(domain, chain, key); !result.Success {
+		t.Fatalf("error = %v (%s)", result.Error, result.Message)
+	}
+
+	info, err := os.Stat(s.localPath(keyPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("key mode = %v, want 0600", mode)
+	}
+	if content, _ := s.FileSystem().ReadFile(keyPath); string(content) != string(key) {
+		t.Errorf("key = %q, want the uploaded one", content)
+	}
+	if _, err := os.Stat(versionDir(keyPath)); !os.IsNotExist(err) {
+		t.Errorf("key versions are kept: %v", err)
+	}
+	result := s.ListManagedFiles()
+	if !result.Success {
+		t.Fatal(result.Error)
+	}
+	if files := result.Data.([]string); !slices.Equal(files, []string{chainPath}) {
+		t.Errorf("managed files = %v, want %v", files, []string{chainPath})
+	}
+}
+
+// selfSignedCertificate returns a certificate for a domain and its key, in
+// PEM form
+func selfSignedCertificate(t *testing.T, domain string) (chain, key []byte) {
+	t.Helper()
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &private.PublicKey, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
@@ -0,0 +1,133 @@
+package actions
+
+import (
+	"easygo/pkg/state"
+	"path/filepath"
+	"strings"
+)
+
+// Cipher presets of HTTPS vhosts, after Mozilla's server side TLS
+// guidelines
+const (
+	CiphersModern       = "modern"       // TLS 1.3 only
+	CiphersIntermediate = "intermediate" // TLS 1.2 and 1.3, the default
+)
+
+// intermediateCiphers are the TLS 1.2 cipher suites of the intermediate
+// preset, forward secret AEAD ciphers without the DHE ones needing
+// Diffie-Hellman parameters. TLS 1.3 suites are not configured by name.
+var intermediateCiphers = strings.Join([]string{
+	"ECDHE-ECDSA-AES128-GCM-SHA256",
+	"ECDHE-RSA-AES128-GCM-SHA256",
+	"ECDHE-ECDSA-AES256-GCM-SHA384",
+	"ECDHE-RSA-AES256-GCM-SHA384",
+	"ECDHE-ECDSA-CHACHA20-POLY1305",
+	"ECDHE-RSA-CHACHA20-POLY1305",
+}, ":")
+
+// tlsSnippet is the Apache configuration snippet with the server-wide
+// settings of HTTPS vhosts, written when one staples OCSP responses
+const tlsSnippet = "easygo-tls"
+
+// privateKeyName is the private key's file name next to the chain in
+// certbot's live directory
+const privateKeyName = "privkey.pem"
+
+// validateTLS checks HTTPS settings
+func validateTLS(settings *state.TLS) error {
+	switch settings.Ciphers {
+	case "", CiphersModern, CiphersIntermediate:
+		return nil
+	}
+	return newError(ErrValidationFailed, "ciphers must be %s or %s, not %q", CiphersModern, CiphersIntermediate, settings.Ciphers)
+}
+
+// vhostTLS returns what templates render the HTTPS side of a domain's
+// vhost with, its certificate and the settings in the web server's syntax
+func (w *WebServerAction) vhostTLS(layout *vhostLayout, domain string, settings *state.TLS) (*VhostTLS, error) {
+	if err := validateTLS(settings); err != nil {
+		return nil, err
+	}
+	chain, key, err := w.certificateFiles(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	protocols := []string{"TLSv1.2", "TLSv1.3"}
+	ciphers := intermediateCiphers
+	if settings.Ciphers == CiphersModern {
+		protocols, ciphers = []string{"TLSv1.3"}, ""
+	}
+	if layout.webServer == WebServerApache {
+		for i, protocol := range protocols {
+			protocols[i] = "+" + protocol
+		}
+		protocols = append([]string{"-all"}, protocols...)
+	}
+	return &VhostTLS{
+		Certificate:  chain,
+		Key:          key,
+		Protocols:    strings.Join(protocols, " "),
+		Ciphers:      ciphers,
+		HTTP2:        !settings.NoHTTP2,
+		HSTS:         settings.HSTS,
+		OCSPStapling: settings.OCSPStapling,
+		Redirect:     !settings.NoRedirect,
+	}, nil
+}
+
+// certificateFiles returns the certificate chain and private key of a
+// domain: those recorded for it, or certbot's in its live directory
+func (w *WebServerAction) certificateFiles(domain string) (chain, key string, err error) {
+	chain = CertificatePath(domain)
+	if store := w.Store(); store != nil {
+		if record, err := store.Certificates().Get(domain); err == nil && record.Path != "" {
+			chain, key = record.Path, record.KeyPath
+		}
+	}
+	if key == "" {
+		key = filepath.Join(filepath.Dir(chain), privateKeyName)
+	}
+
+	// Under a dry run the certificate may be issued by an earlier step
+	if w.DryRun() {
+		return chain, key, nil
+	}
+	for _, path := range []string{chain, key} {
+		if !w.FileExists(path) {
+			return "", "", newError(ErrNotFound, "no certificate for %s: %s does not exist, issue or upload one first", domain, path)
+		}
+	}
+	return chain, key, nil
+}
+
+// apacheTLSSteps enables the modules HTTPS vhosts need, and the stapling
+// cache when they staple OCSP responses
+func (w *WebServerAction) apacheTLSSteps(tx *Transaction, settings *state.TLS) *Result {
+	modules := []string{"ssl"}
+	if !settings.NoHTTP2 {
+		modules = append(modules, "http2")
+	}
+	if settings.HSTS {
+		modules = append(modules, "headers")
+	}
+	for _, module := range modules {
+		if result := w.apacheModuleStep(tx, module); !result.Success {
+			return result
+		}
+	}
+	if !settings.OCSPStapling {
+		return &Result{Success: true}
+	}
+
+	platform := w.Platform()
+	snippet := filepath.Join(platform.ApacheConfSnippets, tlsSnippet+".conf")
+	if result := tx.WriteFile(snippet, `# Managed by EasyGo: settings shared by HTTPS vhosts
+<IfModule ssl_module>
+    SSLStaplingCache shmcb:/var/run/ocsp(128000)
+</IfModule>
+`); !result.Success {
+		return result
+	}
+	return w.apacheConfStep(tx, tlsSnippet)
+}
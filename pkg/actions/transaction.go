@@ -0,0 +1,232 @@
+package actions
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Journal entry states
+const (
+	StepDone       = "done"
+	StepFailed     = "failed"
+	StepUndone     = "undone"
+	StepUndoFailed = "undo-failed"
+)
+
+// JournalEntry records the outcome of a transaction step
+type JournalEntry struct {
+	Step    string `json:"step"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// Transaction runs a compound operation as a series of steps. Each step
+// may register an undo function; when a step fails, the completed steps
+// are undone in reverse order so the system is left as it was.
+type Transaction struct {
+	ba      *BaseAction
+	name    string
+	undo    []transactionStep
+	journal []JournalEntry
+}
+
+type transactionStep struct {
+	name string
+	undo func() *Result
+}
+
+// Begin starts a new transaction
+func (ba *BaseAction) Begin(name string) *Transaction {
+	return &Transaction{ba: ba, name: name}
+}
+
+// Journal returns the steps recorded so far
+func (tx *Transaction) Journal() []JournalEntry {
+	journal := make([]JournalEntry, len(tx.journal))
+	copy(journal, tx.journal)
+	return journal
+}
+
+// Do runs a step. On success its undo function, if any, is registered.
+// On failure the transaction is rolled back and the returned result
+// describes both the failure and the rollback.
+func (tx *Transaction) Do(name string, do func() *Result, undo func() *Result) *Result {
+	result := do()
+	if !result.Success {
+		tx.journal = append(tx.journal, JournalEntry{Step: name, Status: StepFailed, Message: strings.TrimSpace(result.Message)})
+		return tx.fail(name, result)
+	}
+
+	tx.journal = append(tx.journal, JournalEntry{Step: name, Status: StepDone})
+	if undo != nil {
+		tx.undo = append(tx.undo, transactionStep{name: name, undo: undo})
+	}
+	return result
+}
+
+// Run runs a command as a step. undo, when given, is the command that
+// reverses it, e.g. []string{"a2dissite", domain}.
+func (tx *Transaction) Run(undo []string, command string, args ...string) *Result {
+	var undoFunc func() *Result
+	if len(undo) > 0 {
+		undoFunc = func() *Result {
+			return tx.ba.RunCommand(undo[0], undo[1:]...)
+		}
+	}
+
+	name := Command{Name: command, Args: args}.String()
+	return tx.Do(name, func() *Result {
+		return tx.ba.RunCommand(command, args...)
+	}, undoFunc)
+}
+
+// Validate runs a configuration test command as a step. Its failure is
+// reported as ErrValidationFailed.
+func (tx *Transaction) Validate(command string, args ...string) *Result {
+	name := Command{Name: command, Args: args}.String()
+	return tx.Do(name, func() *Result {
+		return validationResult(tx.ba.RunCommand(command, args...))
+	}, nil)
+}
+
+// WriteFile writes a file as a step. Undoing it restores the previous
+// content, or removes the file if it did not exist.
+func (tx *Transaction) WriteFile(path, content string) *Result {
+	previous, err := tx.ba.FileSystem().ReadFile(path)
+	existed := err == nil
+
+	return tx.Do("write "+path, func() *Result {
+		return tx.ba.WriteFile(path, content)
+	}, func() *Result {
+		if existed {
+			return tx.ba.WriteFile(path, string(previous))
+		}
+		return tx.ba.RemoveFile(path)
+	})
+}
+
+// WritePrivateFile writes a secret as a step, readable by its owner only
+// and kept out of file versions. Undoing it restores the previous content,
+// or removes the file if it did not exist.
+func (tx *Transaction) WritePrivateFile(path, content string) *Result {
+	previous, err := tx.ba.FileSystem().ReadFile(path)
+	existed := err == nil
+
+	return tx.Do("write "+path, func() *Result {
+		return tx.ba.writePrivateFile(path, content)
+	}, func() *Result {
+		if existed {
+			return tx.ba.writePrivateFile(path, string(previous))
+		}
+		return tx.ba.RemoveFile(path)
+	})
+}
+
+// Symlink creates or replaces a symbolic link as a step. Undoing it
+// restores the previous link target, or removes the link.
+func (tx *Transaction) Symlink(target, link string) *Result {
+	previous, err := tx.ba.FileSystem().Readlink(link)
+	existed := err == nil
+
+	return tx.Do(fmt.Sprintf("link %s -> %s", link, target), func() *Result {
+		return tx.ba.Symlink(target, link)
+	}, func() *Result {
+		if existed {
+			return tx.ba.Symlink(previous, link)
+		}
+		return tx.ba.RemoveFile(link)
+	})
+}
+
+// RemoveFile removes a file as a step. Undoing it writes the file back.
+func (tx *Transaction) RemoveFile(path string) *Result {
+	previous, err := tx.ba.FileSystem().ReadFile(path)
+	var undo func() *Result
+	if err == nil {
+		undo = func() *Result {
+			return tx.ba.WriteFile(path, string(previous))
+		}
+	}
+
+	return tx.Do("remove "+path, func() *Result {
+		return tx.ba.RemoveFile(path)
+	}, undo)
+}
+
+// Unlink removes a symbolic link as a step. Undoing it creates the link
+// again.
+func (tx *Transaction) Unlink(link string) *Result {
+	previous, err := tx.ba.FileSystem().Readlink(link)
+	var undo func() *Result
+	if err == nil {
+		undo = func() *Result {
+			return tx.ba.Symlink(previous, link)
+		}
+	}
+
+	return tx.Do("unlink "+link, func() *Result {
+		return tx.ba.RemoveFile(link)
+	}, undo)
+}
+
+// OnRollback registers an undo action that has no forward step, e.g.
+// restarting a service once the files it reads have been restored
+func (tx *Transaction) OnRollback(name string, undo func() *Result) {
+	tx.undo = append(tx.undo, transactionStep{name: name, undo: undo})
+}
+
+// Rollback undoes all completed steps in reverse order
+func (tx *Transaction) Rollback() *Result {
+	var failures []string
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		step := tx.undo[i]
+		result := step.undo()
+		if result.Success {
+			tx.journal = append(tx.journal, JournalEntry{Step: step.name, Status: StepUndone})
+		} else {
+			tx.journal = append(tx.journal, JournalEntry{Step: step.name, Status: StepUndoFailed, Message: strings.TrimSpace(result.Message)})
+			failures = append(failures, step.name)
+		}
+	}
+	tx.undo = nil
+
+	if len(failures) > 0 {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("Rollback of %s incomplete, could not undo: %s", tx.name, strings.Join(failures, "; ")),
+			Error:   fmt.Errorf("rollback failed"),
+			Data:    tx.Journal(),
+		}
+	}
+
+	return &Result{
+		Success: true,
+		Message: fmt.Sprintf("Rolled back %s", tx.name),
+		Data:    tx.Journal(),
+	}
+}
+
+// Commit finishes the transaction, discarding the undo steps
+func (tx *Transaction) Commit(result *Result) *Result {
+	tx.undo = nil
+	return result
+}
+
+// fail rolls back after a failed step and describes the outcome
+func (tx *Transaction) fail(step string, result *Result) *Result {
+	rollback := tx.Rollback()
+
+	message := fmt.Sprintf("%s failed at step %q: %s", tx.name, step, strings.TrimSpace(result.Message))
+	if rollback.Success {
+		message += " (all changes rolled back)"
+	} else {
+		message += " (" + rollback.Message + ")"
+	}
+
+	return &Result{
+		Success: false,
+		Message: message,
+		Error:   result.Error,
+		Data:    tx.Journal(),
+	}
+}
@@ -0,0 +1,865 @@
+package actions
+
+import (
+	"easygo/pkg/config"
+	"easygo/pkg/state"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Web servers virtual hosts are configured for
+const (
+	WebServerApache = "apache"
+	WebServerNginx  = "nginx"
+)
+
+// disabledSuffix marks disabled vhost files in layouts without
+// sites-enabled, whose web servers include every *.conf file
+const disabledSuffix = ".disabled"
+
+// Vhost is a virtual host configured on the server
+type Vhost struct {
+	Domain       string `json:"domain"` // the vhost file's name
+	ServerName   string `json:"server_name"`
+	WebServer    string `json:"web_server"`
+	DocumentRoot string `json:"document_root"`
+	ConfigPath   string `json:"config_path"`
+	Enabled      bool   `json:"enabled"`
+	Managed      bool   `json:"managed"`          // recorded in the state store
+	Config       string `json:"config,omitempty"` // the file's content, from ShowVhost
+
+	// The template and variables a managed vhost was rendered from
+	Template string            `json:"template,omitempty"`
+	Vars     map[string]string `json:"vars,omitempty"`
+	Proxy    *state.Proxy      `json:"proxy,omitempty"`
+	Hybrid   bool              `json:"hybrid,omitempty"` // either side of an Nginx in front of Apache vhost
+	TLS      *state.TLS        `json:"tls,omitempty"`    // HTTPS settings, on the Nginx side of hybrid vhosts
+}
+
+// vhostLayout is where a web server keeps its virtual hosts on the
+// detected platform
+type vhostLayout struct {
+	webServer   string
+	title       string // the web server's name in hooks and messages
+	service     string
+	available   string
+	enabled     string // empty when vhosts are included directly
+	logDir      string
+	test        []string // configuration test command
+	namePattern *regexp.Regexp
+	rootPattern *regexp.Regexp
+}
+
+// vhostLayout returns the vhost layout of a web server
+func (w *WebServerAction) vhostLayout(webServer string) (*vhostLayout, *Result) {
+	platform := w.Platform()
+	switch webServer {
+	case WebServerApache:
+		return &vhostLayout{
+			webServer:   WebServerApache,
+			title:       "Apache",
+			service:     platform.ApacheService,
+			available:   platform.ApacheSitesAvailable,
+			enabled:     platform.ApacheSitesEnabled,
+			logDir:      platform.ApacheLogDir,
+			test:        []string{"apachectl", "configtest"},
+			namePattern: apacheServerNamePattern,
+			rootPattern: apacheDocumentRootPattern,
+		}, nil
+	case WebServerNginx:
+		return &vhostLayout{
+			webServer:   WebServerNginx,
+			title:       "Nginx",
+			service:     "nginx",
+			available:   platform.NginxSitesAvailable,
+			enabled:     platform.NginxSitesEnabled,
+			logDir:      platform.NginxLogDir,
+			test:        []string{"nginx", "-t"},
+			namePattern: nginxServerNamePattern,
+			rootPattern: nginxRootPattern,
+		}, nil
+	}
+	return nil, &Result{
+		Success: false,
+		Message: fmt.Sprintf("Unknown web server %q", webServer),
+		Error:   newError(ErrValidationFailed, "web server must be %s or %s", WebServerApache, WebServerNginx),
+	}
+}
+
+// fileName returns the name of a domain's vhost file. Debian's Nginx
+// sites-available files have no extension.
+func (l *vhostLayout) fileName(domain string) string {
+	if l.webServer == WebServerNginx && l.enabled != "" {
+		return domain
+	}
+	return domain + ".conf"
+}
+
+// configPath returns a domain's vhost file while enabled
+func (l *vhostLayout) configPath(domain string) string {
+	return filepath.Join(l.available, l.fileName(domain))
+}
+
+// enabledPath returns a domain's sites-enabled entry, or an empty string
+// when the layout has none
+func (l *vhostLayout) enabledPath(domain string) string {
+	if l.enabled == "" {
+		return ""
+	}
+	return filepath.Join(l.enabled, l.fileName(domain))
+}
+
+// domainOf returns the domain a vhost file belongs to and whether it is
+// disabled by name, or an empty domain for files that are not vhosts
+func (l *vhostLayout) domainOf(name string) (domain string, disabled bool) {
+	if l.enabled == "" {
+		if disabled = strings.HasSuffix(name, disabledSuffix); disabled {
+			name = strings.TrimSuffix(name, disabledSuffix)
+		}
+		if !strings.HasSuffix(name, ".conf") {
+			return "", false
+		}
+	}
+	return strings.TrimSuffix(name, ".conf"), disabled
+}
+
+// validateDomain rejects names that would escape the vhost directories
+func validateDomain(domain string) *Result {
+	if domain == "" || strings.ContainsAny(domain, "/\\ \t\n") || strings.HasPrefix(domain, ".") {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("Invalid domain %q", domain),
+			Error:   newError(ErrValidationFailed, "invalid domain %q", domain),
+		}
+	}
+	return nil
+}
+
+// ListVhosts lists the virtual hosts of a web server, enabled or not
+func (w *WebServerAction) ListVhosts(webServer string) *Result {
+	layout, failure := w.vhostLayout(webServer)
+	if failure != nil {
+		return failure
+	}
+	vhosts, err := w.vhosts(layout)
+	if err != nil {
+		return &Result{
+			Success: false,
+			Message: "Failed to read the state store",
+			Error:   err,
+		}
+	}
+	return &Result{
+		Success: true,
+		Message: fmt.Sprintf("Found %d %s virtual hosts", len(vhosts), webServer),
+		Data:    vhosts,
+	}
+}
+
+// vhosts reads the vhost files of a layout
+func (w *WebServerAction) vhosts(layout *vhostLayout) ([]*Vhost, error) {
+	managed := make(map[string]*state.Domain)
+	if store := w.Store(); store != nil {
+		// Hybrid domains are recorded with their Nginx side
+		domains, err := store.Domains().Find(func(domain *state.Domain) bool {
+			return domain.WebServer == layout.webServer || (domain.Hybrid && layout.webServer == WebServerApache)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, domain := range domains {
+			managed[domain.Name] = domain
+		}
+	}
+
+	fsys := w.FileSystem()
+	vhosts := []*Vhost{}
+	for _, path := range configFiles(fsys, layout.available) {
+		domain, disabled := layout.domainOf(filepath.Base(path))
+		if domain == "" {
+			continue
+		}
+		content, err := fsys.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		serverName := firstMatch(layout.namePattern, string(content))
+		if serverName == "" {
+			continue
+		}
+
+		enabled := !disabled
+		if enabledPath := layout.enabledPath(domain); enabledPath != "" {
+			_, err := fsys.Stat(enabledPath)
+			enabled = err == nil
+		}
+		vhost := &Vhost{
+			Domain:       domain,
+			ServerName:   serverName,
+			WebServer:    layout.webServer,
+			DocumentRoot: firstMatch(layout.rootPattern, string(content)),
+			ConfigPath:   path,
+			Enabled:      enabled,
+		}
+		if record := managed[domain]; record != nil {
+			vhost.Managed = true
+			vhost.Template = record.Template
+			if vhost.Template == "" {
+				vhost.Template = DefaultVhostTemplate
+			}
+			vhost.Vars = record.Vars
+			vhost.Proxy = record.Proxy
+			vhost.Hybrid = record.Hybrid
+			if record.WebServer == layout.webServer {
+				vhost.TLS = record.TLS
+			}
+		}
+		vhosts = append(vhosts, vhost)
+	}
+
+	sort.Slice(vhosts, func(i, j int) bool {
+		return vhosts[i].Domain < vhosts[j].Domain
+	})
+	return vhosts, nil
+}
+
+// findVhost returns a domain's vhost
+func (w *WebServerAction) findVhost(layout *vhostLayout, domain string) (*Vhost, *Result) {
+	if failure := validateDomain(domain); failure != nil {
+		return nil, failure
+	}
+	vhosts, err := w.vhosts(layout)
+	if err != nil {
+		return nil, &Result{
+			Success: false,
+			Message: "Failed to read the state store",
+			Error:   err,
+		}
+	}
+	for _, vhost := range vhosts {
+		if vhost.Domain == domain {
+			return vhost, nil
+		}
+	}
+	return nil, &Result{
+		Success: false,
+		Message: fmt.Sprintf("No %s virtual host for %s", layout.webServer, domain),
+		Error:   newError(ErrNotFound, "no %s virtual host for %s", layout.webServer, domain),
+	}
+}
+
+// ShowVhost returns a virtual host with its configuration
+func (w *WebServerAction) ShowVhost(webServer, domain string) *Result {
+	layout, failure := w.vhostLayout(webServer)
+	if failure != nil {
+		return failure
+	}
+	vhost, failure := w.findVhost(layout, domain)
+	if failure != nil {
+		return failure
+	}
+
+	content, err := w.FileSystem().ReadFile(vhost.ConfigPath)
+	if err != nil {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("Failed to read %s", vhost.ConfigPath),
+			Error:   err,
+		}
+	}
+	vhost.Config = string(content)
+	return &Result{
+		Success: true,
+		Message: fmt.Sprintf("%s virtual host %s", webServer, domain),
+		Data:    vhost,
+	}
+}
+
+// VhostOptions selects the template a virtual host is rendered from
+type VhostOptions struct {
+	Template string            // empty keeps the recorded template, or uses the default
+	Vars     map[string]string // merged over the recorded variables when Template is empty
+	Proxy    *state.Proxy      // settings of proxy templates; nil keeps the recorded ones
+	Hybrid   bool              // Nginx in front of Apache rendering Template; kept when Template is empty
+	TLS      *state.TLS        // HTTPS settings, served with the domain's certificate; nil keeps the recorded ones
+	NoTLS    bool              // plain HTTP only, dropping the recorded HTTPS settings
+}
+
+// ProxyVhostTemplate renders virtual hosts created with proxy settings but
+// without a template
+const ProxyVhostTemplate = "proxy"
+
+// ConfigureVhost creates and enables a virtual host rendered from a
+// template, or re-renders an existing one. The hook and event are named
+// ConfigureApacheVhost or ConfigureNginxVhost, or ConfigureHybridVhost
+// for hybrid Nginx vhosts.
+func (w *WebServerAction) ConfigureVhost(webServer, domain, docroot string, options *VhostOptions) (res *Result) {
+	layout, failure := w.vhostLayout(webServer)
+	if failure != nil {
+		return failure
+	}
+	given := options
+	options = w.vhostOptions(webServer, domain, given)
+	if options.Hybrid {
+		if webServer != WebServerNginx {
+			return &Result{
+				Success: false,
+				Message: "Hybrid vhosts are Nginx vhosts in front of Apache",
+				Error:   newError(ErrValidationFailed, "hybrid vhosts are configured on %s", WebServerNginx),
+			}
+		}
+		return w.configureHybridVhost(domain, docroot, options)
+	}
+	if w.hybridDomain(domain) {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("%s is a hybrid vhost: configure it as one, or delete it first", domain),
+			Error:   newError(ErrValidationFailed, "%s is a hybrid vhost", domain),
+		}
+	}
+	hook := w.Hook("Configure"+layout.title+"Vhost", map[string]string{"domain": domain, "docroot": docroot, "template": options.Template})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+
+	if failure := validateVhostPaths(domain, docroot); failure != nil {
+		return failure
+	}
+	t, failure := w.vhostTemplate(webServer, options.Template)
+	if failure != nil {
+		return failure
+	}
+	if t.Hybrid {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("Template %s renders the Nginx side of hybrid vhosts", t.Name),
+			Error:   newError(ErrValidationFailed, "template %s is only used for hybrid vhosts", t.Name),
+		}
+	}
+	if !t.Proxy && (given == nil || given.Proxy == nil) {
+		// Recorded proxy settings go with a template that does not use them
+		options.Proxy = nil
+	}
+	content, failure := w.renderVhost(layout, t, domain, docroot, options)
+	if failure != nil {
+		return failure
+	}
+
+	tx := w.Begin(fmt.Sprintf("%s vhost %s", layout.title, domain))
+	if options.TLS != nil && layout.webServer == WebServerApache {
+		if result := w.apacheTLSSteps(tx, options.TLS); !result.Success {
+			return result
+		}
+	}
+	if result := w.writeVhostSteps(tx, layout, domain, content); !result.Success {
+		return result
+	}
+	if result := tx.Validate(layout.test[0], layout.test[1:]...); !result.Success {
+		return result
+	}
+	result := tx.Commit(tx.Do("reload "+layout.service, func() *Result {
+		return w.ReloadService(layout.service)
+	}, nil))
+	if result.Success {
+		w.recordDomain(domain, docroot, webServer, layout.configPath(domain), options)
+	}
+	return result
+}
+
+// validateVhostPaths checks the domain and document root of a vhost
+func validateVhostPaths(domain, docroot string) *Result {
+	if failure := validateDomain(domain); failure != nil {
+		return failure
+	}
+	if !filepath.IsAbs(docroot) || strings.ContainsAny(docroot, unsafeValueChars+" \t") {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("Document root %q is not an absolute path without spaces or special characters", docroot),
+			Error:   newError(ErrValidationFailed, "invalid document root %q", docroot),
+		}
+	}
+	return nil
+}
+
+// writeVhostSteps writes a domain's vhost file and enables it: a disabled
+// one is renamed back in layouts without sites-enabled, whose web servers
+// include every vhost file directly
+func (w *WebServerAction) writeVhostSteps(tx *Transaction, layout *vhostLayout, domain, content string) *Result {
+	configPath := layout.configPath(domain)
+	if result := tx.WriteFile(configPath, content); !result.Success {
+		return result
+	}
+
+	switch {
+	case layout.enabled == "":
+		if w.FileExists(configPath + disabledSuffix) {
+			return tx.RemoveFile(configPath + disabledSuffix)
+		}
+		return &Result{Success: true}
+	case layout.webServer == WebServerApache:
+		var undo []string
+		if !w.FileExists(layout.enabledPath(domain)) {
+			undo = []string{"a2dissite", domain}
+		}
+		return tx.Run(undo, "a2ensite", domain)
+	}
+	return tx.Symlink(configPath, layout.enabledPath(domain))
+}
+
+// apacheModuleStep enables an Apache module. Debian's a2enmod links it into
+// mods-enabled, SUSE's adds it to the module list in sysconfig; elsewhere
+// modules are loaded once their package is installed.
+func (w *WebServerAction) apacheModuleStep(tx *Transaction, module string) *Result {
+	platform := w.Platform()
+	switch platform.Family {
+	case FamilyDebian, FamilyUnknown:
+		if !w.FileExists(filepath.Join(platform.ApacheConfDir, "mods-enabled", module+".load")) {
+			return tx.Run([]string{"a2dismod", module}, "a2enmod", module)
+		}
+	case FamilySUSE:
+		return tx.Run(nil, "a2enmod", module)
+	}
+	return &Result{Success: true}
+}
+
+// apacheConfStep enables a snippet in ApacheConfSnippets, which only
+// Debian's conf-available needs a2enconf for
+func (w *WebServerAction) apacheConfStep(tx *Transaction, name string) *Result {
+	platform := w.Platform()
+	if platform.Family != FamilyDebian && platform.Family != FamilyUnknown {
+		return &Result{Success: true}
+	}
+	if !w.FileExists(filepath.Join(platform.ApacheConfDir, "conf-enabled", name+".conf")) {
+		return tx.Run([]string{"a2disconf", name}, "a2enconf", name)
+	}
+	return &Result{Success: true}
+}
+
+// vhostOptions completes the options of a domain. Without a template, the
+// recorded template, variables, proxy settings and hybrid mode are kept,
+// given variables replacing recorded ones and given proxy settings the
+// recorded settings. A new domain gets the proxy template when given proxy
+// settings and the default template otherwise, as does a domain given
+// proxy settings, or hybrid mode, that was rendered without them. HTTPS
+// settings are kept whatever the template, unless replaced or dropped.
+func (w *WebServerAction) vhostOptions(webServer, domain string, given *VhostOptions) *VhostOptions {
+	if given == nil {
+		given = &VhostOptions{}
+	}
+	completed := &VhostOptions{
+		Template: given.Template,
+		Vars:     make(map[string]string),
+		Proxy:    given.Proxy,
+		Hybrid:   given.Hybrid,
+		TLS:      given.TLS,
+	}
+	var record *state.Domain
+	if store := w.Store(); store != nil {
+		if found, err := store.Domains().Get((&state.Domain{Name: domain, WebServer: webServer}).Key()); err == nil {
+			record = found
+		}
+	}
+	// Proxy settings given to a domain rendered without them switch it to
+	// the proxy template, and hybrid to the default template
+	if completed.Template == "" && record != nil && (given.Proxy == nil || record.Proxy != nil) && (!given.Hybrid || record.Hybrid) {
+		completed.Template = record.Template
+		completed.Hybrid = record.Hybrid
+		for name, value := range record.Vars {
+			completed.Vars[name] = value
+		}
+		if completed.Proxy == nil {
+			completed.Proxy = record.Proxy
+		}
+	}
+	if completed.TLS == nil && record != nil {
+		completed.TLS = record.TLS
+	}
+	if given.NoTLS {
+		completed.TLS = nil
+	}
+	if completed.Template == "" {
+		completed.Template = DefaultVhostTemplate
+		if completed.Proxy != nil {
+			completed.Template = ProxyVhostTemplate
+		}
+	}
+	for name, value := range given.Vars {
+		completed.Vars[name] = value
+	}
+	return completed
+}
+
+// EnableVhost enables a disabled virtual host and reloads the web server
+func (w *WebServerAction) EnableVhost(webServer, domain string) (res *Result) {
+	hook := w.Hook("EnableVhost", map[string]string{"web_server": webServer, "domain": domain})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+
+	return w.switchVhost(webServer, domain, true)
+}
+
+// DisableVhost disables a virtual host, keeping its configuration, and
+// reloads the web server
+func (w *WebServerAction) DisableVhost(webServer, domain string) (res *Result) {
+	hook := w.Hook("DisableVhost", map[string]string{"web_server": webServer, "domain": domain})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+
+	return w.switchVhost(webServer, domain, false)
+}
+
+// switchVhost enables or disables a virtual host
+func (w *WebServerAction) switchVhost(webServer, domain string, enable bool) *Result {
+	layout, failure := w.vhostLayout(webServer)
+	if failure != nil {
+		return failure
+	}
+	vhost, failure := w.findVhost(layout, domain)
+	if failure != nil {
+		return failure
+	}
+	if failure := rejectHybridBackend(layout, vhost); failure != nil {
+		return failure
+	}
+	status := "disabled"
+	if enable {
+		status = "enabled"
+	}
+	if vhost.Enabled == enable {
+		return &Result{
+			Success: true,
+			Message: fmt.Sprintf("%s is already %s", domain, status),
+			Data:    vhost,
+		}
+	}
+
+	tx := w.Begin(fmt.Sprintf("%s vhost %s", webServer, domain))
+	var result *Result
+	if enable {
+		result = w.enableStep(tx, layout, vhost)
+	} else {
+		result = w.disableStep(tx, layout, vhost)
+	}
+	if !result.Success {
+		return result
+	}
+	if result := tx.Validate(layout.test[0], layout.test[1:]...); !result.Success {
+		return result
+	}
+	result = tx.Commit(tx.Do("reload "+layout.service, func() *Result {
+		return w.ReloadService(layout.service)
+	}, nil))
+	if !result.Success {
+		return result
+	}
+
+	configPath := layout.configPath(domain)
+	if !enable && layout.enabled == "" {
+		configPath += disabledSuffix
+	}
+	w.updateDomain(webServer, domain, func(record *state.Domain) {
+		record.Enabled = enable
+		record.ConfigPath = configPath
+	})
+	return &Result{
+		Success: true,
+		Message: fmt.Sprintf("%s virtual host %s %s", webServer, domain, status),
+	}
+}
+
+// enableStep enables a vhost: a2ensite for Apache, a sites-enabled link
+// for Nginx, or removing the disabled suffix without sites-enabled
+func (w *WebServerAction) enableStep(tx *Transaction, layout *vhostLayout, vhost *Vhost) *Result {
+	switch {
+	case layout.enabled == "":
+		return w.renameStep(tx, vhost.ConfigPath, layout.configPath(vhost.Domain))
+	case layout.webServer == WebServerApache:
+		return tx.Run([]string{"a2dissite", vhost.Domain}, "a2ensite", vhost.Domain)
+	}
+	return tx.Symlink(vhost.ConfigPath, layout.enabledPath(vhost.Domain))
+}
+
+// disableStep undoes enableStep
+func (w *WebServerAction) disableStep(tx *Transaction, layout *vhostLayout, vhost *Vhost) *Result {
+	switch {
+	case layout.enabled == "":
+		return w.renameStep(tx, vhost.ConfigPath, vhost.ConfigPath+disabledSuffix)
+	case layout.webServer == WebServerApache:
+		return tx.Run([]string{"a2ensite", vhost.Domain}, "a2dissite", vhost.Domain)
+	}
+	return tx.Unlink(layout.enabledPath(vhost.Domain))
+}
+
+// renameStep moves a vhost file by writing the new one and removing the
+// old, so both stay tracked for drift
+func (w *WebServerAction) renameStep(tx *Transaction, from, to string) *Result {
+	content, err := w.FileSystem().ReadFile(from)
+	if err != nil {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("Failed to read %s", from),
+			Error:   err,
+		}
+	}
+	if result := tx.WriteFile(to, string(content)); !result.Success {
+		return result
+	}
+	return tx.RemoveFile(from)
+}
+
+// DeleteVhost removes a virtual host and reloads the web server. With
+// archive, its document root and logs are first packed into
+// <backup.dir>/vhosts and then removed; otherwise they are left alone.
+func (w *WebServerAction) DeleteVhost(webServer, domain string, archive bool) (res *Result) {
+	hook := w.Hook("DeleteVhost", map[string]string{"web_server": webServer, "domain": domain, "archive": strconv.FormatBool(archive)})
+	if failed := hook.Pre(); failed != nil {
+		return failed
+	}
+	defer hook.Post(&res)
+
+	layout, failure := w.vhostLayout(webServer)
+	if failure != nil {
+		return failure
+	}
+	vhost, failure := w.findVhost(layout, domain)
+	if failure != nil {
+		return failure
+	}
+	if failure := rejectHybridBackend(layout, vhost); failure != nil {
+		return failure
+	}
+
+	// A hybrid vhost is deleted with its Apache side
+	sides := []vhostSide{{layout, vhost}}
+	if vhost.Hybrid {
+		apache, _ := w.vhostLayout(WebServerApache)
+		if backend, failure := w.findVhost(apache, domain); failure == nil {
+			sides = append(sides, vhostSide{apache, backend})
+		}
+	}
+
+	var archived []string
+	var archivePath string
+	if archive {
+		for _, side := range sides {
+			files, failure := w.vhostFiles(side.layout, side.vhost, sides)
+			if failure != nil {
+				return failure
+			}
+			for _, path := range files {
+				if !slices.Contains(archived, path) {
+					archived = append(archived, path)
+				}
+			}
+		}
+		var result *Result
+		if archivePath, result = w.archiveVhost(domain, archived); !result.Success {
+			return result
+		}
+	}
+
+	// Without sites-enabled, removing the file is what disables the vhost
+	tx := w.Begin(fmt.Sprintf("deletion of %s vhost %s", webServer, domain))
+	for _, side := range sides {
+		if side.vhost.Enabled && side.layout.enabled != "" {
+			if result := w.disableStep(tx, side.layout, side.vhost); !result.Success {
+				return result
+			}
+		}
+		if result := tx.RemoveFile(side.vhost.ConfigPath); !result.Success {
+			return result
+		}
+	}
+	for _, side := range sides {
+		if result := tx.Validate(side.layout.test[0], side.layout.test[1:]...); !result.Success {
+			return result
+		}
+	}
+	var result *Result
+	for _, side := range sides {
+		service := side.layout.service
+		if result = tx.Do("reload "+service, func() *Result {
+			return w.ReloadService(service)
+		}, nil); !result.Success {
+			return result
+		}
+	}
+	tx.Commit(result)
+	w.forgetDomain(webServer, domain)
+
+	message := fmt.Sprintf("Deleted %s virtual host %s", webServer, domain)
+	if archive {
+		var failed []string
+		for _, path := range archived {
+			if result := w.RemoveAll(path); !result.Success {
+				failed = append(failed, path)
+			}
+		}
+		message += fmt.Sprintf(", archived its files to %s", archivePath)
+		if len(failed) > 0 {
+			return &Result{
+				Success: false,
+				Message: message + " but could not remove " + strings.Join(failed, ", "),
+				Error:   newError(ErrCommandFailed, "failed to remove %s", strings.Join(failed, ", ")),
+			}
+		}
+	}
+	return &Result{
+		Success: true,
+		Message: message,
+		Data:    map[string]string{"archive": archivePath},
+	}
+}
+
+// vhostSide is a vhost with the layout of its web server
+type vhostSide struct {
+	layout *vhostLayout
+	vhost  *Vhost
+}
+
+// vhostFiles returns the document root and log files of a vhost that exist,
+// to be removed along with the deleted vhosts. The document root must be
+// one only this domain uses, below vhosts.web_root.
+func (w *WebServerAction) vhostFiles(layout *vhostLayout, vhost *Vhost, deleted []vhostSide) ([]string, *Result) {
+	fsys := w.FileSystem()
+	var files []string
+	if vhost.DocumentRoot != "" && w.DirectoryExists(vhost.DocumentRoot) {
+		root := filepath.Clean(vhost.DocumentRoot)
+		if webRoot := config.Current().Vhosts.WebRoot; root == filepath.Clean(webRoot) || !within(root, webRoot) {
+			return nil, &Result{
+				Success: false,
+				Message: fmt.Sprintf("Not archiving %s: its document root %s is not below vhosts.web_root %s", vhost.Domain, root, webRoot),
+				Error:   newError(ErrValidationFailed, "document root %s is outside %s", root, webRoot),
+			}
+		}
+		if failure := w.checkSharedRoot(root, deleted); failure != nil {
+			return nil, failure
+		}
+		files = append(files, root)
+	}
+	entries, _ := fsys.ReadDir(layout.logDir)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), vhost.Domain+"_") {
+			files = append(files, filepath.Join(layout.logDir, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// checkSharedRoot refuses removing a document root that another domain
+// serves, or serves a directory above or below. The vhost files of both
+// web servers, managed or not, are checked along with the recorded
+// domains; when neither can be read it refuses as well.
+func (w *WebServerAction) checkSharedRoot(root string, deleted []vhostSide) *Result {
+	var others []*Vhost
+	read := false
+	for _, webServer := range []string{WebServerApache, WebServerNginx} {
+		layout, _ := w.vhostLayout(webServer)
+		if _, err := w.FileSystem().ReadDir(layout.available); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if vhosts, err := w.vhosts(layout); err == nil {
+			others = append(others, vhosts...)
+			read = true
+		}
+	}
+	if store := w.Store(); store != nil {
+		if domains, err := store.Domains().List(); err == nil {
+			for _, domain := range domains {
+				others = append(others, &Vhost{Domain: domain.Name, WebServer: domain.WebServer, DocumentRoot: domain.DocumentRoot})
+			}
+			read = true
+		}
+	}
+	if !read {
+		return &Result{
+			Success: false,
+			Message: fmt.Sprintf("Not archiving: could not read the vhost files or the recorded domains to check that no other domain uses %s", root),
+			Error:   newError(ErrConflict, "cannot tell whether document root %s is shared", root),
+		}
+	}
+
+	for _, other := range others {
+		if other.DocumentRoot == "" || slices.ContainsFunc(deleted, func(side vhostSide) bool {
+			return side.layout.webServer == other.WebServer && side.vhost.Domain == other.Domain
+		}) {
+			continue
+		}
+		otherRoot := filepath.Clean(other.DocumentRoot)
+		if within(root, otherRoot) || within(otherRoot, root) {
+			return &Result{
+				Success: false,
+				Message: fmt.Sprintf("Not archiving: document root %s overlaps %s of %s vhost %s", root, otherRoot, other.WebServer, other.Domain),
+				Error:   newError(ErrConflict, "document root %s is shared with %s", root, other.Domain),
+			}
+		}
+	}
+	return nil
+}
+
+// within reports whether path is dir or below it
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// archiveVhost packs a vhost's files into a tarball in <backup.dir>/vhosts
+func (w *WebServerAction) archiveVhost(domain string, files []string) (string, *Result) {
+	if len(files) == 0 {
+		return "", &Result{Success: true}
+	}
+	dir := filepath.Join(config.Current().Backup.Dir, "vhosts")
+	archivePath := filepath.Join(dir, fmt.Sprintf("%s-%s.tar.gz", domain, time.Now().Format("20060102-150405")))
+
+	if result := w.RunCommand("mkdir", "-p", dir); !result.Success {
+		return "", result
+	}
+	// Archive paths relative to the managed system's root
+	args := []string{"-czf", archivePath, "-C", w.localPath("/")}
+	for _, file := range files {
+		args = append(args, strings.TrimPrefix(file, "/"))
+	}
+	if result := w.RunCommand("tar", args...); !result.Success {
+		return "", &Result{
+			Success: false,
+			Message: fmt.Sprintf("Failed to archive %s, nothing was deleted: %s", domain, strings.TrimSpace(result.Message)),
+			Error:   result.Error,
+		}
+	}
+	return archivePath, &Result{Success: true}
+}
+
+// updateDomain changes the recorded domain, if it is recorded
+func (w *WebServerAction) updateDomain(webServer, name string, change func(record *state.Domain)) {
+	w.record(func(store *state.Store) error {
+		record, err := store.Domains().Get((&state.Domain{Name: name, WebServer: webServer}).Key())
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		change(record)
+		return store.Domains().Put(record)
+	})
+}
+
+// forgetDomain removes a deleted domain from the state store
+func (w *WebServerAction) forgetDomain(webServer, name string) {
+	w.record(func(store *state.Store) error {
+		return store.Domains().Delete((&state.Domain{Name: name, WebServer: webServer}).Key())
+	})
+}
@@ -0,0 +1,79 @@
+package actions
+
+import (
+	"easygo/pkg/config"
+	"easygo/pkg/state"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDeleteVhostArchive(t *testing.T) {
+	tests := []struct {
+		name      string
+		docroot   string
+		other     string // document root of another domain
+		unmanaged string // web server of the other domain's vhost written by hand, unrecorded
+		noStore   bool
+		code      string // error code of the refusal, empty when it is archived
+	}{
+		{name: "own document root", docroot: "/var/www/a.example.com", other: "/var/www/b.example.com"},
+		{name: "shared document root", docroot: "/var/www/shop", other: "/var/www/shop", code: "conflict"},
+		{name: "inside another document root", docroot: "/var/www/shop/blog", other: "/var/www/shop", code: "conflict"},
+		{name: "around another document root", docroot: "/var/www/shop", other: "/var/www/shop/blog", code: "conflict"},
+		{name: "outside the web root", docroot: "/srv/a.example.com", other: "/var/www/b.example.com", code: "validation_failed"},
+		{name: "the web root itself", docroot: "/var/www", other: "/srv/b.example.com", code: "validation_failed"},
+		{name: "shared with an unmanaged nginx vhost", docroot: "/var/www/shop", other: "/var/www/shop", unmanaged: WebServerNginx, code: "conflict"},
+		{name: "shared with an unmanaged apache vhost", docroot: "/var/www/shop", other: "/var/www/shop", unmanaged: WebServerApache, code: "conflict"},
+		{name: "shared without a state store", docroot: "/var/www/shop", other: "/var/www/shop", unmanaged: WebServerNginx, noStore: true, code: "conflict"},
+		{name: "own document root without a state store", docroot: "/var/www/a.example.com", other: "/var/www/b.example.com", unmanaged: WebServerApache, noStore: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWebServerAction()
+			runner := fakeSystem(t, &w.BaseAction)
+			store, err := state.Open(filepath.Join(t.TempDir(), "state.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.SetStore(store)
+
+			for domain, docroot := range map[string]string{"a.example.com": tt.docroot, "b.example.com": tt.other} {
+				runner.Expect("nginx", "-t")
+				runner.Expect("systemctl", "reload", "nginx")
+				if result := w.ConfigureVhost(WebServerNginx, domain, docroot, &VhostOptions{Template: "static"}); !result.Success {
+					t.Fatalf("configure %s: %v", domain, result.Error)
+				}
+				if result := w.CreateDirectory(docroot); !result.Success {
+					t.Fatalf("create %s: %v", docroot, result.Error)
+				}
+			}
+
+			configured := len(runner.Calls())
+			runner.Expect("mkdir", "-p", filepath.Join(config.Current().Backup.Dir, "vhosts"))
+
+			// The archive's name holds the time, so tar is left unexpected
+			// and fails, which stops the deletion once the checks passed
+			result := w.DeleteVhost(WebServerNginx, "a.example.com", true)
+			calls := runner.Calls()[configured:]
+			if tt.code == "" {
+				if len(calls) != 2 || calls[1].Name != "tar" || !slices.Contains(calls[1].Args, tt.docroot[1:]) {
+					t.Errorf("commands = %v, want the document root archived", calls)
+				}
+			} else {
+				if code := ErrorCode(result.Error); result.Success || code != tt.code {
+					t.Errorf("code = %q, want %q (%s)", code, tt.code, result.Message)
+				}
+				if len(calls) != 0 {
+					t.Errorf("commands = %v, want none", calls)
+				}
+			}
+			for _, docroot := range []string{tt.docroot, tt.other} {
+				if !w.DirectoryExists(docroot) {
+					t.Errorf("%s was removed", docroot)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,410 @@
+package actions
+
+import (
+	"bytes"
+	"easygo/pkg/config"
+	"easygo/pkg/state"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// vhostPresets are the built-in templates, in <web server>/<name>.tmpl,
+// and the partials every template of a web server can use, in
+// partials/<web server>.tmpl
+//
+//go:embed vhosttemplates
+var vhostPresets embed.FS
+
+// DefaultVhostTemplate renders virtual hosts created without a template
+const DefaultVhostTemplate = "php"
+
+// builtinTemplate is the source of the built-in templates
+const builtinTemplate = "built-in"
+
+// templateExt is the extension of template files
+const templateExt = ".tmpl"
+
+var (
+	templateNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	variableNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+)
+
+// unsafeValueChars could end a directive or block, or open a new one, in
+// either web server's configuration
+const unsafeValueChars = "\n\r;{}<>\"'`\\#"
+
+// VhostTemplate renders a web server's virtual host configuration. Files
+// in <paths.templates>/<web server>/<name>.tmpl add templates or replace
+// the built-in presets of the same name: a YAML front matter between ---
+// lines with a description and the variables the template takes, followed
+// by text/template source executed with VhostData.
+type VhostTemplate struct {
+	Name        string             `json:"name"`
+	WebServer   string             `json:"web_server"`
+	Description string             `json:"description" yaml:"description"`
+	Variables   []TemplateVariable `json:"variables" yaml:"variables"`
+	Proxy       bool               `json:"proxy,omitempty" yaml:"proxy"`   // renders .Proxy, so needs proxy settings
+	Hybrid      bool               `json:"hybrid,omitempty" yaml:"hybrid"` // the Nginx side of hybrid vhosts
+	Source      string             `json:"source"`                         // built-in, or the file's path
+
+	tmpl *template.Template
+}
+
+// TemplateVariable is a value a template takes, set per domain
+type TemplateVariable struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+	Default     string `json:"default,omitempty" yaml:"default"`
+	Required    bool   `json:"required,omitempty" yaml:"required"`
+	Pattern     string `json:"pattern,omitempty" yaml:"pattern"` // regular expression values must match
+
+	pattern *regexp.Regexp
+}
+
+// VhostData is what vhost templates are executed with
+type VhostData struct {
+	Domain       string
+	Aliases      []string // www.<domain>
+	DocumentRoot string
+	Listen       string // 80 for Nginx, *:80 for Apache or vhosts.hybrid_backend behind Nginx; 443 for HTTPS
+	LogDir       string
+	PHPInclude   string            // fastcgi directives of Nginx PHP locations
+	PHPSocket    string            // PHP-FPM socket of the php_version variable, or of php.default_version
+	Vars         map[string]string // every variable the template declares
+	Proxy        *state.Proxy      // proxy settings, for templates declaring proxy: true
+	Upstream     string            // name for the domain's upstream block, cache zone and variables
+	Backend      string            // vhosts.hybrid_backend, where hybrid vhosts' Apache side listens
+	TLS          *VhostTLS         // HTTPS configuration, rendered by the "tls" partial; nil for plain HTTP
+}
+
+// VhostTLS is the HTTPS configuration of a vhost, its settings in the web
+// server's syntax
+type VhostTLS struct {
+	Certificate  string // certificate chain
+	Key          string // private key
+	Protocols    string
+	Ciphers      string // TLS 1.2 cipher suites; empty for TLS 1.3 only
+	HTTP2        bool
+	HSTS         bool
+	OCSPStapling bool
+	Redirect     bool // plain HTTP is redirected to HTTPS by the "redirect" partial
+}
+
+// parseVhostTemplate reads a template file
+func parseVhostTemplate(webServer, name, source string, content []byte) (*VhostTemplate, error) {
+	header, body, err := splitFrontMatter(string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	t := &VhostTemplate{Name: name, WebServer: webServer, Source: source}
+	if err := yaml.Unmarshal([]byte(header), t); err != nil {
+		return nil, fmt.Errorf("front matter: %w", err)
+	}
+	seen := make(map[string]bool)
+	for i := range t.Variables {
+		variable := &t.Variables[i]
+		if !variableNamePattern.MatchString(variable.Name) {
+			return nil, fmt.Errorf("variables[%d]: %q is not a variable name", i, variable.Name)
+		}
+		if seen[variable.Name] {
+			return nil, fmt.Errorf("variables[%d]: %s is declared twice", i, variable.Name)
+		}
+		seen[variable.Name] = true
+		if variable.Pattern != "" {
+			if variable.pattern, err = regexp.Compile(variable.Pattern); err != nil {
+				return nil, fmt.Errorf("variables[%d].pattern: %w", i, err)
+			}
+		}
+	}
+
+	// The partials are parsed first, so templates may redefine them
+	partials, err := vhostPresets.ReadFile("vhosttemplates/partials/" + webServer + templateExt)
+	if err != nil {
+		return nil, err
+	}
+	t.tmpl, err = template.New(name).Option("missingkey=error").Parse(string(partials))
+	if err != nil {
+		return nil, fmt.Errorf("partials: %w", err)
+	}
+	if _, err := t.tmpl.Parse(body); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// splitFrontMatter separates the YAML front matter between leading ---
+// lines from the template source. The front matter is optional.
+func splitFrontMatter(content string) (header, body string, err error) {
+	if !strings.HasPrefix(content, "---\n") {
+		return "", content, nil
+	}
+	rest := content[len("---\n"):]
+	if strings.HasPrefix(rest, "---\n") {
+		return "", rest[len("---\n"):], nil
+	}
+	end := strings.Index(rest, "\n---\n")
+	if end < 0 {
+		return "", "", errors.New("front matter has no closing ---")
+	}
+	return rest[:end], rest[end+len("\n---\n"):], nil
+}
+
+// vhostTemplates returns a web server's templates by name: the built-in
+// presets, replaced or added to by the files in paths.templates
+func (w *WebServerAction) vhostTemplates(webServer string) (map[string]*VhostTemplate, error) {
+	templates := make(map[string]*VhostTemplate)
+
+	presets, err := fs.ReadDir(vhostPresets, "vhosttemplates/"+webServer)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range presets {
+		name := strings.TrimSuffix(entry.Name(), templateExt)
+		content, err := vhostPresets.ReadFile("vhosttemplates/" + webServer + "/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		t, err := parseVhostTemplate(webServer, name, builtinTemplate, content)
+		if err != nil {
+			return nil, fmt.Errorf("built-in template %s: %w", name, err)
+		}
+		templates[name] = t
+	}
+
+	// Templates are EasyGo's own files, read from the local file system
+	dir := filepath.Join(config.Current().Paths.Templates, webServer)
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), templateExt)
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), templateExt) || !templateNamePattern.MatchString(name) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		t, err := parseVhostTemplate(webServer, name, path, content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		templates[name] = t
+	}
+	return templates, nil
+}
+
+// ListVhostTemplates lists the templates virtual hosts of a web server can
+// be rendered from
+func (w *WebServerAction) ListVhostTemplates(webServer string) *Result {
+	if _, failure := w.vhostLayout(webServer); failure != nil {
+		return failure
+	}
+	templates, err := w.vhostTemplates(webServer)
+	if err != nil {
+		return &Result{
+			Success: false,
+			Message: "Failed to read the vhost templates",
+			Error:   wrapError(ErrValidationFailed, err, "invalid vhost template"),
+		}
+	}
+
+	list := make([]*VhostTemplate, 0, len(templates))
+	for _, t := range templates {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return &Result{
+		Success: true,
+		Message: fmt.Sprintf("Found %d %s vhost templates", len(list), webServer),
+		Data:    list,
+	}
+}
+
+// vhostTemplate returns a template by name
+func (w *WebServerAction) vhostTemplate(webServer, name string) (*VhostTemplate, *Result) {
+	templates, err := w.vhostTemplates(webServer)
+	if err != nil {
+		return nil, &Result{
+			Success: false,
+			Message: "Failed to read the vhost templates",
+			Error:   wrapError(ErrValidationFailed, err, "invalid vhost template"),
+		}
+	}
+	t, ok := templates[name]
+	if !ok {
+		return nil, &Result{
+			Success: false,
+			Message: fmt.Sprintf("No %s vhost template named %q", webServer, name),
+			Error:   newError(ErrNotFound, "no %s vhost template named %q", webServer, name),
+		}
+	}
+	return t, nil
+}
+
+// resolveVars checks values against the template's variables and returns
+// every declared variable, missing ones set to their default
+func (t *VhostTemplate) resolveVars(values map[string]string) (map[string]string, error) {
+	declared := make(map[string]bool)
+	vars := make(map[string]string)
+	for _, variable := range t.Variables {
+		declared[variable.Name] = true
+		value, ok := values[variable.Name]
+		if !ok || value == "" {
+			if variable.Required {
+				return nil, fmt.Errorf("template %s needs %s: %s", t.Name, variable.Name, variable.Description)
+			}
+			vars[variable.Name] = variable.Default
+			continue
+		}
+		if strings.ContainsAny(value, unsafeValueChars) {
+			return nil, fmt.Errorf("%s: %q may not contain quotes, backslashes, ;, #, {, }, < or >", variable.Name, value)
+		}
+		if variable.pattern != nil && !variable.pattern.MatchString(value) {
+			return nil, fmt.Errorf("%s: %q does not match %s", variable.Name, value, variable.Pattern)
+		}
+		vars[variable.Name] = value
+	}
+	for name := range values {
+		if !declared[name] {
+			return nil, fmt.Errorf("template %s has no variable %s", t.Name, name)
+		}
+	}
+	return vars, nil
+}
+
+// checkProxy checks that proxy settings are given to, and only to,
+// templates that render them
+func (t *VhostTemplate) checkProxy(proxy *state.Proxy) error {
+	switch {
+	case t.Proxy && proxy == nil:
+		return fmt.Errorf("template %s needs proxy settings, at least one backend", t.Name)
+	case !t.Proxy && proxy != nil:
+		return fmt.Errorf("template %s does not take proxy settings", t.Name)
+	case proxy != nil:
+		return validateProxy(proxy)
+	}
+	return nil
+}
+
+// renderVhost executes a template for a domain
+func (w *WebServerAction) renderVhost(layout *vhostLayout, t *VhostTemplate, domain, docroot string, options *VhostOptions) (string, *Result) {
+	vars, err := t.resolveVars(options.Vars)
+	if err == nil {
+		err = t.checkProxy(options.Proxy)
+	}
+	if err != nil {
+		return "", &Result{
+			Success: false,
+			Message: err.Error(),
+			Error:   wrapError(ErrValidationFailed, err, "invalid vhost settings"),
+		}
+	}
+
+	platform := w.Platform()
+	phpVersion := vars["php_version"]
+	if phpVersion == "" {
+		phpVersion = config.Current().PHP.DefaultVersion
+	}
+	listen := "80"
+	if layout.webServer == WebServerApache {
+		listen = "*:80"
+	}
+	backend := ""
+	settings := options.TLS
+	if options.Hybrid {
+		backend = config.Current().Vhosts.HybridBackend
+		if layout.webServer == WebServerApache {
+			// Nginx terminates TLS in front of Apache
+			listen, settings = backend, nil
+		}
+	}
+	var tls *VhostTLS
+	if settings != nil {
+		if tls, err = w.vhostTLS(layout, domain, settings); err != nil {
+			return "", &Result{
+				Success: false,
+				Message: err.Error(),
+				Error:   err,
+			}
+		}
+		switch {
+		case layout.webServer == WebServerApache:
+			listen = "*:443"
+		case tls.HTTP2:
+			listen = "443 ssl http2"
+		default:
+			listen = "443 ssl"
+		}
+	}
+	data := &VhostData{
+		Domain:       domain,
+		Aliases:      []string{"www." + domain},
+		DocumentRoot: docroot,
+		Listen:       listen,
+		LogDir:       layout.logDir,
+		PHPInclude:   platform.NginxPHPInclude,
+		PHPSocket:    platform.PHPFPMSocket(phpVersion, ""),
+		Vars:         vars,
+		Proxy:        options.Proxy,
+		Upstream:     upstreamName(domain),
+		Backend:      backend,
+		TLS:          tls,
+	}
+
+	var out bytes.Buffer
+	if tls != nil {
+		err = t.renderHTTP(&out, layout, data)
+	}
+	if err == nil {
+		err = t.tmpl.Execute(&out, data)
+	}
+	if err == nil && tls != nil && !strings.Contains(out.String(), tls.Certificate) {
+		err = errors.New(`HTTPS needs {{template "tls" .}} in the server block`)
+	}
+	if err != nil {
+		return "", &Result{
+			Success: false,
+			Message: fmt.Sprintf("Failed to render template %s (%s)", t.Name, t.Source),
+			Error:   wrapError(ErrValidationFailed, err, "template %s", t.Name),
+		}
+	}
+	return out.String(), nil
+}
+
+// renderHTTP renders what an HTTPS vhost serves on port 80: the redirect
+// to HTTPS, or for Apache the template once more without TLS. Nginx serves
+// both ports from the one server block instead.
+func (t *VhostTemplate) renderHTTP(out *bytes.Buffer, layout *vhostLayout, data *VhostData) error {
+	switch {
+	case data.TLS.Redirect:
+		if err := t.tmpl.ExecuteTemplate(out, "redirect", data); err != nil {
+			return err
+		}
+	case layout.webServer == WebServerApache:
+		plain := *data
+		plain.Listen, plain.TLS = "*:80", nil
+		if err := t.tmpl.Execute(out, &plain); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	out.WriteString("\n")
+	return nil
+}
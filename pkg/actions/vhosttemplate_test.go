@@ -0,0 +1,80 @@
+package actions
+
+import (
+	"easygo/pkg/state"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNginxTemplatesHSTS(t *testing.T) {
+	w := NewWebServerAction()
+	fakeSystem(t, &w.BaseAction)
+	chain := CertificatePath("example.com")
+	for _, path := range []string{chain, filepath.Join(filepath.Dir(chain), privateKeyName)} {
+		if err := w.FileSystem().WriteFile(path, []byte("PEM\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	templates, err := w.vhostTemplates(WebServerNginx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout, _ := w.vhostLayout(WebServerNginx)
+	const hsts = "add_header Strict-Transport-Security"
+
+	for name, tmpl := range templates {
+		t.Run(name, func(t *testing.T) {
+			options := &VhostOptions{Hybrid: tmpl.Hybrid, TLS: &state.TLS{HSTS: true}}
+			if tmpl.Proxy {
+				options.Proxy = &state.Proxy{Backends: []string{"127.0.0.1:3000"}, Cache: "10m"}
+			}
+			content, failure := w.renderVhost(layout, tmpl, "example.com", "/var/www/example.com", options)
+			if failure != nil {
+				t.Fatalf("render: %s", failure.Message)
+			}
+
+			// Every location adding headers of its own repeats HSTS
+			for _, location := range nginxLocations(content) {
+				if strings.Contains(location, "add_header") && !strings.Contains(location, hsts) {
+					t.Errorf("location without HSTS:\n%s", location)
+				}
+			}
+
+			options.TLS.HSTS = false
+			content, failure = w.renderVhost(layout, tmpl, "example.com", "/var/www/example.com", options)
+			if failure != nil {
+				t.Fatalf("render: %s", failure.Message)
+			}
+			if strings.Contains(content, hsts) {
+				t.Errorf("HSTS sent while off:\n%s", content)
+			}
+		})
+	}
+
+	// Both templates with such locations are covered
+	for _, name := range []string{"spa", "proxy"} {
+		if templates[name] == nil {
+			t.Errorf("no %s template", name)
+		}
+	}
+}
+
+// nginxLocations returns the location blocks of a rendered server block
+func nginxLocations(content string) []string {
+	var locations []string
+	var location []string
+	for _, line := range strings.Split(content, "\n") {
+		switch {
+		case strings.HasPrefix(line, "    location "):
+			location = []string{line}
+		case location != nil:
+			location = append(location, line)
+			if line == "    }" {
+				locations = append(locations, strings.Join(location, "\n"))
+				location = nil
+			}
+		}
+	}
+	return locations
+}
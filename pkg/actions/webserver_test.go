@@ -0,0 +1,212 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstallWebServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		install func(w *WebServerAction) *Result
+		fail    string // command line that fails, if any
+		hang    string // command line that never finishes, if any
+		want    []string
+	}{
+		{
+			name:    "apache",
+			install: (*WebServerAction).InstallApache,
+			want: []string{
+				"apt update",
+				"apt install -y apache2",
+				"systemctl enable apache2",
+				"systemctl start apache2",
+			},
+		},
+		{
+			name:    "nginx",
+			install: (*WebServerAction).InstallNginx,
+			want: []string{
+				"apt update",
+				"apt install -y nginx",
+				"systemctl enable nginx",
+				"systemctl start nginx",
+			},
+		},
+		{
+			name:    "failed update",
+			install: (*WebServerAction).InstallNginx,
+			fail:    "apt update",
+			want:    []string{"apt update"},
+		},
+		{
+			name:    "hung install",
+			install: (*WebServerAction).InstallNginx,
+			hang:    "apt install -y nginx",
+			want: []string{
+				"apt update",
+				"apt install -y nginx",
+			},
+		},
+		{
+			name:    "failed install",
+			install: (*WebServerAction).InstallApache,
+			fail:    "apt install -y apache2",
+			want: []string{
+				"apt update",
+				"apt install -y apache2",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWebServerAction()
+			runner := fakeSystem(t, &w.BaseAction)
+			for _, line := range tt.want {
+				fields := strings.Fields(line)
+				expected := runner.Expect(fields[0], fields[1:]...)
+				switch line {
+				case tt.fail:
+					expected.Fails("failed")
+				case tt.hang:
+					expected.Blocks()
+				}
+			}
+			w.SetTimeout(10 * time.Millisecond)
+
+			result := tt.install(w)
+			if result.Success != (tt.fail == "" && tt.hang == "") {
+				t.Errorf("success = %t, error = %v", result.Success, result.Error)
+			}
+			if tt.hang != "" && !errors.Is(result.Error, context.DeadlineExceeded) {
+				t.Errorf("error = %v, want a timeout", result.Error)
+			}
+			checkCalls(t, runner, tt.want)
+		})
+	}
+}
+
+func TestUninstallWebServer(t *testing.T) {
+	tests := []struct {
+		name      string
+		uninstall func(w *WebServerAction) *Result
+		removed   func(platform *Platform) []string
+		want      []string
+	}{
+		{
+			name:      "apache",
+			uninstall: (*WebServerAction).UninstallApache,
+			removed: func(platform *Platform) []string {
+				return []string{platform.ApacheConfDir, platform.ApacheLogDir, "/var/lib/apache2", "/var/www/html"}
+			},
+			want: []string{
+				"systemctl stop apache2",
+				"systemctl disable apache2",
+				"apt purge -y apache2 apache2-utils apache2-data apache2-bin",
+				"apt autoremove -y",
+				"apt autoclean",
+			},
+		},
+		{
+			name:      "nginx",
+			uninstall: (*WebServerAction).UninstallNginx,
+			removed: func(platform *Platform) []string {
+				return []string{platform.NginxConfDir, platform.NginxLogDir, "/var/lib/nginx", "/var/www/html"}
+			},
+			want: []string{
+				"systemctl stop nginx",
+				"systemctl disable nginx",
+				"apt purge -y nginx nginx-common nginx-core",
+				"apt autoremove -y",
+				"apt autoclean",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWebServerAction()
+			runner := fakeSystem(t, &w.BaseAction)
+			for _, line := range tt.want {
+				fields := strings.Fields(line)
+				runner.Expect(fields[0], fields[1:]...)
+			}
+			removed := tt.removed(w.Platform())
+			kept := "/var/www/example.com/index.html"
+			for _, dir := range removed {
+				if result := w.WriteFile(dir+"/file", "content\n"); !result.Success {
+					t.Fatal(result.Error)
+				}
+			}
+			if result := w.WriteFile(kept, "content\n"); !result.Success {
+				t.Fatal(result.Error)
+			}
+
+			// Directories are removed under the root, not by commands that
+			// would reach the real ones
+			if result := tt.uninstall(w); !result.Success {
+				t.Fatalf("error = %v (%s)", result.Error, result.Message)
+			}
+			checkCalls(t, runner, tt.want)
+			for _, dir := range removed {
+				if _, err := os.Stat(w.localPath(dir)); !os.IsNotExist(err) {
+					t.Errorf("%s was kept: %v", dir, err)
+				}
+			}
+			if !w.FileExists(kept) {
+				t.Errorf("%s was removed", kept)
+			}
+		})
+	}
+}
+
+func TestConfigureNginxVhost(t *testing.T) {
+	tests := []struct {
+		name    string
+		test    func(expected *FakeCommand)
+		success bool
+		want    []string
+	}{
+		{
+			name:    "valid",
+			test:    func(*FakeCommand) {},
+			success: true,
+			want: []string{
+				"nginx -t",
+				"systemctl reload nginx",
+			},
+		},
+		{
+			name:    "invalid configuration",
+			test:    func(expected *FakeCommand) { expected.Fails("nginx: [emerg] unknown directive") },
+			success: false,
+			want:    []string{"nginx -t"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWebServerAction()
+			runner := fakeSystem(t, &w.BaseAction)
+			tt.test(runner.Expect("nginx", "-t"))
+			runner.Expect("systemctl", "reload", "nginx")
+
+			result := w.ConfigureVhost(WebServerNginx, "example.com", "/var/www/example.com", &VhostOptions{Template: "static"})
+			if result.Success != tt.success {
+				t.Errorf("success = %t, error = %v", result.Success, result.Error)
+			}
+			checkCalls(t, runner, tt.want)
+
+			config := w.Platform().NginxVhostPath("example.com")
+			_, err := w.FileSystem().ReadFile(config)
+			if exists := err == nil; exists != tt.success {
+				t.Errorf("%s exists = %t, want %t", config, exists, tt.success)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+// Package audit keeps a tamper-evident record of administrative actions:
+// who did what, from where, through which interface and with what result.
+// Entries are chained by keyed hashes in the state store and can be
+// forwarded to syslog.
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"easygo/pkg/config"
+	"easygo/pkg/events"
+	"easygo/pkg/state"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Open opens the audit log of the configured state store
+func Open() (*state.AuditLog, error) {
+	store, err := state.Open(config.Current().Paths.State)
+	if err != nil {
+		return nil, err
+	}
+	return store.AuditLog(), nil
+}
+
+// Record appends an event to the audit log and forwards it to syslog when
+// that is configured. Ping events, which only test webhooks, are skipped.
+func Record(event *events.Event) {
+	if event.Type == events.TypePing {
+		return
+	}
+
+	entry := &state.AuditEntry{
+		Time:       event.Time.UTC(),
+		User:       event.User,
+		Source:     event.Source,
+		Interface:  event.Interface,
+		Action:     event.Type,
+		Params:     events.Redact(event.Params),
+		Success:    event.Success,
+		Message:    event.Message,
+		Error:      event.Error,
+		ErrorCode:  event.ErrorCode,
+		DurationMS: event.DurationMS,
+	}
+
+	auditLog, err := Open()
+	var key []byte
+	if err == nil {
+		key, err = Key(auditLog)
+	}
+	if err == nil {
+		err = auditLog.Append(entry, sealWith(key))
+	}
+	if err != nil {
+		slog.Error("Audit entry not recorded", "action", entry.Action, "user", entry.User, "error", err)
+		return
+	}
+	forward(entry)
+}
+
+// Hash returns the hash of an entry: HMAC-SHA256 with the key of its JSON
+// encoding without the hash itself, which covers the previous entry's hash
+func Hash(key []byte, entry *state.AuditEntry) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(unsealed(entry))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// legacyHash is the unkeyed SHA-256 entries were hashed with before the
+// chain was keyed
+func legacyHash(entry *state.AuditEntry) string {
+	sum := sha256.Sum256(unsealed(entry))
+	return hex.EncodeToString(sum[:])
+}
+
+// unsealed returns the JSON encoding of an entry without its hash
+func unsealed(entry *state.AuditEntry) []byte {
+	copied := *entry
+	copied.Hash = ""
+	data, _ := json.Marshal(&copied)
+	return data
+}
+
+// sealWith returns a function linking a new entry to the last one
+func sealWith(key []byte) func(entry, last *state.AuditEntry) error {
+	return func(entry, last *state.AuditEntry) error {
+		if last != nil {
+			entry.PrevHash = last.Hash
+		}
+		entry.Hash = Hash(key, entry)
+		return nil
+	}
+}
+
+// Verify checks that the entries, in order from the first, form an
+// unbroken chain under the key: none was changed, removed or inserted.
+// last is the sequence number of the last entry appended, so removing
+// entries from the end shows too.
+func Verify(key []byte, entries []*state.AuditEntry, last uint64) error {
+	return verify(entries, last, func(entry *state.AuditEntry) string { return Hash(key, entry) })
+}
+
+// verify checks the chain with the given hash function
+func verify(entries []*state.AuditEntry, last uint64, hash func(entry *state.AuditEntry) string) error {
+	var prev *state.AuditEntry
+	for _, entry := range entries {
+		switch {
+		case prev == nil && entry.Seq != 1:
+			return fmt.Errorf("entries 1 to %d are missing", entry.Seq-1)
+		case prev != nil && entry.Seq != prev.Seq+1:
+			return fmt.Errorf("entries %d to %d are missing", prev.Seq+1, entry.Seq-1)
+		case prev != nil && entry.PrevHash != prev.Hash:
+			return fmt.Errorf("entry %d does not follow entry %d", entry.Seq, prev.Seq)
+		case !hmac.Equal([]byte(entry.Hash), []byte(hash(entry))):
+			return fmt.Errorf("entry %d was modified", entry.Seq)
+		}
+		prev = entry
+	}
+
+	switch {
+	case prev == nil && last > 0:
+		return fmt.Errorf("entries 1 to %d are missing", last)
+	case prev != nil && prev.Seq < last:
+		return fmt.Errorf("entries %d to %d are missing", prev.Seq+1, last)
+	}
+	return nil
+}
+
+// Filter selects audit entries. Empty fields match everything.
+type Filter struct {
+	User      string
+	Action    string // part of the action name, in any case
+	Interface string
+	Source    string
+	Since     time.Time
+	Until     time.Time
+	Failed    bool // only failed actions
+	Limit     int  // newest entries returned, 0 for all
+}
+
+// Match reports whether an entry passes the filter
+func (f *Filter) Match(entry *state.AuditEntry) bool {
+	switch {
+	case f.User != "" && entry.User != f.User:
+		return false
+	case f.Action != "" && !strings.Contains(strings.ToLower(entry.Action), strings.ToLower(f.Action)):
+		return false
+	case f.Interface != "" && entry.Interface != f.Interface:
+		return false
+	case f.Source != "" && entry.Source != f.Source:
+		return false
+	case !f.Since.IsZero() && entry.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !entry.Time.Before(f.Until):
+		return false
+	case f.Failed && entry.Success:
+		return false
+	}
+	return true
+}
+
+// Result is what a query found
+type Result struct {
+	Entries []*state.AuditEntry `json:"entries"`          // newest first
+	Total   int                 `json:"total"`            // entries in the log
+	Broken  string              `json:"broken,omitempty"` // why the chain does not verify
+}
+
+// Query returns the entries that pass the filter and verifies the log
+func Query(f *Filter) (*Result, error) {
+	auditLog, err := Open()
+	if err != nil {
+		return nil, err
+	}
+	key, err := Key(auditLog)
+	if err != nil {
+		return nil, err
+	}
+	entries, last, err := auditLog.List()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Entries: []*state.AuditEntry{}, Total: len(entries)}
+	if err := Verify(key, entries, last); err != nil {
+		result.Broken = err.Error()
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if f.Limit > 0 && len(result.Entries) == f.Limit {
+			break
+		}
+		if f.Match(entries[i]) {
+			result.Entries = append(result.Entries, entries[i])
+		}
+	}
+	return result, nil
+}
+
+// ParseTime reads a filter time: an RFC 3339 time, a date such as
+// 2024-05-01 (local time), or a duration such as 24h meaning that long ago
+func ParseTime(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a time, date or duration", value)
+}
@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"crypto/rand"
+	"easygo/pkg/config"
+	"easygo/pkg/state"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// keySize is the length of a generated key, in bytes
+const keySize = 32
+
+// Key returns the key the chain is sealed with, read from audit.key_file.
+// Without one a key is created, and the entries recorded before the chain
+// was keyed are sealed with it if their chain is intact; a broken chain
+// is left as it was, so it keeps failing verification.
+func Key(auditLog *state.AuditLog) ([]byte, error) {
+	path := config.Current().Audit.KeyFile
+	key, err := readKey(path)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return key, err
+	}
+
+	// The key is created in the transaction that reseals the entries, so
+	// processes starting at once end up with the same key
+	err = auditLog.Rewrite(func(entries []*state.AuditEntry, last uint64) (bool, error) {
+		existing, err := readKey(path)
+		if !errors.Is(err, fs.ErrNotExist) {
+			key = existing
+			return false, err
+		}
+
+		key = make([]byte, keySize)
+		if _, err := rand.Read(key); err != nil {
+			return false, err
+		}
+		if err := writeKey(path, key); err != nil {
+			return false, err
+		}
+		if verify(entries, last, legacyHash) != nil {
+			return false, nil
+		}
+
+		seal := sealWith(key)
+		var prev *state.AuditEntry
+		for _, entry := range entries {
+			seal(entry, prev)
+			prev = entry
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// readKey reads a hex-encoded key
+func readKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("%s does not hold a hex-encoded key", path)
+	}
+	return key, nil
+}
+
+// writeKey creates the key file, readable by root only
+func writeKey(path string, key []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(hex.EncodeToString(key) + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
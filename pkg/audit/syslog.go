@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"easygo/pkg/config"
+	"easygo/pkg/state"
+	"encoding/json"
+	"log/slog"
+	"log/syslog"
+	"sync"
+)
+
+// facilities maps audit.syslog.facility values to syslog facilities
+var facilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+// The syslog connection is kept open, and reopened when the settings
+// change (e.g. on SIGHUP) or a write fails
+var (
+	syslogMu     sync.Mutex
+	syslogWriter *syslog.Writer
+	syslogDialed config.SyslogConfig
+)
+
+// forward sends an entry to syslog as JSON, at notice level for
+// successful actions and warning level for failed ones
+func forward(entry *state.AuditEntry) {
+	cfg := config.Current().Audit.Syslog
+	if !cfg.Enabled {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	syslogMu.Lock()
+	defer syslogMu.Unlock()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		if syslogWriter == nil || syslogDialed != cfg {
+			if syslogWriter != nil {
+				syslogWriter.Close()
+			}
+			syslogWriter, err = syslog.Dial(cfg.Network, cfg.Address, facilities[cfg.Facility]|syslog.LOG_NOTICE, cfg.Tag)
+			if err != nil {
+				syslogWriter = nil
+				slog.Warn("Audit entry not sent to syslog", "seq", entry.Seq, "error", err)
+				return
+			}
+			syslogDialed = cfg
+		}
+
+		if entry.Success {
+			err = syslogWriter.Notice(string(data))
+		} else {
+			err = syslogWriter.Warning(string(data))
+		}
+		if err == nil {
+			return
+		}
+		syslogWriter.Close()
+		syslogWriter = nil
+	}
+	slog.Warn("Audit entry not sent to syslog", "seq", entry.Seq, "error", err)
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"os/user"
 
@@ -71,7 +72,7 @@ func IsRoot() bool {
 // RequireRoot ensures the user is running as root
 func RequireRoot() error {
 	if !IsRoot() {
-		return errors.New("this operation requires root privileges")
+		return fmt.Errorf("this operation requires root privileges: %w", os.ErrPermission)
 	}
 	return nil
 }
@@ -0,0 +1,343 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath is where the panel configuration is read from
+const DefaultPath = "/etc/easygo/config.yaml"
+
+// Config holds the panel settings
+type Config struct {
+	Web      WebConfig      `yaml:"web"`
+	Services []string       `yaml:"services"` // shown on the dashboard
+	PHP      PHPConfig      `yaml:"php"`
+	Backup   BackupConfig   `yaml:"backup"`
+	Paths    PathsConfig    `yaml:"paths"`
+	Vhosts   VhostsConfig   `yaml:"vhosts"`
+	Commands CommandsConfig `yaml:"commands"`
+	Webhooks WebhooksConfig `yaml:"webhooks"`
+	Audit    AuditConfig    `yaml:"audit"`
+	Log      LogConfig      `yaml:"log"`
+}
+
+// WebConfig configures the web panel
+type WebConfig struct {
+	Listen        string `yaml:"listen"`
+	SessionSecret string `yaml:"session_secret"`
+}
+
+// PHPConfig configures PHP defaults
+type PHPConfig struct {
+	DefaultVersion string `yaml:"default_version"`
+}
+
+// BackupConfig configures backups
+type BackupConfig struct {
+	Dir string `yaml:"dir"` // default destination
+}
+
+// PathsConfig locates EasyGo's own data
+type PathsConfig struct {
+	Root         string `yaml:"root"`          // prefix of the managed system's files, empty for /
+	State        string `yaml:"state"`         // state database
+	FileVersions string `yaml:"file_versions"` // previous versions of managed files
+	Hooks        string `yaml:"hooks"`         // hook scripts, in <action>/{pre,post}.d
+	Templates    string `yaml:"templates"`     // vhost templates, in {apache,nginx}/<name>.tmpl
+	Plugins      string `yaml:"plugins"`       // Go and process plugins
+}
+
+// VhostsConfig configures virtual hosts
+type VhostsConfig struct {
+	HybridBackend string `yaml:"hybrid_backend"` // IP:port Apache listens on behind Nginx in hybrid vhosts
+	WebRoot       string `yaml:"web_root"`       // directory document roots are under; only those are removed with a vhost
+}
+
+// CommandsConfig configures how system commands are run
+type CommandsConfig struct {
+	Timeout time.Duration `yaml:"timeout"` // 0 for no limit
+}
+
+// WebhooksConfig configures the webhooks events are delivered to
+type WebhooksConfig struct {
+	Endpoints   []WebhookEndpoint `yaml:"endpoints"`
+	MaxAttempts int               `yaml:"max_attempts"` // attempts per delivery before giving up
+	Backoff     time.Duration     `yaml:"backoff"`      // delay before the first retry, doubled after each
+}
+
+// WebhookEndpoint is a URL events are POSTed to
+type WebhookEndpoint struct {
+	URL    string   `yaml:"url"`
+	Secret string   `yaml:"secret"` // key for the HMAC-SHA256 signature
+	Events []string `yaml:"events"` // event types to send, all when empty
+}
+
+// LogConfig configures EasyGo's own log
+type LogConfig struct {
+	File   string `yaml:"file"`   // empty to log to stderr only
+	Level  string `yaml:"level"`  // debug, info, warn or error
+	Format string `yaml:"format"` // text or json
+}
+
+// AuditConfig configures the audit log
+type AuditConfig struct {
+	KeyFile string       `yaml:"key_file"` // HMAC key of the hash chain, kept out of the state database
+	Syslog  SyslogConfig `yaml:"syslog"`
+}
+
+// SyslogConfig forwards audit entries to syslog
+type SyslogConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Network  string `yaml:"network"` // udp or tcp for a remote server, empty for the local daemon
+	Address  string `yaml:"address"` // host:port of a remote server
+	Facility string `yaml:"facility"`
+	Tag      string `yaml:"tag"`
+}
+
+// SyslogFacilities are the valid audit.syslog.facility values
+var SyslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news", "uucp", "cron", "authpriv", "ftp",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// Default returns the built-in configuration
+func Default() *Config {
+	return &Config{
+		Web: WebConfig{
+			Listen: "0.0.0.0:8080",
+		},
+		Services: []string{"apache", "nginx", "php-fpm", "mysql", "postgresql"},
+		PHP: PHPConfig{
+			DefaultVersion: "8.2",
+		},
+		Backup: BackupConfig{
+			Dir: "/var/backups/easygo",
+		},
+		Paths: PathsConfig{
+			State:        "/var/lib/easygo/state.db",
+			FileVersions: "/var/lib/easygo/backups",
+			Hooks:        "/etc/easygo/hooks",
+			Templates:    "/etc/easygo/templates",
+			Plugins:      "/opt/easygo/plugins",
+		},
+		Vhosts: VhostsConfig{
+			HybridBackend: "127.0.0.1:8081",
+			WebRoot:       "/var/www",
+		},
+		Webhooks: WebhooksConfig{
+			MaxAttempts: 6,
+			Backoff:     30 * time.Second,
+		},
+		Log: LogConfig{
+			File:   "/var/log/easygo/easygo.log",
+			Level:  "info",
+			Format: "text",
+		},
+		Audit: AuditConfig{
+			KeyFile: "/etc/easygo/audit.key",
+			Syslog: SyslogConfig{
+				Facility: "authpriv",
+				Tag:      "easygo",
+			},
+		},
+	}
+}
+
+// Load reads a configuration file over the defaults, applies environment
+// overrides and validates the result. A missing file is not an error.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides settings from EASYGO_* environment variables
+func (c *Config) applyEnv() error {
+	fields := map[string]*string{
+		"EASYGO_LISTEN":              &c.Web.Listen,
+		"EASYGO_SESSION_SECRET":      &c.Web.SessionSecret,
+		"EASYGO_PHP_DEFAULT_VERSION": &c.PHP.DefaultVersion,
+		"EASYGO_BACKUP_DIR":          &c.Backup.Dir,
+		"EASYGO_STATE_PATH":          &c.Paths.State,
+		"EASYGO_FILE_VERSIONS_DIR":   &c.Paths.FileVersions,
+		"EASYGO_HOOKS_DIR":           &c.Paths.Hooks,
+		"EASYGO_TEMPLATES_DIR":       &c.Paths.Templates,
+		"EASYGO_PLUGINS_DIR":         &c.Paths.Plugins,
+		"EASYGO_ROOT":                &c.Paths.Root,
+		"EASYGO_HYBRID_BACKEND":      &c.Vhosts.HybridBackend,
+		"EASYGO_WEB_ROOT":            &c.Vhosts.WebRoot,
+		"EASYGO_AUDIT_KEY_FILE":      &c.Audit.KeyFile,
+		"EASYGO_LOG_FILE":            &c.Log.File,
+		"EASYGO_LOG_LEVEL":           &c.Log.Level,
+	}
+	for name, field := range fields {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = value
+		}
+	}
+
+	if value, ok := os.LookupEnv("EASYGO_SERVICES"); ok {
+		c.Services = splitList(value)
+	}
+	if value, ok := os.LookupEnv("EASYGO_COMMAND_TIMEOUT"); ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("EASYGO_COMMAND_TIMEOUT: %w", err)
+		}
+		c.Commands.Timeout = timeout
+	}
+	return nil
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+var phpVersionPattern = regexp.MustCompile(`^\d+\.\d+$`)
+
+// Validate checks the configuration and reports every problem found
+func (c *Config) Validate() error {
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if _, port, err := net.SplitHostPort(c.Web.Listen); err != nil || port == "" {
+		fail("web.listen: %q is not a host:port address", c.Web.Listen)
+	}
+	if c.Web.SessionSecret != "" && len(c.Web.SessionSecret) < 32 {
+		fail("web.session_secret: must be at least 32 characters")
+	}
+	if len(c.Services) == 0 {
+		fail("services: at least one service is required")
+	}
+	for _, service := range c.Services {
+		if strings.ContainsAny(service, " /\t") {
+			fail("services: %q is not a service name", service)
+		}
+	}
+	if !phpVersionPattern.MatchString(c.PHP.DefaultVersion) {
+		fail("php.default_version: %q is not a version like 8.2", c.PHP.DefaultVersion)
+	}
+	for _, setting := range []struct{ name, path string }{
+		{"backup.dir", c.Backup.Dir},
+		{"paths.state", c.Paths.State},
+		{"paths.file_versions", c.Paths.FileVersions},
+		{"paths.hooks", c.Paths.Hooks},
+		{"paths.templates", c.Paths.Templates},
+		{"paths.plugins", c.Paths.Plugins},
+		{"audit.key_file", c.Audit.KeyFile},
+		{"vhosts.web_root", c.Vhosts.WebRoot},
+	} {
+		if !filepath.IsAbs(setting.path) {
+			fail("%s: %q must be an absolute path", setting.name, setting.path)
+		}
+	}
+	if host, port, err := net.SplitHostPort(c.Vhosts.HybridBackend); err != nil || net.ParseIP(host) == nil || port == "" {
+		fail("vhosts.hybrid_backend: %q is not an IP:port address", c.Vhosts.HybridBackend)
+	}
+	if c.Commands.Timeout < 0 {
+		fail("commands.timeout: must not be negative")
+	}
+	if c.Paths.Root != "" && !filepath.IsAbs(c.Paths.Root) {
+		fail("paths.root: %q must be an absolute path", c.Paths.Root)
+	}
+	for i, endpoint := range c.Webhooks.Endpoints {
+		if u, err := url.Parse(endpoint.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("webhooks.endpoints[%d].url: %q is not an http(s) URL", i, endpoint.URL)
+		}
+		if endpoint.Secret == "" {
+			fail("webhooks.endpoints[%d].secret: is required to sign deliveries", i)
+		}
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		fail("webhooks.max_attempts: must be at least 1")
+	}
+	if c.Webhooks.Backoff <= 0 {
+		fail("webhooks.backoff: must be positive")
+	}
+	switch c.Audit.Syslog.Network {
+	case "":
+		if c.Audit.Syslog.Address != "" {
+			fail("audit.syslog.address: needs audit.syslog.network")
+		}
+	case "udp", "tcp":
+		if _, _, err := net.SplitHostPort(c.Audit.Syslog.Address); err != nil {
+			fail("audit.syslog.address: %q is not a host:port address", c.Audit.Syslog.Address)
+		}
+	default:
+		fail("audit.syslog.network: %q is not udp or tcp", c.Audit.Syslog.Network)
+	}
+	if !slices.Contains(SyslogFacilities, c.Audit.Syslog.Facility) {
+		fail("audit.syslog.facility: %q is not a syslog facility", c.Audit.Syslog.Facility)
+	}
+	if c.Log.File != "" && !filepath.IsAbs(c.Log.File) {
+		fail("log.file: %q must be an absolute path", c.Log.File)
+	}
+	if !slices.Contains([]string{"debug", "info", "warn", "error"}, strings.ToLower(c.Log.Level)) {
+		fail("log.level: %q is not debug, info, warn or error", c.Log.Level)
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		fail("log.format: %q is not text or json", c.Log.Format)
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+var current atomic.Pointer[Config]
+
+// Current returns the configuration in effect, or the defaults when none
+// has been loaded
+func Current() *Config {
+	if cfg := current.Load(); cfg != nil {
+		return cfg
+	}
+	return Default()
+}
+
+// Set makes cfg the configuration in effect
+func Set(cfg *Config) {
+	current.Store(cfg)
+}
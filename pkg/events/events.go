@@ -0,0 +1,145 @@
+// Package events carries what happens in EasyGo, such as a vhost being
+// created or a user logging in, to whoever subscribed, e.g. the webhook
+// dispatcher.
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types that are not actions. Actions publish an event named after
+// themselves, e.g. ConfigureNginxVhost, like their hook directories.
+const (
+	TypeLogin = "Login"
+	TypePing  = "Ping"
+)
+
+// Interfaces events come from
+const (
+	InterfaceCLI = "cli"
+	InterfaceWeb = "web"
+)
+
+// Event is something that happened
+type Event struct {
+	ID         string            `json:"id"`
+	Type       string            `json:"type"`
+	Time       time.Time         `json:"time"`
+	Host       string            `json:"host"`
+	User       string            `json:"user,omitempty"`
+	Interface  string            `json:"interface,omitempty"` // cli or web
+	Source     string            `json:"source,omitempty"`    // client address
+	Success    bool              `json:"success"`
+	Message    string            `json:"message,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	ErrorCode  string            `json:"error_code,omitempty"`
+	Params     map[string]string `json:"params,omitempty"`
+	DurationMS int64             `json:"duration_ms,omitempty"`
+}
+
+// Origin describes who set an operation in motion, and from where
+type Origin struct {
+	Interface string // cli or web
+	User      string
+	Source    string // client address, e.g. of the browser
+}
+
+type originKey struct{}
+
+// WithOrigin returns a context carrying the origin of the operations run
+// under it
+func WithOrigin(ctx context.Context, origin Origin) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// OriginFrom returns the origin carried by a context, if any
+func OriginFrom(ctx context.Context) Origin {
+	origin, _ := ctx.Value(originKey{}).(Origin)
+	return origin
+}
+
+// Bus delivers published events to its subscribers
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers []func(event *Event)
+}
+
+// Default is the bus actions publish to
+var Default = &Bus{}
+
+// Subscribe registers a function that receives every event published
+// afterwards. It is called synchronously, so it must not block for long.
+func (b *Bus) Subscribe(fn func(event *Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers = append(b.subscribers, fn)
+}
+
+// Publish fills in the event's ID, time and host, redacts secret
+// parameters and hands the event to every subscriber in turn
+func (b *Bus) Publish(event *Event) {
+	if event.ID == "" {
+		event.ID = newID()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.Host == "" {
+		event.Host, _ = os.Hostname()
+	}
+	event.Params = Redact(event.Params)
+
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+
+	for _, fn := range subscribers {
+		fn(event)
+	}
+}
+
+// secretNames are parts of parameter names whose values are secret
+var secretNames = []string{"password", "passwd", "secret", "token", "credential", "private_key", "api_key"}
+
+// Redacted replaces the values of secret parameters
+const Redacted = "[redacted]"
+
+// Redact returns params with the values of secret ones, such as passwords
+// and tokens, replaced by Redacted
+func Redact(params map[string]string) map[string]string {
+	var redacted map[string]string
+	for name := range params {
+		lower := strings.ToLower(name)
+		for _, secret := range secretNames {
+			if !strings.Contains(lower, secret) {
+				continue
+			}
+			if redacted == nil {
+				redacted = make(map[string]string, len(params))
+				for k, v := range params {
+					redacted[k] = v
+				}
+			}
+			redacted[name] = Redacted
+			break
+		}
+	}
+	if redacted == nil {
+		return params
+	}
+	return redacted
+}
+
+// newID returns a random event ID
+func newID() string {
+	id := make([]byte, 12)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
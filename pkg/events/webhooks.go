@@ -0,0 +1,327 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"easygo/pkg/config"
+	"easygo/pkg/state"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Delivery states
+const (
+	DeliveryPending    = "pending"
+	DeliveryDelivering = "delivering" // claimed by a dispatcher posting it
+	DeliveryDelivered  = "delivered"
+	DeliveryFailed     = "failed"
+)
+
+// ErrDelivering reports a delivery another dispatcher is posting
+var ErrDelivering = errors.New("already being sent")
+
+const (
+	deliveryTimeout = 10 * time.Second
+	maxBackoff      = time.Hour
+	pollInterval    = 15 * time.Second
+
+	// claimTime is how long a claimed delivery is left to the dispatcher
+	// posting it. A claim outlives the delivery timeout, so it only expires
+	// when that process died, and the delivery is then picked up again.
+	claimTime = time.Minute
+
+	// maxDeliveries is how many deliveries the log keeps
+	maxDeliveries = 1000
+)
+
+// Dispatcher POSTs events to the configured webhook endpoints. Every
+// delivery is queued in the state store and sent by a dispatcher running
+// in the background, i.e. the web panel's, which retries failed ones with
+// exponential backoff. A delivery is claimed in the store before it is
+// posted, so no two dispatchers post it at once.
+type Dispatcher struct {
+	client *http.Client
+	wake   chan struct{}
+}
+
+// NewDispatcher creates a dispatcher
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		client: &http.Client{Timeout: deliveryTimeout},
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Webhooks is the dispatcher the CLI and the web panel use
+var Webhooks = NewDispatcher()
+
+// Sign returns the signature of a payload, as sent in the
+// X-EasyGo-Signature header
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// openStore opens the state store that holds the delivery log
+func openStore() (*state.Store, error) {
+	return state.Open(config.Current().Paths.State)
+}
+
+// Handle queues an event for every endpoint that wants it, for the
+// background loop to send
+func (d *Dispatcher) Handle(event *Event) {
+	cfg := config.Current().Webhooks
+	if len(cfg.Endpoints) == 0 {
+		return
+	}
+	store, err := openStore()
+	if err != nil {
+		slog.Warn("Webhook deliveries skipped", "event", event.Type, "error", err)
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		slog.Warn("Webhook deliveries skipped", "event", event.Type, "error", err)
+		return
+	}
+
+	for _, endpoint := range cfg.Endpoints {
+		if !wants(endpoint, event.Type) {
+			continue
+		}
+		delivery := &state.WebhookDelivery{
+			EventID:     event.ID,
+			EventType:   event.Type,
+			URL:         endpoint.URL,
+			Payload:     string(payload),
+			Status:      DeliveryPending,
+			NextAttempt: time.Now(),
+		}
+		if err := store.WebhookDeliveries().Put(delivery); err != nil {
+			slog.Warn("Failed to record webhook delivery", "url", endpoint.URL, "error", err)
+		}
+	}
+	prune(store)
+	d.wakeUp()
+}
+
+// wants reports whether an endpoint subscribed to an event type
+func wants(endpoint config.WebhookEndpoint, eventType string) bool {
+	if len(endpoint.Events) == 0 {
+		return true
+	}
+	for _, t := range endpoint.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Start makes the dispatcher deliver in the background, including the
+// deliveries the CLI queued, and retry failed ones until ctx is done
+func (d *Dispatcher) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			d.deliverDue()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-d.wake:
+			}
+		}
+	}()
+}
+
+// wakeUp makes the background loop look for due deliveries now
+func (d *Dispatcher) wakeUp() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliverDue attempts every pending delivery whose time has come, and
+// those whose claim expired
+func (d *Dispatcher) deliverDue() {
+	store, err := openStore()
+	if err != nil {
+		return
+	}
+	due, err := store.WebhookDeliveries().Find(isDue)
+	if err != nil {
+		slog.Warn("Failed to read webhook deliveries", "error", err)
+		return
+	}
+	for _, delivery := range due {
+		delivery, err := claim(store, delivery.ID, false)
+		if err != nil {
+			// Claimed by another dispatcher or redelivered meanwhile
+			continue
+		}
+		d.attempt(store, delivery)
+	}
+}
+
+// isDue reports whether a delivery should be attempted now
+func isDue(delivery *state.WebhookDelivery) bool {
+	switch delivery.Status {
+	case DeliveryPending, DeliveryDelivering:
+		return !delivery.NextAttempt.After(time.Now())
+	}
+	return false
+}
+
+// claim marks a delivery as being delivered by this process, in the same
+// transaction that checks nobody else has. A redelivery claims any
+// delivery that is not being delivered and resets its attempts; otherwise
+// the delivery must be due.
+func claim(store *state.Store, id string, redeliver bool) (*state.WebhookDelivery, error) {
+	return store.WebhookDeliveries().Update(id, func(delivery *state.WebhookDelivery) error {
+		claimed := delivery.Status == DeliveryDelivering && delivery.NextAttempt.After(time.Now())
+		switch {
+		case claimed:
+			return fmt.Errorf("delivery %s: %w", id, ErrDelivering)
+		case redeliver:
+			delivery.Attempts = 0
+		case !isDue(delivery):
+			return fmt.Errorf("delivery %s is not due", id)
+		}
+		delivery.Status = DeliveryDelivering
+		delivery.NextAttempt = time.Now().Add(claimTime)
+		return nil
+	})
+}
+
+// Redeliver sends a delivery again, e.g. one that failed, resetting its
+// attempts. A delivery that is being sent is not sent again.
+func (d *Dispatcher) Redeliver(id string) (*state.WebhookDelivery, error) {
+	store, err := openStore()
+	if err != nil {
+		return nil, err
+	}
+	delivery, err := claim(store, id, true)
+	if err != nil {
+		return nil, err
+	}
+	d.attempt(store, delivery)
+	return delivery, nil
+}
+
+// attempt POSTs a delivery once and records the outcome: delivered, due
+// for a retry after the backoff, or failed after the last attempt
+func (d *Dispatcher) attempt(store *state.Store, delivery *state.WebhookDelivery) {
+	cfg := config.Current().Webhooks
+	delivery.Attempts++
+
+	var err error
+	endpoint, ok := endpointFor(cfg, delivery.URL)
+	if ok {
+		delivery.StatusCode, err = d.post(endpoint, delivery)
+	} else {
+		err = fmt.Errorf("%s is no longer a configured webhook endpoint", delivery.URL)
+		delivery.Attempts = cfg.MaxAttempts
+	}
+
+	switch {
+	case err == nil:
+		delivery.Status = DeliveryDelivered
+		delivery.DeliveredAt = time.Now()
+		delivery.NextAttempt = time.Time{}
+		delivery.LastError = ""
+	case delivery.Attempts >= cfg.MaxAttempts:
+		delivery.Status = DeliveryFailed
+		delivery.NextAttempt = time.Time{}
+		delivery.LastError = err.Error()
+	default:
+		delivery.Status = DeliveryPending
+		delivery.NextAttempt = time.Now().Add(backoff(cfg.Backoff, delivery.Attempts))
+		delivery.LastError = err.Error()
+	}
+
+	if err := store.WebhookDeliveries().Put(delivery); err != nil {
+		slog.Warn("Failed to record webhook delivery", "delivery", delivery.ID, "error", err)
+	}
+}
+
+// endpointFor finds the configured endpoint for a URL
+func endpointFor(cfg config.WebhooksConfig, url string) (config.WebhookEndpoint, bool) {
+	for _, endpoint := range cfg.Endpoints {
+		if endpoint.URL == url {
+			return endpoint, true
+		}
+	}
+	return config.WebhookEndpoint{}, false
+}
+
+// backoff returns the delay after a failed attempt: base, doubled for
+// every earlier attempt, up to an hour
+func backoff(base time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+// post sends the delivery's payload, signed with the endpoint's secret.
+// Any 2xx response counts as delivered.
+func (d *Dispatcher) post(endpoint config.WebhookEndpoint, delivery *state.WebhookDelivery) (int, error) {
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "EasyGo-Webhook")
+	req.Header.Set("X-EasyGo-Event", delivery.EventType)
+	req.Header.Set("X-EasyGo-Delivery", delivery.ID)
+	req.Header.Set("X-EasyGo-Signature", Sign(endpoint.Secret, payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// prune drops the oldest finished deliveries beyond maxDeliveries
+func prune(store *state.Store) {
+	deliveries, err := store.WebhookDeliveries().List()
+	if err != nil {
+		return
+	}
+	excess := len(deliveries) - maxDeliveries
+	for _, delivery := range deliveries {
+		if excess <= 0 {
+			break
+		}
+		if delivery.Status == DeliveryPending || delivery.Status == DeliveryDelivering {
+			continue
+		}
+		store.WebhookDeliveries().Delete(delivery.ID)
+		excess--
+	}
+}
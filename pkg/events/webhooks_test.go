@@ -0,0 +1,240 @@
+package events
+
+import (
+	"easygo/pkg/config"
+	"easygo/pkg/state"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver stands in for a webhook endpoint. It answers with the given
+// status codes in turn, then with the last one again.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	headers  []http.Header
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.headers = append(r.headers, req.Header.Clone())
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(r.statuses[min(len(r.bodies), len(r.statuses))-1])
+}
+
+// posts returns how many deliveries were posted to the receiver
+func (r *receiver) posts() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.bodies)
+}
+
+// startWebhooks points the webhooks at a receiver answering with the given
+// status codes, and the state store into the test's directory
+func startWebhooks(t *testing.T, maxAttempts int, backoff time.Duration, statuses ...int) (*Dispatcher, *receiver) {
+	t.Helper()
+
+	endpoint := &receiver{statuses: statuses}
+	server := httptest.NewServer(endpoint)
+	t.Cleanup(server.Close)
+
+	cfg := config.Default()
+	cfg.Paths.State = filepath.Join(t.TempDir(), "state.db")
+	cfg.Webhooks = config.WebhooksConfig{
+		Endpoints:   []config.WebhookEndpoint{{URL: server.URL, Secret: "s3cret"}},
+		MaxAttempts: maxAttempts,
+		Backoff:     backoff,
+	}
+	previous := config.Current()
+	config.Set(cfg)
+	t.Cleanup(func() { config.Set(previous) })
+
+	return NewDispatcher(), endpoint
+}
+
+// deliveryOf returns the delivery of an event
+func deliveryOf(t *testing.T, eventID string) *state.WebhookDelivery {
+	t.Helper()
+
+	store, err := openStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliveries, err := store.WebhookDeliveries().Find(func(delivery *state.WebhookDelivery) bool {
+		return delivery.EventID == eventID
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("%d deliveries of event %s, want 1", len(deliveries), eventID)
+	}
+	return deliveries[0]
+}
+
+func TestWebhookSignature(t *testing.T) {
+	d, endpoint := startWebhooks(t, 3, time.Minute, http.StatusOK)
+
+	d.Handle(&Event{ID: "e1", Type: "ConfigureNginxVhost", Success: true})
+	if posts := endpoint.posts(); posts != 0 {
+		t.Fatalf("posted %d deliveries while queueing, want 0", posts)
+	}
+	d.deliverDue()
+
+	if posts := endpoint.posts(); posts != 1 {
+		t.Fatalf("posted %d deliveries, want 1", posts)
+	}
+	header, body := endpoint.headers[0], endpoint.bodies[0]
+	if signature := header.Get("X-EasyGo-Signature"); signature != Sign("s3cret", body) {
+		t.Errorf("signature = %q, want %q", signature, Sign("s3cret", body))
+	}
+	if Sign("s3cret", body) == Sign("other", body) || Sign("s3cret", body) == Sign("s3cret", append(body, ' ')) {
+		t.Error("signature does not depend on the secret and payload")
+	}
+	if eventType := header.Get("X-EasyGo-Event"); eventType != "ConfigureNginxVhost" {
+		t.Errorf("event header = %q", eventType)
+	}
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil || event.ID != "e1" {
+		t.Errorf("payload = %s (%v), want event e1", body, err)
+	}
+
+	delivery := deliveryOf(t, "e1")
+	if delivery.Status != DeliveryDelivered || delivery.Attempts != 1 || delivery.StatusCode != http.StatusOK {
+		t.Errorf("delivery = %+v, want delivered on the first attempt", delivery)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	d, endpoint := startWebhooks(t, 3, 50*time.Millisecond, http.StatusServiceUnavailable, http.StatusOK)
+
+	d.Handle(&Event{ID: "e1", Type: "ConfigureNginxVhost"})
+	failed := time.Now()
+	d.deliverDue()
+
+	delivery := deliveryOf(t, "e1")
+	if delivery.Status != DeliveryPending || delivery.Attempts != 1 || delivery.StatusCode != http.StatusServiceUnavailable || !strings.Contains(delivery.LastError, "503") {
+		t.Fatalf("delivery = %+v, want a retry after HTTP 503", delivery)
+	}
+	if delivery.NextAttempt.Before(failed.Add(50 * time.Millisecond)) {
+		t.Errorf("next attempt %s, want it 50ms after %s", delivery.NextAttempt, failed)
+	}
+
+	// Not retried before the backoff has passed
+	d.deliverDue()
+	if posts := endpoint.posts(); posts != 1 {
+		t.Fatalf("posted %d times during the backoff, want 1", posts)
+	}
+	time.Sleep(time.Until(delivery.NextAttempt) + 10*time.Millisecond)
+	d.deliverDue()
+
+	if posts := endpoint.posts(); posts != 2 {
+		t.Fatalf("posted %d times, want 2", posts)
+	}
+	if delivery := deliveryOf(t, "e1"); delivery.Status != DeliveryDelivered || delivery.Attempts != 2 || delivery.LastError != "" {
+		t.Errorf("delivery = %+v, want delivered on the second attempt", delivery)
+	}
+}
+
+func TestWebhookGiveUp(t *testing.T) {
+	d, endpoint := startWebhooks(t, 3, time.Millisecond, http.StatusInternalServerError)
+
+	d.Handle(&Event{ID: "e1", Type: "ConfigureNginxVhost"})
+	for i := 0; i < 50 && endpoint.posts() < 3; i++ {
+		d.deliverDue()
+		time.Sleep(5 * time.Millisecond)
+	}
+	d.deliverDue()
+
+	if posts := endpoint.posts(); posts != 3 {
+		t.Errorf("posted %d times, want 3", posts)
+	}
+	delivery := deliveryOf(t, "e1")
+	if delivery.Status != DeliveryFailed || delivery.Attempts != 3 || !delivery.NextAttempt.IsZero() {
+		t.Errorf("delivery = %+v, want failed after 3 attempts", delivery)
+	}
+}
+
+func TestWebhookRedeliver(t *testing.T) {
+	d, endpoint := startWebhooks(t, 1, time.Minute, http.StatusInternalServerError, http.StatusOK)
+	store, err := openStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed delivery is not claimed again, but can be redelivered
+	d.Handle(&Event{ID: "e1", Type: "ConfigureNginxVhost"})
+	d.deliverDue()
+	failed := deliveryOf(t, "e1")
+	if failed.Status != DeliveryFailed {
+		t.Fatalf("delivery = %+v, want failed", failed)
+	}
+	if _, err := claim(store, failed.ID, false); err == nil {
+		t.Error("claimed a failed delivery")
+	}
+	delivery, err := d.Redeliver(failed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != DeliveryDelivered || delivery.Attempts != 1 || endpoint.posts() != 2 {
+		t.Errorf("delivery = %+v after %d posts, want delivered on its first new attempt", delivery, endpoint.posts())
+	}
+
+	// A delivery claimed by another dispatcher is left to it
+	d.Handle(&Event{ID: "e2", Type: "ConfigureNginxVhost"})
+	claimed, err := claim(store, deliveryOf(t, "e2").ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed.Status != DeliveryDelivering || !claimed.NextAttempt.After(time.Now()) {
+		t.Errorf("claimed delivery = %+v, want delivering with a lease", claimed)
+	}
+	if _, err := d.Redeliver(claimed.ID); !errors.Is(err, ErrDelivering) {
+		t.Errorf("redeliver error = %v, want ErrDelivering", err)
+	}
+	d.deliverDue()
+	if posts := endpoint.posts(); posts != 2 {
+		t.Fatalf("posted a claimed delivery, %d posts", posts)
+	}
+
+	// and picked up again once the claim expired
+	if _, err := store.WebhookDeliveries().Update(claimed.ID, func(delivery *state.WebhookDelivery) error {
+		delivery.NextAttempt = time.Now().Add(-time.Second)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	d.deliverDue()
+	if delivery := deliveryOf(t, "e2"); delivery.Status != DeliveryDelivered || endpoint.posts() != 3 {
+		t.Errorf("delivery = %+v after %d posts, want delivered once its claim expired", delivery, endpoint.posts())
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Second},
+		{attempts: 2, want: 2 * time.Second},
+		{attempts: 4, want: 8 * time.Second},
+		{attempts: 20, want: maxBackoff},
+	}
+	for _, tt := range tests {
+		if got := backoff(time.Second, tt.attempts); got != tt.want {
+			t.Errorf("backoff after %d attempts = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Package logging sets up EasyGo's structured log (log/slog): records go
+// to the configured log file and to stderr, each with its own level, and
+// carry the ID of the web request they belong to.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"easygo/pkg/config"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	mu   sync.Mutex
+	file *os.File
+)
+
+// ParseLevel reads a level name: debug, info, warn or error
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(name))
+	return level, err
+}
+
+// Setup makes slog's default logger, and the standard log package, write
+// records at the configured level and above to the log file and records at
+// consoleLevel and above to stderr. verbose lowers both to debug. The log
+// file is reopened, so calling Setup again after logrotate moved it (on
+// SIGHUP) starts a new file. When the file cannot be opened, e.g. by an
+// unprivileged CLI user, only stderr is written and the error is returned.
+func Setup(cfg config.LogConfig, consoleLevel slog.Level, verbose bool) error {
+	fileLevel, err := ParseLevel(cfg.Level)
+	if err != nil {
+		fileLevel = slog.LevelInfo
+	}
+	if verbose {
+		fileLevel, consoleLevel = slog.LevelDebug, slog.LevelDebug
+	}
+
+	handlers := []slog.Handler{
+		slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: consoleLevel}),
+	}
+
+	var opened *os.File
+	var openErr error
+	if cfg.File != "" {
+		opened, openErr = openFile(cfg.File)
+		if openErr == nil {
+			handlers = append(handlers, newHandler(opened, cfg.Format, fileLevel))
+		}
+	}
+
+	slog.SetDefault(slog.New(&contextHandler{fanout(handlers)}))
+
+	mu.Lock()
+	previous := file
+	file = opened
+	mu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+	return openErr
+}
+
+// openFile opens the log file for appending, creating its directory
+func openFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+}
+
+// newHandler creates a handler writing text or JSON records
+func newHandler(w io.Writer, format string, level slog.Level) slog.Handler {
+	options := &slog.HandlerOptions{Level: level}
+	if strings.EqualFold(format, "json") {
+		return slog.NewJSONHandler(w, options)
+	}
+	return slog.NewTextHandler(w, options)
+}
+
+// fanout passes records to every handler that takes their level
+type fanout []slog.Handler
+
+func (f fanout) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanout) Handle(ctx context.Context, record slog.Record) error {
+	var first error
+	for _, h := range f {
+		if !h.Enabled(ctx, record.Level) {
+			continue
+		}
+		if err := h.Handle(ctx, record.Clone()); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (f fanout) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(fanout, len(f))
+	for i, h := range f {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (f fanout) WithGroup(name string) slog.Handler {
+	handlers := make(fanout, len(f))
+	for i, h := range f {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
+
+// contextHandler adds the request ID carried by the context to records
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
+
+type requestIDKey struct{}
+
+// NewRequestID returns a random request ID
+func NewRequestID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// WithRequestID returns a context whose log records carry a request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by a context, if any
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
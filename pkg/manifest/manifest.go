@@ -0,0 +1,216 @@
+package manifest
+
+import (
+	"bytes"
+	"easygo/pkg/actions"
+	"easygo/pkg/state"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest describes the desired state of a server
+type Manifest struct {
+	PHP          []PHP          `yaml:"php"`
+	Domains      []Domain       `yaml:"domains"`
+	Certificates []Certificate  `yaml:"certificates"`
+	Databases    []Database     `yaml:"databases"`
+	Cron         []CronJob      `yaml:"cron"`
+	Firewall     []FirewallRule `yaml:"firewall"`
+}
+
+// PHP is an installed PHP version and its FPM pools
+type PHP struct {
+	Version string   `yaml:"version"`
+	Pools   []string `yaml:"pools"`
+}
+
+// Domain is a site with a virtual host
+type Domain struct {
+	Name         string            `yaml:"name"`
+	WebServer    string            `yaml:"web_server"` // apache, nginx
+	DocumentRoot string            `yaml:"document_root"`
+	Template     string            `yaml:"template"` // vhost template, php when empty
+	Vars         map[string]string `yaml:"vars"`     // template variables
+	Proxy        *state.Proxy      `yaml:"proxy"`    // reverse proxy backends and settings
+	Hybrid       bool              `yaml:"hybrid"`   // nginx in front of apache, rendered from template
+	TLS          *state.TLS        `yaml:"tls"`      // HTTPS settings, applied once the domain has a certificate
+}
+
+// Certificate is a Let's Encrypt certificate
+type Certificate struct {
+	Domain  string `yaml:"domain"`
+	Email   string `yaml:"email"`
+	Webroot string `yaml:"webroot"` // defaults to the domain's document root
+}
+
+// Database is a database and its owning user. The password is only used
+// when the database is created.
+type Database struct {
+	Name        string `yaml:"name"`
+	Type        string `yaml:"type"` // mysql, mariadb, postgresql
+	User        string `yaml:"user"`
+	Password    string `yaml:"password"`
+	PasswordEnv string `yaml:"password_env"` // environment variable holding the password
+}
+
+// CronJob is a crontab entry
+type CronJob struct {
+	Schedule    string `yaml:"schedule"`
+	Command     string `yaml:"command"`
+	Description string `yaml:"description"`
+}
+
+// FirewallRule is an INPUT rule
+type FirewallRule struct {
+	Protocol string `yaml:"protocol"` // tcp, udp
+	Port     string `yaml:"port"`
+	Source   string `yaml:"source"`
+	Action   string `yaml:"action"` // allow, deny
+}
+
+// Load reads and validates a manifest file
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(m); err != nil && !errors.Is(err, io.EOF) {
+		return nil, invalid(path, err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, invalid(path, err)
+	}
+	return m, nil
+}
+
+// invalid reports a problem with a manifest file as a validation failure
+func invalid(path string, err error) error {
+	return &actions.Error{Kind: actions.ErrValidationFailed, Msg: path, Err: err}
+}
+
+var (
+	phpVersionPattern = regexp.MustCompile(`^\d+\.\d+$`)
+	namePattern       = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	portPattern       = regexp.MustCompile(`^\d+(:\d+)?$`)
+)
+
+// Validate checks the manifest and reports every problem found
+func (m *Manifest) Validate() error {
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	for i, php := range m.PHP {
+		if !phpVersionPattern.MatchString(php.Version) {
+			fail("php[%d].version: %q is not a version like 8.2", i, php.Version)
+		}
+		for _, pool := range php.Pools {
+			if !namePattern.MatchString(pool) {
+				fail("php[%d].pools: %q is not a pool name", i, pool)
+			}
+		}
+	}
+
+	domains := make(map[string]Domain)
+	for i, domain := range m.Domains {
+		if domain.Name == "" || strings.ContainsAny(domain.Name, " /") {
+			fail("domains[%d].name: %q is not a domain name", i, domain.Name)
+		}
+		if _, ok := domains[domain.Name]; ok {
+			fail("domains[%d].name: %s is listed twice", i, domain.Name)
+		}
+		if domain.WebServer != "apache" && domain.WebServer != "nginx" {
+			fail("domains[%d].web_server: must be apache or nginx", i)
+		}
+		if domain.Hybrid && domain.WebServer != "nginx" {
+			fail("domains[%d].hybrid: needs web_server nginx, in front of apache", i)
+		}
+		if !filepath.IsAbs(domain.DocumentRoot) {
+			fail("domains[%d].document_root: %q must be an absolute path", i, domain.DocumentRoot)
+		}
+		if tls := domain.TLS; tls != nil && tls.Ciphers != "" && tls.Ciphers != actions.CiphersModern && tls.Ciphers != actions.CiphersIntermediate {
+			fail("domains[%d].tls.ciphers: must be %s or %s", i, actions.CiphersModern, actions.CiphersIntermediate)
+		}
+		domains[domain.Name] = domain
+	}
+
+	for i, cert := range m.Certificates {
+		if cert.Domain == "" {
+			fail("certificates[%d].domain: is required", i)
+		}
+		if !strings.Contains(cert.Email, "@") {
+			fail("certificates[%d].email: %q is not an email address", i, cert.Email)
+		}
+		if _, ok := domains[cert.Domain]; !ok && cert.Webroot == "" {
+			fail("certificates[%d].webroot: is required for %s, which is not in domains", i, cert.Domain)
+		}
+	}
+
+	for i, db := range m.Databases {
+		if !namePattern.MatchString(db.Name) {
+			fail("databases[%d].name: %q is not a database name", i, db.Name)
+		}
+		switch db.Type {
+		case "mysql", "mariadb", "postgresql":
+		default:
+			fail("databases[%d].type: must be mysql, mariadb or postgresql", i)
+		}
+		if !namePattern.MatchString(db.User) {
+			fail("databases[%d].user: %q is not a user name", i, db.User)
+		}
+		if db.Password != "" && db.PasswordEnv != "" {
+			fail("databases[%d]: set password or password_env, not both", i)
+		}
+	}
+
+	for i, job := range m.Cron {
+		if len(strings.Fields(job.Schedule)) != 5 {
+			fail("cron[%d].schedule: %q must have 5 fields", i, job.Schedule)
+		}
+		if job.Command == "" {
+			fail("cron[%d].command: is required", i)
+		}
+	}
+
+	for i, rule := range m.Firewall {
+		if rule.Protocol != "tcp" && rule.Protocol != "udp" {
+			fail("firewall[%d].protocol: must be tcp or udp", i)
+		}
+		if rule.Port != "" && !portPattern.MatchString(rule.Port) {
+			fail("firewall[%d].port: %q is not a port or range", i, rule.Port)
+		}
+		if rule.Action != "allow" && rule.Action != "deny" {
+			fail("firewall[%d].action: must be allow or deny", i)
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid manifest:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// password returns the database password, reading it from the
+// environment when password_env is set
+func (db Database) password() (string, error) {
+	if db.PasswordEnv == "" {
+		return db.Password, nil
+	}
+	password, ok := os.LookupEnv(db.PasswordEnv)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", db.PasswordEnv)
+	}
+	return password, nil
+}
@@ -0,0 +1,366 @@
+package manifest
+
+import (
+	"easygo/pkg/actions"
+	"easygo/pkg/state"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"reflect"
+	"strings"
+)
+
+// Change operations
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+)
+
+// Change is one step needed to bring the server to the manifest
+type Change struct {
+	Op     string `json:"op"`
+	Kind   string `json:"kind"` // php, pool, domain, certificate, database, cron, firewall
+	Name   string `json:"name"`
+	Detail string `json:"detail,omitempty"`
+
+	apply func() *actions.Result
+}
+
+// String describes the change on one line
+func (c *Change) String() string {
+	symbol := "+"
+	if c.Op == OpUpdate {
+		symbol = "~"
+	}
+	s := fmt.Sprintf("%s %s %s", symbol, c.Kind, c.Name)
+	if c.Detail != "" {
+		s += " (" + c.Detail + ")"
+	}
+	return s
+}
+
+// Plan is the list of changes that converge the server on a manifest, in
+// the order they must be applied
+type Plan struct {
+	Changes []*Change `json:"changes"`
+}
+
+// Empty reports whether the server already matches the manifest
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// Text renders the plan for humans
+func (p *Plan) Text() string {
+	if p.Empty() {
+		return "No changes. The server matches the manifest.\n"
+	}
+
+	var sb strings.Builder
+	counts := make(map[string]int)
+	for _, change := range p.Changes {
+		fmt.Fprintf(&sb, "  %s\n", change)
+		counts[change.Op]++
+	}
+	fmt.Fprintf(&sb, "Plan: %d to create, %d to update.\n", counts[OpCreate], counts[OpUpdate])
+	return sb.String()
+}
+
+// Apply makes the planned changes in order, calling progress after each.
+// It stops at the first failure; changes already made are kept, so
+// running apply again resumes where it stopped.
+func (p *Plan) Apply(progress func(change *Change, result *actions.Result)) *actions.Result {
+	for i, change := range p.Changes {
+		result := change.apply()
+		if progress != nil {
+			progress(change, result)
+		}
+		if !result.Success {
+			return &actions.Result{
+				Success: false,
+				Message: fmt.Sprintf("%s %s %s failed after %d of %d changes: %s", change.Op, change.Kind, change.Name, i, len(p.Changes), strings.TrimSpace(result.Message)),
+				Error:   result.Error,
+			}
+		}
+	}
+
+	return &actions.Result{
+		Success: true,
+		Message: fmt.Sprintf("Applied %d changes", len(p.Changes)),
+	}
+}
+
+// Planner compares a manifest with the server and works out the changes
+// needed to converge on it
+type Planner struct {
+	web      *actions.WebServerAction
+	php      *actions.PHPAction
+	database *actions.DatabaseAction
+	ssl      *actions.SSLAction
+	cron     *actions.CronAction
+	firewall *actions.FirewallAction
+}
+
+// NewPlanner creates a planner. prepare, when not nil, is applied to each
+// action the planner uses, e.g. to set its context or dry-run plan.
+func NewPlanner(prepare func(ba *actions.BaseAction)) *Planner {
+	p := &Planner{
+		web:      actions.NewWebServerAction(),
+		php:      actions.NewPHPAction(),
+		database: actions.NewDatabaseAction(),
+		ssl:      actions.NewSSLAction(),
+		cron:     actions.NewCronAction(),
+		firewall: actions.NewFirewallAction(),
+	}
+	if prepare != nil {
+		for _, ba := range []*actions.BaseAction{
+			&p.web.BaseAction, &p.php.BaseAction, &p.database.BaseAction,
+			&p.ssl.BaseAction, &p.cron.BaseAction, &p.firewall.BaseAction,
+		} {
+			prepare(ba)
+		}
+	}
+	return p
+}
+
+// Plan diffs the manifest against the server. Domains, pools and
+// databases are compared with the state store; PHP versions,
+// certificates, cron jobs and firewall rules with the system itself.
+// Resources that are not in the manifest are left alone.
+func (p *Planner) Plan(m *Manifest) (*Plan, error) {
+	store := p.web.Store()
+	if store == nil {
+		return nil, errors.New("the state store is unavailable; apply must run as root")
+	}
+
+	plan := &Plan{}
+	steps := []func(*Manifest, *state.Store, *Plan) error{
+		p.planPHP, p.planDomains, p.planCertificates, p.planDatabases, p.planCron, p.planFirewall,
+	}
+	for _, step := range steps {
+		if err := step(m, store, plan); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// planPHP installs missing PHP versions and configures missing pools
+func (p *Planner) planPHP(m *Manifest, store *state.Store, plan *Plan) error {
+	for _, php := range m.PHP {
+		version := php.Version
+		installed := p.php.LocalFileExists(p.php.Platform().PHPBinary(version))
+		if !installed {
+			plan.Changes = append(plan.Changes, &Change{
+				Op: OpCreate, Kind: "php", Name: version,
+				apply: func() *actions.Result { return p.php.InstallPHP(version) },
+			})
+		}
+
+		for _, pool := range php.Pools {
+			pool := pool
+			if installed {
+				exists, err := recorded(store.FPMPools().Get(version + "/" + pool))
+				if err != nil {
+					return err
+				}
+				if exists {
+					continue
+				}
+			}
+			plan.Changes = append(plan.Changes, &Change{
+				Op: OpCreate, Kind: "pool", Name: version + "/" + pool,
+				apply: func() *actions.Result { return p.php.ConfigurePHPFPM(version, pool) },
+			})
+		}
+	}
+	return nil
+}
+
+// planDomains creates missing virtual hosts and rewrites those whose
+// document root, template, variables, proxy settings, hybrid mode or
+// HTTPS settings differ. HTTPS settings wait for the domain's
+// certificate, which planCertificates applies them with; without any, a
+// vhost keeps those it has.
+func (p *Planner) planDomains(m *Manifest, store *state.Store, plan *Plan) error {
+	for _, domain := range m.Domains {
+		domain := domain
+		template := domain.Template
+		if template == "" {
+			template = actions.DefaultVhostTemplate
+			if domain.Proxy != nil {
+				template = actions.ProxyVhostTemplate
+			}
+		}
+		settings := domain.TLS
+		if settings != nil && !p.ssl.HasCertificate(domain.Name) {
+			settings = nil
+		}
+		change := &Change{
+			Op: OpCreate, Kind: "domain", Name: domain.Name,
+			Detail: domain.WebServer + ", " + domain.DocumentRoot + ", " + template,
+			apply: func() *actions.Result {
+				return p.web.ConfigureVhost(domain.WebServer, domain.Name, domain.DocumentRoot, &actions.VhostOptions{
+					Template: template,
+					Vars:     domain.Vars,
+					Proxy:    domain.Proxy,
+					Hybrid:   domain.Hybrid,
+					TLS:      settings,
+				})
+			},
+		}
+		if settings != nil {
+			change.Detail += ", https"
+		}
+
+		current, err := store.Domains().Get((&state.Domain{Name: domain.Name, WebServer: domain.WebServer}).Key())
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return err
+		default:
+			var diffs []string
+			if current.DocumentRoot != domain.DocumentRoot {
+				diffs = append(diffs, fmt.Sprintf("document_root %s -> %s", current.DocumentRoot, domain.DocumentRoot))
+			}
+			currentTemplate := current.Template
+			if currentTemplate == "" {
+				currentTemplate = actions.DefaultVhostTemplate
+			}
+			if currentTemplate != template {
+				diffs = append(diffs, fmt.Sprintf("template %s -> %s", currentTemplate, template))
+			}
+			if !maps.Equal(current.Vars, domain.Vars) {
+				diffs = append(diffs, "vars")
+			}
+			if !reflect.DeepEqual(current.Proxy, domain.Proxy) {
+				diffs = append(diffs, "proxy")
+			}
+			if current.Hybrid != domain.Hybrid {
+				diffs = append(diffs, fmt.Sprintf("hybrid %t -> %t", current.Hybrid, domain.Hybrid))
+			}
+			if settings != nil && !reflect.DeepEqual(current.TLS, settings) {
+				diffs = append(diffs, "tls")
+			}
+			if len(diffs) == 0 {
+				continue
+			}
+			change.Op = OpUpdate
+			change.Detail = strings.Join(diffs, ", ")
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+	return nil
+}
+
+// planCertificates issues missing certificates, which switches their
+// domains' vhosts to HTTPS with the domains' HTTPS settings
+func (p *Planner) planCertificates(m *Manifest, store *state.Store, plan *Plan) error {
+	for _, cert := range m.Certificates {
+		if p.ssl.HasCertificate(cert.Domain) {
+			continue
+		}
+
+		cert := cert
+		var site *Domain
+		for i, domain := range m.Domains {
+			if domain.Name == cert.Domain {
+				site = &m.Domains[i]
+			}
+		}
+		if cert.Webroot == "" && site != nil {
+			cert.Webroot = site.DocumentRoot
+		}
+		plan.Changes = append(plan.Changes, &Change{
+			Op: OpCreate, Kind: "certificate", Name: cert.Domain,
+			apply: func() *actions.Result {
+				result := p.ssl.IssueCertificate(cert.Domain, cert.Email, cert.Webroot)
+				if !result.Success || site == nil || site.TLS == nil {
+					return result
+				}
+				return p.web.ConfigureVhost(site.WebServer, site.Name, site.DocumentRoot, &actions.VhostOptions{TLS: site.TLS})
+			},
+		})
+	}
+	return nil
+}
+
+// planDatabases creates missing databases
+func (p *Planner) planDatabases(m *Manifest, store *state.Store, plan *Plan) error {
+	for _, db := range m.Databases {
+		exists, err := recorded(store.Databases().Get((&state.Database{Name: db.Name, Type: db.Type}).Key()))
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		db := db
+		password, err := db.password()
+		if err != nil {
+			return &actions.Error{Kind: actions.ErrValidationFailed, Msg: "database " + db.Name, Err: err}
+		}
+		plan.Changes = append(plan.Changes, &Change{
+			Op: OpCreate, Kind: "database", Name: db.Type + "/" + db.Name,
+			Detail: "user " + db.User,
+			apply:  func() *actions.Result { return p.database.CreateDatabase(db.Name, db.Type, db.User, password) },
+		})
+	}
+	return nil
+}
+
+// planCron adds cron jobs missing from the crontab
+func (p *Planner) planCron(m *Manifest, store *state.Store, plan *Plan) error {
+	entries := make(map[string]bool)
+	if current := p.cron.ListCronJobs(); current.Success {
+		for _, line := range strings.Split(current.Message, "\n") {
+			entries[strings.TrimSpace(line)] = true
+		}
+	}
+
+	for _, job := range m.Cron {
+		if entries[job.Schedule+" "+job.Command] {
+			continue
+		}
+
+		job := job
+		plan.Changes = append(plan.Changes, &Change{
+			Op: OpCreate, Kind: "cron", Name: job.Schedule + " " + job.Command,
+			apply: func() *actions.Result { return p.cron.AddCronJob(job.Schedule, job.Command, job.Description) },
+		})
+	}
+	return nil
+}
+
+// planFirewall adds missing firewall rules
+func (p *Planner) planFirewall(m *Manifest, store *state.Store, plan *Plan) error {
+	for _, rule := range m.Firewall {
+		if p.firewall.HasRule(rule.Protocol, rule.Port, rule.Source, rule.Action) {
+			continue
+		}
+
+		rule := rule
+		name := rule.Action + " " + rule.Protocol
+		if rule.Port != "" {
+			name += "/" + rule.Port
+		}
+		if rule.Source != "" {
+			name += " from " + rule.Source
+		}
+		plan.Changes = append(plan.Changes, &Change{
+			Op: OpCreate, Kind: "firewall", Name: name,
+			apply: func() *actions.Result { return p.firewall.AddRule(rule.Protocol, rule.Port, rule.Source, rule.Action) },
+		})
+	}
+	return nil
+}
+
+// recorded reports whether a state store lookup found a record
+func recorded[T any](_ T, err error) (bool, error) {
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,31 @@
+package plugins
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// RegisterFunc is the function a Go plugin exports as Register. Go
+// plugins must be built with the same Go version and module versions as
+// EasyGo itself:
+//
+//	go build -buildmode=plugin -o /opt/easygo/plugins/myplugin.so .
+type RegisterFunc = func(reg *Registrar) error
+
+// loadGoPlugin opens a Go plugin and calls its Register function
+func (r *Registry) loadGoPlugin(path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return err
+	}
+	symbol, err := p.Lookup("Register")
+	if err != nil {
+		return err
+	}
+	register, ok := symbol.(RegisterFunc)
+	if !ok {
+		return fmt.Errorf("Register is %T, want func(*plugins.Registrar) error", symbol)
+	}
+
+	return r.Register(&Plugin{Name: pluginName(path), Kind: KindGo, Path: path}, register)
+}
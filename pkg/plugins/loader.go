@@ -0,0 +1,95 @@
+package plugins
+
+import (
+	"easygo/pkg/actions"
+	"easygo/pkg/config"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// Dir returns the configured plugin directory
+func Dir() string {
+	return config.Current().Paths.Plugins
+}
+
+// LoadDir loads every plugin in dir: .so files as Go plugins and other
+// executables as process plugins. Hidden files and files that are not
+// executable are skipped. A plugin that fails to load is reported and the
+// others are still loaded. A missing directory loads nothing.
+func (r *Registry) LoadDir(dir string) []error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return []error{err}
+	}
+	if err := checkOwnership(dir); err != nil {
+		return []error{err}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	var errs []error
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		isGo := filepath.Ext(name) == ".so"
+		if !isGo && info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		if err := checkOwnership(path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if isGo {
+			err = r.loadGoPlugin(path)
+		} else {
+			err = r.loadProcessPlugin(path)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	return errs
+}
+
+// checkOwnership refuses plugins that someone other than root or the
+// current user could have replaced, since they run with EasyGo's privileges
+func checkOwnership(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0002 != 0 {
+		return &actions.Error{Kind: actions.ErrPermissionDenied, Msg: fmt.Sprintf("%s is world-writable, refusing to load plugins from it", path)}
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		if uid := int(stat.Uid); uid != 0 && uid != os.Getuid() {
+			return &actions.Error{Kind: actions.ErrPermissionDenied, Msg: fmt.Sprintf("%s is owned by uid %d, refusing to load plugins from it", path, uid)}
+		}
+	}
+	return nil
+}
+
+// pluginName derives a plugin's default name from its file name
+func pluginName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
@@ -0,0 +1,342 @@
+// Package plugins lets third-party modules extend EasyGo with new actions,
+// CLI commands, panel pages and API routes. A plugin is either a Go plugin
+// (.so) exporting a Register function, or an executable that speaks JSON
+// over stdin and stdout.
+package plugins
+
+import (
+	"easygo/pkg/actions"
+	"fmt"
+	"html/template"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/cobra"
+)
+
+// Plugin kinds
+const (
+	KindGo      = "go"
+	KindProcess = "process"
+)
+
+// Plugin describes a loaded plugin
+type Plugin struct {
+	Name        string `json:"name"`
+	Version     string `json:"version,omitempty"`
+	Description string `json:"description,omitempty"`
+	Kind        string `json:"kind"`
+	Path        string `json:"path"`
+}
+
+// Request is one invocation of a plugin action or page
+type Request struct {
+	// Base carries the context, dry-run plan and owner of the invocation.
+	// Go plugins can run their commands through it.
+	Base   *actions.BaseAction
+	Params map[string]string
+}
+
+// Action is an action type a plugin provides
+type Action struct {
+	Plugin      string   `json:"plugin"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Params      []string `json:"params,omitempty"`
+
+	Run func(req *Request) *actions.Result `json:"-"`
+}
+
+// FullName returns the action name qualified by its plugin, e.g. hello.greet
+func (a *Action) FullName() string {
+	return a.Plugin + "." + a.Name
+}
+
+// Command is a CLI command that runs a plugin action. Positional
+// arguments fill the named params in order; the action's other params
+// become flags.
+type Command struct {
+	Plugin string   `json:"plugin"`
+	Name   string   `json:"name"`
+	Short  string   `json:"short,omitempty"`
+	Action string   `json:"action"`
+	Args   []string `json:"args,omitempty"`
+}
+
+// Page is a panel page rendered by a plugin, served at
+// /panel/plugins/<plugin><path>
+type Page struct {
+	Plugin string `json:"plugin"`
+	Path   string `json:"path"`
+	Title  string `json:"title"`
+
+	Render func(req *Request) (template.HTML, error) `json:"-"`
+}
+
+// URL returns the panel URL of the page
+func (p *Page) URL() string {
+	return "/panel/plugins/" + p.Plugin + p.Path
+}
+
+// Route is an API route that runs a plugin action, served under
+// /panel/api/plugins/<plugin>. Path variables and form values become the
+// action's params.
+type Route struct {
+	Plugin string `json:"plugin"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Action string `json:"action"`
+}
+
+// Registry holds everything plugins have registered
+type Registry struct {
+	mu            sync.RWMutex
+	plugins       []*Plugin
+	actions       map[string]*Action
+	commands      []*Command
+	cobraCommands []*cobra.Command
+	pages         []*Page
+	routes        []*Route
+	routers       map[string][]func(router *mux.Router)
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		actions: make(map[string]*Action),
+		routers: make(map[string][]func(router *mux.Router)),
+	}
+}
+
+// Default is the registry the CLI and web panel load plugins into
+var Default = NewRegistry()
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Register adds a plugin through its register function. Nothing the
+// plugin registered is kept when register fails.
+func (r *Registry) Register(plugin *Plugin, register func(reg *Registrar) error) error {
+	if !namePattern.MatchString(plugin.Name) {
+		return &actions.Error{Kind: actions.ErrValidationFailed, Msg: fmt.Sprintf("invalid plugin name %q", plugin.Name)}
+	}
+
+	r.mu.RLock()
+	for _, p := range r.plugins {
+		if p.Name == plugin.Name {
+			r.mu.RUnlock()
+			return &actions.Error{Kind: actions.ErrConflict, Msg: fmt.Sprintf("plugin %s is already loaded from %s", p.Name, p.Path)}
+		}
+	}
+	r.mu.RUnlock()
+
+	reg := &Registrar{plugin: plugin, actions: make(map[string]*Action)}
+	if err := register(reg); err != nil {
+		return fmt.Errorf("plugin %s: %w", plugin.Name, err)
+	}
+	if err := reg.check(); err != nil {
+		return fmt.Errorf("plugin %s: %w", plugin.Name, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.plugins = append(r.plugins, plugin)
+	for name, action := range reg.actions {
+		r.actions[name] = action
+	}
+	r.commands = append(r.commands, reg.commands...)
+	r.cobraCommands = append(r.cobraCommands, reg.cobraCommands...)
+	r.pages = append(r.pages, reg.pages...)
+	r.routes = append(r.routes, reg.routes...)
+	r.routers[plugin.Name] = append(r.routers[plugin.Name], reg.routers...)
+	return nil
+}
+
+// Plugins returns the loaded plugins in load order
+func (r *Registry) Plugins() []*Plugin {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]*Plugin(nil), r.plugins...)
+}
+
+// Actions returns every plugin action, sorted by full name
+func (r *Registry) Actions() []*Action {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]*Action, 0, len(r.actions))
+	for _, action := range r.actions {
+		list = append(list, action)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].FullName() < list[j].FullName()
+	})
+	return list
+}
+
+// Action looks up an action by its full name, e.g. hello.greet
+func (r *Registry) Action(name string) (*Action, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	action, ok := r.actions[name]
+	return action, ok
+}
+
+// Commands returns the commands that run plugin actions
+func (r *Registry) Commands() []*Command {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]*Command(nil), r.commands...)
+}
+
+// CobraCommands returns the commands Go plugins built themselves
+func (r *Registry) CobraCommands() []*cobra.Command {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]*cobra.Command(nil), r.cobraCommands...)
+}
+
+// Pages returns the plugin panel pages
+func (r *Registry) Pages() []*Page {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]*Page(nil), r.pages...)
+}
+
+// Routes returns the API routes that run plugin actions
+func (r *Registry) Routes() []*Route {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]*Route(nil), r.routes...)
+}
+
+// Routers returns, per plugin, the functions Go plugins use to add their
+// own handlers to the API router
+func (r *Registry) Routers() map[string][]func(router *mux.Router) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	routers := make(map[string][]func(router *mux.Router), len(r.routers))
+	for name, setups := range r.routers {
+		routers[name] = append(([]func(router *mux.Router))(nil), setups...)
+	}
+	return routers
+}
+
+// Registrar is the handle a plugin registers its extensions through
+type Registrar struct {
+	plugin        *Plugin
+	actions       map[string]*Action
+	commands      []*Command
+	cobraCommands []*cobra.Command
+	pages         []*Page
+	routes        []*Route
+	routers       []func(router *mux.Router)
+}
+
+// Plugin returns the plugin being registered, so it can set its version
+// and description
+func (reg *Registrar) Plugin() *Plugin {
+	return reg.plugin
+}
+
+// RegisterAction adds an action type
+func (reg *Registrar) RegisterAction(action Action) error {
+	if !namePattern.MatchString(action.Name) {
+		return fmt.Errorf("invalid action name %q", action.Name)
+	}
+	if action.Run == nil {
+		return fmt.Errorf("action %s has no Run function", action.Name)
+	}
+	action.Plugin = reg.plugin.Name
+	if _, ok := reg.actions[action.FullName()]; ok {
+		return fmt.Errorf("action %s is registered twice", action.Name)
+	}
+
+	// Plugin actions run hooks like built-in ones, named e.g. hello.greet
+	run, name := action.Run, action.FullName()
+	action.Run = func(req *Request) (res *actions.Result) {
+		hook := req.Base.Hook(name, req.Params)
+		if failed := hook.Pre(); failed != nil {
+			return failed
+		}
+		defer hook.Post(&res)
+
+		return run(req)
+	}
+	reg.actions[action.FullName()] = &action
+	return nil
+}
+
+// RegisterCommand adds a CLI command that runs one of the plugin's actions
+func (reg *Registrar) RegisterCommand(command Command) error {
+	if !namePattern.MatchString(command.Name) {
+		return fmt.Errorf("invalid command name %q", command.Name)
+	}
+	command.Plugin = reg.plugin.Name
+	reg.commands = append(reg.commands, &command)
+	return nil
+}
+
+// RegisterCobraCommand adds a command built by a Go plugin under the root
+// command
+func (reg *Registrar) RegisterCobraCommand(cmd *cobra.Command) {
+	reg.cobraCommands = append(reg.cobraCommands, cmd)
+}
+
+// RegisterPage adds a panel page
+func (reg *Registrar) RegisterPage(page Page) error {
+	if !strings.HasPrefix(page.Path, "/") {
+		return fmt.Errorf("page path %q must start with /", page.Path)
+	}
+	if page.Render == nil {
+		return fmt.Errorf("page %s has no Render function", page.Path)
+	}
+	page.Plugin = reg.plugin.Name
+	reg.pages = append(reg.pages, &page)
+	return nil
+}
+
+// RegisterRoute adds an API route that runs one of the plugin's actions
+func (reg *Registrar) RegisterRoute(route Route) error {
+	if !strings.HasPrefix(route.Path, "/") {
+		return fmt.Errorf("route path %q must start with /", route.Path)
+	}
+	if route.Method == "" {
+		route.Method = "POST"
+	}
+	route.Plugin = reg.plugin.Name
+	reg.routes = append(reg.routes, &route)
+	return nil
+}
+
+// RegisterRoutes lets a Go plugin add its own handlers to the router
+// mounted at /panel/api/plugins/<plugin>
+func (reg *Registrar) RegisterRoutes(setup func(router *mux.Router)) {
+	reg.routers = append(reg.routers, setup)
+}
+
+// check verifies that commands and routes name actions the plugin
+// registered
+func (reg *Registrar) check() error {
+	for _, command := range reg.commands {
+		if _, ok := reg.actions[reg.plugin.Name+"."+command.Action]; !ok {
+			return fmt.Errorf("command %s runs unknown action %q", command.Name, command.Action)
+		}
+	}
+	for _, route := range reg.routes {
+		if _, ok := reg.actions[reg.plugin.Name+"."+route.Action]; !ok {
+			return fmt.Errorf("route %s %s runs unknown action %q", route.Method, route.Path, route.Action)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"easygo/pkg/actions"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Process plugins are executables run once per request. EasyGo writes one
+// JSON request to the plugin's stdin and reads one JSON response from its
+// stdout; stderr is kept for error reports. A describe request:
+//
+//	{"method": "describe"}
+//
+// is answered with the plugin's descriptor, and an invoke request:
+//
+//	{"method": "invoke", "action": "greet", "params": {"name": "Ada"}, "dry_run": false, "user": "admin"}
+//
+// with the action's result.
+
+// Timeouts for process plugin requests
+const (
+	describeTimeout = 10 * time.Second
+	invokeTimeout   = 10 * time.Minute
+)
+
+// processRequest is a request sent to a process plugin
+type processRequest struct {
+	Method string            `json:"method"` // describe, invoke
+	Action string            `json:"action,omitempty"`
+	Params map[string]string `json:"params,omitempty"`
+	DryRun bool              `json:"dry_run,omitempty"`
+	User   string            `json:"user,omitempty"`
+}
+
+// descriptor is a process plugin's answer to describe
+type descriptor struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	Actions     []struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Params      []string `json:"params"`
+	} `json:"actions"`
+	Commands []Command `json:"commands"`
+	Pages    []struct {
+		Path   string `json:"path"`
+		Title  string `json:"title"`
+		Action string `json:"action"`
+	} `json:"pages"`
+	Routes []Route `json:"routes"`
+}
+
+// processResponse is a process plugin's answer to invoke
+type processResponse struct {
+	Success bool                       `json:"success"`
+	Message string                     `json:"message"`
+	Data    json.RawMessage            `json:"data,omitempty"`
+	HTML    string                     `json:"html,omitempty"` // page content
+	Plan    []actions.PlannedOperation `json:"plan,omitempty"` // operations planned in a dry run
+	Error   *struct {
+		Code    string `json:"code"` // an error code such as not_found
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// processPlugin runs a plugin executable
+type processPlugin struct {
+	path string
+}
+
+// loadProcessPlugin asks an executable to describe itself and registers
+// what it provides
+func (r *Registry) loadProcessPlugin(path string) error {
+	p := &processPlugin{path: path}
+	ctx, cancel := context.WithTimeout(context.Background(), describeTimeout)
+	defer cancel()
+
+	var desc descriptor
+	if err := p.call(ctx, &processRequest{Method: "describe"}, &desc); err != nil {
+		return err
+	}
+	if desc.Name == "" {
+		desc.Name = pluginName(path)
+	}
+
+	plugin := &Plugin{
+		Name:        desc.Name,
+		Version:     desc.Version,
+		Description: desc.Description,
+		Kind:        KindProcess,
+		Path:        path,
+	}
+	return r.Register(plugin, func(reg *Registrar) error {
+		for _, a := range desc.Actions {
+			name := a.Name
+			err := reg.RegisterAction(Action{
+				Name:        name,
+				Description: a.Description,
+				Params:      a.Params,
+				Run: func(req *Request) *actions.Result {
+					return p.invoke(name, req)
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		for _, command := range desc.Commands {
+			if err := reg.RegisterCommand(command); err != nil {
+				return err
+			}
+		}
+		for _, page := range desc.Pages {
+			action := page.Action
+			err := reg.RegisterPage(Page{
+				Path:  page.Path,
+				Title: page.Title,
+				Render: func(req *Request) (template.HTML, error) {
+					return p.render(action, req)
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		for _, route := range desc.Routes {
+			if err := reg.RegisterRoute(route); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// invoke runs an action in the plugin process
+func (p *processPlugin) invoke(action string, req *Request) *actions.Result {
+	response, err := p.request(action, req)
+	if err != nil {
+		return &actions.Result{
+			Success: false,
+			Message: fmt.Sprintf("Plugin action %s failed", action),
+			Error:   err,
+		}
+	}
+	req.Base.AddPlanned(response.Plan...)
+
+	result := &actions.Result{
+		Success: response.Success,
+		Message: response.Message,
+	}
+	if len(response.Data) > 0 {
+		result.Data = response.Data
+	}
+	if !response.Success {
+		result.Error = response.err()
+	}
+	return result
+}
+
+// render runs a page's action and returns the HTML it produced
+func (p *processPlugin) render(action string, req *Request) (template.HTML, error) {
+	response, err := p.request(action, req)
+	if err != nil {
+		return "", err
+	}
+	if !response.Success {
+		return "", response.err()
+	}
+	// Plugins are trusted like the panel itself, so their HTML is not escaped
+	return template.HTML(response.HTML), nil
+}
+
+// request sends an invoke request for an action
+func (p *processPlugin) request(action string, req *Request) (*processResponse, error) {
+	ctx := req.Base.Context()
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, invokeTimeout)
+		defer cancel()
+	}
+
+	response := &processResponse{}
+	err := p.call(ctx, &processRequest{
+		Method: "invoke",
+		Action: action,
+		Params: req.Params,
+		DryRun: req.Base.DryRun(),
+		User:   req.Base.Owner(),
+	}, response)
+	return response, err
+}
+
+// call runs the plugin with one request and decodes its response
+func (p *processPlugin) call(ctx context.Context, req *processRequest, response interface{}) error {
+	input, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, p.path)
+	cmd.WaitDelay = 5 * time.Second
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		commandErr := &actions.CommandError{Command: p.path + " " + req.Method, ExitCode: -1, Stderr: strings.TrimSpace(stderr.String()), Err: err}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.Exited() {
+			commandErr.ExitCode = exitErr.ExitCode()
+		}
+		return commandErr
+	}
+	if err := json.Unmarshal(stdout.Bytes(), response); err != nil {
+		return fmt.Errorf("invalid response to %s: %w", req.Method, err)
+	}
+	return nil
+}
+
+// err converts the error a plugin reported, keeping its kind
+func (r *processResponse) err() error {
+	msg := r.Message
+	var kind error
+	if r.Error != nil {
+		kind = actions.KindForCode(r.Error.Code)
+		if r.Error.Message != "" {
+			msg = r.Error.Message
+		}
+	}
+	if msg == "" {
+		msg = "plugin action failed"
+	}
+	return &actions.Error{Kind: kind, Msg: msg}
+}
@@ -0,0 +1,136 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// AuditEntry records an administrative action. Each entry holds the hash
+// of the one before it, so removing or changing an entry breaks the chain.
+// The hashes are keyed, with a key kept out of the store.
+type AuditEntry struct {
+	Seq        uint64            `json:"seq"`
+	Time       time.Time         `json:"time"`
+	User       string            `json:"user,omitempty"`
+	Source     string            `json:"source,omitempty"`    // client address
+	Interface  string            `json:"interface,omitempty"` // cli or web
+	Action     string            `json:"action"`
+	Params     map[string]string `json:"params,omitempty"`
+	Success    bool              `json:"success"`
+	Message    string            `json:"message,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	ErrorCode  string            `json:"error_code,omitempty"`
+	DurationMS int64             `json:"duration_ms"`
+	PrevHash   string            `json:"prev_hash"`
+	Hash       string            `json:"hash"`
+}
+
+// AuditLog is the append-only log of audit entries
+type AuditLog struct {
+	store *Store
+}
+
+// AuditLog returns the audit log
+func (s *Store) AuditLog() *AuditLog {
+	return &AuditLog{store: s}
+}
+
+// Append adds an entry after the last one. seal is called in the same
+// transaction with the last entry, or nil for the first, to number the new
+// entry and link it to the chain.
+func (l *AuditLog) Append(entry *AuditEntry, seal func(entry, last *AuditEntry) error) error {
+	return l.store.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketAudit))
+
+		var last *AuditEntry
+		if seq := bucket.Sequence(); seq > 0 {
+			if data := bucket.Get(auditKey(seq)); data != nil {
+				last = &AuditEntry{}
+				if err := json.Unmarshal(data, last); err != nil {
+					return fmt.Errorf("audit entry %d: %w", seq, err)
+				}
+			}
+		}
+
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		entry.Seq = seq
+		if err := seal(entry, last); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(auditKey(seq), data)
+	})
+}
+
+// Rewrite passes the entries, in order, and the sequence number of the
+// last one appended to change in one transaction, and stores the entries
+// again when change reports that it changed them. It is for resealing the
+// chain, e.g. with a new key.
+func (l *AuditLog) Rewrite(change func(entries []*AuditEntry, last uint64) (bool, error)) error {
+	return l.store.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketAudit))
+
+		var entries []*AuditEntry
+		err := bucket.ForEach(func(k, v []byte) error {
+			entry := &AuditEntry{}
+			if err := json.Unmarshal(v, entry); err != nil {
+				return fmt.Errorf("audit entry %s: %w", k, err)
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		changed, err := change(entries, bucket.Sequence())
+		if err != nil || !changed {
+			return err
+		}
+		for _, entry := range entries {
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(auditKey(entry.Seq), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// List returns the entries in order and the sequence number of the last
+// one appended
+func (l *AuditLog) List() ([]*AuditEntry, uint64, error) {
+	var entries []*AuditEntry
+	var last uint64
+	err := l.store.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketAudit))
+		last = bucket.Sequence()
+		return bucket.ForEach(func(k, v []byte) error {
+			entry := &AuditEntry{}
+			if err := json.Unmarshal(v, entry); err != nil {
+				return fmt.Errorf("audit entry %s: %w", k, err)
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	return entries, last, err
+}
+
+// auditKey zero-pads the sequence number so keys sort in order
+func auditKey(seq uint64) []byte {
+	return []byte(fmt.Sprintf("%020d", seq))
+}
@@ -0,0 +1,271 @@
+package state
+
+import "time"
+
+// Bucket names, one per record type
+const (
+	bucketDomains      = "domains"
+	bucketDatabases    = "databases"
+	bucketBackupJobs   = "backup_jobs"
+	bucketCronJobs     = "cron_jobs"
+	bucketFPMPools     = "fpm_pools"
+	bucketCertificates = "certificates"
+	bucketManagedFiles = "managed_files"
+	bucketDeliveries   = "webhook_deliveries"
+	bucketJobs         = "jobs"
+	bucketAudit        = "audit"
+)
+
+var buckets = []string{bucketDomains, bucketDatabases, bucketBackupJobs, bucketCronJobs, bucketFPMPools, bucketCertificates, bucketManagedFiles, bucketDeliveries, bucketJobs, bucketAudit}
+
+// Domain is a site with a virtual host
+type Domain struct {
+	Name         string            `json:"name"`
+	DocumentRoot string            `json:"document_root"`
+	WebServer    string            `json:"web_server"` // apache, nginx
+	ConfigPath   string            `json:"config_path"`
+	Enabled      bool              `json:"enabled"`
+	Template     string            `json:"template,omitempty"` // vhost template, the default when empty
+	Vars         map[string]string `json:"vars,omitempty"`     // template variables
+	Proxy        *Proxy            `json:"proxy,omitempty"`    // reverse proxy settings of proxy templates
+	Hybrid       bool              `json:"hybrid,omitempty"`   // Nginx in front of Apache, rendered from Template
+	TLS          *TLS              `json:"tls,omitempty"`      // HTTPS settings; plain HTTP only when nil
+	Meta
+}
+
+// Proxy configures a reverse-proxy virtual host: the backends requests are
+// balanced over and how they are passed on. Timeouts are in seconds, 0 for
+// the web server's default.
+type Proxy struct {
+	Backends       []string `json:"backends" yaml:"backends"`                   // host:port or unix:/path
+	Method         string   `json:"method,omitempty" yaml:"method"`             // round_robin, least_conn, ip_hash or random
+	MaxFails       int      `json:"max_fails,omitempty" yaml:"max_fails"`       // failed attempts before a backend is skipped
+	FailTimeout    int      `json:"fail_timeout,omitempty" yaml:"fail_timeout"` // how long it is skipped
+	Websocket      bool     `json:"websocket,omitempty" yaml:"websocket"`       // pass Upgrade requests on
+	ConnectTimeout int      `json:"connect_timeout,omitempty" yaml:"connect_timeout"`
+	ReadTimeout    int      `json:"read_timeout,omitempty" yaml:"read_timeout"`
+	SendTimeout    int      `json:"send_timeout,omitempty" yaml:"send_timeout"`
+	Unbuffered     bool     `json:"unbuffered,omitempty" yaml:"unbuffered"` // stream responses as they arrive
+	Cache          string   `json:"cache,omitempty" yaml:"cache"`           // how long to cache responses, e.g. 10m; empty for none
+}
+
+// TLS configures the HTTPS side of a virtual host, served with the domain's
+// certificate. The zero value is the default: intermediate ciphers, plain
+// HTTP redirected to HTTPS and HTTP/2.
+type TLS struct {
+	Ciphers      string `json:"ciphers,omitempty" yaml:"ciphers"`             // modern (TLS 1.3 only) or intermediate
+	NoRedirect   bool   `json:"no_redirect,omitempty" yaml:"no_redirect"`     // serve plain HTTP too instead of redirecting
+	NoHTTP2      bool   `json:"no_http2,omitempty" yaml:"no_http2"`           // HTTP/1.1 only
+	HSTS         bool   `json:"hsts,omitempty" yaml:"hsts"`                   // send Strict-Transport-Security
+	OCSPStapling bool   `json:"ocsp_stapling,omitempty" yaml:"ocsp_stapling"` // staple the CA's OCSP responses
+}
+
+// Key identifies the domain within its web server, which may each have a
+// vhost for it
+func (d *Domain) Key() string {
+	return d.WebServer + "/" + d.Name
+}
+
+// Database is a database and its owning user
+type Database struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // mysql, mariadb, postgresql
+	User string `json:"user"`
+	Meta
+}
+
+// Key identifies the database within its server type
+func (d *Database) Key() string {
+	return d.Type + "/" + d.Name
+}
+
+// BackupJob is a backup EasyGo created or runs on a schedule
+type BackupJob struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Type        string    `json:"type"` // files, database, full
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Schedule    string    `json:"schedule,omitempty"`
+	Enabled     bool      `json:"enabled"`
+	LastRun     time.Time `json:"last_run"`
+	Status      string    `json:"status"`
+	Meta
+}
+
+// Key returns the job ID
+func (b *BackupJob) Key() string {
+	return b.ID
+}
+
+// SetID assigns the job ID
+func (b *BackupJob) SetID(id string) {
+	b.ID = id
+}
+
+// CronJob is a crontab entry added through EasyGo
+type CronJob struct {
+	ID          string    `json:"id"`
+	Schedule    string    `json:"schedule"`
+	Command     string    `json:"command"`
+	User        string    `json:"user"`
+	Description string    `json:"description,omitempty"`
+	Enabled     bool      `json:"enabled"`
+	LastRun     time.Time `json:"last_run,omitempty"`
+	NextRun     time.Time `json:"next_run,omitempty"`
+	Meta
+}
+
+// Key returns the job ID
+func (c *CronJob) Key() string {
+	return c.ID
+}
+
+// SetID assigns the job ID
+func (c *CronJob) SetID(id string) {
+	c.ID = id
+}
+
+// FPMPool is a PHP-FPM pool
+type FPMPool struct {
+	Name       string `json:"name"`
+	PHPVersion string `json:"php_version"`
+	Socket     string `json:"socket"`
+	ConfigPath string `json:"config_path"`
+	Meta
+}
+
+// Key identifies the pool within its PHP version
+func (p *FPMPool) Key() string {
+	return p.PHPVersion + "/" + p.Name
+}
+
+// Certificate is a TLS certificate issued for, or uploaded to, a domain
+type Certificate struct {
+	Domain   string    `json:"domain"`
+	Path     string    `json:"path"`               // certificate chain
+	KeyPath  string    `json:"key_path,omitempty"` // private key, privkey.pem next to Path when empty
+	Source   string    `json:"source,omitempty"`   // letsencrypt, the default, or uploaded
+	NotAfter time.Time `json:"not_after"`
+	Meta
+}
+
+// Key returns the certificate's domain
+func (c *Certificate) Key() string {
+	return c.Domain
+}
+
+// ManagedFile is a file written by EasyGo, with the hash of the content
+// it last wrote
+type ManagedFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+	Meta
+}
+
+// Key returns the file's path
+func (f *ManagedFile) Key() string {
+	return f.Path
+}
+
+// WebhookDelivery is an event sent, or to be sent, to a webhook endpoint
+type WebhookDelivery struct {
+	ID          string    `json:"id"`
+	EventID     string    `json:"event_id"`
+	EventType   string    `json:"event_type"`
+	URL         string    `json:"url"`
+	Payload     string    `json:"payload"`
+	Status      string    `json:"status"` // pending, delivering, delivered, failed
+	Attempts    int       `json:"attempts"`
+	StatusCode  int       `json:"status_code,omitempty"` // of the last attempt
+	LastError   string    `json:"last_error,omitempty"`
+	NextAttempt time.Time `json:"next_attempt,omitempty"` // when delivering, when the claim expires
+	DeliveredAt time.Time `json:"delivered_at,omitempty"`
+	Meta
+}
+
+// Key returns the delivery ID
+func (d *WebhookDelivery) Key() string {
+	return d.ID
+}
+
+// SetID assigns the delivery ID
+func (d *WebhookDelivery) SetID(id string) {
+	d.ID = id
+}
+
+// Job is a long-running operation queued in the web panel. The user who
+// queued it is the owner and its parameters are kept in Params.
+type Job struct {
+	ID         string    `json:"id"`
+	Kind       string    `json:"kind"` // e.g. uninstall, backup-full
+	Title      string    `json:"title"`
+	Status     string    `json:"status"`   // queued, running, succeeded, failed, cancelled
+	Progress   int       `json:"progress"` // percent
+	Step       string    `json:"step,omitempty"`
+	Log        []string  `json:"log,omitempty"`
+	LogDropped int       `json:"log_dropped,omitempty"` // lines cut from the start of a long log
+	Source     string    `json:"source,omitempty"`      // address of the client that queued it
+	Message    string    `json:"message,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	ErrorCode  string    `json:"error_code,omitempty"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Meta
+}
+
+// Key returns the job ID
+func (j *Job) Key() string {
+	return j.ID
+}
+
+// SetID assigns the job ID
+func (j *Job) SetID(id string) {
+	j.ID = id
+}
+
+// Domains returns the domain repository
+func (s *Store) Domains() *Repository[*Domain] {
+	return &Repository[*Domain]{store: s, bucket: bucketDomains, new: func() *Domain { return &Domain{} }}
+}
+
+// Databases returns the database repository
+func (s *Store) Databases() *Repository[*Database] {
+	return &Repository[*Database]{store: s, bucket: bucketDatabases, new: func() *Database { return &Database{} }}
+}
+
+// BackupJobs returns the backup job repository
+func (s *Store) BackupJobs() *Repository[*BackupJob] {
+	return &Repository[*BackupJob]{store: s, bucket: bucketBackupJobs, new: func() *BackupJob { return &BackupJob{} }}
+}
+
+// CronJobs returns the cron job repository
+func (s *Store) CronJobs() *Repository[*CronJob] {
+	return &Repository[*CronJob]{store: s, bucket: bucketCronJobs, new: func() *CronJob { return &CronJob{} }}
+}
+
+// FPMPools returns the PHP-FPM pool repository
+func (s *Store) FPMPools() *Repository[*FPMPool] {
+	return &Repository[*FPMPool]{store: s, bucket: bucketFPMPools, new: func() *FPMPool { return &FPMPool{} }}
+}
+
+// Certificates returns the certificate repository
+func (s *Store) Certificates() *Repository[*Certificate] {
+	return &Repository[*Certificate]{store: s, bucket: bucketCertificates, new: func() *Certificate { return &Certificate{} }}
+}
+
+// ManagedFiles returns the managed file repository
+func (s *Store) ManagedFiles() *Repository[*ManagedFile] {
+	return &Repository[*ManagedFile]{store: s, bucket: bucketManagedFiles, new: func() *ManagedFile { return &ManagedFile{} }}
+}
+
+// WebhookDeliveries returns the webhook delivery log
+func (s *Store) WebhookDeliveries() *Repository[*WebhookDelivery] {
+	return &Repository[*WebhookDelivery]{store: s, bucket: bucketDeliveries, new: func() *WebhookDelivery { return &WebhookDelivery{} }}
+}
+
+// Jobs returns the queued job repository
+func (s *Store) Jobs() *Repository[*Job] {
+	return &Repository[*Job]{store: s, bucket: bucketJobs, new: func() *Job { return &Job{} }}
+}
@@ -0,0 +1,277 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultPath is where the state database is kept
+const DefaultPath = "/var/lib/easygo/state.db"
+
+// lockTimeout bounds how long an operation waits for another process
+// (e.g. the web panel while the CLI runs) to release the database
+const lockTimeout = 10 * time.Second
+
+// Store is the persistent record of the resources EasyGo manages. The
+// database is opened for each operation so the CLI and the web panel can
+// share it.
+type Store struct {
+	path string
+}
+
+// Open creates the state database if needed and returns a store for it
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("create state directory: %w", err)
+	}
+
+	s := &Store{path: path}
+	err := s.update(func(tx *bolt.Tx) error {
+		for _, bucket := range buckets {
+			if _, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+				return err
+			}
+		}
+		return rekeyDomains(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// rekeyDomains moves domain records kept under their name alone, as they
+// were before domains were keyed by web server too
+func rekeyDomains(tx *bolt.Tx) error {
+	bucket := tx.Bucket([]byte(bucketDomains))
+	moved := make(map[string][]byte)
+	err := bucket.ForEach(func(k, v []byte) error {
+		domain := &Domain{}
+		if err := json.Unmarshal(v, domain); err != nil {
+			return fmt.Errorf("%s %q: %w", bucketDomains, k, err)
+		}
+		if domain.Key() != string(k) {
+			moved[string(k)] = v
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for k, v := range moved {
+		domain := &Domain{}
+		json.Unmarshal(v, domain)
+		if err := bucket.Delete([]byte(k)); err != nil {
+			return err
+		}
+		if err := bucket.Put([]byte(domain.Key()), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Path returns the location of the state database
+func (s *Store) Path() string {
+	return s.path
+}
+
+// view runs fn in a read-only transaction
+func (s *Store) view(fn func(tx *bolt.Tx) error) error {
+	db, err := bolt.Open(s.path, 0600, &bolt.Options{Timeout: lockTimeout, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("open state database: %w", err)
+	}
+	defer db.Close()
+	return db.View(fn)
+}
+
+// update runs fn in a read-write transaction
+func (s *Store) update(fn func(tx *bolt.Tx) error) error {
+	db, err := bolt.Open(s.path, 0600, &bolt.Options{Timeout: lockTimeout})
+	if err != nil {
+		return fmt.Errorf("open state database: %w", err)
+	}
+	defer db.Close()
+	return db.Update(fn)
+}
+
+// Record is an entity kept in the store
+type Record interface {
+	Key() string
+	Metadata() *Meta
+}
+
+// Meta records who created a resource, when, and with what parameters
+type Meta struct {
+	Owner     string            `json:"owner,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Params    map[string]string `json:"params,omitempty"`
+}
+
+// Metadata returns the record's metadata
+func (m *Meta) Metadata() *Meta {
+	return m
+}
+
+// identified is implemented by records whose key is assigned by the store
+type identified interface {
+	SetID(id string)
+}
+
+// Repository stores records of one type
+type Repository[T Record] struct {
+	store  *Store
+	bucket string
+	new    func() T
+}
+
+// Get returns the record with the given key. A missing record is reported
+// with an error matching fs.ErrNotExist.
+func (r *Repository[T]) Get(key string) (T, error) {
+	record := r.new()
+	err := r.store.view(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(r.bucket)).Get([]byte(key))
+		if data == nil {
+			return fmt.Errorf("%s %q: %w", r.bucket, key, fs.ErrNotExist)
+		}
+		return json.Unmarshal(data, record)
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return record, nil
+}
+
+// Put creates or updates a record. Creation time is kept across updates;
+// records without a key get the next sequence number as their ID.
+func (r *Repository[T]) Put(record T) error {
+	return r.store.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(r.bucket))
+		if record.Key() == "" {
+			withID, ok := any(record).(identified)
+			if !ok {
+				return fmt.Errorf("%s record has no key", r.bucket)
+			}
+			seq, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			withID.SetID(strconv.FormatUint(seq, 10))
+		}
+
+		now := time.Now()
+		meta := record.Metadata()
+		meta.UpdatedAt = now
+		if meta.CreatedAt.IsZero() {
+			meta.CreatedAt = now
+			if data := bucket.Get([]byte(record.Key())); data != nil {
+				existing := r.new()
+				if err := json.Unmarshal(data, existing); err == nil {
+					meta.CreatedAt = existing.Metadata().CreatedAt
+				}
+			}
+		}
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(record.Key()), data)
+	})
+}
+
+// Update changes a record in a single transaction, so no other process
+// changes it in between. When change returns an error the record is left
+// as it was and the error is returned.
+func (r *Repository[T]) Update(key string, change func(record T) error) (T, error) {
+	record := r.new()
+	err := r.store.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(r.bucket))
+		data := bucket.Get([]byte(key))
+		if data == nil {
+			return fmt.Errorf("%s %q: %w", r.bucket, key, fs.ErrNotExist)
+		}
+		if err := json.Unmarshal(data, record); err != nil {
+			return err
+		}
+		if err := change(record); err != nil {
+			return err
+		}
+
+		record.Metadata().UpdatedAt = time.Now()
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), data)
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return record, nil
+}
+
+// Delete removes a record. Deleting a missing record is not an error.
+func (r *Repository[T]) Delete(key string) error {
+	return r.store.update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(r.bucket)).Delete([]byte(key))
+	})
+}
+
+// List returns all records ordered by key
+func (r *Repository[T]) List() ([]T, error) {
+	var records []T
+	err := r.store.view(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(r.bucket)).ForEach(func(k, v []byte) error {
+			record := r.new()
+			if err := json.Unmarshal(v, record); err != nil {
+				return fmt.Errorf("%s %q: %w", r.bucket, k, err)
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Numeric IDs sort as numbers
+	sort.SliceStable(records, func(i, j int) bool {
+		a, errA := strconv.Atoi(records[i].Key())
+		b, errB := strconv.Atoi(records[j].Key())
+		if errA == nil && errB == nil {
+			return a < b
+		}
+		return records[i].Key() < records[j].Key()
+	})
+	return records, nil
+}
+
+// Find returns the records that match a predicate
+func (r *Repository[T]) Find(match func(T) bool) ([]T, error) {
+	records, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []T
+	for _, record := range records {
+		if match(record) {
+			found = append(found, record)
+		}
+	}
+	return found, nil
+}